@@ -0,0 +1,37 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// 追加接收（receive --append）：打开保存路径时不截断，本次接收的数据追加到已有内容之后，
+// 多次接收到同一个文件即可拼接分段发送的文件或日志。发送端的校验和按本次发送的内容计算，
+// 接收端也只校验本次追加的部分；校验失败、超过大小限制或取消下载时把文件截断回追加前的长度，不删除已有内容。
+
+// appendStartSize 追加前保存路径已有的字节数（文件不存在时为0）
+func appendStartSize(path string) int64 {
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0
+	}
+	return info.Size()
+}
+
+// discardReceived 丢弃接收失败的数据：删除文件，追加模式下截断回追加前的长度base（保留原有内容），
+// 返回用于提示的处理结果
+func discardReceived(path string, appendMode bool, base int64) string {
+	if !appendMode {
+		removeReceived(path)
+		return "已删除"
+	}
+	if err := os.Truncate(path, base); err != nil {
+		return fmt.Sprintf("撤销本次追加的数据失败: %v", err)
+	}
+	return "已撤销本次追加的数据"
+}
+
+// printAppendResult 接收完成后显示本次追加的字节数和文件现在的大小
+func printAppendResult(base, received int64) {
+	fmt.Printf("本次追加: %d 字节（追加前 %d 字节，现共 %d 字节）\n", received, base, base+received)
+}
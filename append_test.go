@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestAppend 两次HTTP下载追加到同一个文件后内容依次拼接；校验失败时撤销本次追加的数据，保留原有内容
+func TestAppend(t *testing.T) {
+	parts := map[string]string{"/part1": "first part\n", "/part2": "second part\n", "/bad": "corrupted\n"}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		content := parts[r.URL.Path]
+		sum := sha256.Sum256([]byte(content))
+		if r.URL.Path == "/bad" {
+			sum = sha256.Sum256([]byte("other content"))
+		}
+		w.Header().Set(checksumHeader, hex.EncodeToString(sum[:]))
+		io.WriteString(w, content)
+	}))
+	defer server.Close()
+
+	savePath := filepath.Join(t.TempDir(), "joined.log")
+	download := func(path string) error {
+		receiver := NewHTTPReceiver(server.URL+path, savePath)
+		receiver.appendMode = true
+		_, err := receiver.Start(context.Background())
+		return err
+	}
+	for _, path := range []string{"/part1", "/part2"} {
+		if err := download(path); err != nil {
+			t.Fatalf("追加下载 %s: %v", path, err)
+		}
+	}
+	want := parts["/part1"] + parts["/part2"]
+	if got, _ := os.ReadFile(savePath); string(got) != want {
+		t.Fatalf("追加后的内容为 %q，期望 %q", got, want)
+	}
+	if err := download("/bad"); err == nil {
+		t.Fatal("校验和不一致的追加下载没有报错")
+	}
+	if got, _ := os.ReadFile(savePath); string(got) != want {
+		t.Fatalf("校验失败后文件内容为 %q，期望保留 %q", got, want)
+	}
+}
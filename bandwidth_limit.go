@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// 发送限速（send --limit）：在共享的办公网络上限制上传速度。一个发送命令只有一个令牌桶，WebRTC和直接TCP模式在发送每个数据块前、
+// HTTP模式在向下载连接写入数据前取令牌，同时进行的多个HTTP下载（以及混合模式下的HTTP下载和WebRTC传输）共享同一个限制，
+// 限制的是合计速度而不是每个连接的速度。进度和速度按实际发送的字节计算，因此显示的就是限速后的速度。
+
+// bandwidthLimitPiece HTTP响应每次取令牌和写入的最大字节数（限速较低时也能平滑发送）
+const bandwidthLimitPiece = 16 * 1024
+
+// bandwidthLimiter 令牌桶：按rate字节/秒补充令牌，最多积累一个数据块的令牌；
+// 令牌不足时先扣除（欠下的令牌由之后补充的抵消）再等待，多个连接同时取令牌时按先后顺序排队
+type bandwidthLimiter struct {
+	rate   int64 // 字节/秒
+	burst  float64
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+// newBandwidthLimiter 创建限速器；rate<=0时返回nil（不限速）
+func newBandwidthLimiter(rate int64) *bandwidthLimiter {
+	if rate <= 0 {
+		return nil
+	}
+	burst := float64(defaultChunkSize)
+	return &bandwidthLimiter{rate: rate, burst: burst, tokens: burst, last: time.Now()}
+}
+
+// Wait 取n个令牌，令牌不足时等待（nil时不限速）
+func (l *bandwidthLimiter) Wait(n int) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	now := time.Now()
+	l.tokens += now.Sub(l.last).Seconds() * float64(l.rate)
+	if l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+	l.last = now
+	l.tokens -= float64(n)
+	wait := time.Duration(-l.tokens / float64(l.rate) * float64(time.Second))
+	l.mu.Unlock()
+	if wait > 0 {
+		time.Sleep(wait)
+	}
+}
+
+// describe 打印限速（nil时什么也不做）
+func (l *bandwidthLimiter) describe() {
+	if l == nil {
+		return
+	}
+	fmt.Printf("限速: %s/s（所有连接合计，--limit）\n", formatByteSize(l.rate))
+}
+
+// limitedResponseWriter 按限速写入的http.ResponseWriter（保留Flush，跟随模式需要）
+type limitedResponseWriter struct {
+	http.ResponseWriter
+	limiter *bandwidthLimiter
+}
+
+func (w *limitedResponseWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		n := len(p)
+		if n > bandwidthLimitPiece {
+			n = bandwidthLimitPiece
+		}
+		w.limiter.Wait(n)
+		m, err := w.ResponseWriter.Write(p[:n])
+		written += m
+		if err != nil {
+			return written, err
+		}
+		p = p[n:]
+	}
+	return written, nil
+}
+
+func (w *limitedResponseWriter) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// withBandwidthLimit 所有响应按limiter限速（limiter为nil时原样返回next）
+func withBandwidthLimit(limiter *bandwidthLimiter, next http.Handler) http.Handler {
+	if limiter == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(&limitedResponseWriter{ResponseWriter: w, limiter: limiter}, r)
+	})
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestBandwidthLimit 发送限速：两个同时进行的HTTP下载共享同一个限制，合计速度不超过--limit，下载的内容不变
+func TestBandwidthLimit(t *testing.T) {
+	if newBandwidthLimiter(0) != nil {
+		t.Fatal("--limit 0 应不限速")
+	}
+
+	const size, rate = 256 * 1024, 1024 * 1024
+	src := filepath.Join(t.TempDir(), "source.bin")
+	if err := writeRandomFile(src, size); err != nil {
+		t.Fatal(err)
+	}
+	content, err := os.ReadFile(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mux := http.NewServeMux()
+	registerFileHandlers(mux, []string{src}, nil, nil)
+	server := httptest.NewServer(withBandwidthLimit(newBandwidthLimiter(rate), mux))
+	defer server.Close()
+
+	start := time.Now()
+	errs := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			resp, err := http.Get(server.URL + "/download")
+			if err != nil {
+				errs <- err
+				return
+			}
+			defer resp.Body.Close()
+			body, err := io.ReadAll(resp.Body)
+			if err == nil && !bytes.Equal(body, content) {
+				err = errors.New("限速下载的内容与文件不一致")
+			}
+			errs <- err
+		}()
+	}
+	for i := 0; i < 2; i++ {
+		if err := <-errs; err != nil {
+			t.Fatalf("限速下载: %v", err)
+		}
+	}
+	// 合计512KB，1MB/s的限速（减去初始的一个数据块）至少需要约0.47秒
+	elapsed := time.Since(start)
+	if minimum := time.Duration(float64(2*size-defaultChunkSize) / rate * float64(time.Second) * 0.9); elapsed < minimum {
+		t.Fatalf("两个下载合计 %d 字节只用了 %v，超过了限速 %s/s", 2*size, elapsed, formatByteSize(rate))
+	}
+	if elapsed > 3*time.Second {
+		t.Fatalf("两个下载合计 %d 字节用了 %v，远低于限速 %s/s", 2*size, elapsed, formatByteSize(rate))
+	}
+}
@@ -0,0 +1,495 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pion/webrtc/v3"
+)
+
+// 广播模式（send --broadcast N）：一个发送端同时把同一文件发送给最多N个接收端
+// 在信令服务器上创建广播房间，每个接收端加入后单独建立一个PeerConnection和DataChannel，
+// offer/answer按接收端ID（PeerID）定向转发。接收端与点对点模式相同地加入房间，不需要额外参数。
+
+const (
+	broadcastConnectTimeout = 60 * time.Second // 发送Offer后等待Answer和DataChannel打开的时间
+	broadcastIdleTimeout    = 5 * time.Minute  // 没有进行中的接收端时等待新接收端加入的时间
+)
+
+// 广播接收端的状态（broadcastPeer.state）
+const (
+	broadcastConnecting int32 = iota
+	broadcastSending
+	broadcastDone
+	broadcastFailed
+)
+
+// broadcastPeer 广播模式中的一个接收端
+type broadcastPeer struct {
+	index      int           // 加入顺序（从1开始，用于显示）
+	id         string        // 信令服务器分配的接收端ID
+	answers    chan string   // 接收端的Answer（base64）
+	left       chan struct{} // 接收端离开房间时关闭
+	leftOnce   sync.Once
+	replies    chan ControlMessage // 接收端对元数据的确认回复（见handshake.go）
+	confirming int32               // 等待接收端用户确认接收（原子访问）
+	sent       int64               // 已交给DataChannel的字节数（原子访问）
+	state      int32               // broadcastConnecting等（原子访问）
+	err        error               // 接收失败的原因（仅startBroadcast所在goroutine访问）
+}
+
+// leave 标记接收端已离开房间
+func (p *broadcastPeer) leave() {
+	p.leftOnce.Do(func() { close(p.left) })
+}
+
+// broadcastResult 一个接收端的传输结果
+type broadcastResult struct {
+	peer *broadcastPeer
+	err  error
+}
+
+// startBroadcast 广播模式发送：创建广播房间，同时发送给最多s.broadcast个接收端，全部结束后返回
+func (s *WebRTCSender) startBroadcast() error {
+	fileName, fileSize, err := s.sourceInfo()
+	if err != nil {
+		return err
+	}
+
+	if s.fileID == "" {
+		s.fileID = generateUniqueFileID()
+		defer releaseFileID(s.fileID)
+	}
+
+	fmt.Println("=== WebRTC 广播 - 发送端 ===")
+	fmt.Printf("文件: %s\n", fileName)
+	fmt.Printf("大小: %d 字节 (%.2f MB)\n", fileSize, float64(fileSize)/1024/1024)
+
+	iceServers := getDefaultICEServers(s.stunServer, s.turnServer, s.debug)
+
+	signalingURL := s.signalingURL
+	if signalingURL == "" {
+		signalingURL = getDefaultSignalingURL()
+		fmt.Printf("使用默认信令服务器: %s\n", signalingURL)
+	}
+
+	client, err := NewSignalingClient(signalingURL)
+	if err != nil {
+		return fmt.Errorf("连接信令服务器失败: %w", err)
+	}
+	defer client.Close()
+	s.onCancel(client.Close)
+
+	roomID := s.roomID
+	if roomID == "" {
+		roomID = s.fileID
+	}
+	client.Send(&Message{
+		Type:      "create_room",
+		RoomID:    roomID,
+		Broadcast: true,
+	})
+	msg, err := client.Receive(5 * time.Second)
+	if err != nil {
+		return fmt.Errorf("等待房间创建失败: %w", err)
+	}
+	if msg.Type == "error" {
+		return fmt.Errorf("创建房间失败: %s", msg.Error)
+	}
+	if msg.Type != "room_created" {
+		return fmt.Errorf("意外的消息类型: %s", msg.Type)
+	}
+	if !msg.Broadcast {
+		return fmt.Errorf("信令服务器不支持广播房间（请更新信令服务器），可以不加 --broadcast 逐个发送")
+	}
+
+	fmt.Printf("广播房间已创建: %s\n", roomID)
+	fmt.Printf("文件编号: %s\n", s.fileID)
+	link := &MagicLink{
+		Mode:         linkModeWebRTC,
+		FileID:       s.fileID,
+		SignalingURL: signalingURL,
+		STUNServer:   s.stunServer,
+		TURNServer:   s.turnServer,
+		RoomID:       roomID,
+	}
+	fmt.Printf("分享链接: %s\n", link.String())
+	fmt.Printf("\n等待接收端加入（最多 %d 个，每个接收端执行相同的接收命令）...\n", s.broadcast)
+
+	// startBroadcast返回时关闭，结束仍在进行的接收端连接
+	done := make(chan struct{})
+	defer close(done)
+
+	peers := make(map[string]*broadcastPeer)
+	var order []*broadcastPeer
+	results := make(chan broadcastResult, s.broadcast)
+	active := 0
+	lastActivity := time.Now()
+	recv := client.recv
+
+	// 每秒显示总进度和每个接收端的进度
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	var lastTotal int64
+
+	for {
+		select {
+		case msg, ok := <-recv:
+			if !ok {
+				// 已建立的P2P连接不依赖信令服务器，继续完成；不再接受新的接收端
+				recv = nil
+				fmt.Println("\n信令服务器连接已断开，不再接受新的接收端")
+				if active == 0 {
+					return broadcastSummary(order)
+				}
+				continue
+			}
+			switch msg.Type {
+			case "peer_joined":
+				if len(order) >= s.broadcast {
+					fmt.Printf("\n已有 %d 个接收端，忽略新加入的接收端\n", s.broadcast)
+					continue
+				}
+				peer := &broadcastPeer{
+					index:   len(order) + 1,
+					id:      msg.PeerID,
+					answers: make(chan string, 1),
+					replies: make(chan ControlMessage, 4),
+					left:    make(chan struct{}),
+				}
+				peers[peer.id] = peer
+				order = append(order, peer)
+				active++
+				lastActivity = time.Now()
+				fmt.Printf("\n接收端 #%d 已加入，发送Offer...\n", peer.index)
+				go func() {
+					err := s.sendToBroadcastPeer(client, roomID, iceServers, peer, fileName, fileSize, done)
+					results <- broadcastResult{peer: peer, err: err}
+				}()
+			case "answer":
+				if peer := peers[msg.PeerID]; peer != nil {
+					select {
+					case peer.answers <- msg.SDP:
+					default:
+					}
+				}
+			case "peer_left":
+				if peer := peers[msg.PeerID]; peer != nil {
+					peer.leave()
+				}
+			case "error":
+				return fmt.Errorf("信令服务器错误: %s", msg.Error)
+			case "server_shutdown":
+				recv = nil
+				fmt.Println("\n信令服务器已关闭，不再接受新的接收端")
+				if active == 0 {
+					return broadcastSummary(order)
+				}
+			}
+		case result := <-results:
+			active--
+			lastActivity = time.Now()
+			if result.err != nil {
+				result.peer.err = result.err
+				atomic.StoreInt32(&result.peer.state, broadcastFailed)
+				fmt.Printf("\n接收端 #%d 接收失败: %v\n", result.peer.index, result.err)
+			} else {
+				atomic.StoreInt32(&result.peer.state, broadcastDone)
+				fmt.Printf("\n接收端 #%d 已确认接收完成\n", result.peer.index)
+			}
+			if active == 0 && (len(order) == s.broadcast || recv == nil) {
+				err := broadcastSummary(order)
+				if err == nil {
+					client.CompleteTransfer(roomID)
+				}
+				return err
+			}
+		case <-ticker.C:
+			if active > 0 {
+				lastTotal = printBroadcastProgress(order, fileSize, lastTotal)
+			} else if time.Since(lastActivity) >= broadcastIdleTimeout {
+				if len(order) == 0 {
+					return fmt.Errorf("等待接收端加入超时（%v）", broadcastIdleTimeout)
+				}
+				fmt.Printf("\n%v 内没有新的接收端加入，结束广播\n", broadcastIdleTimeout)
+				return broadcastSummary(order)
+			}
+		case <-s.cancelDone():
+			return errTransferCanceled
+		}
+	}
+}
+
+// sendToBroadcastPeer 与一个接收端建立PeerConnection并发送文件，接收端确认接收完成后返回nil
+func (s *WebRTCSender) sendToBroadcastPeer(client *SignalingClient, roomID string, iceServers []webrtc.ICEServer, peer *broadcastPeer, fileName string, fileSize int64, done <-chan struct{}) error {
+	pc, err := newPeerConnection(iceServers)
+	if err != nil {
+		return err
+	}
+	defer pc.Close()
+
+	dc, err := pc.CreateDataChannel("fileTransfer", defaultDCOptions().init())
+	if err != nil {
+		return fmt.Errorf("创建DataChannel失败: %w", err)
+	}
+	opened := make(chan struct{})
+	dc.OnOpen(func() { close(opened) })
+
+	received := make(chan struct{}, 1)
+	var ackHandled int32 // 已处理接收完成确认并回复close_ok（原子访问）
+	cancelled := make(chan string, 1)
+	dc.OnMessage(func(msg webrtc.DataChannelMessage) {
+		var ctrl ControlMessage
+		if err := json.Unmarshal(msg.Data, &ctrl); err != nil {
+			return
+		}
+		deliverHandshakeReply(peer.replies, ctrl)
+		switch ctrl.Type {
+		case "file_received":
+			if atomic.LoadInt32(&ackHandled) == 1 {
+				replyCloseOK(dc)
+				return
+			}
+			select {
+			case received <- struct{}{}:
+			default:
+			}
+		case "cancel":
+			select {
+			case cancelled <- ctrl.Reason:
+			default:
+			}
+		}
+	})
+
+	iceFailed := make(chan struct{}, 1)
+	pc.OnICEConnectionStateChange(func(state webrtc.ICEConnectionState) {
+		if s.debug {
+			fmt.Printf("接收端 #%d ICE连接状态: %s\n", peer.index, state.String())
+		}
+		switch state {
+		case webrtc.ICEConnectionStateFailed, webrtc.ICEConnectionStateDisconnected, webrtc.ICEConnectionStateClosed:
+			select {
+			case iceFailed <- struct{}{}:
+			default:
+			}
+		}
+	})
+
+	offer, err := pc.CreateOffer(nil)
+	if err != nil {
+		return fmt.Errorf("创建Offer失败: %w", err)
+	}
+	gathered := webrtc.GatheringCompletePromise(pc)
+	if err := pc.SetLocalDescription(offer); err != nil {
+		return fmt.Errorf("设置LocalDescription失败: %w", err)
+	}
+	select {
+	case <-gathered:
+	case <-done:
+		return errTransferCanceled
+	case <-time.After(10 * time.Second):
+		fmt.Printf("警告: 接收端 #%d 的ICE候选者收集超时，继续使用当前SDP\n", peer.index)
+	}
+
+	offerJSON, err := json.Marshal(pc.LocalDescription())
+	if err != nil {
+		return fmt.Errorf("序列化Offer失败: %w", err)
+	}
+	client.Send(&Message{
+		Type:   "offer",
+		RoomID: roomID,
+		FileID: s.fileID,
+		SDP:    base64.StdEncoding.EncodeToString(offerJSON),
+		PeerID: peer.id,
+	})
+
+	// 等待Answer和DataChannel打开
+	timeout := time.After(broadcastConnectTimeout)
+	select {
+	case answerB64 := <-peer.answers:
+		answer, err := decodeSessionDescription(answerB64, webrtc.SDPTypeAnswer)
+		if err != nil {
+			return fmt.Errorf("解析Answer失败: %w", err)
+		}
+		if err := pc.SetRemoteDescription(answer); err != nil {
+			return fmt.Errorf("设置RemoteDescription失败: %w", err)
+		}
+	case <-peer.left:
+		return fmt.Errorf("接收端在连接建立前离开")
+	case <-done:
+		return errTransferCanceled
+	case <-timeout:
+		return fmt.Errorf("等待Answer超时")
+	}
+	select {
+	case <-opened:
+	case <-iceFailed:
+		return fmt.Errorf("ICE连接失败，无法建立P2P连接")
+	case <-peer.left:
+		return fmt.Errorf("接收端在连接建立前离开")
+	case <-done:
+		return errTransferCanceled
+	case <-timeout:
+		return fmt.Errorf("等待连接建立超时")
+	}
+
+	atomic.StoreInt32(&peer.state, broadcastSending)
+	sendErr := make(chan error, 1)
+	go func() {
+		sendErr <- s.sendBroadcastFile(newDCSender(dc, s.debug), peer, fileName, fileSize, done)
+	}()
+
+	// 无进度看门狗：以对端实际取走的字节数衡量进度，数据发送完后不再检测
+	stalled := make(chan struct{}, 1)
+	stopWatch := make(chan struct{})
+	defer close(stopWatch)
+	go watchStall(pausedWhile(func() int64 {
+		return atomic.LoadInt64(&peer.sent) - int64(dc.BufferedAmount())
+	}, func() bool {
+		return atomic.LoadInt32(&peer.confirming) == 1
+	}), s.stallTimeout, nil, stalled, stopWatch)
+
+	for {
+		select {
+		case err := <-sendErr:
+			if err != nil {
+				return fmt.Errorf("发送数据失败: %w", err)
+			}
+			sendErr = nil
+			stalled = nil
+		case <-received:
+			// 回复close_ok，等它发出后再关闭连接（见close_ack.go）
+			atomic.StoreInt32(&ackHandled, 1)
+			replyCloseOK(dc)
+			drainDataChannel(dc, time.Second)
+			return nil
+		case reason := <-cancelled:
+			return fmt.Errorf("接收端已取消传输: %s", reason)
+		case <-peer.left:
+			// 接收端确认后立即离开房间时，确认消息可能与离开通知同时到达
+			select {
+			case <-received:
+				return nil
+			default:
+			}
+			return fmt.Errorf("接收端在确认接收完成前离开")
+		case <-iceFailed:
+			return fmt.Errorf("连接已断开（已发送 %d / %d 字节）", atomic.LoadInt64(&peer.sent), fileSize)
+		case <-stalled:
+			return fmt.Errorf("传输停滞: %v 内没有数据进展", s.stallTimeout)
+		case <-done:
+			return errTransferCanceled
+		}
+	}
+}
+
+// sendBroadcastFile 向一个接收端发送元数据和文件数据（每个接收端单独打开文件）
+func (s *WebRTCSender) sendBroadcastFile(sender chunkSender, peer *broadcastPeer, fileName string, fileSize int64, done <-chan struct{}) error {
+	file, err := s.openSource()
+	if err != nil {
+		return fmt.Errorf("打开文件失败: %w", err)
+	}
+	defer file.Close()
+
+	metadata := FileMetadata{FileName: fileName, FileSize: fileSize, Handshake: true, IsArchive: s.archive != nil}
+	s.addChecksum(&metadata)
+	if err := sendMetadata(sender, metadata); err != nil {
+		return err
+	}
+	if err := waitAccept(peer.replies, &peer.confirming, done); err != nil {
+		return err
+	}
+
+	// 总发送量和第一个接收端开始接收的时间（--summary-only）
+	atomic.CompareAndSwapInt64(&s.sendStartNanos, 0, time.Now().UnixNano())
+	buffer := make([]byte, defaultChunkSize)
+	limiter := newChunkLimiter(defaultChunkSize)
+	for {
+		n, err := file.Read(buffer)
+		for offset := 0; offset < n; {
+			chunk := limiter.Next(n - offset)
+			s.limiter.Wait(chunk)
+			if sendErr := sender.Send(buffer[offset : offset+chunk]); sendErr != nil {
+				if limiter.Shrink(sendErr) {
+					continue
+				}
+				return sendErr
+			}
+			offset += chunk
+			atomic.AddInt64(&peer.sent, int64(chunk))
+			atomic.AddInt64(&s.totalSent, int64(chunk))
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("读取文件失败: %w", err)
+		}
+	}
+}
+
+// printBroadcastProgress 显示总进度、总速度和每个接收端的进度，返回当前已发送的总字节数
+func printBroadcastProgress(peers []*broadcastPeer, fileSize int64, lastTotal int64) int64 {
+	var total int64
+	parts := make([]string, 0, len(peers))
+	for _, peer := range peers {
+		sent := atomic.LoadInt64(&peer.sent)
+		total += sent
+		status := ""
+		switch atomic.LoadInt32(&peer.state) {
+		case broadcastConnecting:
+			status = "连接中"
+		case broadcastSending:
+			status = fmt.Sprintf("%.1f%%", progressPercent(sent, fileSize))
+			if atomic.LoadInt32(&peer.confirming) == 1 {
+				status = "等待确认"
+			}
+		case broadcastDone:
+			status = "完成"
+		case broadcastFailed:
+			status = "失败"
+		}
+		parts = append(parts, fmt.Sprintf("#%d %s", peer.index, status))
+	}
+	overall := progressPercent(total, fileSize*int64(len(peers)))
+	fmt.Printf("\r总进度: %.2f%% | 速度: %s/s | %s", overall, formatByteSize(total-lastTotal), strings.Join(parts, " "))
+	return total
+}
+
+// progressPercent 已发送字节数占总大小的百分比（空文件为100%）
+func progressPercent(sent, size int64) float64 {
+	if size <= 0 {
+		return 100
+	}
+	return float64(sent) / float64(size) * 100
+}
+
+// broadcastSummary 显示每个接收端的结果，有接收端失败时返回错误
+func broadcastSummary(peers []*broadcastPeer) error {
+	fmt.Println("\n" + strings.Repeat("=", 70))
+	succeeded := 0
+	for _, peer := range peers {
+		if peer.err == nil {
+			succeeded++
+			fmt.Printf("接收端 #%d: 接收完成\n", peer.index)
+		} else {
+			fmt.Printf("接收端 #%d: 接收失败（%v）\n", peer.index, peer.err)
+		}
+	}
+	fmt.Println(strings.Repeat("=", 70))
+	if len(peers) == 0 {
+		return fmt.Errorf("没有接收端加入")
+	}
+	if succeeded < len(peers) {
+		return fmt.Errorf("%d 个接收端中 %d 个接收失败", len(peers), len(peers)-succeeded)
+	}
+	fmt.Printf("全部 %d 个接收端已接收完成\n", len(peers))
+	return nil
+}
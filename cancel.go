@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// errTransferCanceled 调用Cancel后Start返回的错误（errors.Is(err, context.Canceled)成立）
+var errTransferCanceled = fmt.Errorf("传输已取消: %w", context.Canceled)
+
+// canceler 发送端和接收端共用的取消机制
+// Cancel关闭done通道并按注册的相反顺序执行清理函数（关闭连接、停止服务器等），使阻塞中的Start尽快返回
+type canceler struct {
+	mu       sync.Mutex
+	done     chan struct{}
+	canceled bool
+	cleanups []func()
+}
+
+// newCanceler 创建取消器
+func newCanceler() *canceler {
+	return &canceler{done: make(chan struct{})}
+}
+
+// Cancel 取消传输并断开连接，Start随后返回errTransferCanceled（可重复调用，也可在Start之前调用）
+func (c *canceler) Cancel() {
+	c.mu.Lock()
+	if c.canceled {
+		c.mu.Unlock()
+		return
+	}
+	c.canceled = true
+	close(c.done)
+	cleanups := c.cleanups
+	c.cleanups = nil
+	c.mu.Unlock()
+
+	for i := len(cleanups) - 1; i >= 0; i-- {
+		cleanups[i]()
+	}
+}
+
+// cancelDone 取消时关闭的通道
+func (c *canceler) cancelDone() <-chan struct{} {
+	return c.done
+}
+
+// isCanceled 是否已取消
+func (c *canceler) isCanceled() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.canceled
+}
+
+// onCancel 注册取消时执行的清理函数（已取消时立即执行）
+func (c *canceler) onCancel(f func()) {
+	c.mu.Lock()
+	if !c.canceled {
+		c.cleanups = append(c.cleanups, f)
+		c.mu.Unlock()
+		return
+	}
+	c.mu.Unlock()
+	f()
+}
+
+// cancelContext 返回取消时随之取消的context（用于HTTP请求）
+func (c *canceler) cancelContext() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	c.onCancel(cancel)
+	return ctx, cancel
+}
+
+// canceledOr 已取消时返回errTransferCanceled（连接被关闭导致的错误都归为取消），否则原样返回err
+func (c *canceler) canceledOr(err error) error {
+	if c.isCanceled() {
+		return errTransferCanceled
+	}
+	return err
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestContextCancel context取消时Start尽快返回errTransferCanceled（HTTP服务器关闭），
+// WebRTC接收端删除未完成的文件，已接收完成的文件保留
+func TestContextCancel(t *testing.T) {
+	dir := t.TempDir()
+
+	t.Run("http sender", func(t *testing.T) {
+		src := filepath.Join(dir, "source.bin")
+		if err := writeRandomFile(src, 4096); err != nil {
+			t.Fatal(err)
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+		defer cancel()
+		start := time.Now()
+		if err := NewHTTPSender(src, 0).Start(ctx); !errors.Is(err, context.Canceled) {
+			t.Fatalf("context取消后HTTP发送端返回 %v，期望取消错误", err)
+		}
+		if elapsed := time.Since(start); elapsed > 3*time.Second {
+			t.Fatalf("context取消后HTTP发送端 %v 才返回", elapsed)
+		}
+	})
+
+	// receive 接收元数据和data（文件大小为size），然后取消
+	receive := func(t *testing.T, name string, size int, data []byte) string {
+		t.Helper()
+		metadataJSON, _ := json.Marshal(FileMetadata{FileName: name, FileSize: int64(size)})
+		header := make([]byte, 4)
+		binary.BigEndian.PutUint32(header, uint32(len(metadataJSON)))
+		path := filepath.Join(dir, name)
+		receiver := NewWebRTCReceiver("", "", path, iceServerNone, iceServerNone, "", "", false)
+		for _, msg := range [][]byte{header, metadataJSON, data} {
+			if err := receiver.handleMessage(msg); err != nil {
+				t.Fatal(err)
+			}
+		}
+		receiver.Cancel()
+		receiver.closeOrDiscard()
+		return path
+	}
+
+	t.Run("partial", func(t *testing.T) {
+		if _, err := os.Stat(receive(t, "partial.bin", 4096, make([]byte, 1000))); !os.IsNotExist(err) {
+			t.Fatal("取消后没有删除未完成的文件")
+		}
+	})
+
+	t.Run("complete", func(t *testing.T) {
+		if info, err := os.Stat(receive(t, "complete.bin", 1000, make([]byte, 1000))); err != nil || info.Size() != 1000 {
+			t.Fatal("取消时删除了已接收完成的文件")
+		}
+	})
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"lukechampine.com/blake3"
+)
+
+// 校验算法（--checksum-algo），发送端选择，HTTP模式经响应头、WebRTC模式经元数据告知接收端
+const (
+	checksumSHA256 = "sha256"
+	checksumSHA512 = "sha512"
+	checksumBLAKE3 = "blake3"
+	checksumCRC32  = "crc32" // 只能发现传输中的意外损坏，不能防止有意篡改
+)
+
+// defaultChecksumAlgo 默认校验算法
+const defaultChecksumAlgo = checksumSHA256
+
+// checksumHeader HTTP模式下携带文件SHA-256的响应头（旧版接收端只识别该响应头）
+const checksumHeader = "X-Content-SHA256"
+
+// HTTP模式下携带校验和及其算法的响应头
+const (
+	checksumValueHeader = "X-Content-Checksum"
+	checksumAlgoHeader  = "X-Content-Checksum-Algo"
+)
+
+// newChecksumHash 按算法名创建hash.Hash（HTTP和WebRTC共用）
+func newChecksumHash(algo string) (hash.Hash, error) {
+	switch algo {
+	case checksumSHA256:
+		return sha256.New(), nil
+	case checksumSHA512:
+		return sha512.New(), nil
+	case checksumBLAKE3:
+		return blake3.New(32, nil), nil
+	case checksumCRC32:
+		return crc32.NewIEEE(), nil
+	}
+	return nil, fmt.Errorf("不支持的校验算法: %s（可选 sha256、sha512、blake3、crc32）", algo)
+}
+
+// parseChecksumAlgo 解析--checksum-algo（不区分大小写，空字符串表示默认算法）
+func parseChecksumAlgo(s string) (string, error) {
+	algo := strings.ToLower(strings.TrimSpace(s))
+	if algo == "" {
+		return defaultChecksumAlgo, nil
+	}
+	if _, err := newChecksumHash(algo); err != nil {
+		return "", err
+	}
+	return algo, nil
+}
+
+// checksumName 校验算法的显示名称
+func checksumName(algo string) string {
+	switch algo {
+	case checksumSHA256:
+		return "SHA-256"
+	case checksumSHA512:
+		return "SHA-512"
+	case checksumBLAKE3:
+		return "BLAKE3"
+	case checksumCRC32:
+		return "CRC32"
+	}
+	return strings.ToUpper(algo)
+}
+
+// fileChecksum 按指定算法计算文件的校验和（十六进制小写），path是目录时计算其tar打包流的校验和（见dir_archive.go）
+func fileChecksum(path, algo string) (string, error) {
+	h, err := newChecksumHash(algo)
+	if err != nil {
+		return "", err
+	}
+	var file io.ReadCloser
+	if isDirectory(path) {
+		archive, err := newDirArchive(path)
+		if err != nil {
+			return "", err
+		}
+		file = archive.Open()
+	} else if file, err = os.Open(path); err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	if _, err := io.Copy(h, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// fileSHA256 计算文件的SHA-256（十六进制小写）
+func fileSHA256(path string) (string, error) {
+	return fileChecksum(path, checksumSHA256)
+}
+
+// setChecksumHeaders 设置携带校验和的响应头（SHA-256时同时设置旧版响应头）
+func setChecksumHeaders(header http.Header, algo, sum string) {
+	header.Set(checksumValueHeader, sum)
+	header.Set(checksumAlgoHeader, algo)
+	if algo == checksumSHA256 {
+		header.Set(checksumHeader, sum)
+	}
+}
+
+// responseChecksum 从响应头读取发送端提供的校验和及其算法，没有时返回空字符串
+func responseChecksum(header http.Header) (sum, algo string) {
+	if sum := header.Get(checksumValueHeader); sum != "" {
+		algo := strings.ToLower(header.Get(checksumAlgoHeader))
+		if algo == "" {
+			algo = checksumSHA256
+		}
+		return sum, algo
+	}
+	return header.Get(checksumHeader), checksumSHA256
+}
+
+// lazyChecksum 延迟计算并缓存文件的校验和，避免每次请求都重新计算
+type lazyChecksum struct {
+	path string
+	algo string
+	once sync.Once
+	sum  string
+	err  error
+	done atomic.Bool // 已计算完成（Peek不等待计算）
+}
+
+// newLazyChecksum 创建延迟计算的校验和
+func newLazyChecksum(path, algo string) *lazyChecksum {
+	return &lazyChecksum{path: path, algo: algo}
+}
+
+// Get 获取校验和（首次调用时计算，并发调用会等待同一次计算完成）
+func (c *lazyChecksum) Get() (string, error) {
+	c.once.Do(func() {
+		c.sum, c.err = fileChecksum(c.path, c.algo)
+		c.done.Store(true)
+	})
+	return c.sum, c.err
+}
+
+// Peek 已计算出校验和时返回它，还在计算（或计算失败）时返回false，不等待计算
+func (c *lazyChecksum) Peek() (string, bool) {
+	if c == nil || !c.done.Load() || c.err != nil {
+		return "", false
+	}
+	return c.sum, true
+}
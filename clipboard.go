@@ -0,0 +1,335 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// 剪贴板传输：send-clipboard 读取本机剪贴板中的文本或图片，保存为临时文件 clipboard.txt 或 clipboard.png 后按 send 发送；
+// receive --to-clipboard 在内存中接收，完成后写入接收端的剪贴板而不是保存为文件。
+// 与桌面通知（notify.go）一样调用系统自带的工具，不依赖图形界面库：Windows PowerShell（System.Windows.Forms.Clipboard）、
+// macOS pbpaste/pbcopy 和 osascript（图片）、Linux wl-paste/wl-copy（Wayland）或 xclip（X11）。
+// 只支持UTF-8文本和PNG图片；剪贴板为空或是其他内容（如在文件管理器中复制的文件）时报错。
+
+// 剪贴板内容的类型
+const (
+	clipboardText  = "text"
+	clipboardImage = "image"
+)
+
+// clipboardMaxSize --to-clipboard 允许接收的最大大小（内容先在内存中接收）
+const clipboardMaxSize = 64 * 1024 * 1024
+
+// clipboardTimeout 调用剪贴板工具的时间上限
+const clipboardTimeout = 10 * time.Second
+
+// pngSignature PNG文件头
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+// clipboardKind 按内容判断类型：PNG文件头为图片，有效的UTF-8为文本，其他内容不支持
+func clipboardKind(data []byte) (string, error) {
+	switch {
+	case len(data) == 0:
+		return "", fmt.Errorf("内容为空")
+	case bytes.HasPrefix(data, pngSignature):
+		return clipboardImage, nil
+	case utf8.Valid(data):
+		return clipboardText, nil
+	default:
+		return "", fmt.Errorf("不支持的内容类型（只支持UTF-8文本和PNG图片）")
+	}
+}
+
+// clipboardFileName 发送时使用的文件名
+func clipboardFileName(kind string) string {
+	if kind == clipboardImage {
+		return "clipboard.png"
+	}
+	return "clipboard.txt"
+}
+
+// windowsReadClipboardScript 把剪贴板中的图片（PNG）或文本（UTF-8）写入$env:FT_CLIPBOARD_FILE，输出类型
+const windowsReadClipboardScript = `Add-Type -AssemblyName System.Windows.Forms
+Add-Type -AssemblyName System.Drawing
+if ([Windows.Forms.Clipboard]::ContainsImage()) {
+  [Windows.Forms.Clipboard]::GetImage().Save($env:FT_CLIPBOARD_FILE, [Drawing.Imaging.ImageFormat]::Png)
+  'image'
+} elseif ([Windows.Forms.Clipboard]::ContainsText()) {
+  [IO.File]::WriteAllText($env:FT_CLIPBOARD_FILE, [Windows.Forms.Clipboard]::GetText())
+  'text'
+} elseif ([Windows.Forms.Clipboard]::GetDataObject().GetFormats().Length -gt 0) {
+  'unsupported'
+} else {
+  'empty'
+}`
+
+// windowsWriteClipboardScript 把$env:FT_CLIPBOARD_FILE的内容按$env:FT_CLIPBOARD_KIND写入剪贴板
+const windowsWriteClipboardScript = `Add-Type -AssemblyName System.Windows.Forms
+Add-Type -AssemblyName System.Drawing
+if ($env:FT_CLIPBOARD_KIND -eq 'image') {
+  $img = [Drawing.Image]::FromFile($env:FT_CLIPBOARD_FILE)
+  [Windows.Forms.Clipboard]::SetImage($img)
+  $img.Dispose()
+} else {
+  [Windows.Forms.Clipboard]::SetText([IO.File]::ReadAllText($env:FT_CLIPBOARD_FILE))
+}`
+
+// macReadImageScript 剪贴板中有PNG图片时写入参数指定的文件并输出image，否则输出none
+const macReadImageScript = `on run argv
+  try
+    set png to the clipboard as «class PNGf»
+  on error
+    return "none"
+  end try
+  set f to open for access (POSIX file (item 1 of argv)) with write permission
+  set eof of f to 0
+  write png to f
+  close access f
+  return "image"
+end run`
+
+// macWriteImageScript 把参数指定的PNG文件写入剪贴板
+const macWriteImageScript = `on run argv
+  set the clipboard to (read (POSIX file (item 1 of argv)) as «class PNGf»)
+end run`
+
+// readClipboard 读取本机剪贴板中的文本或PNG图片，剪贴板为空、内容不支持或没有可用的工具时返回错误
+func readClipboard() ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), clipboardTimeout)
+	defer cancel()
+
+	var data []byte
+	var err error
+	switch runtime.GOOS {
+	case "windows":
+		data, err = readClipboardWindows(ctx)
+	case "darwin":
+		data, err = readClipboardMac(ctx)
+	default:
+		data, err = readClipboardLinux(ctx)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 {
+		return nil, fmt.Errorf("剪贴板为空")
+	}
+	if _, err := clipboardKind(data); err != nil {
+		return nil, fmt.Errorf("剪贴板: %w", err)
+	}
+	return data, nil
+}
+
+// writeClipboard 把文本或PNG图片写入本机剪贴板
+func writeClipboard(data []byte) error {
+	kind, err := clipboardKind(data)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), clipboardTimeout)
+	defer cancel()
+
+	switch runtime.GOOS {
+	case "windows":
+		return withClipboardFile(data, func(path string) error {
+			cmd := exec.CommandContext(ctx, "powershell", "-NoProfile", "-NonInteractive", "-STA", "-Command", windowsWriteClipboardScript)
+			cmd.Env = append(os.Environ(), "FT_CLIPBOARD_FILE="+path, "FT_CLIPBOARD_KIND="+kind)
+			return runClipboardTool(cmd)
+		})
+	case "darwin":
+		if kind == clipboardImage {
+			return withClipboardFile(data, func(path string) error {
+				return runClipboardTool(exec.CommandContext(ctx, "osascript", "-e", macWriteImageScript, path))
+			})
+		}
+		cmd := exec.CommandContext(ctx, "pbcopy")
+		cmd.Env = append(os.Environ(), "LANG=en_US.UTF-8")
+		cmd.Stdin = bytes.NewReader(data)
+		return runClipboardTool(cmd)
+	default:
+		name, args, err := linuxClipboardWriter(kind)
+		if err != nil {
+			return err
+		}
+		cmd := exec.CommandContext(ctx, name, args...)
+		cmd.Stdin = bytes.NewReader(data)
+		return runClipboardTool(cmd)
+	}
+}
+
+// readClipboardWindows 用PowerShell把剪贴板内容写入临时文件后读取
+func readClipboardWindows(ctx context.Context) ([]byte, error) {
+	var data []byte
+	err := withClipboardFile(nil, func(path string) error {
+		cmd := exec.CommandContext(ctx, "powershell", "-NoProfile", "-NonInteractive", "-STA", "-Command", windowsReadClipboardScript)
+		cmd.Env = append(os.Environ(), "FT_CLIPBOARD_FILE="+path)
+		out, err := cmd.Output()
+		if err != nil {
+			return fmt.Errorf("读取剪贴板失败: %w", err)
+		}
+		switch strings.TrimSpace(string(out)) {
+		case "empty":
+			return nil
+		case "unsupported":
+			return fmt.Errorf("剪贴板中没有文本或图片（不支持该内容类型）")
+		}
+		data, err = os.ReadFile(path)
+		return err
+	})
+	return data, err
+}
+
+// readClipboardMac 先尝试读取PNG图片，没有图片时用pbpaste读取文本
+func readClipboardMac(ctx context.Context) ([]byte, error) {
+	var data []byte
+	err := withClipboardFile(nil, func(path string) error {
+		out, err := exec.CommandContext(ctx, "osascript", "-e", macReadImageScript, path).Output()
+		if err != nil || strings.TrimSpace(string(out)) != clipboardImage {
+			return nil
+		}
+		data, err = os.ReadFile(path)
+		return err
+	})
+	if err != nil || len(data) > 0 {
+		return data, err
+	}
+	cmd := exec.CommandContext(ctx, "pbpaste")
+	cmd.Env = append(os.Environ(), "LANG=en_US.UTF-8")
+	if data, err = cmd.Output(); err != nil {
+		return nil, fmt.Errorf("读取剪贴板失败: %w", err)
+	}
+	return data, nil
+}
+
+// readClipboardLinux 用wl-paste（Wayland）或xclip（X11）按剪贴板提供的类型读取PNG图片或文本
+func readClipboardLinux(ctx context.Context) ([]byte, error) {
+	var list, image, text []string
+	switch {
+	case os.Getenv("WAYLAND_DISPLAY") != "" && hasCommand("wl-paste"):
+		list = []string{"wl-paste", "--list-types"}
+		image = []string{"wl-paste", "--no-newline", "--type", "image/png"}
+		text = []string{"wl-paste", "--no-newline", "--type", "text/plain;charset=utf-8"}
+	case os.Getenv("DISPLAY") != "" && hasCommand("xclip"):
+		list = []string{"xclip", "-selection", "clipboard", "-t", "TARGETS", "-o"}
+		image = []string{"xclip", "-selection", "clipboard", "-t", "image/png", "-o"}
+		text = []string{"xclip", "-selection", "clipboard", "-t", "UTF8_STRING", "-o"}
+	case os.Getenv("DISPLAY") == "" && os.Getenv("WAYLAND_DISPLAY") == "":
+		return nil, fmt.Errorf("没有图形界面，无法访问剪贴板")
+	default:
+		return nil, fmt.Errorf("没有找到剪贴板工具，请安装 wl-clipboard（Wayland）或 xclip（X11）")
+	}
+
+	// 剪贴板为空时工具以非0状态退出
+	out, err := exec.CommandContext(ctx, list[0], list[1:]...).Output()
+	if err != nil {
+		return nil, nil
+	}
+	types := strings.Fields(string(out))
+	hasType := func(names ...string) bool {
+		for _, t := range types {
+			for _, name := range names {
+				if strings.HasPrefix(t, name) {
+					return true
+				}
+			}
+		}
+		return false
+	}
+	var args []string
+	switch {
+	case hasType("image/png"):
+		args = image
+	case hasType("text/plain", "UTF8_STRING", "STRING", "TEXT"):
+		args = text
+	case len(types) == 0:
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("剪贴板中没有文本或图片（不支持该内容类型: %s）", strings.Join(types, " "))
+	}
+	data, err := exec.CommandContext(ctx, args[0], args[1:]...).Output()
+	if err != nil {
+		return nil, fmt.Errorf("读取剪贴板失败: %w", err)
+	}
+	return data, nil
+}
+
+// linuxClipboardWriter 写入剪贴板的命令（wl-copy或xclip，内容从标准输入读取）
+func linuxClipboardWriter(kind string) (string, []string, error) {
+	mime := "text/plain;charset=utf-8"
+	if kind == clipboardImage {
+		mime = "image/png"
+	}
+	switch {
+	case os.Getenv("WAYLAND_DISPLAY") != "" && hasCommand("wl-copy"):
+		return "wl-copy", []string{"--type", mime}, nil
+	case os.Getenv("DISPLAY") != "" && hasCommand("xclip"):
+		if kind == clipboardText {
+			mime = "UTF8_STRING"
+		}
+		return "xclip", []string{"-selection", "clipboard", "-t", mime, "-i"}, nil
+	case os.Getenv("DISPLAY") == "" && os.Getenv("WAYLAND_DISPLAY") == "":
+		return "", nil, fmt.Errorf("没有图形界面，无法访问剪贴板")
+	default:
+		return "", nil, fmt.Errorf("没有找到剪贴板工具，请安装 wl-clipboard（Wayland）或 xclip（X11）")
+	}
+}
+
+// hasCommand 系统中是否有该命令
+func hasCommand(name string) bool {
+	_, err := exec.LookPath(name)
+	return err == nil
+}
+
+// runClipboardTool 运行剪贴板工具，失败时附带工具的错误输出。
+// 不捕获标准输出：wl-copy和xclip会留下后台进程继续提供剪贴板内容，捕获输出时需要等待它退出
+func runClipboardTool(cmd *exec.Cmd) error {
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return fmt.Errorf("写入剪贴板失败: %v（%s）", err, msg)
+		}
+		return fmt.Errorf("写入剪贴板失败: %w", err)
+	}
+	return nil
+}
+
+// withClipboardFile 创建临时文件（写入data）供剪贴板工具读写，fn返回后删除
+func withClipboardFile(data []byte, fn func(path string) error) error {
+	dir, err := os.MkdirTemp("", "ftf-clipboard-")
+	if err != nil {
+		return fmt.Errorf("创建临时文件失败: %w", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "clipboard")
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return fmt.Errorf("创建临时文件失败: %w", err)
+	}
+	return fn(path)
+}
+
+// saveClipboardFile 把剪贴板内容保存为临时目录中的 clipboard.txt 或 clipboard.png，返回文件路径
+func saveClipboardFile(data []byte) (string, error) {
+	kind, err := clipboardKind(data)
+	if err != nil {
+		return "", err
+	}
+	dir, err := os.MkdirTemp("", "ftf-clipboard-")
+	if err != nil {
+		return "", fmt.Errorf("创建临时文件失败: %w", err)
+	}
+	path := filepath.Join(dir, clipboardFileName(kind))
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		os.RemoveAll(dir)
+		return "", fmt.Errorf("创建临时文件失败: %w", err)
+	}
+	return path, nil
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestClipboardContent 剪贴板内容按PNG文件头和UTF-8识别为图片或文本并得到对应的文件名，空内容和其他二进制内容被拒绝
+// （不访问真实的剪贴板：测试环境通常没有图形界面）
+func TestClipboardContent(t *testing.T) {
+	for _, c := range []struct {
+		desc string
+		data []byte
+		name string // 期望的文件名，空表示应被拒绝
+	}{
+		{"text", []byte("你好, clipboard\n"), "clipboard.txt"},
+		{"png", append(append([]byte(nil), pngSignature...), 0, 0, 0, 13), "clipboard.png"},
+		{"empty", nil, ""},
+		{"binary", []byte{0xff, 0xfe, 0x00, 0x80}, ""},
+	} {
+		t.Run(c.desc, func(t *testing.T) {
+			path, err := saveClipboardFile(c.data)
+			if err == nil {
+				defer os.RemoveAll(filepath.Dir(path))
+			}
+			if c.name == "" {
+				if err == nil {
+					t.Fatalf("剪贴板内容 %q 应被拒绝", c.data)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			saved, _ := os.ReadFile(path)
+			if filepath.Base(path) != c.name || !bytes.Equal(saved, c.data) {
+				t.Fatalf("剪贴板内容 %q 保存为 %s，期望 %s", c.data, filepath.Base(path), c.name)
+			}
+		})
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/pion/webrtc/v3"
+)
+
+// 接收完成确认握手（WebRTC）：接收端发送file_received后等待发送端回复close_ok再结束（随后关闭连接），
+// 没有收到回复时每隔receivedAckInterval重发确认，最多receivedAckAttempts次；发送端处理完确认（记录传输成功）后
+// 回复close_ok，等回复发出后才关闭连接，之后收到重发的确认同样回复。接收端结束时关闭PeerConnection会丢弃尚未发出的确认，握手保证发送端可靠地得知接收完成。
+// 旧版发送端不回复close_ok，接收端重发完后照常结束；发送端已关闭DataChannel同样说明它已收到确认（或已放弃等待）。
+
+// 接收完成确认的重发次数和间隔
+const (
+	receivedAckAttempts = 3
+	receivedAckInterval = time.Second
+)
+
+// isCloseOK 是否是发送端的close_ok消息
+func isCloseOK(data []byte) bool {
+	var ctrl ControlMessage
+	return json.Unmarshal(data, &ctrl) == nil && ctrl.Type == "close_ok"
+}
+
+// awaitCloseOK 调用send发送接收完成确认并等待close_ok，interval内没有回复时重发，最多attempts次；
+// 收到closeOK（close_ok或DataChannel已关闭）时返回true，发送失败或重发完仍没有回复时返回false
+func awaitCloseOK(send func() error, closeOK <-chan struct{}, attempts int, interval time.Duration) bool {
+	for i := 0; i < attempts; i++ {
+		if err := send(); err != nil {
+			fmt.Printf("发送确认消息失败: %v\n", err)
+			return false
+		}
+		select {
+		case <-closeOK:
+			return true
+		case <-time.After(interval):
+		}
+	}
+	return false
+}
+
+// confirmReceived 接收完成后与发送端完成确认握手，然后让Start返回nil。
+// 在DataChannel的消息回调之外执行，close_ok才能在等待期间被处理
+func (r *WebRTCReceiver) confirmReceived() {
+	defer r.finish(nil)
+	dc := r.dc
+	if dc.ReadyState() != webrtc.DataChannelStateOpen {
+		return
+	}
+	ackJSON, _ := json.Marshal(ControlMessage{Type: "file_received"})
+	if awaitCloseOK(func() error { return dc.Send(ackJSON) }, r.closeOK, receivedAckAttempts, receivedAckInterval) {
+		fmt.Println("发送端已确认接收完成，可以关闭窗口了（按Ctrl+C退出）")
+		return
+	}
+	fmt.Println("已发送接收完成确认给发送端（发送端没有回复），可以关闭窗口了（按Ctrl+C退出）")
+}
+
+// signalCloseOK 通知confirmReceived发送端已回复close_ok或已关闭连接
+func (r *WebRTCReceiver) signalCloseOK() {
+	select {
+	case r.closeOK <- struct{}{}:
+	default:
+	}
+}
+
+// replyCloseOK 发送端回复close_ok（DataChannel未打开时什么也不做）
+func replyCloseOK(dc *webrtc.DataChannel) {
+	if dc.ReadyState() != webrtc.DataChannelStateOpen {
+		return
+	}
+	okJSON, _ := json.Marshal(ControlMessage{Type: "close_ok"})
+	dc.Send(okJSON)
+}
+
+// drainDataChannel 等待dc中缓冲的消息发出（最多timeout），之后关闭连接不会丢弃它们
+func drainDataChannel(dc *webrtc.DataChannel, timeout time.Duration) {
+	deadline := time.Now().Add(timeout)
+	for dc.BufferedAmount() > 0 && time.Now().Before(deadline) {
+		time.Sleep(20 * time.Millisecond)
+	}
+}
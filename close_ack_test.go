@@ -0,0 +1,55 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// TestCloseHandshake 接收完成确认握手的时序：第一条确认在连接关闭前丢失时接收端重发并收到close_ok；
+// 发送端不回复（旧版）时重发完照常结束；发送端关闭连接（回复之前）时立即结束
+func TestCloseHandshake(t *testing.T) {
+	const interval = 50 * time.Millisecond
+
+	t.Run("lost ack", func(t *testing.T) {
+		closeOK := make(chan struct{}, 1)
+		sent := 0
+		lossy := func() error {
+			sent++
+			// 第一条确认丢失，第二条确认到达后发送端稍后回复
+			if sent == 2 {
+				time.AfterFunc(interval/5, func() { closeOK <- struct{}{} })
+			}
+			return nil
+		}
+		if !awaitCloseOK(lossy, closeOK, receivedAckAttempts, interval) || sent != 2 {
+			t.Fatalf("第一条确认丢失时没有重发并收到close_ok（发送了 %d 次）", sent)
+		}
+	})
+
+	t.Run("no reply", func(t *testing.T) {
+		sent := 0
+		start := time.Now()
+		if awaitCloseOK(func() error { sent++; return nil }, make(chan struct{}), receivedAckAttempts, interval) || sent != receivedAckAttempts {
+			t.Fatalf("发送端不回复时应重发 %d 次后结束，发送了 %d 次", receivedAckAttempts, sent)
+		}
+		if elapsed := time.Since(start); elapsed > interval*time.Duration(receivedAckAttempts+2) {
+			t.Fatalf("发送端不回复时等待了 %v", elapsed)
+		}
+	})
+
+	t.Run("closed", func(t *testing.T) {
+		closed := make(chan struct{})
+		close(closed)
+		sent := 0
+		if !awaitCloseOK(func() error { sent++; return nil }, closed, receivedAckAttempts, time.Minute) || sent != 1 {
+			t.Fatalf("发送端已关闭连接时没有立即结束（发送了 %d 次）", sent)
+		}
+	})
+
+	t.Run("send error", func(t *testing.T) {
+		if awaitCloseOK(func() error { return errors.New("DataChannel已关闭") }, make(chan struct{}), receivedAckAttempts, time.Minute) {
+			t.Fatal("发送确认失败时报告了已确认")
+		}
+	})
+}
@@ -1,26 +1,92 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"log"
-)
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
 
-// 需要导入signaling_server.go中的类型和函数
-// 由于它们在同一个包中，可以直接使用
+	"filetransfer_pc/signaling"
+)
 
 func main() {
 	port := flag.Int("port", 37851, "信令服务器端口")
+	allowedOrigins := flag.String("allowed-origins", "*", "允许连接的浏览器来源，逗号分隔（如 https://a.com,https://b.com），*表示允许所有来源")
+	relayMaxMB := flag.Int("relay-max-mb", signaling.DefaultRelayMaxBytes/1024/1024, "每个房间允许经服务器中转的最大数据量（MB，客户端 --relay-via-signaling），0表示禁止中转")
+	roomTTL := flag.Duration("room-ttl", signaling.DefaultRoomTTL, "房间创建后超过该时间仍没有接收端加入时过期，0表示不过期")
+	redisAddr := flag.String("redis", "", "Redis地址（如 redis://:密码@host:6379/0），设置后房间保存在Redis中，负载均衡后的多个实例共享房间；默认保存在内存中（单实例）")
+	sendBuffer := flag.Int("send-buffer", signaling.DefaultSendBufferSize, "每个客户端的发送队列长度（条消息），客户端读取太慢导致队列满时断开该客户端")
+	readBuffer := flag.Int("read-buffer", signaling.DefaultReadBufferSize, "每个WebSocket连接的读缓冲区大小（字节），不限制消息大小")
+	writeBuffer := flag.Int("write-buffer", signaling.DefaultWriteBufferSize, "每个WebSocket连接的写缓冲区大小（字节），不限制消息大小")
+	compression := flag.Bool("compression", true, "与支持的客户端协商permessage-deflate压缩（只压缩1KB以上的消息，如SDP），-compression=false关闭以节省CPU")
 	flag.Parse()
+	// 日志时间精确到微秒，便于对比发送端、接收端的操作顺序
+	log.SetFlags(log.LstdFlags | log.Lmicroseconds)
 
 	fmt.Println("=== WebRTC 信令服务器 ===")
 	fmt.Printf("端口: %d\n", *port)
 	fmt.Printf("WebSocket端点: ws://localhost:%d/ws\n", *port)
 	fmt.Println()
 
-	server := NewSignalingServer()
+	server := signaling.NewSignalingServer()
+	server.AllowedOrigins = signaling.ParseAllowedOrigins(*allowedOrigins)
+	server.RelayMaxBytes = int64(*relayMaxMB) * 1024 * 1024
+	server.RoomTTL = *roomTTL
+	server.SendBufferSize = *sendBuffer
+	server.ReadBufferSize = *readBuffer
+	server.WriteBufferSize = *writeBuffer
+	server.EnableCompression = *compression
+	if *redisAddr != "" {
+		store, err := signaling.NewRedisRoomStore(*redisAddr)
+		if err != nil {
+			log.Fatalf("%v", err)
+		}
+		defer store.Close()
+		server.Store = store
+		fmt.Println("房间存储: Redis（多个实例共享房间）")
+	}
+	if server.RoomTTL > 0 {
+		fmt.Printf("房间有效期: %v（期间没有接收端加入时过期）\n", server.RoomTTL)
+	}
+	if server.RelayMaxBytes > 0 {
+		fmt.Printf("数据中转: 每个房间最多 %d MB\n", *relayMaxMB)
+	} else {
+		fmt.Println("数据中转: 已禁用")
+	}
+	allowAll := len(server.AllowedOrigins) == 0
+	for _, origin := range server.AllowedOrigins {
+		allowAll = allowAll || origin == "*"
+	}
+	if allowAll {
+		fmt.Println("注意: 允许所有来源的浏览器连接，公网部署并有浏览器客户端时建议使用 --allowed-origins 限制")
+	} else {
+		fmt.Printf("允许的来源: %s\n", strings.Join(server.AllowedOrigins, ", "))
+	}
+
+	// 收到SIGINT/SIGTERM时优雅关闭
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	shutdownDone := make(chan struct{})
+	go func() {
+		defer close(shutdownDone)
+		sig := <-sigChan
+		log.Printf("收到信号 %v，开始关闭...", sig)
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := server.Shutdown(ctx); err != nil {
+			log.Printf("关闭服务器失败: %v", err)
+		}
+	}()
+
 	if err := server.Start(*port); err != nil {
 		log.Fatalf("服务器启动失败: %v", err)
 	}
-}
 
+	// Start在Shutdown被调用后立即返回，等待客户端通知完成
+	<-shutdownDone
+}
@@ -3,22 +3,66 @@ package main
 import (
 	"crypto/rand"
 	"encoding/hex"
+	"sync"
 )
 
 // FileMetadata 文件元数据
 type FileMetadata struct {
 	FileName string `json:"fileName"`
 	FileSize int64  `json:"fileSize"`
+	// ReliableAck 发送端要求接收端定期确认已写入的字节偏移（--reliable-ack）
+	ReliableAck bool `json:"reliableAck,omitempty"`
+	// Session 可续传的传输会话ID（发送端指定了--room时设置），接收端需回复resume控制消息（见resume.go）
+	Session string `json:"session,omitempty"`
+	// Checksum 文件的校验和（十六进制），ChecksumAlgo为其算法（见checksum.go），接收端接收完成后校验
+	Checksum     string `json:"checksum,omitempty"`
+	ChecksumAlgo string `json:"checksumAlgo,omitempty"`
+	// Handshake 发送端等待接收端回复accept/rename后才发送文件数据（见handshake.go）
+	Handshake bool `json:"handshake,omitempty"`
+	// IsArchive 发送的是目录的tar打包流，FileName为目录名，接收端解压到同名子目录（见dir_archive.go）
+	IsArchive bool `json:"isArchive,omitempty"`
+	// FileIndex和FileCount 一次发送多个文件时为当前文件的序号（从1开始）和文件总数，
+	// 接收端收完一个文件后等待下一个文件的元数据，收完最后一个才确认接收完成（见multi_send.go）
+	FileIndex int `json:"fileIndex,omitempty"`
+	FileCount int `json:"fileCount,omitempty"`
+	// Compressed 文件数据按gzip压缩发送，FileSize和Checksum仍是原始数据的，接收端解压后写入（见compress.go）
+	Compressed bool `json:"compressed,omitempty"`
+	// Encryption 文件数据用--password派生的密钥按记录加密时的算法，Salt为派生密钥的盐，KeyCheck为密钥校验值（base64，见encrypt.go）
+	Encryption string `json:"encryption,omitempty"`
+	Salt       string `json:"salt,omitempty"`
+	KeyCheck   string `json:"keyCheck,omitempty"`
+}
+
+// maxMetadataLen 元数据长度上限：FileMetadata只有文件名等几个字段，超过该长度说明数据损坏或对端不是本程序的发送端，
+// 在分配缓冲区之前拒绝，防止按错误的长度分配大量内存
+const maxMetadataLen = 16 * 1024
+
+// ControlMessage DataChannel控制消息（JSON，接收端发往发送端；verify_request由发送端发出，见verify.go）
+type ControlMessage struct {
+	Type    string  `json:"type"`              // "file_received", "cancel", "ack", "seq_ack", "resume", "confirm_pending", "accept", "rename", "verify_request", "verify_result", "close_ok"
+	Reason  string  `json:"reason,omitempty"`  // 取消原因；verify_result: 不一致的原因
+	Name    string  `json:"name,omitempty"`    // rename: 接收端保存的文件名；verify_result: 接收端比对的文件路径
+	Offset  int64   `json:"offset,omitempty"`  // ack: 已连续写入文件的字节数；seq_ack: 数据流中连续收到的位置；resume: 接收端已有的字节数
+	Missing []int64 `json:"missing,omitempty"` // seq_ack: Offset之后缺失的范围（位置、长度交替）
+	Metadata *FileMetadata `json:"metadata,omitempty"` // verify_request: 待比对文件的名称、大小和校验和
+	Result   string        `json:"result,omitempty"`   // verify_result: match、differ或missing
 }
 
 // Message 信令消息类型（用于WebRTC信令）
 type Message struct {
-	Type       string `json:"type"`        // "create_room", "join_room", "offer", "answer", "error"
+	Type       string `json:"type"` // "create_room", "join_room", "offer", "answer", "request_offer", "data", "data_ack", "transfer_complete", "error"
 	RoomID     string `json:"room_id,omitempty"`
 	FileID     string `json:"file_id,omitempty"`
 	SDP        string `json:"sdp,omitempty"`
 	Error      string `json:"error,omitempty"`
 	ClientType string `json:"client_type,omitempty"`
+	// 信令服务器中转（--relay-via-signaling）
+	Data   string `json:"data,omitempty"`   // data: base64编码的数据块
+	Offset int64  `json:"offset,omitempty"` // data: 数据块在数据流中的位置；data_ack: 已写入的位置
+	Reason string `json:"reason,omitempty"` // error: 房间不存在的原因（never_existed/expired/closed，旧版信令服务器为空）
+	// 广播房间（send --broadcast，见broadcast.go）
+	Broadcast bool   `json:"broadcast,omitempty"` // create_room: 创建广播房间；room_created: 服务器支持广播房间
+	PeerID    string `json:"peer_id,omitempty"`   // peer_joined/peer_left/answer: 接收端ID；offer: 目标接收端ID
 }
 
 // generateFileID 生成随机文件ID
@@ -28,3 +72,29 @@ func generateFileID() string {
 	return hex.EncodeToString(bytes)
 }
 
+// 进程内活跃的文件ID（同一进程同时进行多个传输时避免ID冲突）
+var (
+	activeFileIDs   = make(map[string]bool)
+	activeFileIDsMu sync.Mutex
+)
+
+// generateUniqueFileID 生成进程内唯一的文件ID并登记为活跃，传输结束后需调用releaseFileID释放
+func generateUniqueFileID() string {
+	activeFileIDsMu.Lock()
+	defer activeFileIDsMu.Unlock()
+
+	for {
+		id := generateFileID()
+		if !activeFileIDs[id] {
+			activeFileIDs[id] = true
+			return id
+		}
+	}
+}
+
+// releaseFileID 释放文件ID
+func releaseFileID(id string) {
+	activeFileIDsMu.Lock()
+	defer activeFileIDsMu.Unlock()
+	delete(activeFileIDs, id)
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"sync/atomic"
+)
+
+// 压缩传输（send --compress）：WebRTC、直接TCP和中转模式下发送端把文件数据压缩为gzip流后分块发送，元数据带Compressed，
+// FileSize和校验和仍是原始文件的；接收端边接收边解压写入文件，进度和接收的字节数按解压后的数据计算，
+// 速度按网络上收到的字节数计算（两端的进度行分别标注"原始"和"网络"，加密时同样区分），
+// gzip流结束（包括末尾的CRC和长度）时才算接收完成，因此一次发送多个文件时每个文件的压缩流之间不需要额外的长度信息。
+// 适合文本、日志等容易压缩的文件；已压缩的文件（zip、视频、图片）压缩后几乎不变小，只增加CPU开销。
+// 压缩流在发送端重启之间无法对应到原始文件的位置，不支持续传；HTTP模式和广播不使用压缩。
+// 旧版接收端不认识Compressed，会把gzip流保存为文件并报告校验失败。
+
+// compressedSource 按gzip压缩的待发送数据（在后台压缩），Consumed为已压缩的原始字节数（用于按原始大小显示进度）
+type compressedSource struct {
+	r   *io.PipeReader
+	src io.ReadCloser
+	raw *countingReader
+}
+
+// countingReader 统计已读取的字节数（可在其他goroutine中读取Count）
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	atomic.AddInt64(&c.n, int64(n))
+	return n, err
+}
+
+// Count 已读取的字节数
+func (c *countingReader) Count() int64 {
+	return atomic.LoadInt64(&c.n)
+}
+
+// compressSource 返回从src读取并压缩为gzip流的Reader，关闭时停止压缩并关闭src
+func compressSource(src io.ReadCloser) *compressedSource {
+	pr, pw := io.Pipe()
+	raw := &countingReader{r: src}
+	go func() {
+		gz := gzip.NewWriter(pw)
+		_, err := io.Copy(gz, raw)
+		if err == nil {
+			err = gz.Close()
+		}
+		pw.CloseWithError(err)
+	}()
+	return &compressedSource{r: pr, src: src, raw: raw}
+}
+
+func (c *compressedSource) Read(p []byte) (int, error) {
+	return c.r.Read(p)
+}
+
+// Consumed 已读取并压缩的原始字节数
+func (c *compressedSource) Consumed() int64 {
+	return c.raw.Count()
+}
+
+func (c *compressedSource) Close() error {
+	c.r.Close()
+	return c.src.Close()
+}
+
+// gunzipTarget 接收端把写入的gzip流解压后写入file（和校验和）。
+// 与tar解压不同，Write等解压端处理完写入的数据才返回（解压端逐字节读取，不预读），
+// 因此每次写入后都能确定gzip流是否已经结束，以及写入的数据中有多少属于gzip流（之后的属于下一个文件）
+type gunzipTarget struct {
+	file     io.WriteCloser
+	out      *countingWriter // 解压后的数据写入file和校验和
+	input    chan []byte     // 交给解压端的数据（关闭表示中止）
+	need     chan struct{}   // 解压端已处理完交给它的数据，等待更多数据
+	done     chan error      // gzip流结束（nil）或解压失败
+	cur      []byte          // 解压端还没有读取的数据
+	started  bool
+	finished bool
+	err      error
+}
+
+// newGunzipTarget 创建解压目标，sum不为nil时解压后的数据同时写入sum
+func newGunzipTarget(file io.WriteCloser, sum io.Writer) *gunzipTarget {
+	w := io.Writer(file)
+	if sum != nil {
+		w = io.MultiWriter(file, sum)
+	}
+	g := &gunzipTarget{
+		file:  file,
+		out:   &countingWriter{w: w},
+		input: make(chan []byte),
+		need:  make(chan struct{}, 1),
+		done:  make(chan error, 1),
+	}
+	go g.run()
+	return g
+}
+
+// run 解压端：读取gzip流（只读取一个流，结束后不再读取）并写入out
+func (g *gunzipTarget) run() {
+	gz, err := gzip.NewReader(g)
+	if err == nil {
+		gz.Multistream(false)
+		_, err = io.Copy(g.out, gz)
+	}
+	g.done <- err
+}
+
+// Read和ReadByte 供解压端读取交给它的数据；实现io.ByteReader使gzip不预读，不会读入gzip流之后的数据
+func (g *gunzipTarget) Read(p []byte) (int, error) {
+	if !g.fill() {
+		return 0, io.ErrUnexpectedEOF
+	}
+	n := copy(p, g.cur)
+	g.cur = g.cur[n:]
+	return n, nil
+}
+
+func (g *gunzipTarget) ReadByte() (byte, error) {
+	if !g.fill() {
+		return 0, io.ErrUnexpectedEOF
+	}
+	b := g.cur[0]
+	g.cur = g.cur[1:]
+	return b, nil
+}
+
+// fill 当前数据已读完时通知写入方并等待更多数据，中止时返回false
+func (g *gunzipTarget) fill() bool {
+	for len(g.cur) == 0 {
+		if g.started {
+			g.need <- struct{}{}
+		}
+		g.started = true
+		data, ok := <-g.input
+		if !ok {
+			return false
+		}
+		g.cur = data
+	}
+	return true
+}
+
+// writeCompressed 写入gzip流的一部分，等解压端处理完后返回data中属于gzip流的字节数和解压出的字节数；
+// gzip流结束后Finished返回true，data中剩余的部分不属于本文件
+func (g *gunzipTarget) writeCompressed(data []byte) (consumed, written int, err error) {
+	if g.finished {
+		return 0, 0, g.err
+	}
+	before := g.out.Count()
+	g.input <- data
+	select {
+	case <-g.need:
+		consumed = len(data)
+	case err := <-g.done:
+		g.finished = true
+		if err != nil {
+			g.err = fmt.Errorf("解压失败: %w", err)
+		}
+		consumed = len(data) - len(g.cur)
+	}
+	return consumed, int(g.out.Count() - before), g.err
+}
+
+// Write 实现io.Writer，gzip流结束后还有数据时返回错误
+func (g *gunzipTarget) Write(p []byte) (int, error) {
+	n, _, err := g.writeCompressed(p)
+	if err == nil && n < len(p) {
+		err = fmt.Errorf("gzip流结束后还有 %d 字节数据", len(p)-n)
+	}
+	return n, err
+}
+
+// Finished gzip流是否已结束（包括末尾的校验）
+func (g *gunzipTarget) Finished() bool {
+	return g.finished
+}
+
+// Close 停止解压端并关闭file
+func (g *gunzipTarget) Close() error {
+	if !g.finished {
+		g.finished = true
+		close(g.input)
+		<-g.done
+	}
+	return g.file.Close()
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+)
+
+// TestCompress 压缩传输：发送端的gzip流明显小于容易压缩的原始文件，接收端解压后内容和校验和一致，
+// 接收的字节数按原始大小计算；多个文件的压缩流首尾相接（包括空文件）时按gzip流的结束分开
+func TestCompress(t *testing.T) {
+	dir := t.TempDir()
+	text := bytes.Repeat([]byte("2026-10-15 12:00:00 INFO transfer progress 42%\n"), 5000)
+	names := []string{"app.log", "empty.log"}
+	contents := [][]byte{text, nil}
+	var stream []byte
+	for i, name := range names {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, contents[i], 0644); err != nil {
+			t.Fatal(err)
+		}
+		sum, err := fileChecksum(path, defaultChecksumAlgo)
+		if err != nil {
+			t.Fatal(err)
+		}
+		file, err := os.Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		source := compressSource(file)
+		compressed, err := io.ReadAll(source)
+		source.Close()
+		if err != nil {
+			t.Fatalf("压缩: %v", err)
+		}
+		if len(contents[i]) > 0 && len(compressed) > len(contents[i])/10 {
+			t.Fatalf("压缩后 %d 字节，原始 %d 字节，没有明显变小", len(compressed), len(contents[i]))
+		}
+		metadataJSON, _ := json.Marshal(FileMetadata{FileName: name, FileSize: int64(len(contents[i])), Checksum: sum, ChecksumAlgo: defaultChecksumAlgo,
+			FileIndex: i + 1, FileCount: len(names), Compressed: true})
+		header := make([]byte, 4)
+		binary.BigEndian.PutUint32(header, uint32(len(metadataJSON)))
+		stream = append(stream, header...)
+		stream = append(stream, metadataJSON...)
+		stream = append(stream, compressed...)
+	}
+
+	out := filepath.Join(dir, "out") + string(filepath.Separator)
+	receiver := NewWebRTCReceiver("", "", out, iceServerNone, iceServerNone, "", "", false)
+	for len(stream) > 0 {
+		n := 333
+		if n > len(stream) {
+			n = len(stream)
+		}
+		if err := receiver.handleMessage(stream[:n]); err != nil {
+			t.Fatalf("接收压缩的文件: %v", err)
+		}
+		stream = stream[n:]
+	}
+	if atomic.LoadInt32(&receiver.finished) != 1 || atomic.LoadInt64(&receiver.totalReceived) != int64(len(text)) {
+		t.Fatalf("接收压缩的文件没有完成（按原始大小已接收 %d / %d 字节）", receiver.totalReceived, len(text))
+	}
+	for i, name := range names {
+		got, err := os.ReadFile(filepath.Join(out, name))
+		if err != nil || !bytes.Equal(got, contents[i]) {
+			t.Errorf("解压出的 %s 与源文件不一致", name)
+		}
+	}
+}
+
+// TestReceiveWireBytes 压缩或加密传输时接收端分别统计原始字节数（进度）和网络上收到的字节数（速度）
+func TestReceiveWireBytes(t *testing.T) {
+	text := bytes.Repeat([]byte("2026-10-15 12:00:00 INFO transfer progress 42%\n"), 5000)
+	for _, c := range []struct {
+		name                string
+		compress, encrypted bool
+	}{
+		{"plain", false, false},
+		{"compressed", true, false},
+		{"encrypted", false, true},
+		{"compressed and encrypted", true, true},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			data := text
+			if c.compress {
+				compressed, err := io.ReadAll(compressSource(io.NopCloser(bytes.NewReader(text))))
+				if err != nil {
+					t.Fatalf("压缩: %v", err)
+				}
+				data = compressed
+			}
+			metadata := FileMetadata{FileName: "app.log", FileSize: int64(len(text)), Compressed: c.compress}
+			receiver := NewWebRTCReceiver("", "", filepath.Join(t.TempDir(), "app.log"), iceServerNone, iceServerNone, "", "", false)
+			if c.encrypted {
+				sealer, err := newRecordSealer("secret", &metadata)
+				if err != nil {
+					t.Fatal(err)
+				}
+				var records []byte
+				for len(data) > 0 {
+					n := min(7000, len(data))
+					records = append(records, sealer.seal(data[:n])...)
+					data = data[n:]
+				}
+				data = records
+				receiver.password = "secret"
+			}
+			metadataJSON, _ := json.Marshal(metadata)
+			stream := binary.BigEndian.AppendUint32(nil, uint32(len(metadataJSON)))
+			stream = append(append(stream, metadataJSON...), data...)
+			for len(stream) > 0 {
+				n := min(333, len(stream))
+				if err := receiver.handleMessage(stream[:n]); err != nil {
+					t.Fatalf("接收: %v", err)
+				}
+				stream = stream[n:]
+			}
+			if receiver.totalReceived != int64(len(text)) || receiver.wireReceived != int64(len(data)) {
+				t.Fatalf("原始 %d 字节（期望 %d），网络 %d 字节（期望 %d）", receiver.totalReceived, len(text), receiver.wireReceived, len(data))
+			}
+			if receiver.wireDiffers() != (c.compress || c.encrypted) {
+				t.Fatal("没有按压缩或加密区分原始和网络字节数")
+			}
+			if got, _ := os.ReadFile(receiver.savePath); !bytes.Equal(got, text) {
+				t.Fatal("接收的文件与源文件不一致")
+			}
+		})
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+)
+
+// Config 用户配置文件（可选，JSON格式）
+// 位置: <用户配置目录>/ftf/config.json
+//
+//	Windows: %AppData%\ftf\config.json
+//	Linux:   ~/.config/ftf/config.json
+//	macOS:   ~/Library/Application Support/ftf/config.json
+type Config struct {
+	DownloadDir      string   `json:"download_dir,omitempty"`      // 默认保存目录
+	SignalingServers []string `json:"signaling_servers,omitempty"` // 默认信令服务器列表（按顺序尝试，后面的为备用服务器）
+}
+
+// getConfigPath 获取配置文件路径
+func getConfigPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "ftf", "config.json")
+}
+
+// loadConfig 读取配置文件，文件不存在或解析失败时返回空配置
+func loadConfig() *Config {
+	config := &Config{}
+	path := getConfigPath()
+	if path == "" {
+		return config
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return config
+	}
+	if err := json.Unmarshal(data, config); err != nil {
+		fmt.Fprintf(os.Stderr, "警告: 解析配置文件失败 %s: %v\n", path, err)
+		return &Config{}
+	}
+	return config
+}
+
+// getDefaultSaveDir 获取默认保存目录
+// 优先级（从高到低）:
+//  1. 环境变量 FT_DOWNLOAD_DIR
+//  2. 配置文件中的 download_dir
+//  3. 系统默认: Windows 为 D:\ft_download，其他系统为 ~/Downloads/ft_download
+//  4. 当前目录下的 ft_download
+func getDefaultSaveDir() string {
+	if dir := os.Getenv("FT_DOWNLOAD_DIR"); dir != "" {
+		return dir
+	}
+
+	if dir := loadConfig().DownloadDir; dir != "" {
+		return dir
+	}
+
+	if runtime.GOOS == "windows" {
+		return "D:\\ft_download"
+	}
+
+	if home, err := os.UserHomeDir(); err == nil {
+		return filepath.Join(home, "Downloads", "ft_download")
+	}
+
+	return "ft_download"
+}
+
+// ensureDefaultSaveDir 获取默认保存目录并确保其存在
+func ensureDefaultSaveDir() (string, error) {
+	dir := getDefaultSaveDir()
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", fmt.Errorf("创建默认保存目录失败 %s: %w", dir, err)
+	}
+	return dir, nil
+}
+
+// checkSaveDirWritable 在建立连接前检查保存位置是否可写（创建并删除一个临时文件）
+// savePath是已存在的目录时检查该目录；是已存在的文件时检查其所在目录；
+// 不存在时检查最近的已存在上级目录（保存路径的规则见save_path.go）
+func checkSaveDirWritable(savePath string) error {
+	dir := savePath
+	if dir == "" {
+		dir = "."
+	}
+	if info, err := os.Stat(dir); err == nil && !info.IsDir() {
+		dir = filepath.Dir(dir)
+	} else if err != nil {
+		for {
+			parent := filepath.Dir(dir)
+			if _, err := os.Stat(parent); err == nil || parent == dir {
+				dir = parent
+				break
+			}
+			dir = parent
+		}
+	}
+
+	f, err := os.CreateTemp(dir, ".ft-write-test-*")
+	if err != nil {
+		absDir, _ := filepath.Abs(dir)
+		return fmt.Errorf("保存目录不可写: %s: %w", absDir, err)
+	}
+	name := f.Name()
+	f.Close()
+	os.Remove(name)
+	return nil
+}
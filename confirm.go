@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// errTransferRejected 用户拒绝接收文件
+var errTransferRejected = errors.New("已拒绝接收文件")
+
+// isTerminal 判断标准输入是否连接到终端（非管道/重定向）
+func isTerminal() bool {
+	info, err := os.Stdin.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+// confirmReceive 显示即将接收的文件信息并等待用户确认
+// 返回最终保存路径（用户可以重命名）；用户拒绝时返回errTransferRejected
+// 标准输入不是终端时直接接受
+func confirmReceive(fileName string, fileSize int64, savePath string) (string, error) {
+	if !isTerminal() {
+		return savePath, nil
+	}
+
+	absPath, _ := filepath.Abs(savePath)
+	fmt.Println("\n" + strings.Repeat("=", 70))
+	fmt.Println("即将接收文件:")
+	fmt.Printf("文件名: %s\n", fileName)
+	if fileSize >= 0 {
+		fmt.Printf("大小: %d 字节 (%.2f MB)\n", fileSize, float64(fileSize)/1024/1024)
+	} else {
+		fmt.Println("大小: 未知")
+	}
+	fmt.Printf("保存到: %s\n", absPath)
+	fmt.Println(strings.Repeat("=", 70))
+
+	reader := bufio.NewReader(os.Stdin)
+	for {
+		fmt.Print("接受(y) / 重命名(r) / 拒绝(n)? [y/r/n]: ")
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return "", fmt.Errorf("读取输入失败: %w", err)
+		}
+
+		switch strings.ToLower(strings.TrimSpace(line)) {
+		case "", "y", "yes":
+			return savePath, nil
+		case "n", "no":
+			return "", errTransferRejected
+		case "r", "rename":
+			fmt.Print("新文件名: ")
+			name, err := reader.ReadString('\n')
+			if err != nil {
+				return "", fmt.Errorf("读取输入失败: %w", err)
+			}
+			// 只取文件名部分，不允许通过重命名写到其他目录
+			name = filepath.Base(strings.TrimSpace(name))
+			if name == "" || name == "." || name == string(filepath.Separator) {
+				fmt.Println("文件名无效，请重新选择")
+				continue
+			}
+			return filepath.Join(filepath.Dir(savePath), name), nil
+		default:
+			fmt.Println("请输入 y、r 或 n")
+		}
+	}
+}
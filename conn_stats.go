@@ -0,0 +1,199 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/pion/webrtc/v3"
+)
+
+// 连接统计（--stats-interval）：WebRTC传输期间按间隔调用pion的GetStats，在进度之外输出一行统计：
+// 选中的候选对（类型和地址）、ICE传输层收发的字节数和速率（包括DTLS/SCTP开销和重传）、往返时间、SCTP拥塞窗口；
+// 连接结束时输出汇总。经TURN中继时RTT明显高于直接连接、拥塞窗口反复缩小（丢包）而传输层速率上不去，说明瓶颈在中继或网络，
+// 反之RTT低、拥塞窗口大但速率低，说明瓶颈在对端（写磁盘或读取太慢）。
+// pion不统计DataChannel连接的丢包数，丢包只能从拥塞窗口的缩小看出。默认关闭；GetStats只读取计数器，间隔不低于1秒时开销可以忽略。
+
+// minConnStatsInterval --stats-interval的下限
+const minConnStatsInterval = time.Second
+
+// connStatsSample 一次GetStats采样
+type connStatsSample struct {
+	at            time.Time
+	pair          string  // 选中的候选对（如 "host 192.168.1.2:50000 <-> relay 1.2.3.4:3478"）
+	bytesSent     uint64  // ICE传输层累计发送的字节数
+	bytesReceived uint64  // ICE传输层累计接收的字节数
+	rtt           float64 // 往返时间（秒）：SCTP平滑RTT，还没有测量值时使用ICE连通性检查的RTT
+	cwnd          uint32  // SCTP拥塞窗口（字节），丢包时缩小
+}
+
+// sampleConnStats 读取pc的统计，连接还没有选中的候选对时返回false
+func sampleConnStats(pc *webrtc.PeerConnection) (connStatsSample, bool) {
+	pair, err := selectedCandidatePair(pc)
+	if err != nil {
+		return connStatsSample{}, false
+	}
+	sample := connStatsSample{
+		at: time.Now(),
+		pair: fmt.Sprintf("%s %s <-> %s %s",
+			pair.Local.Typ, net.JoinHostPort(pair.Local.Address, fmt.Sprint(pair.Local.Port)),
+			pair.Remote.Typ, net.JoinHostPort(pair.Remote.Address, fmt.Sprint(pair.Remote.Port))),
+	}
+
+	report := pc.GetStats()
+	var iceRTT float64
+	if stats, ok := report.GetICECandidatePairStats(pair); ok {
+		iceRTT = stats.CurrentRoundTripTime
+	}
+	for _, stats := range report {
+		switch s := stats.(type) {
+		case webrtc.TransportStats:
+			sample.bytesSent, sample.bytesReceived = s.BytesSent, s.BytesReceived
+		case webrtc.SCTPTransportStats:
+			sample.rtt, sample.cwnd = s.SmoothedRoundTripTime, s.CongestionWindow
+		}
+	}
+	if sample.rtt == 0 {
+		sample.rtt = iceRTT
+	}
+	return sample, true
+}
+
+// formatConnStats 生成一行统计，速率按上一次采样prev计算
+func formatConnStats(prev, cur connStatsSample) string {
+	span := cur.at.Sub(prev.at).Seconds()
+	sendRate, recvRate := 0.0, 0.0
+	if span > 0 {
+		sendRate = float64(cur.bytesSent-prev.bytesSent) / span
+		recvRate = float64(cur.bytesReceived-prev.bytesReceived) / span
+	}
+	return fmt.Sprintf("[连接统计] %s | RTT %.1fms | 拥塞窗口 %s | 传输层 发送 %s (%s/s) 接收 %s (%s/s)",
+		cur.pair, cur.rtt*1000, formatByteSize(int64(cur.cwnd)),
+		formatByteSize(int64(cur.bytesSent)), formatByteSize(int64(sendRate)),
+		formatByteSize(int64(cur.bytesReceived)), formatByteSize(int64(recvRate)))
+}
+
+// connStatsMonitor 定期采样一个PeerConnection的统计（为nil时不采样）
+type connStatsMonitor struct {
+	pc       *webrtc.PeerConnection
+	interval time.Duration
+	stop     chan struct{}
+	done     chan struct{}
+	stopOnce sync.Once
+	mu       sync.Mutex
+	started  bool // 已开始采样（ICE连接建立之后）
+	stopped  bool
+	first    connStatsSample // 第一次和最近一次采样
+	last     connStatsSample
+	samples  int
+	rttSum   float64
+	rttMax   float64
+	cwndMin  uint32
+}
+
+// startConnStats 准备按interval采样pc的统计，interval<=0时返回nil（不采样）。
+// 采样在ICE连接建立（Connected）后才开始：SetRemoteDescription在后台启动ICE传输，
+// 在此之前读取选中的候选对与pion设置ICE传输的字段存在数据竞争
+func startConnStats(pc *webrtc.PeerConnection, interval time.Duration) *connStatsMonitor {
+	if interval <= 0 || pc == nil {
+		return nil
+	}
+	return &connStatsMonitor{
+		pc:       pc,
+		interval: interval,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+// Connected ICE连接建立时调用（OnICEConnectionStateChange），开始采样；重复调用、Stop之后或为nil时不做任何事
+func (m *connStatsMonitor) Connected() {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !m.started && !m.stopped {
+		m.started = true
+		go m.run()
+	}
+}
+
+// run 定期采样并输出统计行
+func (m *connStatsMonitor) run() {
+	defer close(m.done)
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			sample, ok := sampleConnStats(m.pc)
+			if !ok {
+				continue
+			}
+			if m.samples > 0 {
+				fmt.Printf("\n%s\n", formatConnStats(m.last, sample))
+			}
+			m.record(sample)
+		case <-m.stop:
+			return
+		}
+	}
+}
+
+// record 记录一次采样，累计RTT和最小拥塞窗口（SCTP空闲时也会缩小拥塞窗口，只统计期间有数据发送的采样）
+func (m *connStatsMonitor) record(sample connStatsSample) {
+	sending := m.samples == 0 || sample.bytesSent > m.last.bytesSent
+	if m.samples == 0 {
+		m.first = sample
+	}
+	m.last = sample
+	m.samples++
+	m.rttSum += sample.rtt
+	if sample.rtt > m.rttMax {
+		m.rttMax = sample.rtt
+	}
+	if sending && sample.cwnd > 0 && (m.cwndMin == 0 || sample.cwnd < m.cwndMin) {
+		m.cwndMin = sample.cwnd
+	}
+}
+
+// Stop 停止采样并输出汇总（在关闭PeerConnection之前调用，可重复调用）
+func (m *connStatsMonitor) Stop() {
+	if m == nil {
+		return
+	}
+	m.stopOnce.Do(func() {
+		m.mu.Lock()
+		m.stopped = true
+		started := m.started
+		m.mu.Unlock()
+		if !started {
+			return
+		}
+		close(m.stop)
+		<-m.done
+		if sample, ok := sampleConnStats(m.pc); ok {
+			m.record(sample)
+		}
+		if line := m.summary(); line != "" {
+			fmt.Println(line)
+		}
+	})
+}
+
+// summary 生成汇总行，没有采样时为空
+func (m *connStatsMonitor) summary() string {
+	if m.samples == 0 {
+		return ""
+	}
+	span := m.last.at.Sub(m.first.at).Seconds()
+	sendRate := 0.0
+	if span > 0 {
+		sendRate = float64(m.last.bytesSent-m.first.bytesSent) / span
+	}
+	return fmt.Sprintf("[连接统计汇总] %s | 采样 %d 次 | RTT 平均 %.1fms 最大 %.1fms | 最小拥塞窗口 %s | 传输层 发送 %s 接收 %s（平均发送 %s/s）",
+		m.last.pair, m.samples, m.rttSum/float64(m.samples)*1000, m.rttMax*1000, formatByteSize(int64(m.cwndMin)),
+		formatByteSize(int64(m.last.bytesSent)), formatByteSize(int64(m.last.bytesReceived)), formatByteSize(int64(sendRate)))
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestConnStats 连接统计行按两次采样计算速率，汇总包括平均/最大RTT和最小拥塞窗口；未启用时不采样
+func TestConnStats(t *testing.T) {
+	if startConnStats(nil, time.Second) != nil || startConnStats(nil, 0) != nil {
+		t.Fatal("未启用时创建了连接统计")
+	}
+	var disabled *connStatsMonitor
+	disabled.Connected()
+	disabled.Stop()
+
+	at := time.Now()
+	pair := "host 10.0.0.1:5000 <-> relay 1.2.3.4:3478"
+	samples := []connStatsSample{
+		{at: at, pair: pair, bytesSent: 0, bytesReceived: 0, rtt: 0.010, cwnd: 64 * 1024},
+		{at: at.Add(2 * time.Second), pair: pair, bytesSent: 4 * 1024 * 1024, bytesReceived: 64 * 1024, rtt: 0.030, cwnd: 16 * 1024},
+		{at: at.Add(4 * time.Second), pair: pair, bytesSent: 8 * 1024 * 1024, bytesReceived: 128 * 1024, rtt: 0.020, cwnd: 32 * 1024},
+	}
+	line := formatConnStats(samples[0], samples[1])
+	for _, want := range []string{pair, "RTT 30.0ms", "拥塞窗口 16.00 KB", "发送 4.00 MB (2.00 MB/s)", "接收 64.00 KB (32.00 KB/s)"} {
+		if !strings.Contains(line, want) {
+			t.Errorf("统计行 %q 中没有 %q", line, want)
+		}
+	}
+
+	m := &connStatsMonitor{}
+	if m.summary() != "" {
+		t.Fatal("没有采样时输出了汇总")
+	}
+	for _, sample := range samples {
+		m.record(sample)
+	}
+	summary := m.summary()
+	for _, want := range []string{"采样 3 次", "RTT 平均 20.0ms 最大 30.0ms", "最小拥塞窗口 16.00 KB", "发送 8.00 MB 接收 128.00 KB", "平均发送 2.00 MB/s"} {
+		if !strings.Contains(summary, want) {
+			t.Errorf("汇总 %q 中没有 %q", summary, want)
+		}
+	}
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pion/webrtc/v3"
+)
+
+// DataChannel发送缓冲区水位：超过高水位时暂停发送，降到低水位后继续
+const (
+	dcBufferedAmountHigh = 4 * 1024 * 1024
+	dcBufferedAmountLow  = 1 * 1024 * 1024
+)
+
+// 发送失败重试参数
+const (
+	maxSendRetries  = 5
+	sendRetryDelay  = 100 * time.Millisecond
+	bufferWaitLimit = 30 * time.Second // 等待缓冲区下降的最长时间（由无进度看门狗负责更长的停滞）
+)
+
+// errChannelClosed DataChannel已关闭，无法继续发送
+var errChannelClosed = errors.New("DataChannel已关闭")
+
+// errSendRetriesExhausted 通道仍然打开，但重试后仍发送失败（发送文件数据时减小数据块后继续，见chunkLimiter）
+var errSendRetriesExhausted = errors.New("发送失败")
+
+// chunkSender 发送元数据和文件数据块的通道（DataChannel或信令服务器中转）
+type chunkSender interface {
+	Send(data []byte) error
+}
+
+// dcSender 带流量控制和重试的DataChannel发送器
+type dcSender struct {
+	dc        *webrtc.DataChannel
+	bufferLow chan struct{} // 缓冲区降到低水位时通知
+	debug     bool
+}
+
+// newDCSender 创建发送器并注册缓冲区低水位回调（需在开始发送前调用）
+func newDCSender(dc *webrtc.DataChannel, debug bool) *dcSender {
+	s := &dcSender{
+		dc:        dc,
+		bufferLow: make(chan struct{}, 1),
+		debug:     debug,
+	}
+	dc.SetBufferedAmountLowThreshold(dcBufferedAmountLow)
+	dc.OnBufferedAmountLow(func() {
+		select {
+		case s.bufferLow <- struct{}{}:
+		default:
+		}
+	})
+	return s
+}
+
+// Send 发送一条消息：缓冲区过满时先等待，临时错误短暂等待后重试，通道关闭等致命错误立即返回
+func (s *dcSender) Send(data []byte) error {
+	if err := s.waitBuffer(dcBufferedAmountHigh); err != nil {
+		return err
+	}
+
+	for attempt := 0; ; attempt++ {
+		err := s.dc.Send(data)
+		if err == nil {
+			return nil
+		}
+		if s.isFatal(err) {
+			return fmt.Errorf("%w: %v", errChannelClosed, err)
+		}
+		if attempt >= maxSendRetries {
+			return fmt.Errorf("%w（已重试%d次）: %v", errSendRetriesExhausted, maxSendRetries, err)
+		}
+
+		if s.debug {
+			fmt.Printf("\n发送失败，等待缓冲区释放后重试（第%d次）: %v\n", attempt+1, err)
+		}
+		// 等待缓冲区释放一部分后重试
+		time.Sleep(sendRetryDelay * time.Duration(attempt+1))
+		if err := s.waitBuffer(dcBufferedAmountLow); err != nil {
+			return err
+		}
+	}
+}
+
+// waitBuffer 等待缓冲区中未发送的数据不超过limit
+func (s *dcSender) waitBuffer(limit uint64) error {
+	deadline := time.Now().Add(bufferWaitLimit)
+	for s.dc.BufferedAmount() > limit {
+		if s.dc.ReadyState() != webrtc.DataChannelStateOpen {
+			return errChannelClosed
+		}
+		if time.Now().After(deadline) {
+			// 不视为错误，交给发送重试和无进度看门狗处理
+			return nil
+		}
+		select {
+		case <-s.bufferLow:
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+	return nil
+}
+
+// isFatal 判断发送错误是否不可恢复（通道已关闭或不再处于打开状态）
+func (s *dcSender) isFatal(err error) bool {
+	if errors.Is(err, io.ErrClosedPipe) || errors.Is(err, io.EOF) {
+		return true
+	}
+	return s.dc.ReadyState() != webrtc.DataChannelStateOpen
+}
+
+// defaultChunkSize 发送文件数据时每条消息携带的数据量
+const defaultChunkSize = 32 * 1024
+
+// minChunkSize 连续发送失败时数据块减小的下限（也是--chunk-size的下限）
+const minChunkSize = 1024
+
+// maxChunkSizeFlag --chunk-size的上限（直接TCP模式不受DataChannel消息大小限制，加密记录不超过maxRecordSize）
+const maxChunkSizeFlag = 1024 * 1024
+
+// chunkLimiter 发送文件数据时的数据块大小：有些不稳定的中继上大消息间歇性发送失败而小消息可以成功，
+// 重试后仍失败时把数据块减半（不小于minChunkSize）再发送同一位置的数据，而不是中止传输
+type chunkLimiter struct {
+	size int // 当前数据块大小
+}
+
+// newChunkLimiter 从size字节的数据块开始
+func newChunkLimiter(size int) *chunkLimiter {
+	return &chunkLimiter{size: size}
+}
+
+// Next 还剩n字节要发送时下一个数据块的大小
+func (c *chunkLimiter) Next(n int) int {
+	if n > c.size {
+		return c.size
+	}
+	return n
+}
+
+// Shrink 发送失败时调用：重试后仍失败（errSendRetriesExhausted）且未达到下限时把数据块减半并返回true，
+// 调用方重新发送同一位置的数据；通道已关闭等其他错误返回false
+func (c *chunkLimiter) Shrink(err error) bool {
+	if !errors.Is(err, errSendRetriesExhausted) || c.size <= minChunkSize {
+		return false
+	}
+	smaller := c.size / 2
+	if smaller < minChunkSize {
+		smaller = minChunkSize
+	}
+	fmt.Printf("\n%d 字节的数据块连续发送失败，减小为 %d 字节后继续: %v\n", c.size, smaller, err)
+	c.size = smaller
+	return true
+}
+
+// DataChannel消息大小相关常量
+const (
+	pionMaxMessageSize  = 65536   // pion发送单条消息的上限（pion/sctp默认值）
+	pionReadBufferSize  = 65535   // pion读取单条消息的缓冲区大小，更大的消息读取失败并关闭DataChannel（接收端是本程序时适用）
+	defaultRemoteMaxMsg = 65536   // 对端SDP未声明a=max-message-size时的默认值（RFC 8841）
+	sctpPacketOverhead  = 12 + 16 // SCTP公共头和DATA块头，每个分片的载荷为MTU减去此值
+)
+
+// dcLimits 连接建立后的DataChannel消息限制
+type dcLimits struct {
+	maxMessageSize int  // 可以发送的最大消息（对端声明值与pion上限中较小者）
+	remoteMax      int  // 对端声明的a=max-message-size（0表示不限制）
+	remoteDeclared bool // 对端SDP是否声明了a=max-message-size
+	mtu            int  // SCTP关联当前的MTU（0表示未能获取）
+}
+
+// queryDCLimits 从对端SDP和SCTP统计信息中获取消息限制（连接建立后调用）
+func queryDCLimits(pc *webrtc.PeerConnection) dcLimits {
+	limits := dcLimits{maxMessageSize: pionMaxMessageSize, remoteMax: defaultRemoteMaxMsg}
+	if desc := pc.RemoteDescription(); desc != nil {
+		if value, ok := sdpAttribute(desc.SDP, "max-message-size"); ok {
+			if n, err := strconv.Atoi(strings.TrimSpace(value)); err == nil && n >= 0 {
+				limits.remoteMax = n
+				limits.remoteDeclared = true
+			}
+		}
+	}
+	if limits.remoteMax > 0 && limits.remoteMax < limits.maxMessageSize {
+		limits.maxMessageSize = limits.remoteMax
+	}
+	for _, stats := range pc.GetStats() {
+		if sctpStats, ok := stats.(webrtc.SCTPTransportStats); ok {
+			limits.mtu = int(sctpStats.MTU)
+		}
+	}
+	return limits
+}
+
+// clampChunkSize 按协商的最大消息和pion的读取缓冲区限制数据块大小（header为每条消息附加的头部大小），返回实际使用的大小
+func clampChunkSize(chunkSize int, limits dcLimits, header int) int {
+	maxMessage := limits.maxMessageSize
+	if maxMessage > pionReadBufferSize {
+		maxMessage = pionReadBufferSize
+	}
+	if chunkSize+header > maxMessage {
+		chunkSize = maxMessage - header
+	}
+	if chunkSize < minChunkSize {
+		chunkSize = minChunkSize
+	}
+	return chunkSize
+}
+
+// printChunkAdvice 显示协商得到的消息限制，并判断数据块大小是否合适（header为每条消息附加的头部大小）
+func printChunkAdvice(limits dcLimits, chunkSize, header int) {
+	remote := "对端未声明，按默认 64KB"
+	switch {
+	case limits.remoteDeclared && limits.remoteMax == 0:
+		remote = "对端不限制"
+	case limits.remoteDeclared:
+		remote = fmt.Sprintf("对端声明 %d 字节", limits.remoteMax)
+	}
+	fmt.Printf("DataChannel最大消息: %d 字节（%s，本端上限 %d 字节）\n", limits.maxMessageSize, remote, pionMaxMessageSize)
+
+	message := chunkSize + header
+	if limits.mtu > sctpPacketOverhead {
+		payload := limits.mtu - sctpPacketOverhead
+		fmt.Printf("SCTP MTU: %d 字节，每条 %d 字节的消息分为 %d 个分片\n", limits.mtu, message, (message+payload-1)/payload)
+	}
+
+	// 建议值：最大消息的一半（按1KB取整），既远离上限又能减少消息数量
+	suggested := limits.maxMessageSize / 2 / 1024 * 1024
+	if suggested == 0 {
+		suggested = limits.maxMessageSize - header
+	}
+	switch {
+	case message > limits.maxMessageSize:
+		fmt.Printf("数据块大小 %d 字节超过最大消息，发送会失败，建议不超过 %d 字节\n", chunkSize, limits.maxMessageSize-header)
+	case message*4 < limits.maxMessageSize:
+		fmt.Printf("数据块大小 %d 字节偏小，消息数量多、开销占比高，建议 %d 字节\n", chunkSize, suggested)
+	default:
+		fmt.Printf("数据块大小 %d 字节合适\n", chunkSize)
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+)
+
+// TestChunkFallback 大于4KB的消息总是发送失败时发送端逐步减小数据块完成传输，接收的内容与校验和一致；
+// 减小到下限（1KB）仍失败或通道已关闭时返回错误
+func TestChunkFallback(t *testing.T) {
+	srcPath := filepath.Join(t.TempDir(), "flaky.bin")
+	if err := writeRandomFile(srcPath, 100*1024+123); err != nil {
+		t.Fatal(err)
+	}
+	content, err := os.ReadFile(srcPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	send := func(limit int) (*flakySender, *bytes.Buffer, error) {
+		var out bytes.Buffer
+		receiver := NewWebRTCReceiver("", "", "", iceServerNone, iceServerNone, "", "", false)
+		receiver.output = &out
+		sender := NewWebRTCSender(srcPath, iceServerNone, iceServerNone, "", "")
+		sender.relayViaSignaling = true // 不等待接收端的握手回复
+		sender.checksum = newLazyChecksum(srcPath, sender.checksumAlgo)
+		flaky := &flakySender{limit: limit, receiver: receiver}
+		err := sender.sendFile(flaky, "flaky.bin", int64(len(content)))
+		if err == nil && atomic.LoadInt32(&receiver.finished) != 1 {
+			err = errors.New("接收端没有完成接收")
+		}
+		return flaky, &out, err
+	}
+
+	t.Run("shrink", func(t *testing.T) {
+		flaky, out, err := send(4 * 1024)
+		if err != nil {
+			t.Fatalf("大消息发送失败时没有减小数据块完成传输: %v", err)
+		}
+		if !bytes.Equal(out.Bytes(), content) {
+			t.Fatalf("减小数据块后接收的内容不一致（%d / %d 字节）", out.Len(), len(content))
+		}
+		// 32KB -> 16KB -> 8KB -> 4KB，之后不再失败
+		if flaky.failures != 3 {
+			t.Fatalf("发送失败 %d 次，期望减小3次数据块后不再失败", flaky.failures)
+		}
+	})
+
+	t.Run("below minimum", func(t *testing.T) {
+		if _, _, err := send(minChunkSize / 2); !errors.Is(err, errSendRetriesExhausted) {
+			t.Fatalf("数据块减小到下限仍失败时没有返回发送错误: %v", err)
+		}
+	})
+
+	t.Run("channel closed", func(t *testing.T) {
+		if newChunkLimiter(defaultChunkSize).Shrink(errChannelClosed) {
+			t.Fatal("通道已关闭时不应减小数据块重试")
+		}
+	})
+}
+
+// flakySender 大于limit字节的消息返回重试后仍失败的错误（模拟不稳定的中继），其余消息交给接收端处理
+type flakySender struct {
+	limit    int
+	receiver *WebRTCReceiver
+	failures int
+}
+
+// Send 实现chunkSender（发送端会复用缓冲区，交给接收端前先复制）
+func (f *flakySender) Send(data []byte) error {
+	if len(data) > f.limit {
+		f.failures++
+		return fmt.Errorf("%w（已重试%d次）: 模拟的中继错误", errSendRetriesExhausted, maxSendRetries)
+	}
+	return f.receiver.handleMessage(append([]byte(nil), data...))
+}
+
+// TestChunkSize --chunk-size按对端声明的最大消息和pion的读取缓冲区限制，发送文件数据时使用限制后的大小
+func TestChunkSize(t *testing.T) {
+	for _, c := range []struct {
+		chunk, remoteMax, header, want int
+	}{
+		{defaultChunkSize, 65536, 0, defaultChunkSize},
+		{128 * 1024, 65536, 0, pionReadBufferSize},
+		{128 * 1024, 0, 0, pionReadBufferSize}, // 对端不限制时仍受pion读取缓冲区限制
+		{64 * 1024, 16 * 1024, seqHeaderSize, 16*1024 - seqHeaderSize},
+		{defaultChunkSize, 512, 0, minChunkSize},
+	} {
+		limits := dcLimits{maxMessageSize: pionMaxMessageSize, remoteMax: c.remoteMax}
+		if c.remoteMax > 0 && c.remoteMax < limits.maxMessageSize {
+			limits.maxMessageSize = c.remoteMax
+		}
+		if got := clampChunkSize(c.chunk, limits, c.header); got != c.want {
+			t.Errorf("数据块 %d 字节、对端最大消息 %d 字节时限制为 %d 字节，期望 %d", c.chunk, c.remoteMax, got, c.want)
+		}
+	}
+
+	srcPath := filepath.Join(t.TempDir(), "chunks.bin")
+	if err := writeRandomFile(srcPath, 50*1024); err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	receiver := NewWebRTCReceiver("", "", "", iceServerNone, iceServerNone, "", "", false)
+	receiver.output = &out
+	sender := NewWebRTCSender(srcPath, iceServerNone, iceServerNone, "", "")
+	sender.relayViaSignaling = true // 不等待接收端的握手回复
+	sender.chunkSize = 64 * 1024
+	sender.dcChunkSize = 16 * 1024 // 对端只接受16KB的消息
+	flaky := &flakySender{limit: 16 * 1024, receiver: receiver}
+	if err := sender.sendFile(flaky, "chunks.bin", 50*1024); err != nil || flaky.failures != 0 {
+		t.Fatalf("按限制后的数据块发送: %v（超过16KB的消息 %d 条）", err, flaky.failures)
+	}
+	if atomic.LoadInt32(&receiver.finished) != 1 || out.Len() != 50*1024 {
+		t.Fatalf("按限制后的数据块发送没有完成（已接收 %d 字节）", out.Len())
+	}
+}
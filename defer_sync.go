@@ -0,0 +1,32 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// 延迟同步（receive --defer-sync）：接收过程中把文件写在保存目录下的.ft-incoming子目录中，
+// 接收完成（校验通过）后才移动到最终位置。云同步客户端（Dropbox/OneDrive等）在文件出现后立即开始上传，
+// 把.ft-incoming设为忽略后，同步客户端只会看到完整的文件。传输失败或取消时未完成的文件留在.ft-incoming中。
+
+// deferSyncDir 存放未完成文件的子目录名
+const deferSyncDir = ".ft-incoming"
+
+// deferredPath 返回savePath对应的未完成文件路径（保存目录下的.ft-incoming子目录，不存在时创建）
+func deferredPath(savePath string) (string, error) {
+	dir := filepath.Join(filepath.Dir(savePath), deferSyncDir)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", fmt.Errorf("创建临时目录失败: %w", err)
+	}
+	return filepath.Join(dir, filepath.Base(savePath)), nil
+}
+
+// finishDeferred 把接收完成的文件从.ft-incoming移动到最终位置
+// 不删除.ft-incoming目录，同步客户端对它的忽略设置继续生效
+func finishDeferred(tempPath, savePath string) error {
+	if err := os.Rename(tempPath, savePath); err != nil {
+		return fmt.Errorf("移动文件到保存位置失败（文件保留在 %s）: %w", tempPath, err)
+	}
+	return nil
+}
@@ -0,0 +1,380 @@
+package main
+
+import (
+	"archive/tar"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 发送目录（send <目录>）：发送端把目录实时打包为tar流发送（不生成临时文件），元数据带IsArchive，
+// 接收端边接收边解压到保存位置下与目录同名的子目录（已存在时加序号），而不是保存为一个文件。
+// 压缩包内是相对于该目录的路径，包括空目录；符号链接和设备文件等特殊文件被跳过。
+// 发送前遍历一次目录按tar格式算出打包后的准确大小，WebRTC元数据和HTTP的Content-Length都使用它，进度和校验和与发送单个文件相同
+// （校验的是tar流，见checksum.go）；发送期间文件变小时中断发送，变大时只发送打包时的大小。
+// HTTP模式下载地址返回 <目录名>.tar 并带X-FTF-Archive响应头，本程序的接收端据此解压，浏览器等其他工具得到tar文件；
+// 打包流不支持Range续传。旧版接收端不认识IsArchive，会把tar流保存为一个文件。
+//
+// 目录续传（receive --resume）：接收端解压到与目录同名的已有子目录（不加序号），其中已存在、大小和修改时间都与
+// 压缩包条目一致的文件跳过写入（解压时恢复了修改时间，中断时写了一半的文件修改时间不同，会重新写入）。
+// 发送端仍发送完整的tar流，校验的也是整个tar流；接收失败或取消时不删除解压目录（其中可能有之前接收的文件）。
+
+// archiveHeader HTTP响应头：下载内容是目录的打包流（值为打包格式）
+const archiveHeader = "X-FTF-Archive"
+
+// archiveFormatTar 目录的打包格式
+const archiveFormatTar = "tar"
+
+// archiveEntry 打包的一个条目（目录或普通文件）
+type archiveEntry struct {
+	path   string      // 本地路径
+	header *tar.Header // Name为相对于打包目录的路径（/分隔，目录以/结尾）
+}
+
+// dirArchive 待发送目录的打包计划：条目列表和打包后的准确大小
+type dirArchive struct {
+	root    string
+	name    string // 目录名（接收端解压到同名子目录）
+	entries []archiveEntry
+	files   int      // 普通文件数
+	skipped []string // 跳过的符号链接和特殊文件（相对路径）
+	size    int64    // tar流的总字节数
+}
+
+// isDirectory path是否是目录（跟随符号链接）
+func isDirectory(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
+
+// newDirArchive 遍历目录生成打包计划（按路径排序，两次遍历结果一致时打包流完全相同）
+func newDirArchive(dir string) (*dirArchive, error) {
+	root, err := filepath.Abs(dir)
+	if err == nil {
+		// 目录本身是符号链接时打包它指向的目录
+		root, err = filepath.EvalSymlinks(root)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("目录不存在: %w", err)
+	}
+	archive := &dirArchive{root: root, name: filepath.Base(root)}
+	err = filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if p == root {
+			return nil
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		name := filepath.ToSlash(rel)
+		if !d.Type().IsRegular() && !d.IsDir() {
+			archive.skipped = append(archive.skipped, name)
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		header := &tar.Header{
+			Name:    name,
+			Mode:    int64(info.Mode().Perm()),
+			ModTime: info.ModTime().Truncate(time.Second),
+		}
+		if d.IsDir() {
+			header.Typeflag = tar.TypeDir
+			header.Name += "/"
+		} else {
+			header.Typeflag = tar.TypeReg
+			header.Size = info.Size()
+			archive.files++
+		}
+		archive.entries = append(archive.entries, archiveEntry{path: p, header: header})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("读取目录失败: %w", err)
+	}
+	if archive.size, err = archive.tarSize(); err != nil {
+		return nil, err
+	}
+	return archive, nil
+}
+
+// tarSize 按tar格式计算打包后的字节数：每个条目的头（长路径的PAX扩展头也计入）加上补齐到512字节的数据，末尾两个空块
+func (a *dirArchive) tarSize() (int64, error) {
+	var total int64
+	for _, entry := range a.entries {
+		counter := &countingWriter{w: io.Discard}
+		if err := tar.NewWriter(counter).WriteHeader(entry.header); err != nil {
+			return 0, fmt.Errorf("无法打包 %s: %w", entry.header.Name, err)
+		}
+		total += counter.Count() + (entry.header.Size+511)/512*512
+	}
+	return total + 2*512, nil
+}
+
+// describe 打印目录的文件数和跳过的条目（大小由调用方与单个文件一样显示）
+func (a *dirArchive) describe() {
+	fmt.Printf("发送目录: %s（%d 个文件，打包为tar发送）\n", a.name, a.files)
+	for _, name := range a.skipped {
+		fmt.Printf("跳过符号链接或特殊文件: %s\n", name)
+	}
+}
+
+// Open 开始生成tar流
+func (a *dirArchive) Open() io.ReadCloser {
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(a.writeTar(pw))
+	}()
+	return &archiveStream{r: pr}
+}
+
+// writeTar 按打包计划把目录写成tar流
+func (a *dirArchive) writeTar(w io.Writer) error {
+	tw := tar.NewWriter(w)
+	for _, entry := range a.entries {
+		if err := tw.WriteHeader(entry.header); err != nil {
+			return err
+		}
+		if entry.header.Typeflag != tar.TypeReg {
+			continue
+		}
+		if err := copyArchiveFile(tw, entry); err != nil {
+			return err
+		}
+	}
+	return tw.Close()
+}
+
+// copyArchiveFile 写入一个文件的数据（打包时的大小），文件变小时返回错误
+func copyArchiveFile(w io.Writer, entry archiveEntry) error {
+	file, err := os.Open(entry.path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if _, err := io.CopyN(w, file, entry.header.Size); err != nil {
+		if err == io.EOF {
+			return fmt.Errorf("%s 在发送过程中变小了", entry.header.Name)
+		}
+		return err
+	}
+	return nil
+}
+
+// archiveStream 目录的tar流，支持向后定位（续传时丢弃之前的数据）
+type archiveStream struct {
+	r   *io.PipeReader
+	pos int64
+}
+
+func (s *archiveStream) Read(p []byte) (int, error) {
+	n, err := s.r.Read(p)
+	s.pos += int64(n)
+	return n, err
+}
+
+// Seek 只支持从当前位置向后定位（读取并丢弃中间的数据）
+func (s *archiveStream) Seek(offset int64, whence int) (int64, error) {
+	if whence != io.SeekStart || offset < s.pos {
+		return s.pos, fmt.Errorf("目录的打包流只能向后定位")
+	}
+	_, err := io.CopyN(io.Discard, s, offset-s.pos)
+	return s.pos, err
+}
+
+// Close 停止生成tar流
+func (s *archiveStream) Close() error {
+	return s.r.Close()
+}
+
+// serveArchive 处理下载请求：把目录实时打包为tar发送（不支持Range），返回已发送的字节数和是否已完整发送
+func serveArchive(w http.ResponseWriter, r *http.Request, dir string, tracker *serveTracker) (int64, bool) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return 0, false
+	}
+	archive, err := newDirArchive(dir)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return 0, false
+	}
+
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s.tar\"", archive.name))
+	w.Header().Set("Content-Type", "application/x-tar")
+	w.Header().Set("Content-Length", strconv.FormatInt(archive.size, 10))
+	w.Header().Set(archiveHeader, archiveFormatTar)
+	w.WriteHeader(http.StatusOK)
+	if r.Method == http.MethodHead {
+		return 0, false
+	}
+
+	sendRange := byteRange{start: 0, length: archive.size}
+	counter := &countingWriter{w: w}
+	done := make(chan struct{})
+	go reportServeProgress(r.RemoteAddr, sendRange, archive.size, counter, done)
+	download := tracker.Begin(r.RemoteAddr, dir, 0, archive.size, counter)
+	defer tracker.End(download)
+
+	err = archive.writeTar(counter)
+	close(done)
+	if err != nil {
+		fmt.Printf("[%s] 打包发送中断: 已发送 %d 字节 (%v)\n", r.RemoteAddr, counter.Count(), err)
+		return counter.Count(), false
+	}
+	return counter.Count(), true
+}
+
+// keptArchive --resume接收目录失败或取消时的处理结果
+const keptArchive = "已保留解压出的文件（用 --resume 重新接收时跳过已完成的文件）"
+
+// archiveExtractor 接收端把写入的tar流边接收边解压到目录
+type archiveExtractor struct {
+	pw     *io.PipeWriter
+	done   chan error
+	closed bool
+	err    error
+}
+
+// createArchiveTarget 创建解压目标目录，返回的Writer写入tar流，Close等待解压完成并返回解压错误；
+// resume时跳过已完成的文件（--resume）
+func createArchiveTarget(dir string, resume bool) (io.WriteCloser, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("创建目录失败: %w", err)
+	}
+	pr, pw := io.Pipe()
+	e := &archiveExtractor{pw: pw, done: make(chan error, 1)}
+	go func() {
+		err := extractTar(pr, dir, resume)
+		if err == nil {
+			// tar流的结尾之后可能还有补齐的数据，读完避免写入方阻塞
+			_, err = io.Copy(io.Discard, pr)
+		}
+		pr.CloseWithError(err)
+		e.done <- err
+	}()
+	return e, nil
+}
+
+func (e *archiveExtractor) Write(p []byte) (int, error) {
+	return e.pw.Write(p)
+}
+
+// Close 结束tar流并等待解压完成（可重复调用）
+func (e *archiveExtractor) Close() error {
+	if e.closed {
+		return e.err
+	}
+	e.closed = true
+	e.pw.Close()
+	if e.err = <-e.done; e.err != nil {
+		e.err = fmt.Errorf("解压失败: %w", e.err)
+	}
+	return e.err
+}
+
+// extractTar 把tar流解压到dir：只接受dir之内的相对路径，跳过符号链接等特殊条目；
+// resume时已存在、大小和修改时间一致的文件不再写入
+func extractTar(r io.Reader, dir string, resume bool) error {
+	tr := tar.NewReader(r)
+	skipped := 0
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			if skipped > 0 {
+				fmt.Printf("\n续传: 跳过 %d 个已完成的文件\n", skipped)
+			}
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		target, err := archiveEntryPath(dir, header.Name)
+		if err != nil {
+			return err
+		}
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if resume && sameArchiveFile(target, header) {
+				if _, err := io.Copy(io.Discard, tr); err != nil {
+					return err
+				}
+				skipped++
+				continue
+			}
+			if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+				return err
+			}
+			if err := extractFile(tr, target, header); err != nil {
+				return err
+			}
+		default:
+			fmt.Printf("\n跳过压缩包中的特殊条目: %s\n", header.Name)
+		}
+	}
+}
+
+// archiveEntryPath 压缩包条目在dir中的路径，绝对路径或含..跳出dir的路径返回错误
+func archiveEntryPath(dir, name string) (string, error) {
+	rel := filepath.FromSlash(path.Clean(strings.TrimSuffix(name, "/")))
+	if !filepath.IsLocal(rel) {
+		return "", fmt.Errorf("压缩包中的路径不安全: %s", name)
+	}
+	return filepath.Join(dir, rel), nil
+}
+
+// sameArchiveFile target是否是已完成解压的同一文件（普通文件，大小和修改时间与压缩包条目一致）
+func sameArchiveFile(target string, header *tar.Header) bool {
+	info, err := os.Lstat(target)
+	return err == nil && info.Mode().IsRegular() && info.Size() == header.Size && info.ModTime().Equal(header.ModTime)
+}
+
+// extractFile 写入一个文件并恢复权限和修改时间
+func extractFile(r io.Reader, target string, header *tar.Header) error {
+	file, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, os.FileMode(header.Mode).Perm()|0600)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(file, r)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	os.Chtimes(target, header.ModTime, header.ModTime)
+	return nil
+}
+
+// removeReceived 删除接收的文件，接收的是目录时删除解压出的整个目录（不使用--resume时解压目录总是新建的，见archiveSavePath）
+func removeReceived(path string) error {
+	if info, err := os.Lstat(path); err == nil && info.IsDir() {
+		return os.RemoveAll(path)
+	}
+	return os.Remove(path)
+}
+
+// archiveSavePath 解压目录的位置：与已有的文件或目录同名时加序号，不合并到已有的目录中（失败时可以整个删除）；
+// resume时解压到同名的已有目录
+func archiveSavePath(savePath string, resume bool) string {
+	if info, err := os.Stat(savePath); resume && err == nil && info.IsDir() {
+		fmt.Printf("续传: 解压到已有的目录 %s，跳过已完成的文件\n", savePath)
+		return savePath
+	}
+	return uniqueFilePath(savePath)
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// TestDirArchive 发送目录：打包流的长度等于预先算出的大小，符号链接被跳过；
+// WebRTC接收端按IsArchive边接收边解压（含空目录），HTTP接收端按响应头解压到同名子目录（已存在时加序号）；
+// 含..的条目被拒绝，不会写到解压目录之外
+func TestDirArchive(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "photos")
+	files := map[string]int{"a.txt": 10, "sub/b.bin": 100 * 1024, "sub/deep/" + strings.Repeat("long-name-", 12) + ".bin": 700}
+	for name, size := range files {
+		path := filepath.Join(src, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := writeRandomFile(path, int64(size)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Mkdir(filepath.Join(src, "empty"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	// 不支持符号链接的系统上跳过这一项
+	os.Symlink(filepath.Join(src, "a.txt"), filepath.Join(src, "link.txt"))
+
+	archive, err := newDirArchive(src)
+	if err != nil {
+		t.Fatalf("打包目录: %v", err)
+	}
+	stream := archive.Open()
+	data, err := io.ReadAll(stream)
+	stream.Close()
+	if err != nil {
+		t.Fatalf("读取打包流: %v", err)
+	}
+	if int64(len(data)) != archive.size || archive.files != len(files) {
+		t.Fatalf("打包流为 %d 字节（%d 个文件），期望 %d 字节（%d 个文件）", len(data), archive.files, archive.size, len(files))
+	}
+	sum, err := fileChecksum(src, defaultChecksumAlgo)
+	if err != nil {
+		t.Fatalf("计算目录的校验和: %v", err)
+	}
+	if streamSum := sha256.Sum256(data); sum != hex.EncodeToString(streamSum[:]) {
+		t.Fatal("目录的校验和与打包流的不一致")
+	}
+
+	// 比对解压出的目录与源目录
+	compare := func(t *testing.T, extracted string) {
+		t.Helper()
+		for name := range files {
+			want, _ := os.ReadFile(filepath.Join(src, filepath.FromSlash(name)))
+			got, err := os.ReadFile(filepath.Join(extracted, filepath.FromSlash(name)))
+			if err != nil || !bytes.Equal(got, want) {
+				t.Errorf("解压出的 %s 与源文件不一致", name)
+			}
+		}
+		if !isDirectory(filepath.Join(extracted, "empty")) {
+			t.Error("没有解压出空目录")
+		}
+		if _, err := os.Lstat(filepath.Join(extracted, "link.txt")); !os.IsNotExist(err) {
+			t.Error("符号链接没有被跳过")
+		}
+	}
+
+	t.Run("webrtc", func(t *testing.T) {
+		// 一条消息包含长度前缀和元数据，之后是打包流
+		recvDir := t.TempDir()
+		metadataJSON, _ := json.Marshal(FileMetadata{FileName: archive.name, FileSize: archive.size, Checksum: sum, ChecksumAlgo: defaultChecksumAlgo, IsArchive: true})
+		message := make([]byte, 4, 4+len(metadataJSON))
+		binary.BigEndian.PutUint32(message, uint32(len(metadataJSON)))
+		receiver := NewWebRTCReceiver("", "", recvDir, iceServerNone, iceServerNone, "", "", false)
+		for _, chunk := range [][]byte{append(message, metadataJSON...), data[:len(data)/2], data[len(data)/2:]} {
+			if err := receiver.handleMessage(chunk); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if atomic.LoadInt32(&receiver.finished) != 1 {
+			t.Fatal("没有完成接收目录")
+		}
+		compare(t, filepath.Join(recvDir, "photos"))
+	})
+
+	t.Run("http", func(t *testing.T) {
+		mux := http.NewServeMux()
+		registerFileHandlers(mux, []string{src}, newLazyChecksum(src, defaultChecksumAlgo), nil)
+		server := httptest.NewServer(mux)
+		defer server.Close()
+		// 第二次下载解压到加序号的目录
+		httpDir := t.TempDir()
+		for _, name := range []string{"photos", "photos (1)"} {
+			if _, err := NewHTTPReceiver(server.URL+"/download", httpDir+string(filepath.Separator)).Start(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+			compare(t, filepath.Join(httpDir, name))
+		}
+	})
+
+	t.Run("unsafe path", func(t *testing.T) {
+		var evil bytes.Buffer
+		tw := tar.NewWriter(&evil)
+		tw.WriteHeader(&tar.Header{Name: "../evil.txt", Typeflag: tar.TypeReg, Mode: 0644, Size: 4})
+		tw.Write([]byte("evil"))
+		tw.Close()
+		evilDir := t.TempDir()
+		target, err := createArchiveTarget(filepath.Join(evilDir, "target"), false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		target.Write(evil.Bytes())
+		if err := target.Close(); err == nil {
+			t.Fatal("含..的条目没有被拒绝")
+		}
+		if _, err := os.Stat(filepath.Join(evilDir, "evil.txt")); !os.IsNotExist(err) {
+			t.Fatal("含..的条目被写到了解压目录之外")
+		}
+	})
+}
+
+// TestArchiveResume --resume重新接收目录：解压到已有的同名目录，大小和修改时间一致的文件不再写入，
+// 缺少、写了一半的文件重新写入
+func TestArchiveResume(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "photos")
+	files := map[string][]byte{"a.txt": make([]byte, 10), "sub/b.bin": make([]byte, 100*1024), "sub/c.bin": make([]byte, 700)}
+	for name, content := range files {
+		rand.Read(content)
+		path := filepath.Join(src, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, content, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	archive, err := newDirArchive(src)
+	if err != nil {
+		t.Fatalf("打包目录: %v", err)
+	}
+	extract := func(savePath string, resume bool) string {
+		t.Helper()
+		target := archiveSavePath(savePath, resume)
+		w, err := createArchiveTarget(target, resume)
+		if err != nil {
+			t.Fatal(err)
+		}
+		stream := archive.Open()
+		_, err = io.Copy(w, stream)
+		stream.Close()
+		if closeErr := w.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			t.Fatalf("解压: %v", err)
+		}
+		return target
+	}
+
+	savePath := filepath.Join(dir, "out", "photos")
+	if got := extract(savePath, false); got != savePath {
+		t.Fatalf("第一次解压到 %s，期望 %s", got, savePath)
+	}
+	// 模拟中断：一个文件还没有解压，一个文件写了一半；已完成的a.txt换成大小和修改时间相同的其他内容，用于确认没有重新写入
+	os.Remove(filepath.Join(savePath, "sub", "c.bin"))
+	half := filepath.Join(savePath, "sub", "b.bin")
+	if err := os.WriteFile(half, files["sub/b.bin"][:50*1024], 0644); err != nil {
+		t.Fatal(err)
+	}
+	done := filepath.Join(savePath, "a.txt")
+	info, err := os.Stat(done)
+	if err != nil {
+		t.Fatal(err)
+	}
+	marker := bytes.Repeat([]byte("x"), len(files["a.txt"]))
+	if err := os.WriteFile(done, marker, 0644); err != nil {
+		t.Fatal(err)
+	}
+	os.Chtimes(done, info.ModTime(), info.ModTime())
+
+	if got := extract(savePath, false); got == savePath {
+		t.Fatal("不使用--resume时解压到了已有的目录")
+	}
+	if got := extract(savePath, true); got != savePath {
+		t.Fatalf("--resume时解压到 %s，期望已有的目录 %s", got, savePath)
+	}
+	if got, _ := os.ReadFile(done); !bytes.Equal(got, marker) {
+		t.Fatal("--resume时重新写入了大小和修改时间一致的文件")
+	}
+	for _, name := range []string{"sub/b.bin", "sub/c.bin"} {
+		if got, _ := os.ReadFile(filepath.Join(savePath, filepath.FromSlash(name))); !bytes.Equal(got, files[name]) {
+			t.Fatalf("--resume后 %s 与源文件不一致", name)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"time"
+
+	"filetransfer_pc/signaling"
+)
+
+// 内嵌信令服务器（send --embed-signaling）：发送端在本进程内启动信令服务器，
+// 接收端用 --signaling ws://<发送端局域网地址>:<端口>/ws 连接，不需要单独部署信令服务器。
+// 只有接收端能访问发送端的该端口时才有用（如同一局域网内但无法访问公共信令服务器）。
+
+// defaultEmbeddedSignalingPort 内嵌信令服务器的默认端口（与独立部署的信令服务器相同）
+const defaultEmbeddedSignalingPort = 37851
+
+// startEmbeddedSignaling 在所有网卡的port端口（0为随机端口）启动内嵌信令服务器，
+// 返回接收端应使用的信令地址（本机首选的局域网地址）和关闭服务器的函数
+func startEmbeddedSignaling(port int) (string, func(), error) {
+	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
+	if err != nil {
+		return "", nil, fmt.Errorf("启动内嵌信令服务器失败: %w", err)
+	}
+	port = listener.Addr().(*net.TCPAddr).Port
+
+	server := signaling.NewSignalingServer()
+	go server.Serve(listener)
+	stop := func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		server.Shutdown(ctx)
+	}
+
+	host := "127.0.0.1"
+	localIPs, err := getLocalIPs()
+	if err == nil {
+		host = localIPs[0].IP
+	}
+	u := url.URL{Scheme: "ws", Host: net.JoinHostPort(host, strconv.Itoa(port)), Path: "/ws"}
+	signalingURL := u.String()
+
+	fmt.Printf("内嵌信令服务器已启动，端口: %d\n", port)
+	if err != nil {
+		fmt.Println("注意: 未找到局域网地址，内嵌信令服务器只能在本机访问")
+	} else {
+		printLocalIPNotes(localIPs)
+	}
+	fmt.Printf("接收端需要加参数: --signaling %s\n", signalingURL)
+	fmt.Println("（接收端必须能访问本机的该端口，否则请使用公共信令服务器）")
+	return signalingURL, stop, nil
+}
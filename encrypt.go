@@ -0,0 +1,168 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+// 端到端加密（send/receive --password）：在DTLS之外再用双方约定的密码加密文件数据，经公共TURN服务器或信令服务器中转时
+// 中转方也看不到文件内容。发送端为每个文件生成随机盐，用scrypt从密码和盐派生AES-256密钥；文件数据分为记录，
+// 每条记录是4字节大端长度加AES-256-GCM密文（含16字节认证标签），nonce为记录序号（每个文件的密钥不同，nonce不会重复）。
+// 元数据带算法、盐和密钥校验值（用密钥加密的固定内容，附加数据为文件名、大小、校验和等字段），接收端收到元数据后先验证密码，
+// 密码错误、只有一方指定了密码或元数据被篡改时中止并通知发送端，不创建文件；任何一条记录认证失败时立即中止并删除已接收的数据。
+// 与--compress同时使用时先压缩再加密。文件名和大小不加密；HTTP模式和广播不支持加密。
+
+// encryptionAES256GCM 元数据中的加密算法：scrypt派生密钥，AES-256-GCM加密记录
+const encryptionAES256GCM = "scrypt-aes-256-gcm"
+
+// scrypt参数（派生一次密钥约100ms、32MB内存）
+const (
+	scryptN = 1 << 15
+	scryptR = 8
+	scryptP = 1
+)
+
+const (
+	encryptionSaltSize = 16
+	recordOverhead     = 4 + 16 // 每条记录的长度前缀和认证标签
+	// maxRecordSize 记录长度上限：超过时说明数据损坏，在分配缓冲区之前拒绝
+	maxRecordSize = 1024 * 1024
+)
+
+// keyCheckPlaintext 密钥校验值加密的固定内容
+var keyCheckPlaintext = []byte("ftf-key-check")
+
+// deriveAEAD 从密码和盐派生AES-256-GCM
+func deriveAEAD(password string, salt []byte) (cipher.AEAD, error) {
+	key, err := scrypt.Key([]byte(password), salt, scryptN, scryptR, scryptP, 32)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// recordNonce 第seq条记录的nonce（序号0用于密钥校验值，记录从1开始）
+func recordNonce(seq uint64) []byte {
+	nonce := make([]byte, 12)
+	binary.BigEndian.PutUint64(nonce[4:], seq)
+	return nonce
+}
+
+// metadataAAD 密钥校验值的附加数据：元数据中决定如何保存和校验文件的字段
+func metadataAAD(m *FileMetadata) []byte {
+	return []byte(fmt.Sprintf("%s\x00%d\x00%s\x00%s\x00%t\x00%t\x00%d/%d",
+		m.FileName, m.FileSize, m.ChecksumAlgo, m.Checksum, m.IsArchive, m.Compressed, m.FileIndex, m.FileCount))
+}
+
+// recordSealer 发送端按记录加密文件数据
+type recordSealer struct {
+	aead cipher.AEAD
+	seq  uint64
+}
+
+// newRecordSealer 生成盐并派生密钥，在元数据中写入加密算法、盐和密钥校验值（在元数据的其他字段都已确定后调用）
+func newRecordSealer(password string, metadata *FileMetadata) (*recordSealer, error) {
+	salt := make([]byte, encryptionSaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	aead, err := deriveAEAD(password, salt)
+	if err != nil {
+		return nil, fmt.Errorf("派生密钥失败: %w", err)
+	}
+	metadata.Encryption = encryptionAES256GCM
+	metadata.Salt = base64.StdEncoding.EncodeToString(salt)
+	metadata.KeyCheck = base64.StdEncoding.EncodeToString(aead.Seal(nil, recordNonce(0), keyCheckPlaintext, metadataAAD(metadata)))
+	return &recordSealer{aead: aead}, nil
+}
+
+// seal 把一段数据加密为一条记录（长度前缀加密文）
+func (s *recordSealer) seal(plain []byte) []byte {
+	s.seq++
+	record := make([]byte, 4, 4+len(plain)+s.aead.Overhead())
+	record = s.aead.Seal(record, recordNonce(s.seq), plain, nil)
+	binary.BigEndian.PutUint32(record, uint32(len(record)-4))
+	return record
+}
+
+// recordOpener 接收端重组并解密记录
+type recordOpener struct {
+	aead cipher.AEAD
+	seq  uint64
+	buf  []byte // 还不完整的记录
+}
+
+// newRecordOpener 按元数据和接收端的密码创建解密器（都没有加密时返回nil）；
+// 只有一方指定了密码、密码错误或元数据被篡改时返回错误
+func newRecordOpener(password string, metadata *FileMetadata) (*recordOpener, error) {
+	switch {
+	case metadata.Encryption == "" && password == "":
+		return nil, nil
+	case metadata.Encryption == "":
+		return nil, fmt.Errorf("接收端指定了 --password，但发送端没有加密文件（发送端也需要使用相同的 --password）")
+	case password == "":
+		return nil, fmt.Errorf("发送端加密了文件，请使用 --password 指定与发送端相同的密码")
+	case metadata.Encryption != encryptionAES256GCM:
+		return nil, fmt.Errorf("不支持的加密算法: %s（请升级接收端）", metadata.Encryption)
+	}
+	salt, err := base64.StdEncoding.DecodeString(metadata.Salt)
+	if err != nil {
+		return nil, fmt.Errorf("元数据中的盐无效: %w", err)
+	}
+	check, err := base64.StdEncoding.DecodeString(metadata.KeyCheck)
+	if err != nil {
+		return nil, fmt.Errorf("元数据中的密钥校验值无效: %w", err)
+	}
+	aead, err := deriveAEAD(password, salt)
+	if err != nil {
+		return nil, fmt.Errorf("派生密钥失败: %w", err)
+	}
+	if _, err := aead.Open(nil, recordNonce(0), check, metadataAAD(metadata)); err != nil {
+		return nil, fmt.Errorf("密码错误（与发送端的 --password 不一致），或元数据在传输中被篡改")
+	}
+	return &recordOpener{aead: aead}, nil
+}
+
+// next 从data中取出一条完整的记录并解密，返回明文和data中剩余的部分；
+// data不足一条记录时缓存并返回nil明文，认证失败时返回错误
+func (o *recordOpener) next(data []byte) (plain, rest []byte, err error) {
+	need := 4
+	for {
+		if len(o.buf) < need {
+			n := need - len(o.buf)
+			if n > len(data) {
+				n = len(data)
+			}
+			o.buf = append(o.buf, data[:n]...)
+			data = data[n:]
+			if len(o.buf) < need {
+				return nil, data, nil
+			}
+		}
+		if need > 4 {
+			break
+		}
+		size := binary.BigEndian.Uint32(o.buf)
+		if size < uint32(o.aead.Overhead()) || size > maxRecordSize {
+			return nil, nil, fmt.Errorf("无效的加密记录长度 %d（数据损坏或发送端没有加密）", size)
+		}
+		need = 4 + int(size)
+	}
+	o.seq++
+	plain, err = o.aead.Open(nil, recordNonce(o.seq), o.buf[4:], nil)
+	o.buf = o.buf[:0]
+	if err != nil {
+		return nil, nil, fmt.Errorf("第 %d 条加密记录认证失败，数据在传输中被篡改或损坏", o.seq)
+	}
+	return plain, data, nil
+}
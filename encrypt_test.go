@@ -0,0 +1,225 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// TestEncrypt 加密传输：密码一致时接收端解密出的内容和校验和一致；密码错误或只有一方指定了密码时中止且不创建文件，
+// 记录被篡改时认证失败并删除已接收的数据
+func TestEncrypt(t *testing.T) {
+	names := []string{"secret.bin", "notes.txt"}
+	contents := [][]byte{make([]byte, 100*1024), []byte("meet at noon\n")}
+	rand.Read(contents[0])
+
+	// stream 按发送端的格式生成元数据和加密记录（password为空时不加密）
+	stream := func(password string) []byte {
+		var out []byte
+		for i, name := range names {
+			metadata := FileMetadata{FileName: name, FileSize: int64(len(contents[i])), FileIndex: i + 1, FileCount: len(names)}
+			h, err := newChecksumHash(defaultChecksumAlgo)
+			if err != nil {
+				t.Fatal(err)
+			}
+			h.Write(contents[i])
+			metadata.Checksum = hex.EncodeToString(h.Sum(nil))
+			metadata.ChecksumAlgo = defaultChecksumAlgo
+			var sealer *recordSealer
+			if password != "" {
+				if sealer, err = newRecordSealer(password, &metadata); err != nil {
+					t.Fatalf("加密: %v", err)
+				}
+			}
+			metadataJSON, _ := json.Marshal(metadata)
+			header := make([]byte, 4)
+			binary.BigEndian.PutUint32(header, uint32(len(metadataJSON)))
+			out = append(out, header...)
+			out = append(out, metadataJSON...)
+			for data := contents[i]; len(data) > 0; {
+				n := 7000
+				if n > len(data) {
+					n = len(data)
+				}
+				if sealer != nil {
+					out = append(out, sealer.seal(data[:n])...)
+				} else {
+					out = append(out, data[:n]...)
+				}
+				data = data[n:]
+			}
+		}
+		return out
+	}
+	// receive 分块交给接收端，返回handleMessage或中止的错误
+	receive := func(out, password string, data []byte) (*WebRTCReceiver, error) {
+		receiver := NewWebRTCReceiver("", "", out, iceServerNone, iceServerNone, "", "", false)
+		receiver.password = password
+		for len(data) > 0 && receiver.state != 3 {
+			n := 333
+			if n > len(data) {
+				n = len(data)
+			}
+			if err := receiver.handleMessage(data[:n]); err != nil {
+				return receiver, err
+			}
+			data = data[n:]
+		}
+		select {
+		case err := <-receiver.done:
+			return receiver, err
+		default:
+			return receiver, nil
+		}
+	}
+
+	encrypted := stream("correct horse")
+	if bytes.Contains(encrypted, contents[1]) {
+		t.Fatal("加密后的数据中包含明文")
+	}
+
+	t.Run("decrypt", func(t *testing.T) {
+		out := t.TempDir() + string(filepath.Separator)
+		receiver, err := receive(out, "correct horse", encrypted)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if atomic.LoadInt32(&receiver.finished) != 1 {
+			t.Fatal("接收加密的文件没有完成")
+		}
+		for i, name := range names {
+			got, err := os.ReadFile(filepath.Join(out, name))
+			if err != nil || !bytes.Equal(got, contents[i]) {
+				t.Errorf("解密出的 %s 与源文件不一致", name)
+			}
+		}
+	})
+
+	plain := stream("")
+	for _, c := range []struct {
+		desc, password string
+		data           []byte
+		want           string
+	}{
+		{"wrong password", "wrong horse", encrypted, "密码错误"},
+		{"receiver without password", "", encrypted, "发送端加密了文件"},
+		{"sender without password", "correct horse", plain, "发送端没有加密"},
+	} {
+		t.Run(c.desc, func(t *testing.T) {
+			out := t.TempDir() + string(filepath.Separator)
+			if _, err := receive(out, c.password, c.data); err == nil || !strings.Contains(err.Error(), c.want) {
+				t.Fatalf("应中止并提示%q，实际: %v", c.want, err)
+			}
+			if _, err := os.Stat(filepath.Join(out, names[0])); err == nil {
+				t.Fatal("中止时不应创建文件")
+			}
+		})
+	}
+
+	t.Run("tampered", func(t *testing.T) {
+		// 篡改第一个文件的第二条记录中的一个字节
+		tampered := append([]byte(nil), encrypted...)
+		tampered[bytes.Index(tampered, []byte("}"))+1+7000+recordOverhead+100] ^= 1
+		out := t.TempDir() + string(filepath.Separator)
+		if _, err := receive(out, "correct horse", tampered); err == nil || !strings.Contains(err.Error(), "认证失败") {
+			t.Fatalf("记录被篡改时应认证失败，实际: %v", err)
+		}
+		if _, err := os.Stat(filepath.Join(out, names[0])); err == nil {
+			t.Fatal("认证失败后没有删除已接收的数据")
+		}
+	})
+}
+
+// TestEncryptResume 加密传输中断后发送端重启续传：重启的发送端使用新的盐、记录序号从0开始，
+// 接收端按新的元数据重新派生密钥，从已解密的位置继续，得到的文件与源文件一致
+func TestEncryptResume(t *testing.T) {
+	const password = "correct horse"
+	content := make([]byte, 100*1024)
+	rand.Read(content)
+	h, err := newChecksumHash(defaultChecksumAlgo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.Write(content)
+	checksum := hex.EncodeToString(h.Sum(nil))
+
+	// stream 模拟（重新）启动的发送端：新的元数据和盐，从offset开始加密发送；返回元数据消息和之后的记录
+	stream := func(offset int64) ([]byte, []byte) {
+		metadata := FileMetadata{FileName: "secret.bin", FileSize: int64(len(content)), Session: "test-session",
+			Checksum: checksum, ChecksumAlgo: defaultChecksumAlgo}
+		sealer, err := newRecordSealer(password, &metadata)
+		if err != nil {
+			t.Fatalf("加密: %v", err)
+		}
+		metadataJSON, _ := json.Marshal(metadata)
+		header := make([]byte, 4)
+		binary.BigEndian.PutUint32(header, uint32(len(metadataJSON)))
+		var records []byte
+		for data := content[offset:]; len(data) > 0; {
+			n := 7000
+			if n > len(data) {
+				n = len(data)
+			}
+			records = append(records, sealer.seal(data[:n])...)
+			data = data[n:]
+		}
+		return append(header, metadataJSON...), records
+	}
+	feed := func(receiver *WebRTCReceiver, data []byte) error {
+		for len(data) > 0 && receiver.state != 3 {
+			n := 333
+			if n > len(data) {
+				n = len(data)
+			}
+			if err := receiver.handleMessage(data[:n]); err != nil {
+				return err
+			}
+			data = data[n:]
+		}
+		return nil
+	}
+
+	savePath := filepath.Join(t.TempDir(), "secret.bin")
+	receiver := NewWebRTCReceiver("", "", savePath, iceServerNone, iceServerNone, "", "", false)
+	receiver.password = password
+	metadata, records := stream(0)
+	// 在一条记录的中间中断
+	if err := feed(receiver, append(metadata, records[:len(records)/2]...)); err != nil {
+		t.Fatalf("接收中断前的部分: %v", err)
+	}
+	received := atomic.LoadInt64(&receiver.totalReceived)
+	if receiver.state != 2 || received == 0 || received >= int64(len(content)) {
+		t.Fatalf("中断前应已接收部分数据，实际状态 %d，已接收 %d 字节", receiver.state, received)
+	}
+
+	// 重新连接（同OnDataChannel），重启的发送端收到续传位置后才发送数据
+	receiver.state = 0
+	receiver.lengthBuf = nil
+	metadata, records = stream(received)
+	if err := receiver.handleMessage(metadata); err != nil {
+		t.Fatalf("续传: %v", err)
+	}
+	if err := feed(receiver, records); err != nil {
+		t.Fatalf("续传: %v", err)
+	}
+	select {
+	case err := <-receiver.done:
+		if err != nil {
+			t.Fatalf("续传: %v", err)
+		}
+	default:
+	}
+	if atomic.LoadInt32(&receiver.finished) != 1 {
+		t.Fatal("续传没有完成")
+	}
+	if got, err := os.ReadFile(savePath); err != nil || !bytes.Equal(got, content) {
+		t.Fatal("续传后的文件与源文件不一致")
+	}
+}
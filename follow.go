@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+)
+
+// 跟随模式（send --follow）：用于传输正在写入的文件（如日志）
+// 发送端先发送文件现有内容，之后持续发送追加的数据；响应不带Content-Length（分块传输编码），
+// 按Ctrl+C时发送完已追加的数据后正常结束响应，这就是结束标记——发送端被强行终止时响应没有正常结束，接收端会报告下载失败。
+// 文件大小未知，两端都不显示百分比进度，也不提供SHA-256校验和。
+
+// followHeader 跟随模式的响应头：接收端据此取消下载时长限制，并把收到的数据立即写入文件
+const followHeader = "X-FTF-Follow"
+
+// followPollInterval 读到文件末尾后检查文件是否增长的间隔
+const followPollInterval = 500 * time.Millisecond
+
+// serveFollow 以跟随模式发送文件，直到stop关闭（发送剩余数据后正常结束）、文件被截断或连接断开
+// 返回已发送的字节数和是否正常结束（stop关闭或文件被截断）
+func serveFollow(w http.ResponseWriter, r *http.Request, path string, stop <-chan struct{}) (int64, bool) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return 0, false
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return 0, false
+	}
+	defer file.Close()
+
+	w.Header().Set(followHeader, "1")
+	w.WriteHeader(http.StatusOK)
+	if r.Method == http.MethodHead {
+		return 0, false
+	}
+	flusher, _ := w.(http.Flusher)
+
+	fmt.Printf("[%s] 开始跟随下载\n", r.RemoteAddr)
+	counter := &countingWriter{w: w}
+	buffer := make([]byte, 256*1024)
+	stopping := false
+	for {
+		n, readErr := file.Read(buffer)
+		if n > 0 {
+			if _, err := counter.Write(buffer[:n]); err != nil {
+				fmt.Printf("[%s] 连接中断: 已发送 %d 字节 (%v)\n", r.RemoteAddr, counter.Count(), err)
+				return counter.Count(), false
+			}
+			continue
+		}
+		if readErr != nil && readErr != io.EOF {
+			fmt.Printf("[%s] 读取文件失败: %v\n", r.RemoteAddr, readErr)
+			return counter.Count(), false
+		}
+
+		// 已发送到文件当前末尾
+		if flusher != nil {
+			flusher.Flush()
+		}
+		if stopping {
+			fmt.Printf("[%s] 跟随结束: 共发送 %d 字节\n", r.RemoteAddr, counter.Count())
+			return counter.Count(), true
+		}
+		if info, err := file.Stat(); err == nil && info.Size() < counter.Count() {
+			fmt.Printf("[%s] 文件被截断（可能发生了日志轮转），结束跟随: 共发送 %d 字节\n", r.RemoteAddr, counter.Count())
+			return counter.Count(), true
+		}
+
+		select {
+		case <-stop:
+			stopping = true // 再读一次，发送停止前追加的数据
+		case <-r.Context().Done():
+			fmt.Printf("[%s] 接收端断开连接: 已发送 %d 字节\n", r.RemoteAddr, counter.Count())
+			return counter.Count(), false
+		case <-time.After(followPollInterval):
+		}
+	}
+}
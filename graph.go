@@ -0,0 +1,88 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	graphWidth          = 30                     // 曲线保留的采样点数
+	graphSampleInterval = 500 * time.Millisecond // 采样间隔
+)
+
+// sparkBlocks 从低到高的曲线字符
+var sparkBlocks = []rune("▁▂▃▄▅▆▇█")
+
+// speedGraph 终端速度曲线（--graph），记录最近的瞬时速度并渲染为sparkline
+type speedGraph struct {
+	samples   []float64 // 最近的瞬时速度（字节/秒）
+	lastTime  time.Time
+	lastTotal int64
+	rendered  string
+}
+
+// newSpeedGraph 创建速度曲线；标准输出不是终端时返回nil（管道/重定向输出不受影响）
+func newSpeedGraph(enabled bool) *speedGraph {
+	if !enabled || !isOutputTerminal() {
+		return nil
+	}
+	return &speedGraph{
+		lastTime: time.Now(),
+		rendered: strings.Repeat(" ", graphWidth),
+	}
+}
+
+// isOutputTerminal 判断标准输出是否连接到终端
+func isOutputTerminal() bool {
+	info, err := os.Stdout.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+// Update 根据累计传输字节数更新曲线，返回用于追加在进度行后的字符串（nil时返回空字符串）
+func (g *speedGraph) Update(total int64) string {
+	if g == nil {
+		return ""
+	}
+
+	now := time.Now()
+	elapsed := now.Sub(g.lastTime)
+	if elapsed < graphSampleInterval {
+		return " " + g.rendered
+	}
+
+	speed := float64(total-g.lastTotal) / elapsed.Seconds()
+	g.lastTime = now
+	g.lastTotal = total
+
+	g.samples = append(g.samples, speed)
+	if len(g.samples) > graphWidth {
+		g.samples = g.samples[len(g.samples)-graphWidth:]
+	}
+	g.rendered = g.render()
+	return " " + g.rendered
+}
+
+// render 按最近采样中的最大值归一化渲染曲线（不足宽度时右侧补空格，保持行宽不变）
+func (g *speedGraph) render() string {
+	max := 0.0
+	for _, s := range g.samples {
+		if s > max {
+			max = s
+		}
+	}
+
+	var b strings.Builder
+	for _, s := range g.samples {
+		level := 0
+		if max > 0 {
+			level = int(s / max * float64(len(sparkBlocks)-1))
+		}
+		b.WriteRune(sparkBlocks[level])
+	}
+	b.WriteString(strings.Repeat(" ", graphWidth-len(g.samples)))
+	return b.String()
+}
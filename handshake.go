@@ -0,0 +1,97 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+
+	"github.com/pion/webrtc/v3"
+)
+
+// 接收确认握手：发送端在元数据中设置Handshake，发送元数据后等待接收端回复再发送文件数据。
+// 接收端需要交互确认（--confirm）时先回复confirm_pending，用户决定后回复accept，重命名时回复rename（附带最终文件名），
+// 拒绝时回复cancel；不需要确认时直接回复accept。用户决定之前不会有文件数据到达，两端的无进度超时在等待期间暂停。
+// 旧版接收端不回复，发送端等待handshakeReplyTimeout后照常发送。
+
+// handshakeReplyTimeout 发送端等待接收端首次回复的时间（超时说明接收端不支持握手）
+const handshakeReplyTimeout = 10 * time.Second
+
+// isHandshakeReply 是否是握手阶段接收端的回复
+func isHandshakeReply(ctrl ControlMessage) bool {
+	switch ctrl.Type {
+	case "confirm_pending", "accept", "rename", "cancel":
+		return true
+	}
+	return false
+}
+
+// deliverHandshakeReply 把接收端的握手回复交给waitAccept（不阻塞，握手结束后的回复丢弃）
+func deliverHandshakeReply(replies chan<- ControlMessage, ctrl ControlMessage) {
+	if !isHandshakeReply(ctrl) {
+		return
+	}
+	select {
+	case replies <- ctrl:
+	default:
+	}
+}
+
+// waitAccept 等待接收端确认接收；接收端拒绝时返回错误，等待用户确认期间pending为1
+func waitAccept(replies <-chan ControlMessage, pending *int32, cancel <-chan struct{}) error {
+	defer atomic.StoreInt32(pending, 0)
+	timeout := time.After(handshakeReplyTimeout)
+	for {
+		select {
+		case ctrl := <-replies:
+			switch ctrl.Type {
+			case "confirm_pending":
+				fmt.Println("等待接收端确认接收...")
+				atomic.StoreInt32(pending, 1)
+				timeout = nil
+			case "accept":
+				return nil
+			case "rename":
+				fmt.Printf("接收端将保存为: %s\n", ctrl.Name)
+				return nil
+			case "cancel":
+				return fmt.Errorf("接收端已拒绝: %s", ctrl.Reason)
+			}
+		case <-timeout:
+			fmt.Println("警告: 接收端未回复接收确认（可能是不支持的版本），直接发送")
+			return nil
+		case <-cancel:
+			return errTransferCanceled
+		}
+	}
+}
+
+// sendControl 向发送端发送控制消息（直接TCP连接或DataChannel，未连接时什么也不做）
+func (r *WebRTCReceiver) sendControl(msg ControlMessage) {
+	if r.tcpConn != nil {
+		if err := writeTCPControl(r.tcpConn, msg); err != nil {
+			fmt.Printf("发送控制消息失败: %v\n", err)
+		}
+		return
+	}
+	if r.dc == nil || r.dc.ReadyState() != webrtc.DataChannelStateOpen {
+		return
+	}
+	data, _ := json.Marshal(msg)
+	if err := r.dc.Send(data); err != nil {
+		fmt.Printf("发送控制消息失败: %v\n", err)
+	}
+}
+
+// replyAccept 发送端要求握手时回复接收确认：保存的文件名与发送端的不同时回复rename，否则回复accept
+func (r *WebRTCReceiver) replyAccept(metadata *FileMetadata, savePath string) {
+	if !metadata.Handshake {
+		return
+	}
+	if r.output == nil && filepath.Base(savePath) != metadata.FileName {
+		r.sendControl(ControlMessage{Type: "rename", Name: filepath.Base(savePath)})
+		return
+	}
+	r.sendControl(ControlMessage{Type: "accept"})
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// TestHTTPVerify 内容与发送端的校验和不一致时报错并删除文件，--no-verify时不校验，发送端未提供校验和时跳过校验
+func TestHTTPVerify(t *testing.T) {
+	content := make([]byte, 64*1024)
+	rand.Read(content)
+	sum := sha256.Sum256(content)
+	corrupted := append([]byte(nil), content...)
+	corrupted[len(corrupted)/2] ^= 0xff
+
+	mux := http.NewServeMux()
+	// 声明原文件的SHA-256，发送的内容在传输中被改动了一个字节
+	mux.HandleFunc("/corrupted", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(checksumHeader, hex.EncodeToString(sum[:]))
+		w.Header().Set("Content-Length", strconv.Itoa(len(corrupted)))
+		w.Write(corrupted)
+	})
+	mux.HandleFunc("/unverified", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+		w.Write(content)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	dir := t.TempDir()
+	// 每次下载保存到单独的目录，文件名取自URL
+	download := func(path string, noVerify bool) (string, error) {
+		saveDir, err := os.MkdirTemp(dir, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		receiver := NewHTTPReceiver(server.URL+path, saveDir)
+		receiver.noVerify = noVerify
+		_, err = receiver.Start(context.Background())
+		return filepath.Join(saveDir, strings.TrimPrefix(path, "/")), err
+	}
+
+	t.Run("corrupted", func(t *testing.T) {
+		savePath, err := download("/corrupted", false)
+		if err == nil || !strings.Contains(err.Error(), "文件校验失败") {
+			t.Fatalf("内容与校验和不一致时应校验失败，实际: %v", err)
+		}
+		if _, err := os.Stat(savePath); !os.IsNotExist(err) {
+			t.Fatal("校验失败后没有删除文件")
+		}
+	})
+	t.Run("no verify", func(t *testing.T) {
+		savePath, err := download("/corrupted", true)
+		if err != nil {
+			t.Fatalf("--no-verify时下载失败: %v", err)
+		}
+		if got, _ := os.ReadFile(savePath); !bytes.Equal(got, corrupted) {
+			t.Fatal("--no-verify时保存的内容与收到的内容不一致")
+		}
+	})
+	t.Run("no checksum", func(t *testing.T) {
+		savePath, err := download("/unverified", false)
+		if err != nil {
+			t.Fatalf("发送端未提供校验和时下载失败: %v", err)
+		}
+		if got, _ := os.ReadFile(savePath); !bytes.Equal(got, content) {
+			t.Fatal("发送端未提供校验和时保存的内容不一致")
+		}
+	})
+}
+
+// TestHTTPEmptyFile HTTP模式发送0字节的文件：接收端创建大小为0的文件，校验通过后正常完成
+func TestHTTPEmptyFile(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "empty.txt")
+	if err := os.WriteFile(src, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	mux := http.NewServeMux()
+	registerFileHandlers(mux, []string{src}, newLazyChecksum(src, defaultChecksumAlgo), nil)
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	saveDir := t.TempDir()
+	result, err := NewHTTPReceiver(server.URL+"/download", saveDir).Start(context.Background())
+	if err != nil {
+		t.Fatalf("接收0字节的文件: %v", err)
+	}
+	info, err := os.Stat(filepath.Join(saveDir, "empty.txt"))
+	if err != nil {
+		t.Fatalf("接收0字节的文件后没有创建文件: %v", err)
+	}
+	if info.Size() != 0 || result.Bytes != 0 {
+		t.Fatalf("接收0字节的文件得到 %d 字节（报告 %d 字节）", info.Size(), result.Bytes)
+	}
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// HTTP断点续传：下载先写入保存位置旁的 <文件名>.part，完成（并通过校验）后才改名为最终的文件名。
+// 下载中断（网络断开、--keep-partial取消）留下的.part文件在下次下载同一文件时续传：接收端带上 Range: bytes=n-
+// （n为.part的大小）和If-Range（发送端的ETag，确保文件没有变化）重新请求，发送端返回206时追加到.part末尾；
+// 发送端返回200（文件已变化或不支持Range）或第一次响应没有 Accept-Ranges: bytes 时清空.part从头下载。
+// 206的Content-Range必须从n开始、总大小与文件大小一致，且n加上剩余字节数等于总大小，否则同样从头下载。
+// 续传时发送端提供的整体校验和（见checksum.go）从已有部分的校验和继续计算，下载完成后校验的仍是整个文件。
+//
+// 续传前校验（receive --resume-verify）：只靠If-Range无法发现.part本身的损坏，加上该参数时接收端把已有部分的校验和
+// 放在X-Resume-Checksum请求头中（算法:十六进制值）；发送端计算自己文件前n字节的校验和，一致时返回206从n字节处续传，
+// 不一致时忽略Range返回完整文件，两种情况都在X-Resume-Verified响应头中说明结果，不一致时接收端从头重新下载。
+// 旧版发送端不认识该请求头，返回的206没有X-Resume-Verified，接收端无法确认已有部分是否正确，同样从头下载。
+
+// partFileSuffix 未完成的下载文件的后缀
+const partFileSuffix = ".part"
+
+const (
+	resumeChecksumHeader = "X-Resume-Checksum" // 请求头: 已有部分的校验和（算法:十六进制值）
+	resumeVerifiedHeader = "X-Resume-Verified" // 响应头: 发送端的比对结果
+)
+
+// X-Resume-Verified的比对结果
+const (
+	resumeMatch       = "match"       // 已有部分一致，从Range起点续传（206）
+	resumeMismatch    = "mismatch"    // 已有部分不一致，发送完整文件（200）
+	resumeUnsupported = "unsupported" // 无法解析请求头或不支持该算法，发送完整文件（200）
+)
+
+// checkResumePrefix 发送端比对file前n字节与X-Resume-Checksum请求头的值，返回比对结果
+func checkResumePrefix(file io.ReadSeeker, header string, n int64) string {
+	algo, want, ok := strings.Cut(header, ":")
+	if !ok {
+		return resumeUnsupported
+	}
+	h, err := newChecksumHash(algo)
+	if err != nil {
+		return resumeUnsupported
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return resumeMismatch
+	}
+	if _, err := io.CopyN(h, file, n); err != nil {
+		return resumeMismatch
+	}
+	if !strings.EqualFold(hex.EncodeToString(h.Sum(nil)), strings.TrimSpace(want)) {
+		return resumeMismatch
+	}
+	return resumeMatch
+}
+
+// resumeResponse 续传：partPath已有未完成的文件且发送端支持Range时关闭resp，带上Range重新请求剩余部分（verify时先由发送端校验已有部分）。
+// 返回用于下载的响应、续传起点（0表示从头下载）和已有部分的校验和状态（按sumAlgo计算，sumAlgo为空时只在verify时按默认算法计算）；
+// 不需要续传时原样返回resp
+func (r *HTTPReceiver) resumeResponse(ctx context.Context, client *http.Client, resp *http.Response, partPath string, fileSize int64, sumAlgo string, verify bool) (*http.Response, int64, hash.Hash, error) {
+	info, err := os.Stat(partPath)
+	if err != nil || !info.Mode().IsRegular() || info.Size() == 0 || fileSize <= 0 || info.Size() >= fileSize {
+		return resp, 0, nil, nil
+	}
+	if resp.Header.Get("Accept-Ranges") != "bytes" || resp.Header.Get(followHeader) != "" {
+		fmt.Println("发送端不支持续传，从头下载")
+		return resp, 0, nil, nil
+	}
+
+	n := info.Size()
+	algo := sumAlgo
+	if algo == "" && verify {
+		algo = defaultChecksumAlgo
+	}
+	var h hash.Hash
+	if algo != "" {
+		if h, err = newChecksumHash(algo); err != nil {
+			return nil, 0, nil, err
+		}
+		fmt.Printf("已有未完成的文件（%d / %d 字节），正在计算已有部分的%s...\n", n, fileSize, checksumName(algo))
+		file, err := os.Open(partPath)
+		if err != nil {
+			return nil, 0, nil, fmt.Errorf("读取未完成的文件失败: %w", err)
+		}
+		_, err = io.CopyN(h, file, n)
+		file.Close()
+		if err != nil {
+			return nil, 0, nil, fmt.Errorf("读取未完成的文件失败: %w", err)
+		}
+	} else {
+		fmt.Printf("已有未完成的文件（%d / %d 字节）\n", n, fileSize)
+	}
+	resp.Body.Close()
+
+	header := map[string]string{"Range": fmt.Sprintf("bytes=%d-", n)}
+	if verify {
+		header[resumeChecksumHeader] = algo + ":" + hex.EncodeToString(h.Sum(nil))
+	}
+	if etag := resp.Header.Get("ETag"); etag != "" {
+		header["If-Range"] = etag
+	}
+	resumed, err := r.request(ctx, client, header)
+	if err != nil {
+		return nil, 0, nil, err
+	}
+	switch resumed.StatusCode {
+	case http.StatusPartialContent:
+		if verify && resumed.Header.Get(resumeVerifiedHeader) != resumeMatch {
+			resumed.Body.Close()
+			fmt.Println("发送端不支持续传前校验（版本过旧），从头重新下载")
+			return r.restartResponse(ctx, client)
+		}
+		if err := checkResumeRange(resumed, n, fileSize); err != nil {
+			resumed.Body.Close()
+			fmt.Printf("%v，从头重新下载\n", err)
+			return r.restartResponse(ctx, client)
+		}
+		if verify {
+			fmt.Printf("已有部分与发送端的文件一致，从 %d 字节处续传\n", n)
+		} else {
+			fmt.Printf("从 %d 字节处续传\n", n)
+		}
+		return resumed, n, h, nil
+	case http.StatusOK:
+		if resumed.Header.Get(resumeVerifiedHeader) == resumeMismatch {
+			fmt.Println("已有部分与发送端的文件不一致，从头重新下载")
+		} else if verify {
+			fmt.Println("发送端的文件已变化或无法校验已有部分，从头重新下载")
+		} else {
+			fmt.Println("发送端的文件已变化或不支持续传，从头重新下载")
+		}
+		return resumed, 0, nil, nil
+	default:
+		resumed.Body.Close()
+		return nil, 0, nil, fmt.Errorf("续传请求失败: %d %s", resumed.StatusCode, resumed.Status)
+	}
+}
+
+// checkResumeRange 检查续传响应的Content-Range：从n字节开始、总大小为fileSize，且n加上剩余字节数等于总大小
+func checkResumeRange(resp *http.Response, n, fileSize int64) error {
+	start, length, total, err := parseContentRange(resp.Header.Get("Content-Range"), resp.ContentLength)
+	if err != nil || resp.Header.Get("Content-Range") == "" {
+		return fmt.Errorf("发送端返回了无效的Content-Range（%q）", resp.Header.Get("Content-Range"))
+	}
+	if start != n || total != fileSize || n+length != total {
+		return fmt.Errorf("发送端返回的Content-Range（%s）与已有的 %d 字节和文件大小 %d 字节不一致", resp.Header.Get("Content-Range"), n, fileSize)
+	}
+	return nil
+}
+
+// restartResponse 放弃续传，重新请求完整文件
+func (r *HTTPReceiver) restartResponse(ctx context.Context, client *http.Client) (*http.Response, int64, hash.Hash, error) {
+	full, err := r.request(ctx, client, nil)
+	if err != nil {
+		return nil, 0, nil, err
+	}
+	if full.StatusCode != http.StatusOK {
+		full.Body.Close()
+		return nil, 0, nil, fmt.Errorf("服务器返回错误: %d %s", full.StatusCode, full.Status)
+	}
+	return full, 0, nil, nil
+}
+
+// request 向下载地址发送GET请求（带上认证信息和header中的请求头）
+func (r *HTTPReceiver) request(ctx context.Context, client *http.Client, header map[string]string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, r.downloadURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("创建请求失败: %w", err)
+	}
+	if r.httpUser != "" || r.httpPass != "" {
+		req.SetBasicAuth(r.httpUser, r.httpPass)
+	}
+	for key, value := range header {
+		req.Header.Set(key, value)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("下载失败: %w", err)
+	}
+	return resp, nil
+}
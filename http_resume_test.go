@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// TestResumeVerify HTTP续传前校验：已有部分正确时只下载剩余部分，被篡改时从头重新下载；
+// 不认识校验请求头的服务器（标准库的http.ServeFile）同样从头下载，三种情况最终内容都与源文件一致
+func TestResumeVerify(t *testing.T) {
+	const size, partial = 256 * 1024, 100 * 1024
+	dir := t.TempDir()
+	content := make([]byte, size)
+	rand.Read(content)
+	src := filepath.Join(dir, "source.bin")
+	if err := os.WriteFile(src, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+	mux := http.NewServeMux()
+	registerFileHandlers(mux, []string{src}, newLazyChecksum(src, defaultChecksumAlgo), nil)
+	mux.HandleFunc("/plain", func(w http.ResponseWriter, r *http.Request) {
+		http.ServeFile(w, r, src)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	tampered := append([]byte(nil), content[:partial]...)
+	tampered[partial/2] ^= 0xff
+	for _, c := range []struct {
+		name   string
+		path   string
+		prefix []byte
+		want   int64 // 本次下载的字节数
+	}{
+		{"intact", "/download", content[:partial], size - partial},
+		{"tampered", "/download", tampered, size},
+		{"no verify support", "/plain", content[:partial], size},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			savePath := filepath.Join(t.TempDir(), "received.bin")
+			if err := os.WriteFile(savePath+partFileSuffix, c.prefix, 0644); err != nil {
+				t.Fatal(err)
+			}
+			receiver := NewHTTPReceiver(server.URL+c.path, savePath)
+			receiver.resumeVerify = true
+			result, err := receiver.Start(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, _ := os.ReadFile(savePath); !bytes.Equal(got, content) {
+				t.Fatalf("下载后的文件与源文件不一致（%d 字节）", len(got))
+			}
+			if result.Bytes != c.want {
+				t.Fatalf("下载了 %d 字节，期望 %d 字节", result.Bytes, c.want)
+			}
+		})
+	}
+}
+
+// TestPartResume HTTP断点续传：已有的.part只下载剩余部分并在完成后改名；
+// Content-Range的总大小与文件大小不一致、服务器忽略Range（返回200）或没有Accept-Ranges时从头下载
+func TestPartResume(t *testing.T) {
+	const size, partial = 256 * 1024, 100 * 1024
+	dir := t.TempDir()
+	content := make([]byte, size)
+	rand.Read(content)
+	src := filepath.Join(dir, "source.bin")
+	if err := os.WriteFile(src, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+	mux := http.NewServeMux()
+	registerFileHandlers(mux, []string{src}, newLazyChecksum(src, defaultChecksumAlgo), nil)
+	// 续传响应的Content-Range总大小错误
+	mux.HandleFunc("/badrange", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Accept-Ranges", "bytes")
+		start, _, ok := strings.Cut(strings.TrimPrefix(r.Header.Get("Range"), "bytes="), "-")
+		n, err := strconv.Atoi(start)
+		if !ok || err != nil {
+			w.Header().Set("Content-Length", strconv.Itoa(size))
+			w.Write(content)
+			return
+		}
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", n, size-1, size+1))
+		w.Header().Set("Content-Length", strconv.Itoa(size-n))
+		w.WriteHeader(http.StatusPartialContent)
+		w.Write(content[n:])
+	})
+	// 不支持Range
+	mux.HandleFunc("/norange", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", strconv.Itoa(size))
+		w.Write(content)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	for _, c := range []struct {
+		path string
+		want int64 // 本次下载的字节数
+	}{
+		{"/download", size - partial},
+		{"/badrange", size},
+		{"/norange", size},
+	} {
+		t.Run(strings.TrimPrefix(c.path, "/"), func(t *testing.T) {
+			savePath := filepath.Join(t.TempDir(), "received.bin")
+			if err := os.WriteFile(savePath+partFileSuffix, content[:partial], 0644); err != nil {
+				t.Fatal(err)
+			}
+			result, err := NewHTTPReceiver(server.URL+c.path, savePath).Start(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, _ := os.ReadFile(savePath); !bytes.Equal(got, content) {
+				t.Fatalf("下载后的文件与源文件不一致（%d 字节）", len(got))
+			}
+			if _, err := os.Stat(savePath + partFileSuffix); !os.IsNotExist(err) {
+				t.Fatalf("下载完成后仍有 %s", savePath+partFileSuffix)
+			}
+			if result.Bytes != c.want {
+				t.Fatalf("下载了 %d 字节，期望 %d 字节", result.Bytes, c.want)
+			}
+		})
+	}
+}
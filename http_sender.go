@@ -1,98 +1,198 @@
 package main
 
 import (
+	"context"
+	"crypto/subtle"
 	"fmt"
-	"net"
 	"net/http"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
+	"time"
 )
 
 // HTTPSender HTTP文件服务器
 type HTTPSender struct {
-	filePath string
-	port     int
-	server   *http.Server
+	filePath       string
+	moreFiles      []string  // 一次发送多个文件时filePath之后的其余文件（见multi_send.go）
+	port           int
+	portRange      portRange // port为0时在此范围内选择端口（--port-range）
+	server         *http.Server
+	httpUser       string // HTTP Basic Auth用户名（与httpPass均为空时不认证）
+	httpPass       string
+	notify         bool             // 每次文件被完整下载时显示桌面通知（--notify）
+	summary        *summaryReporter // 每次文件被完整下载时输出结果行（--summary-only，见summary.go）
+	follow         bool             // 跟随模式：持续发送追加到文件的数据，直到调用StopFollow（--follow，见follow.go）
+	followStop     chan struct{}
+	followStopOnce sync.Once
+	followStopped  chan struct{} // 跟随模式下服务器关闭完成（所有下载连接已正常结束）
+	checksumAlgo   string        // 校验算法（--checksum-algo，见checksum.go）
+	limiter        *bandwidthLimiter // 所有下载连接共享的限速（--limit，nil表示不限速，见bandwidth_limit.go）
+	*canceler                    // Cancel: 关闭服务器并断开所有下载连接，Start返回errTransferCanceled
 }
 
 // NewHTTPSender 创建HTTP发送端
 func NewHTTPSender(filePath string, port int) *HTTPSender {
 	return &HTTPSender{
-		filePath: filePath,
-		port:     port,
+		filePath:      filePath,
+		port:          port,
+		followStop:    make(chan struct{}),
+		followStopped: make(chan struct{}),
+		checksumAlgo:  defaultChecksumAlgo,
+		canceler:      newCanceler(),
 	}
 }
 
-// Start 启动HTTP文件服务器
-func (s *HTTPSender) Start() error {
-	// 检查文件是否存在
-	fileInfo, err := os.Stat(s.filePath)
-	if err != nil {
-		return fmt.Errorf("文件不存在: %w", err)
+// StopFollow 结束跟随模式：各下载连接发送完已追加的数据后正常结束（作为结束标记），然后关闭服务器，Start随后返回nil
+func (s *HTTPSender) StopFollow() {
+	s.followStopOnce.Do(func() { close(s.followStop) })
+}
+
+// Start 启动HTTP文件服务器（一直运行，直到出错或调用Cancel）
+// ctx取消时（如收到Ctrl+C）调用Cancel（关闭HTTP服务器并断开所有下载连接）
+func (s *HTTPSender) Start(ctx context.Context) error {
+	defer context.AfterFunc(ctx, s.Cancel)()
+	if s.isCanceled() {
+		return errTransferCanceled
 	}
+	var fileName string
+	var remote *remoteFile
+	if isRemoteURL(s.filePath) {
+		// 远程文件：先请求一次确认可用，每次下载时再重新获取（见remote.go）
+		info, body, err := openRemoteFile(s.filePath)
+		if err != nil {
+			return err
+		}
+		body.Close()
+		remote = info
+		fileName = remote.Name
+		describeRemoteFile(remote)
+	} else {
+		// 检查文件是否存在
+		fileInfo, err := os.Stat(s.filePath)
+		if err != nil {
+			return fmt.Errorf("文件不存在: %w", err)
+		}
 
-	fileName := filepath.Base(s.filePath)
-	fileSize := fileInfo.Size()
+		fileName = filepath.Base(s.filePath)
+		fileSize := fileInfo.Size()
+		if fileInfo.IsDir() {
+			// 目录打包为tar发送（见dir_archive.go），每次下载时重新打包
+			archive, err := newDirArchive(s.filePath)
+			if err != nil {
+				return err
+			}
+			archive.describe()
+			fileName, fileSize = archive.name, archive.size
+		}
 
-	fmt.Printf("文件: %s\n", fileName)
-	fmt.Printf("大小: %d 字节 (%.2f MB)\n", fileSize, float64(fileSize)/1024/1024)
+		fmt.Printf("文件: %s\n", fileName)
+		fmt.Printf("大小: %d 字节 (%.2f MB)\n", fileSize, float64(fileSize)/1024/1024)
+	}
+	if s.follow {
+		fmt.Println("跟随模式: 发送现有内容后持续发送追加的数据，按 Ctrl+C 结束")
+	}
 
-	// 获取本机IP地址
-	localIP, err := getLocalIP()
+	// 获取本机IP地址（按适合局域网分享的程度排序）
+	localIPs, err := getLocalIPs()
 	if err != nil {
 		return fmt.Errorf("获取本机IP失败: %w", err)
 	}
+	localIP := localIPs[0].IP
 
-	// 如果未指定端口，使用随机端口
-	actualPort := s.port
-	if actualPort == 0 {
-		// 使用随机端口
-		listener, err := net.Listen("tcp", ":0")
-		if err != nil {
-			return fmt.Errorf("监听端口失败: %w", err)
-		}
-		actualPort = listener.Addr().(*net.TCPAddr).Port
-		listener.Close()
+	// 如果未指定端口，使用随机端口（指定了--port-range时在范围内选择）
+	actualPort, err := pickListenPort(s.port, s.portRange)
+	if err != nil {
+		return err
 	}
 
 	// 创建HTTP服务器
 	mux := http.NewServeMux()
-	mux.HandleFunc("/download", func(w http.ResponseWriter, r *http.Request) {
-		// 设置响应头
-		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", fileName))
-		w.Header().Set("Content-Type", "application/octet-stream")
-		w.Header().Set("Content-Length", fmt.Sprintf("%d", fileSize))
-
-		// 打开文件
-		file, err := os.Open(s.filePath)
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
+	servedFiles := append([]string{s.filePath}, s.moreFiles...)
+	var onDownloaded func(size int64, elapsed time.Duration)
+	if s.notify || s.summary != nil {
+		onDownloaded = func(size int64, elapsed time.Duration) {
+			if s.notify {
+				notifyDesktop("文件发送完成", fmt.Sprintf("%s 已被完整下载", fileName))
+			}
+			s.summary.OK(s.filePath, size, elapsed)
 		}
-		defer file.Close()
-
-		// 发送文件
-		http.ServeContent(w, r, fileName, fileInfo.ModTime(), file)
-	})
+	}
+	if remote != nil {
+		// 远程文件只转发，不提供校验和、Range续传和打包下载
+		mux.HandleFunc("/download", func(w http.ResponseWriter, r *http.Request) {
+			startTime := time.Now()
+			if sent, ok := serveRemote(w, r, remote.URL); ok && onDownloaded != nil {
+				onDownloaded(sent, time.Since(startTime))
+			}
+		})
+	} else if s.follow {
+		// 文件仍在增长，不提供校验和、Range续传和打包下载
+		mux.HandleFunc("/download", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", fileName))
+			w.Header().Set("Content-Type", "application/octet-stream")
+			startTime := time.Now()
+			if sent, ok := serveFollow(w, r, s.filePath, s.followStop); ok && onDownloaded != nil {
+				onDownloaded(sent, time.Since(startTime))
+			}
+		})
+	} else {
+		// 后台预先计算校验和，供接收端比对（--skip-existing）
+		checksum := newLazyChecksum(s.filePath, s.checksumAlgo)
+		go checksum.Get()
+		registerFileHandlers(mux, servedFiles, checksum, onDownloaded)
+	}
 
 	s.server = &http.Server{
 		Addr:    fmt.Sprintf(":%d", actualPort),
-		Handler: mux,
+		Handler: withBasicAuth(s.httpUser, s.httpPass, withBandwidthLimit(s.limiter, mux)),
+	}
+	s.onCancel(func() { s.server.Close() })
+	if s.follow {
+		// StopFollow后等待各下载连接发送完剩余数据再关闭服务器
+		go func() {
+			defer close(s.followStopped)
+			select {
+			case <-s.followStop:
+			case <-s.cancelDone():
+				return
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			defer cancel()
+			if err := s.server.Shutdown(ctx); err != nil {
+				s.server.Close()
+			}
+		}()
 	}
 
 	// 生成下载命令
-	downloadURL := fmt.Sprintf("http://%s:%d/download", localIP, actualPort)
+	downloadURL := localHTTPURL(localIP, actualPort, "/download")
 	downloadCmd := fmt.Sprintf("ftf.exe receive \"%s\" \"%s\"", downloadURL, fileName)
+	if len(servedFiles) > 1 {
+		// 多个文件：命令下载打包的zip，单个文件按编号下载（--pick）
+		downloadCmd = fmt.Sprintf("ftf.exe receive \"%s\"", localHTTPURL(localIP, actualPort, "/download.zip"))
+	}
 
 	fmt.Println("\n" + strings.Repeat("=", 70))
 	fmt.Println("文件服务器已启动!")
 	fmt.Println(strings.Repeat("=", 70))
 	fmt.Printf("下载地址: %s\n", downloadURL)
+	printLocalIPNotes(localIPs)
+	fmt.Printf("分享链接: %s\n", (&MagicLink{Mode: linkModeHTTP, HTTPURL: downloadURL}).String())
+	if len(servedFiles) > 1 {
+		fmt.Printf("打包下载: %s\n", localHTTPURL(localIP, actualPort, "/download.zip"))
+	}
 	fmt.Println(strings.Repeat("-", 70))
 	fmt.Println("复制以下命令到另一台电脑执行:")
 	fmt.Println(strings.Repeat("-", 70))
 	fmt.Printf("%s\n", downloadCmd)
+	if len(servedFiles) > 1 {
+		fmt.Printf("只下载其中的文件: ftf.exe receive \"%s\" --pick <编号或文件名>\n", downloadURL)
+	}
+	if s.httpUser != "" || s.httpPass != "" {
+		fmt.Println("下载需要认证，请在命令后添加: --http-user <用户名> --http-pass <密码>")
+	}
 	fmt.Println(strings.Repeat("=", 70))
 	fmt.Printf("\n服务器运行中，按 Ctrl+C 停止...\n\n")
 
@@ -100,19 +200,33 @@ func (s *HTTPSender) Start() error {
 	if err := s.server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
 		return fmt.Errorf("服务器错误: %w", err)
 	}
+	if s.follow {
+		// Shutdown使ListenAndServe立即返回，等待下载连接正常结束
+		<-s.followStopped
+	}
 
-	return nil
+	return s.canceledOr(nil)
 }
 
-// getLocalIP 获取本机局域网IP地址
-func getLocalIP() (string, error) {
-	conn, err := net.Dial("udp", "8.8.8.8:80")
-	if err != nil {
-		return "", err
-	}
-	defer conn.Close()
-
-	localAddr := conn.LocalAddr().(*net.UDPAddr)
-	return localAddr.IP.String(), nil
+// fileETag 根据文件大小和修改时间生成强ETag
+func fileETag(info os.FileInfo) string {
+	return fmt.Sprintf("\"%x-%x\"", info.Size(), info.ModTime().UnixNano())
 }
 
+// withBasicAuth 为HTTP处理器添加Basic Auth认证（用户名和密码均为空时不认证）
+func withBasicAuth(user, pass string, next http.Handler) http.Handler {
+	if user == "" && pass == "" {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reqUser, reqPass, ok := r.BasicAuth()
+		userMatch := subtle.ConstantTimeCompare([]byte(reqUser), []byte(user)) == 1
+		passMatch := subtle.ConstantTimeCompare([]byte(reqPass), []byte(pass)) == 1
+		if !ok || !userMatch || !passMatch {
+			w.Header().Set("WWW-Authenticate", `Basic realm="ftf", charset="UTF-8"`)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,272 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// registerFileHandlers 注册文件下载相关的路由（HTTPSender和HybridSender共用）
+//   - /download           下载文件（?file=编号或文件名，默认第一个文件）
+//   - /download.zip       所有文件实时打包为zip下载（便于浏览器一次下载全部文件）
+//   - /manifest           文件清单（JSON，包括大小和已计算出的校验和），供接收端 list 查看和 --pick 选择
+//
+// checksum为第一个文件的校验和（其他文件不提供校验和头）；onDownloaded不为nil时在/download把文件发送到末尾后调用，
+// 参数为文件大小和这次请求的耗时。多个下载同时进行时定期显示所有下载的总览（见serve_progress.go）
+func registerFileHandlers(mux *http.ServeMux, servedFiles []string, checksum *lazyChecksum, onDownloaded func(size int64, elapsed time.Duration)) {
+	tracker := newServeTracker()
+	mux.HandleFunc("/download", func(w http.ResponseWriter, r *http.Request) {
+		path, err := selectServedFile(servedFiles, r.URL.Query().Get("file"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		fileInfo, err := os.Stat(path)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if fileInfo.IsDir() {
+			// 目录实时打包为tar发送（见dir_archive.go）
+			if path == servedFiles[0] && checksum != nil {
+				if sum, err := checksum.Get(); err == nil {
+					setChecksumHeaders(w.Header(), checksum.algo, sum)
+				}
+			}
+			startTime := time.Now()
+			if sent, ok := serveArchive(w, r, path, tracker); ok && onDownloaded != nil {
+				onDownloaded(sent, time.Since(startTime))
+			}
+			return
+		}
+
+		// 设置响应头
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", filepath.Base(path)))
+		w.Header().Set("Content-Type", "application/octet-stream")
+		if path == servedFiles[0] && checksum != nil {
+			if sum, err := checksum.Get(); err == nil {
+				setChecksumHeaders(w.Header(), checksum.algo, sum)
+			}
+		}
+		// 强ETag：serveFile据此处理If-Range，文件变化后续传请求会得到完整文件
+		w.Header().Set("ETag", fileETag(fileInfo))
+
+		// 发送文件（支持Range续传，并显示每个连接的发送进度）
+		startTime := time.Now()
+		if serveFile(w, r, path, fileInfo, tracker) && onDownloaded != nil {
+			onDownloaded(fileInfo.Size(), time.Since(startTime))
+		}
+	})
+
+	mux.HandleFunc("/download.zip", func(w http.ResponseWriter, r *http.Request) {
+		serveZip(w, r, servedFiles, tracker)
+	})
+
+	mux.HandleFunc("/manifest", func(w http.ResponseWriter, r *http.Request) {
+		serveManifest(w, r, servedFiles, checksum)
+	})
+}
+
+// byteRange 请求的字节范围 [start, start+length)
+type byteRange struct {
+	start  int64
+	length int64
+}
+
+// parseRange 解析单个Range请求头（bytes=a-b、bytes=a-、bytes=-n）
+// 返回ok=false表示忽略Range发送完整文件（如多段Range）；err不为nil表示范围无法满足
+func parseRange(header string, size int64) (br byteRange, ok bool, err error) {
+	if !strings.HasPrefix(header, "bytes=") {
+		return byteRange{}, false, nil
+	}
+	spec := strings.TrimSpace(strings.TrimPrefix(header, "bytes="))
+	if strings.Contains(spec, ",") {
+		return byteRange{}, false, nil // 不支持多段Range，按完整文件处理
+	}
+
+	startStr, endStr, found := strings.Cut(spec, "-")
+	if !found {
+		return byteRange{}, false, fmt.Errorf("无效的Range: %s", header)
+	}
+	startStr = strings.TrimSpace(startStr)
+	endStr = strings.TrimSpace(endStr)
+
+	if startStr == "" {
+		// bytes=-n：最后n个字节
+		n, err := strconv.ParseInt(endStr, 10, 64)
+		if err != nil || n <= 0 {
+			return byteRange{}, false, fmt.Errorf("无效的Range: %s", header)
+		}
+		if n > size {
+			n = size
+		}
+		return byteRange{start: size - n, length: n}, true, nil
+	}
+
+	start, err := strconv.ParseInt(startStr, 10, 64)
+	if err != nil || start < 0 {
+		return byteRange{}, false, fmt.Errorf("无效的Range: %s", header)
+	}
+	if start >= size {
+		return byteRange{}, false, fmt.Errorf("Range超出文件大小: %s", header)
+	}
+
+	end := size - 1
+	if endStr != "" {
+		end, err = strconv.ParseInt(endStr, 10, 64)
+		if err != nil || end < start {
+			return byteRange{}, false, fmt.Errorf("无效的Range: %s", header)
+		}
+		if end >= size {
+			end = size - 1
+		}
+	}
+	return byteRange{start: start, length: end - start + 1}, true, nil
+}
+
+// countingWriter 统计已写入字节数的Writer（计数可被其他goroutine原子读取）
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	atomic.AddInt64(&c.n, int64(n))
+	return n, err
+}
+
+// Count 已写入字节数
+func (c *countingWriter) Count() int64 {
+	return atomic.LoadInt64(&c.n)
+}
+
+// serveFile 发送文件内容并在发送端终端显示每个连接的下载进度
+// 支持单段Range请求和If-Range（与ETag或Last-Modified比较），调用前需设置好ETag响应头
+// 返回是否已把文件发送到末尾（完整下载或续传完成）；tracker不为nil时计入下载总览
+func serveFile(w http.ResponseWriter, r *http.Request, path string, info os.FileInfo, tracker *serveTracker) bool {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return false
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return false
+	}
+	defer file.Close()
+
+	size := info.Size()
+	modTime := info.ModTime().UTC().Truncate(time.Second)
+	w.Header().Set("Accept-Ranges", "bytes")
+	w.Header().Set("Last-Modified", modTime.Format(http.TimeFormat))
+
+	// 默认发送完整文件
+	status := http.StatusOK
+	sendRange := byteRange{start: 0, length: size}
+
+	if rangeHeader := r.Header.Get("Range"); rangeHeader != "" && ifRangeMatches(r, w.Header().Get("ETag"), modTime) {
+		br, ok, err := parseRange(rangeHeader, size)
+		if err != nil {
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes */%d", size))
+			http.Error(w, err.Error(), http.StatusRequestedRangeNotSatisfiable)
+			return false
+		}
+		// 接收端附带了已有部分的校验和（--resume-verify，见http_resume.go）：不一致时发送完整文件
+		if resumeSum := r.Header.Get(resumeChecksumHeader); ok && resumeSum != "" {
+			result := checkResumePrefix(file, resumeSum, br.start)
+			w.Header().Set(resumeVerifiedHeader, result)
+			if result != resumeMatch {
+				fmt.Printf("[%s] 接收端已有部分的校验结果: %s，发送完整文件\n", r.RemoteAddr, result)
+				ok = false
+			}
+		}
+		if ok {
+			status = http.StatusPartialContent
+			sendRange = br
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", br.start, br.start+br.length-1, size))
+		}
+	}
+
+	w.Header().Set("Content-Length", strconv.FormatInt(sendRange.length, 10))
+	w.WriteHeader(status)
+	if r.Method == http.MethodHead {
+		return false
+	}
+
+	if _, err := file.Seek(sendRange.start, io.SeekStart); err != nil {
+		return false
+	}
+
+	// 统计发送进度
+	counter := &countingWriter{w: w}
+	done := make(chan struct{})
+	go reportServeProgress(r.RemoteAddr, sendRange, size, counter, done)
+	download := tracker.Begin(r.RemoteAddr, path, sendRange.start, size, counter)
+
+	_, copyErr := io.CopyN(counter, file, sendRange.length)
+	close(done)
+	tracker.End(download)
+
+	sent := counter.Count()
+	if copyErr != nil {
+		fmt.Printf("[%s] 连接中断: 已发送 %d / %d 字节 (%v)\n", r.RemoteAddr, sent, sendRange.length, copyErr)
+		return false
+	}
+	return sendRange.start+sendRange.length == size
+}
+
+// ifRangeMatches 判断If-Range条件是否满足（未设置If-Range时视为满足）
+func ifRangeMatches(r *http.Request, etag string, modTime time.Time) bool {
+	ifRange := r.Header.Get("If-Range")
+	if ifRange == "" {
+		return true
+	}
+	if strings.HasPrefix(ifRange, "\"") {
+		return etag != "" && ifRange == etag
+	}
+	t, err := http.ParseTime(ifRange)
+	return err == nil && t.Equal(modTime)
+}
+
+// reportServeProgress 周期性打印某个下载连接的发送进度，done关闭时打印结果
+func reportServeProgress(remoteAddr string, br byteRange, size int64, counter *countingWriter, done <-chan struct{}) {
+	startTime := time.Now()
+	if br.start > 0 {
+		fmt.Printf("[%s] 开始下载（从 %d 字节处续传）\n", remoteAddr, br.start)
+	} else {
+		fmt.Printf("[%s] 开始下载\n", remoteAddr)
+	}
+
+	ticker := time.NewTicker(2 * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			sent := counter.Count()
+			elapsed := time.Since(startTime).Seconds()
+			progress := float64(br.start+sent) / float64(size) * 100
+			fmt.Printf("[%s] 已发送: %.2f%% | %d / %d 字节 | 速度: %.2f MB/s\n",
+				remoteAddr, progress, br.start+sent, size, float64(sent)/elapsed/1024/1024)
+		case <-done:
+			sent := counter.Count()
+			if sent == br.length {
+				elapsed := time.Since(startTime).Seconds()
+				speed := 0.0
+				if elapsed > 0 {
+					speed = float64(sent) / elapsed / 1024 / 1024
+				}
+				fmt.Printf("[%s] 下载完成: %d 字节，耗时 %.2f 秒，平均速度 %.2f MB/s\n", remoteAddr, sent, elapsed, speed)
+			}
+			return
+		}
+	}
+}
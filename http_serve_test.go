@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestRangeRequest 下载地址声明Accept-Ranges: bytes，bytes=100-199返回206和对应的100字节，
+// 超出文件大小的Range返回416（curl -C、wget -c等工具依赖这些响应续传）
+func TestRangeRequest(t *testing.T) {
+	const size = 4096
+	content := make([]byte, size)
+	rand.Read(content)
+	src := filepath.Join(t.TempDir(), "source.bin")
+	if err := os.WriteFile(src, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+	mux := http.NewServeMux()
+	registerFileHandlers(mux, []string{src}, newLazyChecksum(src, defaultChecksumAlgo), nil)
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	get := func(rangeHeader string) (*http.Response, []byte) {
+		t.Helper()
+		req, err := http.NewRequest(http.MethodGet, server.URL+"/download", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Range", rangeHeader)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp, body
+	}
+
+	t.Run("partial", func(t *testing.T) {
+		resp, body := get("bytes=100-199")
+		if resp.StatusCode != http.StatusPartialContent {
+			t.Fatalf("返回 %d，期望206", resp.StatusCode)
+		}
+		if got := resp.Header.Get("Accept-Ranges"); got != "bytes" {
+			t.Fatalf("Accept-Ranges为 %q，期望bytes", got)
+		}
+		if got, want := resp.Header.Get("Content-Range"), fmt.Sprintf("bytes 100-199/%d", size); got != want {
+			t.Fatalf("Content-Range为 %q，期望 %q", got, want)
+		}
+		if resp.ContentLength != 100 || !bytes.Equal(body, content[100:200]) {
+			t.Fatalf("返回了 %d 字节（Content-Length %d），与文件的对应部分不一致", len(body), resp.ContentLength)
+		}
+	})
+
+	t.Run("unsatisfiable", func(t *testing.T) {
+		if resp, _ := get(fmt.Sprintf("bytes=%d-", size)); resp.StatusCode != http.StatusRequestedRangeNotSatisfiable {
+			t.Fatalf("超出文件大小的Range返回 %d，期望416", resp.StatusCode)
+		}
+	})
+}
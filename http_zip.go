@@ -0,0 +1,110 @@
+package main
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// zipArchiveName 打包下载的文件名：单个文件为"<文件名>.zip"，多个文件为"files.zip"
+func zipArchiveName(filePaths []string) string {
+	if len(filePaths) == 1 {
+		return filepath.Base(filePaths[0]) + ".zip"
+	}
+	return "files.zip"
+}
+
+// serveZip 将所有文件实时打包为zip并以流的方式发送（不在内存中缓存整个压缩包），tracker不为nil时计入下载总览
+func serveZip(w http.ResponseWriter, r *http.Request, filePaths []string, tracker *serveTracker) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// 打包前检查所有文件，避免发送了部分内容后才发现文件不存在
+	for _, path := range filePaths {
+		info, err := os.Stat(path)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if info.IsDir() {
+			http.Error(w, fmt.Sprintf("%s 是目录，请从 /download 下载（tar打包）", filepath.Base(path)), http.StatusBadRequest)
+			return
+		}
+	}
+
+	// 压缩包大小事先未知，使用分块传输（不设置Content-Length）
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", zipArchiveName(filePaths)))
+	w.Header().Set("Content-Type", "application/zip")
+	if r.Method == http.MethodHead {
+		return
+	}
+
+	archiveName := zipArchiveName(filePaths)
+	counter := &countingWriter{w: w}
+	download := tracker.Begin(r.RemoteAddr, archiveName, 0, -1, counter)
+	defer tracker.End(download)
+	fmt.Printf("[%s] 开始打包下载 %s（%d 个文件）\n", r.RemoteAddr, archiveName, len(filePaths))
+
+	zw := zip.NewWriter(counter)
+	usedNames := make(map[string]int)
+	for i, path := range filePaths {
+		name := uniqueZipEntryName(filepath.Base(path), usedNames)
+		tracker.SetEntry(download, fmt.Sprintf("%d/%d %s", i+1, len(filePaths), name))
+		if err := addFileToZip(zw, path, name); err != nil {
+			// 响应头已发送，只能中断连接，接收端会得到不完整的压缩包
+			fmt.Printf("[%s] 打包文件失败 %s: %v（已发送 %d 字节）\n", r.RemoteAddr, path, err, counter.Count())
+			return
+		}
+	}
+
+	if err := zw.Close(); err != nil {
+		fmt.Printf("完成压缩包失败: %v\n", err)
+		return
+	}
+	fmt.Printf("[%s] 打包下载完成: %d 字节\n", r.RemoteAddr, counter.Count())
+}
+
+// addFileToZip 将单个文件写入压缩包
+func addFileToZip(zw *zip.Writer, path, name string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	header, err := zip.FileInfoHeader(info)
+	if err != nil {
+		return err
+	}
+	header.Name = name
+	header.Method = zip.Deflate
+
+	writer, err := zw.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(writer, file)
+	return err
+}
+
+// uniqueZipEntryName 同名文件在压缩包中追加序号，如 a.txt、a (1).txt
+func uniqueZipEntryName(name string, used map[string]int) string {
+	count := used[name]
+	used[name] = count + 1
+	if count == 0 {
+		return name
+	}
+	ext := filepath.Ext(name)
+	return fmt.Sprintf("%s (%d)%s", strings.TrimSuffix(name, ext), count, ext)
+}
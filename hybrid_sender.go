@@ -2,27 +2,48 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"net"
 	"net/http"
 	"os"
 	"path/filepath"
 	"strings"
 	"sync"
+	"time"
 )
 
 // HybridSender 混合发送器，同时支持HTTP和WebRTC
 type HybridSender struct {
-	filePath     string
-	port         int
-	stunServer   string
-	turnServer   string
-	signalingURL string
-	roomID       string
-	debug        bool
-	httpServer   *http.Server
-	webrtcSender *WebRTCSender
-	wg           sync.WaitGroup
+	filePath       string
+	moreFiles      []string  // 一次发送多个文件时filePath之后的其余文件（见multi_send.go）
+	compress       bool      // WebRTC传输时按gzip压缩文件数据（HTTP下载不压缩，见compress.go）
+	limiter        *bandwidthLimiter // HTTP下载和WebRTC传输共享的限速（--limit，见bandwidth_limit.go）
+	chunkSize      int               // WebRTC传输每条消息携带的数据量（--chunk-size，0表示默认）
+	port           int
+	portRange      portRange // port为0时在此范围内选择端口（--port-range）
+	stunServer     string
+	turnServer     string
+	signalingURL   string
+	roomID         string
+	debug          bool
+	stallTimeout   time.Duration
+	graph          bool   // WebRTC传输时显示速度曲线
+	reliableAck    bool   // WebRTC传输时要求接收端确认字节偏移
+	minSpeed       int64  // WebRTC传输的最低速度（字节/秒，0表示不检测）
+	relayBudget    int64  // WebRTC连接经TURN中继时最多传输的字节数（0表示不限制）
+	statsInterval  time.Duration // WebRTC连接统计的采样间隔（0表示不采样）
+	httpUser       string // HTTP Basic Auth用户名（与httpPass均为空时不认证）
+	httpPass       string
+	stopAfterFirst bool             // 任一方式成功传输一次后停止另一方式，Start随即返回
+	notify         bool             // 每次成功传输后显示桌面通知（--notify）
+	summary        *summaryReporter // 每次成功传输后输出结果行（--summary-only，见summary.go）
+	dcOptions      dcOptions        // WebRTC传输的DataChannel有序/可靠性设置
+	checksumAlgo   string           // 校验算法（--checksum-algo，HTTP和WebRTC共用同一个校验和）
+	httpServer     *http.Server
+	webrtcSender   *WebRTCSender
+	checksum       *lazyChecksum
+	wg             sync.WaitGroup
+	*canceler      // Stop/Cancel: 同时停止HTTP服务器和WebRTC发送端
 }
 
 // NewHybridSender 创建混合发送器
@@ -34,11 +55,21 @@ func NewHybridSender(filePath string, port int, stunServer, turnServer, signalin
 		turnServer:   turnServer,
 		signalingURL: signalingURL,
 		roomID:       roomID,
+		stallTimeout: defaultStallTimeout,
+		dcOptions:    defaultDCOptions(),
+		checksumAlgo: defaultChecksumAlgo,
+		canceler:     newCanceler(),
 	}
 }
 
-// Start 启动混合发送器（同时启动HTTP和WebRTC）
-func (s *HybridSender) Start() error {
+// Start 启动混合发送器（同时启动HTTP和WebRTC），一直运行到调用Stop
+// ctx取消时（如收到Ctrl+C）调用Cancel（关闭HTTP服务器并取消WebRTC发送）
+func (s *HybridSender) Start(ctx context.Context) error {
+	defer context.AfterFunc(ctx, s.Cancel)()
+	if s.isCanceled() {
+		return errTransferCanceled
+	}
+
 	// 检查文件是否存在
 	fileInfo, err := os.Stat(s.filePath)
 	if err != nil {
@@ -47,51 +78,95 @@ func (s *HybridSender) Start() error {
 
 	fileName := filepath.Base(s.filePath)
 	fileSize := fileInfo.Size()
+	var archive *dirArchive
+	if fileInfo.IsDir() {
+		// 目录打包为tar发送（见dir_archive.go），WebRTC发送端使用同一个打包计划
+		if archive, err = newDirArchive(s.filePath); err != nil {
+			return err
+		}
+		fileName, fileSize = archive.name, archive.size
+	}
 
 	// 生成随机文件ID（用于WebRTC）
-	fileID := generateFileID()
+	fileID := generateUniqueFileID()
+	defer releaseFileID(fileID)
 
 	fmt.Println("=== 文件传输服务 ===")
 	fmt.Printf("文件: %s\n", fileName)
 	fmt.Printf("大小: %d 字节 (%.2f MB)\n", fileSize, float64(fileSize)/1024/1024)
 	fmt.Printf("文件编号: %s\n", fileID)
+	if archive != nil {
+		archive.describe()
+	}
 
-	// 获取本机IP地址
-	localIP, err := getLocalIP()
+	// 获取本机IP地址（按适合局域网分享的程度排序）
+	localIPs, err := getLocalIPs()
 	if err != nil {
 		return fmt.Errorf("获取本机IP失败: %w", err)
 	}
+	localIP := localIPs[0].IP
+
+	// 如果未指定端口，使用随机端口（指定了--port-range时在范围内选择）
+	actualPort, err := pickListenPort(s.port, s.portRange)
+	if err != nil {
+		return err
+	}
+
+	// 后台预先计算校验和，供接收端校验和比对（--skip-existing）
+	s.checksum = newLazyChecksum(s.filePath, s.checksumAlgo)
+	go s.checksum.Get()
 
-	// 如果未指定端口，使用随机端口
-	actualPort := s.port
-	if actualPort == 0 {
-		// 使用随机端口
-		listener, err := net.Listen("tcp", ":0")
-		if err != nil {
-			return fmt.Errorf("监听端口失败: %w", err)
+	// 成功完成一次传输的方式（--stop-after-first）
+	delivered := make(chan string, 2)
+	deliver := func(via string, size int64, elapsed time.Duration) {
+		if s.notify {
+			notifyDesktop("文件发送完成", fmt.Sprintf("%s 已通过%s发送", fileName, via))
+		}
+		s.summary.OK(s.filePath, size, elapsed)
+		select {
+		case delivered <- via:
+		default:
 		}
-		actualPort = listener.Addr().(*net.TCPAddr).Port
-		listener.Close()
 	}
 
 	// 启动HTTP服务器（在goroutine中）
 	s.wg.Add(1)
 	go func() {
 		defer s.wg.Done()
-		if err := s.startHTTPServer(fileName, fileSize, fileInfo, localIP, actualPort); err != nil && err != http.ErrServerClosed {
+		if err := s.startHTTPServer(fileName, fileSize, fileInfo, localIP, actualPort, func(size int64, elapsed time.Duration) {
+			deliver("HTTP", size, elapsed)
+		}); err != nil && err != http.ErrServerClosed {
 			fmt.Printf("HTTP服务器错误: %v\n", err)
 		}
 	}()
 
 	// 启动WebRTC发送端（在goroutine中）
+	s.webrtcSender = NewWebRTCSender(s.filePath, s.stunServer, s.turnServer, s.signalingURL, s.roomID)
+	// 设置文件ID和debug标志
+	s.webrtcSender.fileID = fileID
+	s.webrtcSender.debug = s.debug
+	s.webrtcSender.embedded = true
+	s.webrtcSender.stallTimeout = s.stallTimeout
+	s.webrtcSender.graph = s.graph
+	s.webrtcSender.reliableAck = s.reliableAck
+	s.webrtcSender.minSpeed = s.minSpeed
+	s.webrtcSender.relayBudget = s.relayBudget
+	s.webrtcSender.statsInterval = s.statsInterval
+	s.webrtcSender.dcOptions = s.dcOptions
+	s.webrtcSender.checksum = s.checksum
+	s.webrtcSender.archive = archive
+	s.webrtcSender.moreFiles = s.moreFiles
+	s.webrtcSender.compress = s.compress
+	s.webrtcSender.limiter = s.limiter
+	s.webrtcSender.chunkSize = s.chunkSize
+	s.onCancel(s.webrtcSender.Cancel)
 	s.wg.Add(1)
 	go func() {
 		defer s.wg.Done()
-		s.webrtcSender = NewWebRTCSender(s.filePath, s.stunServer, s.turnServer, s.signalingURL, s.roomID)
-		// 设置文件ID和debug标志
-		s.webrtcSender.fileID = fileID
-		s.webrtcSender.debug = s.debug
-		if err := s.webrtcSender.Start(); err != nil {
+		result, err := s.webrtcSender.Start(context.Background()) // 由s的ctx或Cancel经onCancel取消
+		if err == nil {
+			deliver("WebRTC", result.Bytes, result.Duration)
+		} else if !errors.Is(err, errTransferCanceled) {
 			fmt.Printf("WebRTC发送错误: %v\n", err)
 		}
 	}()
@@ -101,61 +176,102 @@ func (s *HybridSender) Start() error {
 	fmt.Println("文件传输服务已启动!")
 	fmt.Println(strings.Repeat("=", 70))
 	fmt.Println("\n【局域网下载 - HTTP模式】")
-	fmt.Printf("内网地址: http://%s:%d/download\n", localIP, actualPort)
-	fmt.Printf("下载命令: ftf.exe receive \"http://%s:%d/download\"\n", localIP, actualPort)
+	downloadURL := localHTTPURL(localIP, actualPort, "/download")
+	fmt.Printf("内网地址: %s\n", downloadURL)
+	printLocalIPNotes(localIPs)
+	if len(s.moreFiles) > 0 {
+		// 多个文件：HTTP下载打包的zip，单个文件按编号下载（--pick）
+		fmt.Printf("打包下载: %s\n", localHTTPURL(localIP, actualPort, "/download.zip"))
+		fmt.Printf("下载命令: ftf.exe receive \"%s\"\n", localHTTPURL(localIP, actualPort, "/download.zip"))
+		fmt.Printf("只下载其中的文件: ftf.exe receive \"%s\" --pick <编号或文件名>\n", downloadURL)
+	} else {
+		fmt.Printf("下载命令: ftf.exe receive \"%s\"\n", downloadURL)
+	}
+	if s.httpUser != "" || s.httpPass != "" {
+		fmt.Println("下载需要认证，请在命令后添加: --http-user <用户名> --http-pass <密码>")
+	}
 	fmt.Println("\n【跨网络传输 - WebRTC模式】")
 	fmt.Printf("文件编号: %s\n", fileID)
 	fmt.Printf("接收命令: ftf.exe receive \"%s\"\n", fileID)
+	fmt.Println("\n【分享链接 - 自动选择模式】")
+	fmt.Printf("接收命令: ftf.exe receive \"%s\"\n", s.magicLink(fileID, localIP, actualPort).String())
 	fmt.Println(strings.Repeat("=", 70))
-	fmt.Printf("\n服务运行中，按 Ctrl+C 停止...\n\n")
+	if s.stopAfterFirst {
+		fmt.Printf("\n服务运行中，任一方式传输完成后自动退出，按 Ctrl+C 停止...\n\n")
+	} else {
+		fmt.Printf("\n服务运行中，按 Ctrl+C 停止...\n\n")
+	}
 
 	// 等待所有goroutine完成
-	s.wg.Wait()
-	return nil
+	finished := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(finished)
+	}()
+	if s.stopAfterFirst {
+		select {
+		case via := <-delivered:
+			fmt.Printf("\n已通过%s完成一次传输，停止其他传输方式（--stop-after-first）\n", via)
+			s.stopRemaining()
+		case <-finished:
+		case <-s.cancelDone():
+		}
+	}
+	<-finished
+	return s.canceledOr(nil)
+}
+
+// magicLink 生成混合模式的分享链接（接收端优先尝试局域网HTTP，不可达时使用WebRTC；多个文件时HTTP下载打包的zip）
+func (s *HybridSender) magicLink(fileID, localIP string, port int) *MagicLink {
+	httpPath := "/download"
+	if len(s.moreFiles) > 0 {
+		httpPath = "/download.zip"
+	}
+	signalingURL := s.signalingURL
+	if signalingURL == "" {
+		signalingURL = getDefaultSignalingURL()
+	}
+	return &MagicLink{
+		Mode:         linkModeAuto,
+		FileID:       fileID,
+		HTTPURL:      localHTTPURL(localIP, port, httpPath),
+		SignalingURL: signalingURL,
+		STUNServer:   s.stunServer,
+		TURNServer:   s.turnServer,
+		RoomID:       s.roomID,
+	}
 }
 
-// startHTTPServer 启动HTTP服务器
-func (s *HybridSender) startHTTPServer(fileName string, fileSize int64, fileInfo os.FileInfo, localIP string, port int) error {
+// startHTTPServer 启动HTTP服务器，onDownloaded在文件被完整下载后调用
+func (s *HybridSender) startHTTPServer(fileName string, fileSize int64, fileInfo os.FileInfo, localIP string, port int, onDownloaded func(size int64, elapsed time.Duration)) error {
 	// 创建HTTP服务器
 	mux := http.NewServeMux()
-	mux.HandleFunc("/download", func(w http.ResponseWriter, r *http.Request) {
-		// 设置响应头
-		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", fileName))
-		w.Header().Set("Content-Type", "application/octet-stream")
-		w.Header().Set("Content-Length", fmt.Sprintf("%d", fileSize))
-
-		// 打开文件
-		file, err := os.Open(s.filePath)
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
-		defer file.Close()
-
-		// 发送文件
-		http.ServeContent(w, r, fileName, fileInfo.ModTime(), file)
-	})
+	servedFiles := append([]string{s.filePath}, s.moreFiles...)
+	registerFileHandlers(mux, servedFiles, s.checksum, onDownloaded)
 
 	s.httpServer = &http.Server{
 		Addr:    fmt.Sprintf(":%d", port),
-		Handler: mux,
+		Handler: withBasicAuth(s.httpUser, s.httpPass, withBandwidthLimit(s.limiter, mux)),
 	}
+	s.onCancel(func() { s.httpServer.Close() })
 
 	// 启动服务器
 	return s.httpServer.ListenAndServe()
 }
 
-// Stop 停止混合发送器
-func (s *HybridSender) Stop() error {
-	// 停止HTTP服务器
-	if s.httpServer != nil {
-		ctx := context.Background()
-		if err := s.httpServer.Shutdown(ctx); err != nil {
-			return err
-		}
+// stopRemaining 一次传输成功后停止两种方式（--stop-after-first），Start返回nil
+// HTTP服务器优雅关闭，等待刚完成的下载响应发送完毕（最多5秒）
+func (s *HybridSender) stopRemaining() {
+	s.webrtcSender.Cancel()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := s.httpServer.Shutdown(ctx); err != nil {
+		s.httpServer.Close()
 	}
+}
 
-	// WebRTC发送端会在连接关闭时自动停止
+// Stop 停止混合发送器：关闭HTTP服务器（断开正在进行的下载）并取消WebRTC发送，Start随后返回
+func (s *HybridSender) Stop() error {
+	s.Cancel()
 	return nil
 }
-
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/pion/webrtc/v3"
+)
+
+// iceGatherTimeout 收集ICE候选的最长等待时间（STUN/TURN不可达时pion需要较长时间才放弃）
+const iceGatherTimeout = 30 * time.Second
+
+// listICECandidates 使用给定的STUN/TURN配置收集本机ICE候选并以表格打印（诊断NAT/防火墙问题）
+func listICECandidates(stunServer, turnServer string, debug bool) error {
+	iceServers := getDefaultICEServers(stunServer, turnServer, debug)
+	for _, server := range iceServers {
+		fmt.Printf("ICE服务器: %v\n", server.URLs)
+	}
+
+	pc, err := newPeerConnection(iceServers)
+	if err != nil {
+		return err
+	}
+	defer pc.Close()
+
+	var (
+		mu         sync.Mutex
+		candidates []*webrtc.ICECandidate
+	)
+	gatherDone := make(chan struct{})
+	pc.OnICECandidate(func(c *webrtc.ICECandidate) {
+		if c == nil {
+			// nil表示收集结束
+			close(gatherDone)
+			return
+		}
+		mu.Lock()
+		candidates = append(candidates, c)
+		mu.Unlock()
+		if debug {
+			fmt.Printf("收到候选: %s\n", c.String())
+		}
+	})
+
+	// 需要一个DataChannel才能生成包含application段的offer并触发收集
+	if _, err := pc.CreateDataChannel("ice-probe", nil); err != nil {
+		return fmt.Errorf("创建DataChannel失败: %w", err)
+	}
+	offer, err := pc.CreateOffer(nil)
+	if err != nil {
+		return fmt.Errorf("创建offer失败: %w", err)
+	}
+	if err := pc.SetLocalDescription(offer); err != nil {
+		return fmt.Errorf("设置本地描述失败: %w", err)
+	}
+
+	fmt.Println("正在收集ICE候选...")
+	start := time.Now()
+	timedOut := false
+	select {
+	case <-gatherDone:
+	case <-time.After(iceGatherTimeout):
+		timedOut = true
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	fmt.Printf("\n共 %d 个候选（耗时 %.1f 秒）\n", len(candidates), time.Since(start).Seconds())
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "类型\t协议\t地址\t端口\t优先级\t关联地址")
+	counts := make(map[webrtc.ICECandidateType]int)
+	for _, c := range candidates {
+		related := "-"
+		if c.RelatedAddress != "" {
+			related = fmt.Sprintf("%s:%d", c.RelatedAddress, c.RelatedPort)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%d\t%s\n", c.Typ, c.Protocol, c.Address, c.Port, c.Priority, related)
+		counts[c.Typ]++
+	}
+	w.Flush()
+
+	if timedOut {
+		fmt.Printf("\n警告: %v内未完成收集，以上为已收集到的候选\n", iceGatherTimeout)
+	}
+	// 常见问题提示
+	if counts[webrtc.ICECandidateTypeSrflx] == 0 {
+		fmt.Println("提示: 没有srflx候选，STUN服务器可能不可达（UDP被防火墙拦截或地址错误），跨网络直连可能失败")
+	}
+	if turnServer != "" && counts[webrtc.ICECandidateTypeRelay] == 0 {
+		fmt.Println("提示: 没有relay候选，请检查TURN服务器地址和认证信息")
+	}
+	return nil
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// LocalAddress 本机地址候选
+type LocalAddress struct {
+	IP        string // IPv6链路本地地址带zone，如 fe80::1%eth0
+	Label     string // 地址类型说明
+	Reachable bool   // 是否可能被局域网内的对端访问
+	rank      int    // 排序优先级（越小越优先）
+}
+
+// 地址优先级
+const (
+	rankPrivateV4   = iota // RFC1918私有IPv4（局域网首选）
+	rankPublicV4           // 公网IPv4
+	rankULAV6              // IPv6唯一本地地址 fc00::/7
+	rankGlobalV6           // IPv6全局地址
+	rankCGNATV4            // 运营商级NAT地址 100.64.0.0/10
+	rankLinkLocalV6        // IPv6链路本地地址 fe80::/10
+)
+
+var cgnatNet = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+// classifyIP 判断地址类型，返回优先级、说明和是否可能被对端访问；不可用的地址返回ok=false
+func classifyIP(ip net.IP) (rank int, label string, reachable bool, ok bool) {
+	if ip.IsLoopback() || ip.IsUnspecified() || ip.IsMulticast() {
+		return 0, "", false, false
+	}
+
+	if ip4 := ip.To4(); ip4 != nil {
+		switch {
+		case ip4.IsLinkLocalUnicast():
+			return 0, "", false, false // 169.254.0.0/16 自动配置地址，通常不可用
+		case ip4.IsPrivate():
+			return rankPrivateV4, "局域网地址", true, true
+		case cgnatNet.Contains(ip4):
+			return rankCGNATV4, "运营商NAT地址，对端可能无法访问", false, true
+		default:
+			return rankPublicV4, "公网地址", true, true
+		}
+	}
+
+	switch {
+	case ip.IsLinkLocalUnicast():
+		return rankLinkLocalV6, "IPv6链路本地地址，仅同一网段可访问", false, true
+	case ip.IsPrivate():
+		return rankULAV6, "IPv6局域网地址", true, true
+	default:
+		return rankGlobalV6, "IPv6公网地址", true, true
+	}
+}
+
+// getLocalIPs 获取本机地址候选列表（按适合局域网分享的程度排序）
+// 优先RFC1918私有IPv4；没有时退回IPv6 ULA/全局地址，最后是链路本地地址（带zone）
+func getLocalIPs() ([]LocalAddress, error) {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil, err
+	}
+
+	// 默认路由使用的地址在同类地址中优先
+	routeIP := getRouteIP()
+
+	var addrs []LocalAddress
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+		ifaceAddrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, a := range ifaceAddrs {
+			ipNet, ok := a.(*net.IPNet)
+			if !ok {
+				continue
+			}
+			rank, label, reachable, ok := classifyIP(ipNet.IP)
+			if !ok {
+				continue
+			}
+			ip := ipNet.IP.String()
+			if rank == rankLinkLocalV6 {
+				ip = ip + "%" + iface.Name
+			}
+			addrs = append(addrs, LocalAddress{
+				IP:        ip,
+				Label:     label,
+				Reachable: reachable,
+				rank:      rank,
+			})
+		}
+	}
+
+	sort.SliceStable(addrs, func(i, j int) bool {
+		if addrs[i].rank != addrs[j].rank {
+			return addrs[i].rank < addrs[j].rank
+		}
+		return addrs[i].IP == routeIP && addrs[j].IP != routeIP
+	})
+
+	if len(addrs) == 0 {
+		return nil, fmt.Errorf("未找到可用的网络地址")
+	}
+	return addrs, nil
+}
+
+// localHTTPURL 本机地址的HTTP地址，如 http://192.168.1.2:8080/download；
+// IPv6地址加方括号（http://[fd00::1]:8080/download），链路本地地址的zone编码为%25（http://[fe80::1%25eth0]:8080/download）
+func localHTTPURL(ip string, port int, path string) string {
+	u := url.URL{
+		Scheme: "http",
+		Host:   net.JoinHostPort(ip, strconv.Itoa(port)),
+		Path:   path,
+	}
+	return u.String()
+}
+
+// getRouteIP 获取访问外网时内核选择的本机地址（不会实际发送数据）
+func getRouteIP() string {
+	for _, target := range []string{"8.8.8.8:80", "[2001:4860:4860::8888]:80"} {
+		conn, err := net.Dial("udp", target)
+		if err != nil {
+			continue
+		}
+		localAddr := conn.LocalAddr().(*net.UDPAddr)
+		conn.Close()
+		return localAddr.IP.String()
+	}
+	return ""
+}
+
+// printLocalIPNotes 打印最佳地址的可达性提示和其他可用地址
+func printLocalIPNotes(addrs []LocalAddress) {
+	if len(addrs) == 0 {
+		return
+	}
+	if !addrs[0].Reachable {
+		fmt.Printf("注意: %s 为%s\n", addrs[0].IP, addrs[0].Label)
+	}
+	if len(addrs) > 1 {
+		others := make([]string, 0, len(addrs)-1)
+		for _, a := range addrs[1:] {
+			others = append(others, fmt.Sprintf("%s（%s）", a.IP, a.Label))
+		}
+		fmt.Printf("其他地址: %s\n", strings.Join(others, ", "))
+	}
+}
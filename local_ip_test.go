@@ -0,0 +1,72 @@
+package main
+
+import (
+	"net"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestIPv6URLs IPv6地址的HTTP地址构造（方括号、zone编码）以及接收端对这些地址的解析
+func TestIPv6URLs(t *testing.T) {
+	auto := &AutoReceiver{}
+	for _, c := range []struct {
+		ip   string
+		want string
+	}{
+		{"192.168.1.2", "http://192.168.1.2:8080/download"},
+		{"fd00::1", "http://[fd00::1]:8080/download"},
+		{"fe80::1%eth0", "http://[fe80::1%25eth0]:8080/download"},
+	} {
+		t.Run(c.ip, func(t *testing.T) {
+			downloadURL := localHTTPURL(c.ip, 8080, "/download")
+			if downloadURL != c.want {
+				t.Fatalf("下载地址为 %s，期望 %s", downloadURL, c.want)
+			}
+			u, err := url.Parse(downloadURL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if u.Hostname() != c.ip || u.Port() != "8080" {
+				t.Fatalf("下载地址 %s 解析为主机 %s、端口 %s", downloadURL, u.Hostname(), u.Port())
+			}
+			if !auto.isHTTPAddress(downloadURL) {
+				t.Fatalf("%s 没有被识别为HTTP地址", downloadURL)
+			}
+			if name := urlFileName(downloadURL); name != "download" {
+				t.Fatalf("%s 的文件名解析为 %s", downloadURL, name)
+			}
+			if peer := NewHTTPReceiver(downloadURL, "").peerName(); peer != c.ip {
+				t.Fatalf("%s 的发送端标识解析为 %s", downloadURL, peer)
+			}
+
+			// 省略协议的地址补全为http://
+			short := strings.TrimPrefix(downloadURL, "http://")
+			if !auto.isHTTPAddress(short) || normalizeHTTPAddress(short) != downloadURL {
+				t.Fatalf("省略协议的地址 %s 没有被识别为 %s", short, downloadURL)
+			}
+
+			// 分享链接中的HTTP地址
+			link, err := parseMagicLink((&MagicLink{Mode: linkModeAuto, FileID: "0123456789abcdef", HTTPURL: downloadURL}).String())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if link.HTTPURL != downloadURL {
+				t.Fatalf("分享链接中的HTTP地址 %s 解析为 %s", downloadURL, link.HTTPURL)
+			}
+		})
+	}
+	if !auto.isHTTPAddress("[fd00::1]:8080") {
+		t.Error("[fd00::1]:8080 没有被识别为HTTP地址")
+	}
+
+	// 本机支持IPv6时检查能连接方括号格式的地址
+	if listener, err := net.Listen("tcp", "[::1]:0"); err == nil {
+		defer listener.Close()
+		downloadURL := localHTTPURL("::1", listener.Addr().(*net.TCPAddr).Port, "/download")
+		if !isHTTPReachable(downloadURL, time.Second) {
+			t.Errorf("无法连接 %s", downloadURL)
+		}
+	}
+}
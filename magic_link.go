@@ -0,0 +1,220 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// 分享链接（magic link）格式:
+//
+//	ft://webrtc/<文件编号>?signaling=<信令服务器>     仅WebRTC
+//	ft://http?url=<HTTP下载地址>                     仅HTTP
+//	ft://auto/<文件编号>?url=<HTTP下载地址>&signaling=<信令服务器>
+//	                                               混合模式：优先尝试局域网HTTP，不可达时使用WebRTC
+//
+// 可选参数: stun、turn（发送端显式指定时才会写入）；room（房间ID，与文件编号不同时写入）；
+// name（建议的保存文件名，只能是文件名，不能包含路径）
+// 所有参数值均经过URL编码，接收端显式指定的命令行参数优先于链接中的值。
+// 链接可能来自不可信的来源，建议的文件名只在保存位置是目录时使用（命令行指定的文件路径优先），
+// 已存在同名文件时自动加序号，不会写到链接指定的其他位置或覆盖已有文件
+
+const magicLinkScheme = "ft"
+
+// 分享链接中的传输模式
+const (
+	linkModeWebRTC = "webrtc"
+	linkModeHTTP   = "http"
+	linkModeAuto   = "auto"
+)
+
+// MagicLink 分享链接
+type MagicLink struct {
+	Mode         string
+	FileID       string
+	HTTPURL      string
+	SignalingURL string
+	STUNServer   string
+	TURNServer   string
+	RoomID       string // 房间ID（为空时使用文件编号）
+	FileName     string // 建议的保存文件名
+}
+
+// String 序列化为ft://链接
+func (l *MagicLink) String() string {
+	u := url.URL{
+		Scheme: magicLinkScheme,
+		Host:   l.Mode,
+	}
+	if l.FileID != "" {
+		u.Path = "/" + l.FileID
+	}
+
+	query := url.Values{}
+	if l.HTTPURL != "" {
+		query.Set("url", l.HTTPURL)
+	}
+	if l.SignalingURL != "" {
+		query.Set("signaling", l.SignalingURL)
+	}
+	if l.STUNServer != "" {
+		query.Set("stun", l.STUNServer)
+	}
+	if l.TURNServer != "" {
+		query.Set("turn", l.TURNServer)
+	}
+	if l.RoomID != "" && l.RoomID != l.FileID {
+		query.Set("room", l.RoomID)
+	}
+	if l.FileName != "" {
+		query.Set("name", l.FileName)
+	}
+	u.RawQuery = query.Encode()
+
+	return u.String()
+}
+
+// isMagicLink 判断地址是否是ft://分享链接
+func isMagicLink(addr string) bool {
+	return strings.HasPrefix(strings.ToLower(addr), magicLinkScheme+"://")
+}
+
+// parseMagicLink 解析ft://分享链接
+func parseMagicLink(addr string) (*MagicLink, error) {
+	u, err := url.Parse(addr)
+	if err != nil {
+		return nil, fmt.Errorf("解析分享链接失败: %w", err)
+	}
+	if !strings.EqualFold(u.Scheme, magicLinkScheme) {
+		return nil, fmt.Errorf("不是有效的分享链接（应以 %s:// 开头）: %s", magicLinkScheme, addr)
+	}
+
+	query := u.Query()
+	link := &MagicLink{
+		Mode:         strings.ToLower(u.Host),
+		FileID:       strings.Trim(u.Path, "/"),
+		HTTPURL:      query.Get("url"),
+		SignalingURL: query.Get("signaling"),
+		STUNServer:   query.Get("stun"),
+		TURNServer:   query.Get("turn"),
+		RoomID:       query.Get("room"),
+		FileName:     query.Get("name"),
+	}
+
+	switch link.Mode {
+	case linkModeWebRTC:
+		if link.FileID == "" {
+			return nil, fmt.Errorf("分享链接缺少文件编号: %s", addr)
+		}
+	case linkModeHTTP:
+		if link.HTTPURL == "" {
+			return nil, fmt.Errorf("分享链接缺少HTTP下载地址: %s", addr)
+		}
+	case linkModeAuto:
+		if link.FileID == "" && link.HTTPURL == "" {
+			return nil, fmt.Errorf("分享链接缺少文件编号和HTTP下载地址: %s", addr)
+		}
+	default:
+		return nil, fmt.Errorf("分享链接包含未知的传输模式: %s", u.Host)
+	}
+
+	if link.HTTPURL != "" {
+		httpURL, err := url.Parse(link.HTTPURL)
+		if err != nil || (httpURL.Scheme != "http" && httpURL.Scheme != "https") {
+			return nil, fmt.Errorf("分享链接中的HTTP地址无效: %s", link.HTTPURL)
+		}
+	}
+	if link.RoomID != "" && link.Mode == linkModeHTTP {
+		return nil, fmt.Errorf("HTTP模式的分享链接不使用房间ID: %s", addr)
+	}
+	if strings.ContainsFunc(link.RoomID, unicode.IsControl) {
+		return nil, fmt.Errorf("分享链接中的房间ID无效: %q", link.RoomID)
+	}
+	if link.FileName != "" {
+		if err := checkLinkFileName(link.FileName); err != nil {
+			return nil, err
+		}
+	}
+
+	return link, nil
+}
+
+// checkLinkFileName 检查分享链接中建议的文件名：只能是文件名，不能包含路径、盘符或控制字符
+func checkLinkFileName(name string) error {
+	switch {
+	case strings.TrimSpace(name) == "" || name == "." || name == "..":
+		return fmt.Errorf("分享链接中的文件名无效: %q", name)
+	case strings.ContainsAny(name, `/\:`):
+		return fmt.Errorf("分享链接中的文件名不能包含路径: %q", name)
+	case strings.ContainsFunc(name, unicode.IsControl):
+		return fmt.Errorf("分享链接中的文件名包含控制字符: %q", name)
+	}
+	return nil
+}
+
+// maxAddressFileSize 地址文件（receive @文件）的大小上限，SDP Offer格式的地址也远小于此值
+const maxAddressFileSize = 1024 * 1024
+
+// readAddressArg 解析receive的地址参数：以@开头时从该文件读取实际地址（文件编号、HTTP地址或ft://分享链接，如发送端保存的.ftlink文件），
+// 去掉首尾空白；否则原样返回
+func readAddressArg(arg string) (string, error) {
+	if !strings.HasPrefix(arg, "@") {
+		return arg, nil
+	}
+	path := arg[1:]
+	if path == "" {
+		return "", fmt.Errorf("@后缺少地址文件路径")
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("读取地址文件失败: %w", err)
+	}
+	defer file.Close()
+	data, err := io.ReadAll(io.LimitReader(file, maxAddressFileSize+1))
+	if err != nil {
+		return "", fmt.Errorf("读取地址文件失败: %w", err)
+	}
+	if len(data) > maxAddressFileSize {
+		return "", fmt.Errorf("地址文件过大（超过 %d 字节），请确认是否为分享链接文件: %s", maxAddressFileSize, path)
+	}
+
+	// Windows记事本保存的UTF-8文件可能带BOM
+	address := strings.TrimSpace(strings.TrimPrefix(string(data), "\uFEFF"))
+	if address == "" {
+		return "", fmt.Errorf("地址文件为空: %s", path)
+	}
+	if strings.ContainsAny(address, "\r\n") {
+		return "", fmt.Errorf("地址文件包含多行内容，应只包含一个文件编号、HTTP地址或分享链接: %s", path)
+	}
+	return address, nil
+}
+
+// isHTTPReachable 检查HTTP下载地址是否可以在短时间内建立TCP连接（用于混合模式选择）
+func isHTTPReachable(downloadURL string, timeout time.Duration) bool {
+	u, err := url.Parse(downloadURL)
+	if err != nil {
+		return false
+	}
+
+	host := u.Host
+	if u.Port() == "" {
+		port := "80"
+		if u.Scheme == "https" {
+			port = "443"
+		}
+		host = net.JoinHostPort(u.Hostname(), port)
+	}
+
+	conn, err := net.DialTimeout("tcp", host, timeout)
+	if err != nil {
+		return false
+	}
+	conn.Close()
+	return true
+}
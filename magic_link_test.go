@@ -0,0 +1,79 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestMagicLink 分享链接序列化后解析得到相同的字段，格式错误或文件名包含路径的链接被拒绝
+func TestMagicLink(t *testing.T) {
+	links := []MagicLink{
+		{Mode: linkModeWebRTC, FileID: "0123456789abcdef", SignalingURL: "ws://example.com:37851/ws"},
+		{Mode: linkModeWebRTC, FileID: "0123456789abcdef", SignalingURL: "wss://example.com/ws", RoomID: "team room/1", FileName: "报告 (最终版)&v=2.pdf"},
+		{Mode: linkModeHTTP, HTTPURL: "http://192.168.1.2:8080/download", FileName: "a+b.txt"},
+		{Mode: linkModeAuto, FileID: "0123456789abcdef", HTTPURL: "http://[fd00::1]:8080/download", SignalingURL: "ws://example.com/ws",
+			STUNServer: "stun:stun.example.com:3478", TURNServer: "turn:user:pass@turn.example.com:3478", RoomID: "room?#%"},
+	}
+	for _, want := range links {
+		got, err := parseMagicLink(want.String())
+		if err != nil {
+			t.Errorf("解析分享链接 %s: %v", want.String(), err)
+			continue
+		}
+		if *got != want {
+			t.Errorf("分享链接 %s 解析为 %+v，期望 %+v", want.String(), *got, want)
+		}
+	}
+	// 房间ID与文件编号相同时不写入链接
+	if link := (&MagicLink{Mode: linkModeWebRTC, FileID: "0123456789abcdef", RoomID: "0123456789abcdef"}).String(); strings.Contains(link, "room=") {
+		t.Errorf("房间ID与文件编号相同时写入了链接: %s", link)
+	}
+
+	for _, bad := range []string{
+		"http://example.com/download",
+		"ft://webrtc",
+		"ft://http",
+		"ft://unknown/0123456789abcdef",
+		"ft://http?url=ftp%3A%2F%2Fexample.com%2Fa",
+		"ft://http?url=http%3A%2F%2Fexample.com%2Fdownload&room=r1",
+		"ft://webrtc/0123456789abcdef?name=..%2F..%2F.bashrc",
+		"ft://webrtc/0123456789abcdef?name=%2Fetc%2Fpasswd",
+		"ft://webrtc/0123456789abcdef?name=C%3A%5CWindows%5Cwin.ini",
+		"ft://webrtc/0123456789abcdef?name=..",
+		"ft://webrtc/0123456789abcdef?name=a%0Ab.txt",
+		"ft://webrtc/0123456789abcdef?room=a%00b",
+		"ft://webrtc/%zz",
+	} {
+		if _, err := parseMagicLink(bad); err == nil {
+			t.Errorf("格式错误的分享链接 %s 没有被拒绝", bad)
+		}
+	}
+}
+
+// TestSuggestedName 建议的文件名只在保存位置是目录时使用，已存在同名文件时加序号
+func TestSuggestedName(t *testing.T) {
+	dir := t.TempDir()
+	suggest := func(savePath string) string {
+		t.Helper()
+		r := NewAutoReceiver("", savePath, "", "", "", "")
+		if err := r.applySuggestedName("suggested.bin"); err != nil {
+			t.Fatal(err)
+		}
+		return r.savePath
+	}
+	if got := suggest(dir); got != filepath.Join(dir, "suggested.bin") {
+		t.Fatalf("保存到目录时没有使用建议的文件名: %s", got)
+	}
+	explicit := filepath.Join(dir, "mine.bin")
+	if got := suggest(explicit); got != explicit {
+		t.Fatalf("命令行指定的文件路径没有优先于建议的文件名: %s", got)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "suggested.bin"), []byte("keep"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if got := suggest(dir); got == filepath.Join(dir, "suggested.bin") || filepath.Dir(got) != dir {
+		t.Fatalf("已存在同名文件时没有加序号: %s", got)
+	}
+}
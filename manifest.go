@@ -0,0 +1,179 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// ManifestEntry 发送端提供的文件清单条目（/manifest）
+type ManifestEntry struct {
+	Index        int    `json:"index"` // 从1开始的编号，对应 /download?file=编号
+	Name         string `json:"name"`
+	Size         int64  `json:"size"`
+	Checksum     string `json:"checksum,omitempty"`      // 校验和（十六进制，发送端已计算出时才有，旧版发送端没有）
+	ChecksumAlgo string `json:"checksum_algo,omitempty"` // 校验和的算法（见checksum.go）
+}
+
+// buildManifest 根据发送的文件列表生成清单
+func buildManifest(filePaths []string) ([]ManifestEntry, error) {
+	entries := make([]ManifestEntry, 0, len(filePaths))
+	for i, path := range filePaths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, fmt.Errorf("获取文件信息失败: %w", err)
+		}
+		size := info.Size()
+		if info.IsDir() {
+			// 目录的大小为打包后的大小（见dir_archive.go）
+			archive, err := newDirArchive(path)
+			if err != nil {
+				return nil, err
+			}
+			size = archive.size
+		}
+		entries = append(entries, ManifestEntry{
+			Index: i + 1,
+			Name:  filepath.Base(path),
+			Size:  size,
+		})
+	}
+	return entries, nil
+}
+
+// serveManifest 以JSON返回文件清单（只传输元数据，不传输文件内容）；checksum为第一个文件的校验和，
+// 已计算出时写入清单，还在计算时不等待（大文件计算校验和需要一段时间）
+func serveManifest(w http.ResponseWriter, r *http.Request, filePaths []string, checksum *lazyChecksum) {
+	entries, err := buildManifest(filePaths)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if sum, ok := checksum.Peek(); ok {
+		entries[0].Checksum, entries[0].ChecksumAlgo = sum, checksum.algo
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(w).Encode(entries)
+}
+
+// selectServedFile 根据 /download?file= 参数（编号或文件名）选择要发送的文件，未指定时为第一个文件
+func selectServedFile(filePaths []string, selector string) (string, error) {
+	if selector == "" {
+		return filePaths[0], nil
+	}
+	if index, err := strconv.Atoi(selector); err == nil {
+		if index < 1 || index > len(filePaths) {
+			return "", fmt.Errorf("文件编号 %d 超出范围（共 %d 个文件）", index, len(filePaths))
+		}
+		return filePaths[index-1], nil
+	}
+	for _, path := range filePaths {
+		if filepath.Base(path) == selector {
+			return path, nil
+		}
+	}
+	return "", fmt.Errorf("没有名为 %s 的文件", selector)
+}
+
+// pickManifestEntries 按--pick选择清单中的文件（逗号分隔的编号或文件名）
+func pickManifestEntries(entries []ManifestEntry, pick string) ([]ManifestEntry, error) {
+	var picked []ManifestEntry
+	seen := make(map[int]bool)
+	for _, sel := range strings.Split(pick, ",") {
+		sel = strings.TrimSpace(sel)
+		if sel == "" {
+			continue
+		}
+
+		var match *ManifestEntry
+		if index, err := strconv.Atoi(sel); err == nil {
+			if index < 1 || index > len(entries) {
+				return nil, fmt.Errorf("文件编号 %d 超出范围（共 %d 个文件）", index, len(entries))
+			}
+			match = &entries[index-1]
+		} else {
+			for i := range entries {
+				if entries[i].Name == sel {
+					match = &entries[i]
+					break
+				}
+			}
+			if match == nil {
+				return nil, fmt.Errorf("发送端没有名为 %s 的文件", sel)
+			}
+		}
+
+		if !seen[match.Index] {
+			seen[match.Index] = true
+			picked = append(picked, *match)
+		}
+	}
+	if len(picked) == 0 {
+		return nil, fmt.Errorf("--pick 未指定文件")
+	}
+	return picked, nil
+}
+
+// printManifest 打印发送端的文件清单和总大小（有校验和时一并显示）
+func printManifest(entries []ManifestEntry) {
+	fmt.Println("发送端提供的文件:")
+	var total int64
+	for _, e := range entries {
+		total += e.Size
+		if e.Checksum != "" {
+			fmt.Printf("  %d. %s (%s) %s: %s\n", e.Index, e.Name, formatByteSize(e.Size), checksumName(e.ChecksumAlgo), e.Checksum)
+		} else {
+			fmt.Printf("  %d. %s (%s)\n", e.Index, e.Name, formatByteSize(e.Size))
+		}
+	}
+	fmt.Printf("共 %d 个文件，合计 %s\n", len(entries), formatByteSize(total))
+}
+
+// manifestSourceURL 由list的地址参数得到HTTP下载地址：HTTP地址原样使用，分享链接使用其中的HTTP地址；
+// WebRTC文件编号和TCP地址没有清单（连接后才逐个发送文件的元数据）
+func manifestSourceURL(address string) (string, error) {
+	if isMagicLink(address) {
+		link, err := parseMagicLink(address)
+		if err != nil {
+			return "", err
+		}
+		if link.HTTPURL == "" {
+			return "", fmt.Errorf("分享链接是WebRTC模式，没有可查看的文件清单（连接后才逐个发送文件的元数据），请使用发送端输出的HTTP地址")
+		}
+		return link.HTTPURL, nil
+	}
+	if _, ok := tcpAddress(address); ok {
+		return "", fmt.Errorf("直接TCP模式没有可查看的文件清单（连接后才逐个发送文件的元数据）")
+	}
+	if !(&AutoReceiver{}).isHTTPAddress(address) {
+		return "", fmt.Errorf("WebRTC模式没有可查看的文件清单（连接后才逐个发送文件的元数据），请使用发送端输出的HTTP地址")
+	}
+	return normalizeHTTPAddress(address), nil
+}
+
+// manifestURL 由下载地址推出清单地址（同一服务器的 /manifest）
+func manifestURL(downloadURL string) (string, error) {
+	u, err := url.Parse(downloadURL)
+	if err != nil {
+		return "", fmt.Errorf("解析下载地址失败: %w", err)
+	}
+	u.Path = "/manifest"
+	u.RawQuery = ""
+	return u.String(), nil
+}
+
+// fileDownloadURL 由下载地址推出指定编号文件的下载地址
+func fileDownloadURL(downloadURL string, index int) (string, error) {
+	u, err := url.Parse(downloadURL)
+	if err != nil {
+		return "", fmt.Errorf("解析下载地址失败: %w", err)
+	}
+	u.Path = "/download"
+	u.RawQuery = url.Values{"file": {strconv.Itoa(index)}}.Encode()
+	return u.String(), nil
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestManifestList 文件清单只返回元数据：多个文件时每个文件的编号、名称和大小，第一个文件的校验和计算出后才写入；
+// 单个文件的发送端返回一个条目；list的地址参数接受HTTP地址和分享链接，WebRTC文件编号被拒绝
+func TestManifestList(t *testing.T) {
+	dir := t.TempDir()
+	first, second := filepath.Join(dir, "first.bin"), filepath.Join(dir, "second.txt")
+	if err := writeRandomFile(first, 64*1024); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(second, []byte("second file\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// 两个临时HTTP服务器：发送两个文件的和只发送一个文件的
+	checksum := newLazyChecksum(first, defaultChecksumAlgo)
+	mux := http.NewServeMux()
+	registerFileHandlers(mux, []string{first, second}, checksum, nil)
+	multi := httptest.NewServer(mux)
+	defer multi.Close()
+	mux = http.NewServeMux()
+	registerFileHandlers(mux, []string{second}, nil, nil)
+	single := httptest.NewServer(mux)
+	defer single.Close()
+
+	fetch := func(address string) []ManifestEntry {
+		t.Helper()
+		source, err := manifestSourceURL(address)
+		if err != nil {
+			t.Fatal(err)
+		}
+		entries, err := NewHTTPReceiver(source, "").fetchManifest()
+		if err != nil {
+			t.Fatalf("获取 %s 的文件清单: %v", address, err)
+		}
+		return entries
+	}
+
+	// 校验和还没有计算时不等待
+	entries := fetch(multi.URL + "/download")
+	if len(entries) != 2 || entries[0].Name != "first.bin" || entries[0].Size != 64*1024 || entries[1].Name != "second.txt" || entries[1].Size != 12 {
+		t.Fatalf("文件清单不正确: %+v", entries)
+	}
+	if entries[0].Checksum != "" {
+		t.Fatal("校验和还没有计算时清单中已有校验和")
+	}
+
+	want, err := checksum.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries = fetch((&MagicLink{Mode: linkModeHTTP, HTTPURL: multi.URL + "/download"}).String())
+	if entries[0].Checksum != want || entries[0].ChecksumAlgo != defaultChecksumAlgo || entries[1].Checksum != "" {
+		t.Fatalf("计算出校验和后清单中的校验和不正确: %+v", entries)
+	}
+
+	entries = fetch(single.URL + "/download")
+	if len(entries) != 1 || entries[0].Index != 1 || entries[0].Name != "second.txt" {
+		t.Fatalf("单个文件的清单不正确: %+v", entries)
+	}
+
+	if _, err := manifestSourceURL("0123456789abcdef"); err == nil {
+		t.Fatal("WebRTC文件编号没有被拒绝")
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"sync/atomic"
+)
+
+// 一次发送多个文件（send a.txt b.pdf c.zip）：WebRTC和直接TCP模式在同一个连接上依次发送每个文件的元数据和数据，
+// 元数据带FileIndex（从1开始）和FileCount；接收端收完一个文件（校验、--defer-sync的移动）后回到等待元数据的状态，
+// 收完最后一个文件才确认接收完成。接收端的保存位置按目录处理（不存在时创建），每个文件使用发送端的文件名。
+// HTTP模式（包括混合模式的HTTP部分）提供全部文件：?file=N、清单（list、--pick）和 /download.zip 打包下载。
+// 多个文件不支持--reliable-ack（确认的偏移按单个文件计算）、发送端重启续传、广播、中转、--verify-only、--follow和远程地址；
+// 旧版接收端不认识FileIndex，收完第一个文件就结束。
+
+// checkSendFiles 检查一次发送的多个文件：必须是本地文件或目录，且文件名不重复（接收端把它们保存到同一目录）
+func checkSendFiles(paths []string) error {
+	seen := make(map[string]string)
+	for _, path := range paths {
+		if isRemoteURL(path) {
+			return fmt.Errorf("一次发送多个文件时不能包含远程地址: %s", path)
+		}
+		name := filepath.Base(path)
+		if other, ok := seen[name]; ok {
+			return fmt.Errorf("%s 和 %s 的文件名相同，接收端无法区分", other, path)
+		}
+		seen[name] = path
+	}
+	return nil
+}
+
+// sendFiles 依次发送filePath和moreFiles，只有一个文件时等同于sendFile；
+// 发送其余文件时临时切换filePath等字段（sourceInfo、openSource和addChecksum使用它们），返回前恢复
+func (s *WebRTCSender) sendFiles(sender chunkSender, fileName string, fileSize int64) error {
+	if len(s.moreFiles) == 0 {
+		return s.sendFile(sender, fileName, fileSize)
+	}
+	first, archive, checksum := s.filePath, s.archive, s.checksum
+	defer func() {
+		s.filePath, s.archive, s.checksum = first, archive, checksum
+	}()
+
+	// 发送第一个文件期间在后台计算其余文件的校验和
+	paths := append([]string{first}, s.moreFiles...)
+	checksums := make([]*lazyChecksum, len(paths))
+	checksums[0] = checksum
+	for i, path := range s.moreFiles {
+		checksums[i+1] = newLazyChecksum(path, s.checksumAlgo)
+	}
+	go func() {
+		for _, c := range checksums[1:] {
+			c.Get()
+		}
+	}()
+
+	s.fileCount = len(paths)
+	for i, path := range paths {
+		if i > 0 {
+			s.filePath, s.archive, s.checksum = path, nil, checksums[i]
+			var err error
+			if fileName, fileSize, err = s.sourceInfo(); err != nil {
+				return err
+			}
+		}
+		s.fileIndex = i + 1
+		fmt.Printf("\n[%d/%d] %s\n", s.fileIndex, s.fileCount, fileName)
+		if err := s.sendFile(sender, fileName, fileSize); err != nil {
+			return err
+		}
+		s.sentBefore = atomic.LoadInt64(&s.totalSent)
+	}
+	return nil
+}
+
+// multiFileSaveDir 接收多个文件时的保存位置：已存在的目录和当前目录原样使用，其他路径按目录处理（见save_path.go）
+func multiFileSaveDir(savePath string) string {
+	if savePath == "" || savePath == "." || isDirectory(savePath) {
+		return savePath
+	}
+	return savePath + string(filepath.Separator)
+}
+
+// nextFile 一次发送多个文件时，一个文件接收完成后回到等待元数据的状态，准备接收下一个文件
+func (r *WebRTCReceiver) nextFile() {
+	absPath, _ := filepath.Abs(r.savePath)
+	fmt.Printf("\n✓ 第 %d / %d 个文件接收完成: %s\n\n", r.metadata.FileIndex, r.metadata.FileCount, absPath)
+	r.fileOffset = atomic.LoadInt64(&r.totalReceived)
+	r.metadata = nil
+	r.metadataBuf = nil
+	r.checksum = nil
+	r.gunzip = nil
+	r.decrypt = nil
+	r.state = 0
+}
+
+// describeSendFiles 一次发送多个文件时打印文件列表和合计大小（目录为打包后的大小）
+func describeSendFiles(paths []string) {
+	entries, err := buildManifest(paths)
+	if err != nil {
+		return // 发送端检查文件时报告错误
+	}
+	var total int64
+	fmt.Printf("一次发送 %d 个文件:\n", len(entries))
+	for _, e := range entries {
+		total += e.Size
+		fmt.Printf("  %d. %s (%s)\n", e.Index, e.Name, formatByteSize(e.Size))
+	}
+	fmt.Printf("合计 %s\n\n", formatByteSize(total))
+}
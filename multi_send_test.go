@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+)
+
+// TestMultiFile 一次发送多个文件：接收端按FileIndex/FileCount依次接收，每个文件单独校验并按文件名保存到同一目录，
+// 跨越文件边界的数据（直接TCP模式）和空文件都能正确处理，收完最后一个文件才完成
+func TestMultiFile(t *testing.T) {
+	dir := t.TempDir()
+	names := []string{"a.txt", "empty.txt", "c.bin"}
+	sizes := []int64{3000, 0, 50 * 1024}
+	var stream []byte
+	var total int64
+	contents := make([][]byte, len(names))
+	for i, name := range names {
+		path := filepath.Join(dir, name)
+		if err := writeRandomFile(path, sizes[i]); err != nil {
+			t.Fatal(err)
+		}
+		contents[i], _ = os.ReadFile(path)
+		sum, err := fileChecksum(path, defaultChecksumAlgo)
+		if err != nil {
+			t.Fatal(err)
+		}
+		metadataJSON, _ := json.Marshal(FileMetadata{FileName: name, FileSize: sizes[i], Checksum: sum, ChecksumAlgo: defaultChecksumAlgo,
+			FileIndex: i + 1, FileCount: len(names)})
+		header := make([]byte, 4)
+		binary.BigEndian.PutUint32(header, uint32(len(metadataJSON)))
+		stream = append(stream, header...)
+		stream = append(stream, metadataJSON...)
+		stream = append(stream, contents[i]...)
+		total += sizes[i]
+	}
+
+	// 保存位置不存在且不以分隔符结尾，多个文件时按目录处理；按不与文件边界对齐的大小分块，模拟直接TCP模式的读取
+	out := filepath.Join(dir, "out")
+	receiver := NewWebRTCReceiver("", "", out, iceServerNone, iceServerNone, "", "", false)
+	for len(stream) > 0 {
+		n := 777
+		if n > len(stream) {
+			n = len(stream)
+		}
+		if err := receiver.handleMessage(stream[:n]); err != nil {
+			t.Fatalf("接收多个文件: %v", err)
+		}
+		stream = stream[n:]
+	}
+	if atomic.LoadInt32(&receiver.finished) != 1 || atomic.LoadInt64(&receiver.totalReceived) != total {
+		t.Fatalf("接收多个文件没有完成（已接收 %d / %d 字节）", receiver.totalReceived, total)
+	}
+	for i, name := range names {
+		got, err := os.ReadFile(filepath.Join(out, name))
+		if err != nil || !bytes.Equal(got, contents[i]) {
+			t.Errorf("接收的 %s 与源文件不一致", name)
+		}
+	}
+
+	if err := checkSendFiles([]string{filepath.Join(dir, "a.txt"), filepath.Join(dir, "out", "a.txt")}); err == nil {
+		t.Error("文件名相同的多个文件没有被拒绝")
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"time"
+)
+
+// windowsNotifyScript Windows下用托盘气泡显示通知，标题和内容通过环境变量传入（避免转义问题）
+const windowsNotifyScript = `Add-Type -AssemblyName System.Windows.Forms
+$n = New-Object System.Windows.Forms.NotifyIcon
+$n.Icon = [System.Drawing.SystemIcons]::Information
+$n.Visible = $true
+$n.ShowBalloonTip(5000, $env:FT_NOTIFY_TITLE, $env:FT_NOTIFY_MESSAGE, 'Info')
+Start-Sleep -Seconds 6
+$n.Dispose()`
+
+// notifyDesktop 显示桌面通知（--notify）
+// 尽力而为：调用系统自带的通知工具（Windows PowerShell、macOS osascript、Linux notify-send），
+// 工具不存在、没有图形界面或调用失败时静默忽略，不影响传输结果
+func notifyDesktop(title, message string) {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "windows":
+		cmd = exec.Command("powershell", "-NoProfile", "-NonInteractive", "-WindowStyle", "Hidden", "-Command", windowsNotifyScript)
+		cmd.Env = append(os.Environ(), "FT_NOTIFY_TITLE="+title, "FT_NOTIFY_MESSAGE="+message)
+	case "darwin":
+		cmd = exec.Command("osascript",
+			"-e", "on run argv",
+			"-e", "display notification (item 2 of argv) with title (item 1 of argv)",
+			"-e", "end run",
+			title, message)
+	default:
+		// 无图形界面的服务器上没有通知服务
+		if os.Getenv("DISPLAY") == "" && os.Getenv("WAYLAND_DISPLAY") == "" {
+			return
+		}
+		path, err := exec.LookPath("notify-send")
+		if err != nil {
+			return
+		}
+		cmd = exec.Command(path, "--app-name=ftf", title, message)
+	}
+
+	if err := cmd.Start(); err != nil {
+		return
+	}
+	// 最多等待2秒，通知进程仍未退出时（如Windows气泡需要保持显示）不再等待
+	done := make(chan struct{})
+	go func() {
+		cmd.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+	}
+}
+
+// notifyTransferResult 启用--notify时按传输结果显示通知，action为"发送"或"接收"
+func notifyTransferResult(enabled bool, action, name string, err error) {
+	if !enabled {
+		return
+	}
+	if err != nil {
+		notifyDesktop("文件"+action+"失败", fmt.Sprintf("%s: %v", name, err))
+		return
+	}
+	notifyDesktop("文件"+action+"完成", name)
+}
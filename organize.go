@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// 接收文件的子目录整理方式
+const (
+	organizeNone = ""     // 不整理，直接保存到保存目录
+	organizeDate = "date" // 按接收日期保存到 YYYY-MM-DD/
+	organizePeer = "peer" // 按对端保存（WebRTC为房间ID/文件编号，HTTP为发送端地址）
+)
+
+// parseOrganizeMode 校验--organize参数
+func parseOrganizeMode(mode string) (string, error) {
+	switch strings.ToLower(strings.TrimSpace(mode)) {
+	case "", "none", "flat":
+		return organizeNone, nil
+	case organizeDate:
+		return organizeDate, nil
+	case organizePeer:
+		return organizePeer, nil
+	default:
+		return "", fmt.Errorf("未知的整理方式: %s（可选: date、peer）", mode)
+	}
+}
+
+// organizeSubdir 根据整理方式返回子目录名，不整理时返回空字符串
+func organizeSubdir(mode, peer string) string {
+	switch mode {
+	case organizeDate:
+		return time.Now().Format("2006-01-02")
+	case organizePeer:
+		return sanitizeDirName(peer)
+	default:
+		return ""
+	}
+}
+
+// organizePath 在保存目录和文件名之间插入整理子目录
+// 例如 D:\ft_download\a.txt 按日期整理后为 D:\ft_download\2024-01-02\a.txt
+func organizePath(savePath, mode, peer string) string {
+	sub := organizeSubdir(mode, peer)
+	if sub == "" {
+		return savePath
+	}
+	return filepath.Join(filepath.Dir(savePath), sub, filepath.Base(savePath))
+}
+
+// sanitizeDirName 把对端标识转换为安全的目录名（去掉路径分隔符和Windows不允许的字符）
+func sanitizeDirName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		switch r {
+		case '/', '\\', ':', '*', '?', '"', '<', '>', '|', '%':
+			return '_'
+		}
+		if r < 0x20 {
+			return '_'
+		}
+		return r
+	}, strings.TrimSpace(name))
+	name = strings.Trim(name, ". ")
+	if name == "" {
+		return "unknown"
+	}
+	return name
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+)
+
+// defaultWriteBufferSize 接收文件的默认写缓冲区大小（--write-buffer）
+const defaultWriteBufferSize = 1024 * 1024
+
+// nopWriteCloser 为调用方提供的io.Writer加上空的Close（接收结束时不关闭调用方的Writer）
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
+
+// bufferedFile 带写缓冲区的文件：把小块写入合并成大块，减少网络文件系统（SMB/NFS）和同步盘上的写操作
+// Close时刷新缓冲区、Sync并关闭文件（可重复调用），出错或取消时调用Close也能让部分文件包含已收到的数据
+type bufferedFile struct {
+	*bufio.Writer
+	file   *os.File
+	closed bool
+}
+
+// Close 刷新缓冲区并关闭文件，返回第一个出现的错误
+func (f *bufferedFile) Close() error {
+	if f.closed {
+		return nil
+	}
+	f.closed = true
+	err := f.Flush()
+	if syncErr := f.file.Sync(); err == nil {
+		err = syncErr
+	}
+	if closeErr := f.file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// createReceiveTarget 创建接收数据的写入目标：output不为nil时写入output，否则创建savePath文件
+// （appendMode时追加到已有内容之后，见append.go）；bufferSize大于0时使用写缓冲区（见bufferedFile），否则直接写入文件
+func createReceiveTarget(savePath string, output io.Writer, bufferSize int, appendMode bool) (io.WriteCloser, error) {
+	if output != nil {
+		return nopWriteCloser{output}, nil
+	}
+	flag := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if appendMode {
+		flag = os.O_WRONLY | os.O_CREATE | os.O_APPEND
+	}
+	file, err := os.OpenFile(savePath, flag, 0666)
+	if err != nil {
+		return nil, fmt.Errorf("创建文件失败: %w", err)
+	}
+	if bufferSize <= 0 {
+		return file, nil
+	}
+	return &bufferedFile{Writer: bufio.NewWriterSize(file, bufferSize), file: file}, nil
+}
+
+// receiveTargetName 显示用的保存位置
+func receiveTargetName(savePath string, output io.Writer) string {
+	if output != nil {
+		return "调用方提供的Writer"
+	}
+	return savePath
+}
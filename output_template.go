@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 接收文件的命名模板（receive --output-template），如 {date}_{name}、{roomid}/{name}。占位符:
+//
+//	{name}    发送端的文件名（含扩展名）
+//	{ext}     扩展名（不含点，没有扩展名时为空）
+//	{date}    接收日期 YYYY-MM-DD
+//	{time}    接收时间 HHMMSS
+//	{roomid}  房间ID/文件编号（HTTP模式为发送端地址）
+//	{size}    文件大小（字节，未知时为unknown）
+//
+// 展开后的路径相对于保存目录，/分隔的部分创建为子目录；只在文件名来自发送端时（保存路径是目录）使用。
+// 每一部分都去掉路径分隔符和Windows不允许的字符（..等无效的部分替换为unknown），不会写到保存目录之外；
+// 展开后的文件已存在时在文件名后加序号（如 a (1).txt），不覆盖已有的文件。
+
+// outputTemplateValues 展开命名模板时的文件信息
+type outputTemplateValues struct {
+	name   string    // 发送端的文件名
+	size   int64     // 文件大小，小于0表示未知
+	roomID string    // 房间ID/文件编号，HTTP模式为发送端地址
+	at     time.Time // 接收时间
+}
+
+// parseOutputTemplate 校验--output-template参数（未知的占位符或未闭合的{时报错）
+func parseOutputTemplate(tmpl string) (string, error) {
+	tmpl = strings.TrimSpace(tmpl)
+	_, err := expandOutputTemplateRaw(tmpl, outputTemplateValues{})
+	if err != nil {
+		return "", err
+	}
+	return tmpl, nil
+}
+
+// expandOutputTemplateRaw 替换模板中的占位符（各占位符的值中的路径分隔符替换为_）
+func expandOutputTemplateRaw(tmpl string, v outputTemplateValues) (string, error) {
+	noSeparator := strings.NewReplacer("/", "_", "\\", "_")
+	size := "unknown"
+	if v.size >= 0 {
+		size = strconv.FormatInt(v.size, 10)
+	}
+	values := map[string]string{
+		"name":   v.name,
+		"ext":    strings.TrimPrefix(filepath.Ext(v.name), "."),
+		"date":   v.at.Format("2006-01-02"),
+		"time":   v.at.Format("150405"),
+		"roomid": v.roomID,
+		"size":   size,
+	}
+
+	var b strings.Builder
+	for rest := tmpl; rest != ""; {
+		start := strings.IndexByte(rest, '{')
+		if start < 0 {
+			b.WriteString(rest)
+			break
+		}
+		b.WriteString(rest[:start])
+		end := strings.IndexByte(rest[start:], '}')
+		if end < 0 {
+			return "", fmt.Errorf("命名模板中的 { 没有闭合: %s", tmpl)
+		}
+		key := rest[start+1 : start+end]
+		value, ok := values[strings.ToLower(key)]
+		if !ok {
+			return "", fmt.Errorf("命名模板包含未知的占位符 {%s}（可选: {name}、{ext}、{date}、{time}、{roomid}、{size}）", key)
+		}
+		b.WriteString(noSeparator.Replace(value))
+		rest = rest[start+end+1:]
+	}
+	return b.String(), nil
+}
+
+// expandOutputTemplate 按模板计算保存路径：dir为保存目录，返回 dir/<展开后的相对路径>（模板已由parseOutputTemplate校验）
+func expandOutputTemplate(dir, tmpl string, v outputTemplateValues) string {
+	expanded, err := expandOutputTemplateRaw(tmpl, v)
+	if err != nil {
+		expanded = v.name
+	}
+
+	parts := []string{dir}
+	for _, part := range strings.FieldsFunc(expanded, func(r rune) bool { return r == '/' || r == '\\' }) {
+		parts = append(parts, sanitizeDirName(part))
+	}
+	if len(parts) == 1 {
+		parts = append(parts, sanitizeDirName(v.name))
+	}
+	return filepath.Join(parts...)
+}
+
+// uniqueFilePath 路径已存在时在文件名后加序号，如 a.txt -> a (1).txt
+func uniqueFilePath(path string) string {
+	if _, err := os.Lstat(path); os.IsNotExist(err) {
+		return path
+	}
+	ext := filepath.Ext(path)
+	base := strings.TrimSuffix(path, ext)
+	for i := 1; ; i++ {
+		candidate := fmt.Sprintf("%s (%d)%s", base, i, ext)
+		if _, err := os.Lstat(candidate); os.IsNotExist(err) {
+			return candidate
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestOutputTemplate 命名模板的展开、清理（不能写到保存目录之外）和不覆盖已有文件
+func TestOutputTemplate(t *testing.T) {
+	dir := t.TempDir()
+	values := outputTemplateValues{
+		name:   "report.final.pdf",
+		size:   1234,
+		roomID: "room-1",
+		at:     time.Date(2024, 5, 1, 9, 8, 7, 0, time.Local),
+	}
+	for _, c := range []struct {
+		tmpl string
+		want string // 相对于保存目录，/分隔
+	}{
+		{"{name}", "report.final.pdf"},
+		{"{date}/{roomid}_{name}", "2024-05-01/room-1_report.final.pdf"},
+		{"{DATE}_{time}.{ext}", "2024-05-01_090807.pdf"},
+		{"{roomid}/{size}-{name}", "room-1/1234-report.final.pdf"},
+		{"../../{name}", "unknown/unknown/report.final.pdf"},
+		{"/abs//{name}", "abs/report.final.pdf"},
+		{"a:b*c?/{name}", "a_b_c_/report.final.pdf"},
+	} {
+		tmpl, err := parseOutputTemplate(c.tmpl)
+		if err != nil {
+			t.Errorf("命名模板 %q: %v", c.tmpl, err)
+			continue
+		}
+		if got, want := expandOutputTemplate(dir, tmpl, values), filepath.Join(dir, filepath.FromSlash(c.want)); got != want {
+			t.Errorf("命名模板 %q: 得到 %s，期望 %s", c.tmpl, got, want)
+		}
+	}
+
+	// 值中的路径分隔符不会产生子目录
+	got := expandOutputTemplate(dir, "{roomid}_{name}", outputTemplateValues{name: "a.txt", roomID: "x/../y", size: -1})
+	if want := filepath.Join(dir, "x_.._y_a.txt"); got != want {
+		t.Errorf("值中的路径分隔符: 得到 %s，期望 %s", got, want)
+	}
+
+	for _, bad := range []string{"{nam}", "{name", "{date}/{}"} {
+		if _, err := parseOutputTemplate(bad); err == nil {
+			t.Errorf("无效的命名模板 %q 没有报错", bad)
+		}
+	}
+
+	// 已存在时加序号
+	existing := filepath.Join(dir, "a.txt")
+	if err := os.WriteFile(existing, []byte("x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if got := uniqueFilePath(existing); got != filepath.Join(dir, "a (1).txt") {
+		t.Errorf("已存在的文件: 得到 %s，期望 a (1).txt", got)
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync/atomic"
+)
+
+// 跨传输方式续传：WebRTC/直接TCP接收中断（连接断开、无进度超时等，不包括取消）时，已接收的部分改名为
+// <文件名>.part（与HTTP下载的未完成文件相同，见http_resume.go），旁边的 <文件名>.part.json 记录文件的身份
+// （发送端的文件名、大小和校验和）。之后用HTTP地址下载同一文件到同一位置时，接收端先比对身份：
+// 一致时按HTTP断点续传从.part的末尾继续下载，下载完成后校验的是整个文件；不一致（发送端换了文件）时删除.part从头下载。
+// 身份一致只说明是同一个文件（缺少校验和或算法不同时只比对了文件名和大小），不能说明.part的内容正确，
+// 因此采用.part时总是先校验已有部分（同--resume-verify，见http_resume.go），发送端比对不一致或不支持校验时从头下载。
+// 身份记录只在交给HTTP下载时使用一次，之后的.part与普通的HTTP未完成文件相同。
+// 写入output、追加模式和目录的打包流不保留.part（与HTTP下载相同）。
+
+// partInfoSuffix 未完成文件的身份记录的后缀（追加在.part之后）
+const partInfoSuffix = ".json"
+
+// partInfo 未完成文件的身份：发送端的文件名、大小和校验和
+type partInfo struct {
+	FileName     string `json:"fileName"`
+	FileSize     int64  `json:"fileSize"`
+	Checksum     string `json:"checksum,omitempty"`
+	ChecksumAlgo string `json:"checksumAlgo,omitempty"`
+}
+
+// matches 判断HTTP下载的文件是否与未完成的文件相同（双方都有同一算法的校验和时比对校验和）
+func (p *partInfo) matches(name string, size int64, sum, algo string) bool {
+	if p.FileName != name || p.FileSize != size {
+		return false
+	}
+	if p.Checksum == "" || sum == "" || !strings.EqualFold(p.ChecksumAlgo, algo) {
+		return true
+	}
+	return strings.EqualFold(p.Checksum, sum)
+}
+
+// leavePart 接收中断时把已接收的部分改名为.part并记录文件的身份，之后可以通过HTTP下载续传（文件须已关闭）
+func (r *WebRTCReceiver) leavePart() {
+	if r.metadata == nil || r.output != nil || r.appendMode || r.metadata.IsArchive || r.writePath == "" {
+		return
+	}
+	received := atomic.LoadInt64(&r.totalReceived) - r.fileOffset
+	if received <= 0 || received >= r.metadata.FileSize {
+		return
+	}
+	partPath := r.writePath + partFileSuffix
+	if err := os.Rename(r.writePath, partPath); err != nil {
+		fmt.Printf("保留未完成的文件失败: %v\n", err)
+		return
+	}
+	info, _ := json.Marshal(partInfo{
+		FileName:     r.metadata.FileName,
+		FileSize:     r.metadata.FileSize,
+		Checksum:     r.metadata.Checksum,
+		ChecksumAlgo: r.metadata.ChecksumAlgo,
+	})
+	if err := os.WriteFile(partPath+partInfoSuffix, info, 0644); err != nil {
+		fmt.Printf("记录未完成的文件失败: %v\n", err)
+	}
+	fmt.Printf("\n已接收的 %d / %d 字节保存在 %s，用HTTP地址下载同一文件到同一位置时从断点继续\n", received, r.metadata.FileSize, partPath)
+}
+
+// adoptPart HTTP下载前检查partPath旁的身份记录（WebRTC/直接TCP接收中断时留下）：
+// 与要下载的文件一致时返回true（续传前须校验已有部分），不一致时删除.part从头下载；身份记录随即删除
+func adoptPart(partPath, name string, size int64, sum, algo string) bool {
+	data, err := os.ReadFile(partPath + partInfoSuffix)
+	if err != nil {
+		return false
+	}
+	os.Remove(partPath + partInfoSuffix)
+	var info partInfo
+	if json.Unmarshal(data, &info) == nil && info.matches(name, size, sum, algo) {
+		fmt.Println("已有中断的WebRTC传输留下的同一文件的未完成部分")
+		return true
+	}
+	fmt.Printf("已有的未完成文件来自另一个文件（%s，%d 字节），从头下载\n", info.FileName, info.FileSize)
+	os.Remove(partPath)
+	return false
+}
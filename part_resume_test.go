@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestCrossTransportResume WebRTC接收中断后已接收的部分保留为.part并记录文件的身份，之后通过HTTP下载同一文件时
+// 校验已有部分后只下载剩余部分；身份记录与要下载的文件不一致、或已有部分与发送端的文件不一致时从头下载
+func TestCrossTransportResume(t *testing.T) {
+	const size, partial = 256 * 1024, 100 * 1024
+	dir := t.TempDir()
+	content := make([]byte, size)
+	rand.Read(content)
+	src := filepath.Join(dir, "source.bin")
+	if err := os.WriteFile(src, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+	checksum := newLazyChecksum(src, defaultChecksumAlgo)
+	sum, err := checksum.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	mux := http.NewServeMux()
+	registerFileHandlers(mux, []string{src}, checksum, nil)
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	// interrupted WebRTC接收端收到元数据和received后连接断开（不是取消）
+	savePath := filepath.Join(dir, "received.bin")
+	interrupted := func(metadata FileMetadata, received []byte) {
+		t.Helper()
+		metadataJSON, _ := json.Marshal(metadata)
+		header := make([]byte, 4)
+		binary.BigEndian.PutUint32(header, uint32(len(metadataJSON)))
+		receiver := NewWebRTCReceiver("", "", savePath, iceServerNone, iceServerNone, "", "", false)
+		if err := receiver.handleMessage(append(append(header, metadataJSON...), received...)); err != nil {
+			t.Fatalf("WebRTC接收中断前: %v", err)
+		}
+		receiver.closeOrDiscard()
+		if got, err := os.ReadFile(savePath + partFileSuffix); err != nil || !bytes.Equal(got, received) {
+			t.Fatal("WebRTC接收中断后没有把已接收的部分保留为.part")
+		}
+		if _, err := os.Stat(savePath); !os.IsNotExist(err) {
+			t.Fatal("WebRTC接收中断后未完成的文件仍使用最终的文件名")
+		}
+	}
+	// download 通过HTTP下载同一文件，返回本次下载的字节数
+	download := func() int64 {
+		t.Helper()
+		result, err := NewHTTPReceiver(server.URL+"/download", savePath).Start(context.Background())
+		if err != nil {
+			t.Fatalf("通过HTTP下载: %v", err)
+		}
+		if got, _ := os.ReadFile(savePath); !bytes.Equal(got, content) {
+			t.Fatalf("下载后的文件与源文件不一致（%d 字节）", len(got))
+		}
+		for _, path := range []string{savePath + partFileSuffix, savePath + partFileSuffix + partInfoSuffix} {
+			if _, err := os.Stat(path); !os.IsNotExist(err) {
+				t.Fatalf("下载完成后仍有 %s", filepath.Base(path))
+			}
+		}
+		os.Remove(savePath)
+		return result.Bytes
+	}
+	metadata := FileMetadata{FileName: "source.bin", FileSize: size, Checksum: sum, ChecksumAlgo: defaultChecksumAlgo}
+
+	t.Run("same file", func(t *testing.T) {
+		interrupted(metadata, content[:partial])
+		if got := download(); got != size-partial {
+			t.Fatalf("通过HTTP续传时下载了 %d 字节，期望只下载剩余的 %d 字节", got, size-partial)
+		}
+	})
+	t.Run("other file", func(t *testing.T) {
+		other := metadata
+		other.Checksum = strings.Repeat("0", len(sum))
+		interrupted(other, content[:partial])
+		if got := download(); got != size {
+			t.Fatalf("未完成的部分来自另一个文件时下载了 %d 字节，期望从头下载 %d 字节", got, size)
+		}
+	})
+	t.Run("corrupted part without checksum", func(t *testing.T) {
+		// 文件名和大小一致、没有校验和：身份比对通过，续传前校验发现已有部分不一致
+		unverified := metadata
+		unverified.Checksum, unverified.ChecksumAlgo = "", ""
+		corrupted := append([]byte(nil), content[:partial]...)
+		corrupted[partial/2] ^= 0xff
+		interrupted(unverified, corrupted)
+		if got := download(); got != size {
+			t.Fatalf("已有部分与发送端的文件不一致时下载了 %d 字节，期望从头下载 %d 字节", got, size)
+		}
+	})
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// portRange HTTP服务器可用的端口范围（--port-range，low为0表示不限制）
+type portRange struct {
+	low  int
+	high int
+}
+
+// parsePortRange 解析端口范围，格式 LOW-HIGH（如 40000-40100），空字符串表示不限制
+func parsePortRange(s string) (portRange, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return portRange{}, nil
+	}
+	lowStr, highStr, ok := strings.Cut(s, "-")
+	if !ok {
+		return portRange{}, fmt.Errorf("无效的端口范围: %s（格式: LOW-HIGH，如 40000-40100）", s)
+	}
+	low, err1 := strconv.Atoi(strings.TrimSpace(lowStr))
+	high, err2 := strconv.Atoi(strings.TrimSpace(highStr))
+	if err1 != nil || err2 != nil || low < 1 || high > 65535 || low > high {
+		return portRange{}, fmt.Errorf("无效的端口范围: %s（端口须在 1-65535 之间且 LOW 不大于 HIGH）", s)
+	}
+	return portRange{low: low, high: high}, nil
+}
+
+// pickListenPort 确定HTTP服务器端口：指定了port时直接使用；指定了端口范围时从低到高尝试，
+// 使用第一个能绑定的端口；否则由系统分配随机端口
+func pickListenPort(port int, r portRange) (int, error) {
+	if port != 0 {
+		return port, nil
+	}
+
+	if r.low == 0 {
+		listener, err := net.Listen("tcp", ":0")
+		if err != nil {
+			return 0, fmt.Errorf("监听端口失败: %w", err)
+		}
+		port = listener.Addr().(*net.TCPAddr).Port
+		listener.Close()
+		return port, nil
+	}
+
+	for p := r.low; p <= r.high; p++ {
+		listener, err := net.Listen("tcp", fmt.Sprintf(":%d", p))
+		if err != nil {
+			continue
+		}
+		listener.Close()
+		return p, nil
+	}
+	return 0, fmt.Errorf("端口范围 %d-%d 内没有可用的端口", r.low, r.high)
+}
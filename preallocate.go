@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"syscall"
+)
+
+// 预分配磁盘空间（receive --preallocate）：知道文件大小（WebRTC/TCP的元数据、HTTP的Content-Length）时，
+// 开始写入前为整个文件预留空间，减少大文件的碎片，磁盘空间不足时在开始接收前失败，而不是写到一半才失败。
+// Linux使用fallocate真正预留空间；其他系统或文件系统不支持时退回到设置文件大小（Windows的NTFS同样会分配空间，
+// macOS等可能只是稀疏文件，不保证预留）。写入时记录逻辑末尾，关闭时截断到实际写入的位置：
+// 接收完成时文件就是完整的大小，取消或中断时不留下预分配但没有写入的部分（--keep-partial和续传依赖这一点）。
+
+// preallocatedFile 预分配了空间的接收文件（可带写缓冲区），Close时截断到逻辑末尾（可重复调用）
+type preallocatedFile struct {
+	w      io.Writer     // 写入目标：buf或file
+	buf    *bufio.Writer // 写缓冲区（不缓冲时为nil）
+	file   *os.File
+	end    int64 // 逻辑末尾：已写入的数据之后的位置
+	closed bool
+}
+
+// Write 写入数据并推进逻辑末尾
+func (f *preallocatedFile) Write(p []byte) (int, error) {
+	n, err := f.w.Write(p)
+	f.end += int64(n)
+	return n, err
+}
+
+// Close 刷新缓冲区，截断掉预分配但没有写入的部分，同步并关闭文件，返回第一个出现的错误
+func (f *preallocatedFile) Close() error {
+	if f.closed {
+		return nil
+	}
+	f.closed = true
+	var err error
+	if f.buf != nil {
+		err = f.buf.Flush()
+	}
+	if truncErr := f.file.Truncate(f.end); err == nil {
+		err = truncErr
+	}
+	if syncErr := f.file.Sync(); err == nil {
+		err = syncErr
+	}
+	if closeErr := f.file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// createPreallocatedTarget 创建接收文件并从base处预分配size字节（base为追加或续传时已有的长度，0时清空已有内容），
+// 数据从base处开始写入；bufferSize大于0时使用写缓冲区
+func createPreallocatedTarget(savePath string, base, size int64, bufferSize int) (io.WriteCloser, error) {
+	flag := os.O_WRONLY | os.O_CREATE
+	if base == 0 {
+		flag |= os.O_TRUNC
+	}
+	file, err := os.OpenFile(savePath, flag, 0666)
+	if err != nil {
+		return nil, fmt.Errorf("创建文件失败: %w", err)
+	}
+	if err := preallocateFile(file, base, size); err != nil {
+		file.Close()
+		if base == 0 {
+			os.Remove(savePath)
+		}
+		return nil, err
+	}
+	if _, err := file.Seek(base, io.SeekStart); err != nil {
+		file.Truncate(base)
+		file.Close()
+		return nil, fmt.Errorf("创建文件失败: %w", err)
+	}
+
+	f := &preallocatedFile{w: file, file: file, end: base}
+	if bufferSize > 0 {
+		f.buf = bufio.NewWriterSize(file, bufferSize)
+		f.w = f.buf
+	}
+	return f, nil
+}
+
+// preallocateFile 为file预留[offset, offset+size)的空间：不支持快速预分配时退回到设置文件大小，磁盘空间不足时返回错误
+func preallocateFile(file *os.File, offset, size int64) error {
+	err := fallocate(file, offset, size)
+	if err == nil {
+		fmt.Printf("已预分配磁盘空间: %s\n", formatByteSize(size))
+		return nil
+	}
+	if errors.Is(err, syscall.ENOSPC) {
+		return fmt.Errorf("磁盘空间不足，无法预分配 %s", formatByteSize(size))
+	}
+	if !errors.Is(err, errors.ErrUnsupported) {
+		return fmt.Errorf("预分配磁盘空间失败: %w", err)
+	}
+	if err := file.Truncate(offset + size); err != nil {
+		if errors.Is(err, syscall.ENOSPC) {
+			return fmt.Errorf("磁盘空间不足，无法预分配 %s", formatByteSize(size))
+		}
+		return fmt.Errorf("预分配磁盘空间失败: %w", err)
+	}
+	fmt.Printf("文件系统不支持快速预分配，已把文件大小设为 %s（不保证预留磁盘空间）\n", formatByteSize(offset+size))
+	return nil
+}
@@ -0,0 +1,16 @@
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// fallocate 用fallocate(2)为file预留[offset, offset+size)的空间（文件系统不支持时错误满足errors.Is(err, errors.ErrUnsupported)）
+func fallocate(file *os.File, offset, size int64) error {
+	for {
+		err := syscall.Fallocate(int(file.Fd()), 0, offset, size)
+		if err != syscall.EINTR {
+			return err
+		}
+	}
+}
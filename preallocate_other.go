@@ -0,0 +1,13 @@
+//go:build !linux
+
+package main
+
+import (
+	"errors"
+	"os"
+)
+
+// fallocate 非Linux系统没有fallocate，由preallocateFile退回到设置文件大小
+func fallocate(file *os.File, offset, size int64) error {
+	return errors.ErrUnsupported
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// TestPreallocate 预分配的文件在写入前就是完整大小，完整下载后大小和内容与源文件一致；
+// 下载被取消（--keep-partial）时截断到实际收到的字节数；追加时从已有内容之后预分配和写入
+func TestPreallocate(t *testing.T) {
+	const size, sent = 1024 * 1024, 256 * 1024
+	dir := t.TempDir()
+	content := make([]byte, size)
+	rand.Read(content)
+	src := filepath.Join(dir, "source.bin")
+	if err := os.WriteFile(src, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+	mux := http.NewServeMux()
+	registerFileHandlers(mux, []string{src}, newLazyChecksum(src, defaultChecksumAlgo), nil)
+	// 只发送一部分数据后停住，直到接收端取消
+	mux.HandleFunc("/stall", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", strconv.Itoa(size))
+		w.Write(content[:sent])
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	t.Run("append", func(t *testing.T) {
+		// 已有内容之后预分配，关闭后截断到实际写入的位置
+		appendPath := filepath.Join(t.TempDir(), "append.log")
+		if err := os.WriteFile(appendPath, []byte("head\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		target, err := createPreallocatedTarget(appendPath, 5, 100, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info, _ := os.Stat(appendPath); info == nil || info.Size() != 105 {
+			target.Close()
+			t.Fatal("预分配后文件大小不是 105 字节")
+		}
+		io.WriteString(target, "tail\n")
+		if err := target.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if got, _ := os.ReadFile(appendPath); string(got) != "head\ntail\n" {
+			t.Fatalf("追加并截断后的内容为 %q", got)
+		}
+	})
+
+	t.Run("complete", func(t *testing.T) {
+		savePath := filepath.Join(t.TempDir(), "received.bin")
+		receiver := NewHTTPReceiver(server.URL+"/download", savePath)
+		receiver.preallocate = true
+		if _, err := receiver.Start(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		if got, _ := os.ReadFile(savePath); !bytes.Equal(got, content) {
+			t.Fatalf("预分配后下载的文件与源文件不一致（%d 字节）", len(got))
+		}
+	})
+
+	t.Run("canceled", func(t *testing.T) {
+		partialPath := filepath.Join(t.TempDir(), "partial.bin")
+		receiver := NewHTTPReceiver(server.URL+"/stall", partialPath)
+		receiver.preallocate = true
+		receiver.keepPartial = true
+		errc := make(chan error, 1)
+		go func() {
+			_, err := receiver.Start(context.Background())
+			errc <- err
+		}()
+		time.Sleep(500 * time.Millisecond)
+		if info, _ := os.Stat(partialPath + partFileSuffix); info == nil || info.Size() != size {
+			receiver.Cancel()
+			<-errc
+			t.Fatalf("下载过程中文件不是预分配的 %d 字节", size)
+		}
+		receiver.Cancel()
+		if err := <-errc; !errors.Is(err, errTransferCanceled) {
+			t.Fatalf("取消下载返回 %v，期望已取消", err)
+		}
+		if got, _ := os.ReadFile(partialPath + partFileSuffix); !bytes.Equal(got, content[:sent]) {
+			t.Fatalf("取消后保留的文件为 %d 字节，期望截断到已接收的 %d 字节", len(got), sent)
+		}
+	})
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pion/stun"
+	"github.com/pion/turn/v2"
+	"github.com/pion/webrtc/v3"
+	"github.com/spf13/cobra"
+)
+
+// 服务器连通性检查（ftf probe）：按传输时相同的配置（--stun、--turn、--signaling、配置文件和默认值）
+// 逐个检查信令服务器、STUN服务器和TURN服务器，每项输出PASS/FAIL和耗时，全部通过时退出码为0。
+// 信令服务器：连接WebSocket并加入一个不存在的房间，收到服务器的回复即为通过（不创建房间）；
+// STUN服务器：发送Binding请求，输出本机的公网映射地址；
+// TURN服务器：使用配置的用户名和密码申请中继地址（Allocate），输出分配到的中继地址后释放。
+
+// runProbe 执行连通性检查，有检查项失败时以退出码1退出
+func runProbe(cmd *cobra.Command, args []string) {
+	stunServers, _ := cmd.Flags().GetStringSlice("stun")
+	turnServers, _ := cmd.Flags().GetStringSlice("turn")
+	signalingURL, _ := cmd.Flags().GetString("signaling")
+	timeout, _ := cmd.Flags().GetDuration("timeout")
+	debug, _ := cmd.Flags().GetBool("debug")
+
+	if signalingURL == "" {
+		signalingURL = getDefaultSignalingURL()
+	}
+	iceServers := getDefaultICEServers(strings.Join(stunServers, ","), strings.Join(turnServers, ","), debug)
+
+	failed := 0
+	report := func(name string, started time.Time, detail string, err error) {
+		elapsed := time.Since(started).Round(time.Millisecond)
+		if err != nil {
+			failed++
+			fmt.Printf("FAIL %s（%v）: %v\n", name, elapsed, err)
+			return
+		}
+		if detail != "" {
+			detail = "，" + detail
+		}
+		fmt.Printf("PASS %s（%v）%s\n", name, elapsed, detail)
+	}
+
+	checked := 0
+	for _, u := range parseSignalingURLs(signalingURL) {
+		started := time.Now()
+		err := probeSignaling(u, timeout)
+		report("信令服务器 "+u, started, "", err)
+		checked++
+	}
+	for _, server := range iceServers {
+		for _, rawURL := range server.URLs {
+			started := time.Now()
+			var detail string
+			var err error
+			if strings.HasPrefix(rawURL, "stun") {
+				detail, err = probeSTUN(rawURL, timeout)
+			} else {
+				detail, err = probeTURN(rawURL, server, timeout)
+			}
+			report(rawURL, started, detail, err)
+			checked++
+		}
+	}
+
+	if checked == 0 {
+		fmt.Println("没有需要检查的服务器")
+		return
+	}
+	if failed > 0 {
+		fmt.Printf("%d / %d 项检查失败\n", failed, checked)
+		os.Exit(1)
+	}
+	fmt.Printf("全部 %d 项检查通过\n", checked)
+}
+
+// probeSignaling 连接信令服务器并加入一个不存在的房间，在timeout内收到任何回复即为通过
+func probeSignaling(serverURL string, timeout time.Duration) error {
+	type result struct {
+		client *SignalingClient
+		err    error
+	}
+	dialed := make(chan result, 1)
+	go func() {
+		client, err := dialSignalingServer(serverURL)
+		dialed <- result{client, err}
+	}()
+
+	var client *SignalingClient
+	select {
+	case r := <-dialed:
+		if r.err != nil {
+			return r.err
+		}
+		client = r.client
+	case <-time.After(timeout):
+		// 连接最终建立时关闭
+		go func() {
+			if r := <-dialed; r.client != nil {
+				r.client.Close()
+			}
+		}()
+		return fmt.Errorf("连接超时")
+	}
+	defer client.Close()
+
+	client.Send(&Message{Type: "join_room", RoomID: fmt.Sprintf("probe-%d", time.Now().UnixNano())})
+	if _, err := client.Receive(timeout); err != nil {
+		return fmt.Errorf("等待服务器回复: %w", err)
+	}
+	return nil
+}
+
+// probeSTUN 向STUN服务器发送Binding请求，返回本机的公网映射地址
+func probeSTUN(rawURL string, timeout time.Duration) (string, error) {
+	uri, err := stun.ParseURI(rawURL)
+	if err != nil {
+		return "", fmt.Errorf("无效的地址: %w", err)
+	}
+	client, closeClient, err := newProbeTURNClient(uri, "", "", timeout)
+	if err != nil {
+		return "", err
+	}
+	defer closeClient()
+
+	mapped, err := withProbeTimeout(timeout, closeClient, client.SendBindingRequest)
+	if err != nil {
+		return "", fmt.Errorf("Binding请求失败: %w", err)
+	}
+	return fmt.Sprintf("公网映射地址: %s", mapped), nil
+}
+
+// probeTURN 使用server中的用户名和密码向TURN服务器申请中继地址，返回分配到的中继地址
+func probeTURN(rawURL string, server webrtc.ICEServer, timeout time.Duration) (string, error) {
+	uri, err := stun.ParseURI(rawURL)
+	if err != nil {
+		return "", fmt.Errorf("无效的地址: %w", err)
+	}
+	password, _ := server.Credential.(string)
+	client, closeClient, err := newProbeTURNClient(uri, server.Username, password, timeout)
+	if err != nil {
+		return "", err
+	}
+	defer closeClient()
+
+	relayed, err := withProbeTimeout(timeout, closeClient, func() (net.Addr, error) {
+		relayConn, err := client.Allocate()
+		if err != nil {
+			return nil, err
+		}
+		defer relayConn.Close()
+		return relayConn.LocalAddr(), nil
+	})
+	if err != nil {
+		if server.Username == "" {
+			return "", fmt.Errorf("申请中继地址失败（未配置用户名和密码）: %w", err)
+		}
+		return "", fmt.Errorf("申请中继地址失败（用户名: %s）: %w", server.Username, err)
+	}
+	return fmt.Sprintf("中继地址: %s", relayed), nil
+}
+
+// newProbeTURNClient 按uri的协议（UDP、TCP或TLS）连接STUN/TURN服务器并创建客户端（用户名为空时只能发送Binding请求），
+// 返回的关闭函数关闭客户端和连接（可重复调用）
+func newProbeTURNClient(uri *stun.URI, username, password string, timeout time.Duration) (*turn.Client, func(), error) {
+	addr := net.JoinHostPort(uri.Host, fmt.Sprint(uri.Port))
+
+	var conn net.PacketConn
+	switch {
+	case uri.Scheme == stun.SchemeTypeTURNS || uri.Scheme == stun.SchemeTypeSTUNS:
+		dialer := &net.Dialer{Timeout: timeout}
+		tlsConn, err := tls.DialWithDialer(dialer, "tcp", addr, &tls.Config{ServerName: uri.Host})
+		if err != nil {
+			return nil, nil, fmt.Errorf("TLS连接失败: %w", err)
+		}
+		conn = turn.NewSTUNConn(tlsConn)
+	case uri.Proto == stun.ProtoTypeTCP:
+		tcpConn, err := net.DialTimeout("tcp", addr, timeout)
+		if err != nil {
+			return nil, nil, fmt.Errorf("TCP连接失败: %w", err)
+		}
+		conn = turn.NewSTUNConn(tcpConn)
+	default:
+		udpConn, err := net.ListenPacket("udp4", "0.0.0.0:0")
+		if err != nil {
+			return nil, nil, fmt.Errorf("创建UDP套接字失败: %w", err)
+		}
+		conn = udpConn
+	}
+
+	client, err := turn.NewClient(&turn.ClientConfig{
+		STUNServerAddr: addr,
+		TURNServerAddr: addr,
+		Username:       username,
+		Password:       password,
+		Conn:           conn,
+	})
+	if err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+	var once sync.Once
+	closeClient := func() {
+		once.Do(func() {
+			client.Close()
+			conn.Close()
+		})
+	}
+	if err := client.Listen(); err != nil {
+		closeClient()
+		return nil, nil, err
+	}
+	return client, closeClient, nil
+}
+
+// withProbeTimeout 在timeout内执行fn，超时时调用abort（关闭客户端使fn返回）并返回超时错误
+func withProbeTimeout(timeout time.Duration, abort func(), fn func() (net.Addr, error)) (net.Addr, error) {
+	type result struct {
+		addr net.Addr
+		err  error
+	}
+	done := make(chan result, 1)
+	go func() {
+		addr, err := fn()
+		done <- result{addr, err}
+	}()
+	select {
+	case r := <-done:
+		return r.addr, r.err
+	case <-time.After(timeout):
+		abort()
+		return nil, fmt.Errorf("%v 内没有回复（UDP可能被防火墙拦截，或地址错误）", timeout)
+	}
+}
@@ -1,9 +1,14 @@
 package main
 
 import (
+	"bytes"
+	"context"
 	"fmt"
+	"io"
 	"net/url"
+	"path/filepath"
 	"strings"
+	"time"
 )
 
 // AutoReceiver 自动判断接收模式
@@ -15,6 +20,34 @@ type AutoReceiver struct {
 	turnServer   string
 	signalingURL string
 	roomID       string
+	stallTimeout time.Duration
+	resumeWait   time.Duration // 连接中断后等待发送端重启并续传的最长时间（--wait）
+	confirm      bool   // 接收前交互确认
+	organize     string // 按日期/对端整理到子目录
+	outputTemplate string // 接收文件的命名模板（--output-template）
+	graph        bool   // 显示速度曲线
+	maxSize      int64  // 允许接收的最大文件大小（0表示不限制）
+	bufferSize   int    // HTTP下载缓冲区大小
+	writeBufferSize int // 写文件缓冲区大小（0表示不缓冲）
+	preallocate  bool   // 知道文件大小时预先分配磁盘空间
+	pick         string // 只接收清单中的指定文件（HTTP模式）
+	output       io.Writer // 不为nil时数据写入output而不是保存为文件
+	result       *TransferResult // HTTP或WebRTC接收端返回的传输结果（还没有开始接收时为nil）
+	// HTTP参数
+	skipExisting bool
+	noVerify     bool
+	keepPartial  bool // 取消下载时保留未完成的文件
+	resumeVerify bool // 已有未完成的文件时校验已有部分后续传
+	minSpeed     int64 // 最低速度（字节/秒，0表示不检测）
+	relayBudget  int64 // WebRTC连接经TURN中继时最多接收的字节数（0表示不限制）
+	statsInterval time.Duration // WebRTC连接统计的采样间隔（0表示不采样）
+	deferSync    bool  // 接收到.ft-incoming子目录，完成后再移动到保存位置
+	appendMode   bool  // 追加到已有文件之后而不是覆盖（--append）
+	resume       bool  // 接收目录时跳过已完成的文件（--resume）
+	password     string // 解密文件数据的密码（--password，HTTP模式不支持）
+	httpUser     string
+	httpPass     string
+	*canceler         // Cancel: 取消正在进行的接收（HTTP或WebRTC），Start返回errTransferCanceled
 }
 
 // NewAutoReceiver 创建自动接收器
@@ -26,17 +59,45 @@ func NewAutoReceiver(address, savePath, stunServer, turnServer, signalingURL, ro
 		turnServer:   turnServer,
 		signalingURL: signalingURL,
 		roomID:       roomID,
+		stallTimeout: defaultStallTimeout,
+		writeBufferSize: defaultWriteBufferSize,
+		canceler:     newCanceler(),
 	}
 }
 
-// Start 开始接收文件（自动判断模式）
-func (r *AutoReceiver) Start() error {
+// Start 开始接收文件（自动判断模式，可以在其他goroutine中调用Cancel取消），返回传输结果（见result.go）
+// ctx取消时（如收到Ctrl+C）调用Cancel中止接收
+func (r *AutoReceiver) Start(ctx context.Context) (*TransferResult, error) {
+	defer context.AfterFunc(ctx, r.Cancel)()
+	r.result = nil
+	err := errTransferCanceled
+	if !r.isCanceled() {
+		err = r.canceledOr(r.start())
+	}
+	if r.result == nil {
+		return &TransferResult{}, err
+	}
+	return r.result, err
+}
+
+// start 按地址类型选择接收模式
+func (r *AutoReceiver) start() error {
+	// ft://分享链接
+	if isMagicLink(r.address) {
+		return r.startMagicLink()
+	}
+
+	// 直接TCP模式（发送端使用了--tcp）
+	if addr, ok := tcpAddress(r.address); ok {
+		fmt.Println("检测到TCP地址，使用直接TCP连接接收...")
+		return r.startTCP(addr)
+	}
+
 	// 判断是HTTP还是WebRTC
 	if r.isHTTPAddress(r.address) {
 		// HTTP模式
 		fmt.Println("检测到HTTP地址，使用HTTP模式下载...")
-		receiver := NewHTTPReceiver(r.address, r.savePath)
-		return receiver.Start()
+		return r.startHTTP(r.address)
 	} else {
 		// WebRTC模式（文件编号或SDP）
 		fmt.Println("检测到WebRTC模式，使用WebRTC接收...")
@@ -49,16 +110,187 @@ func (r *AutoReceiver) Start() error {
 			sdpOffer = parts[1]
 		}
 		
-		// 如果savePath为空，使用默认目录
-		if r.savePath == "" || r.savePath == "." {
-			r.savePath = "D:\\ft_download"
+		return r.startWebRTC(fileID, sdpOffer)
+	}
+}
+
+// startMagicLink 根据ft://分享链接选择模式并接收
+// 命令行显式指定的参数优先于链接中的值
+func (r *AutoReceiver) startMagicLink() error {
+	link, err := parseMagicLink(r.address)
+	if err != nil {
+		return err
+	}
+
+	if r.signalingURL == "" {
+		r.signalingURL = link.SignalingURL
+	}
+	if r.stunServer == "" {
+		r.stunServer = link.STUNServer
+	}
+	if r.turnServer == "" {
+		r.turnServer = link.TURNServer
+	}
+	if r.roomID == "" {
+		r.roomID = link.RoomID
+	}
+	if link.FileName != "" {
+		if err := r.applySuggestedName(link.FileName); err != nil {
+			return err
 		}
-		
-		receiver := NewWebRTCReceiver(fileID, sdpOffer, r.savePath, r.stunServer, r.turnServer, r.signalingURL, r.roomID, false)
-		return receiver.Start()
+	}
+
+	switch link.Mode {
+	case linkModeHTTP:
+		fmt.Println("检测到分享链接（HTTP模式），使用HTTP模式下载...")
+		return r.startHTTP(link.HTTPURL)
+	case linkModeWebRTC:
+		fmt.Println("检测到分享链接（WebRTC模式），使用WebRTC接收...")
+		return r.startWebRTC(link.FileID, "")
+	default:
+		// 混合模式：局域网HTTP可达时优先使用HTTP（指定了--password时只使用WebRTC，HTTP下载不加密）
+		if link.HTTPURL != "" && r.password == "" && isHTTPReachable(link.HTTPURL, 3*time.Second) {
+			fmt.Println("检测到分享链接，局域网地址可达，使用HTTP模式下载...")
+			return r.startHTTP(link.HTTPURL)
+		}
+		if link.FileID == "" {
+			return fmt.Errorf("HTTP地址不可达: %s", link.HTTPURL)
+		}
+		fmt.Println("检测到分享链接，局域网地址不可达，使用WebRTC接收...")
+		return r.startWebRTC(link.FileID, "")
 	}
 }
 
+// applySuggestedName 使用分享链接建议的文件名：保存位置是目录（包括未指定时的默认目录）时保存为该目录下的这个文件名，
+// 已存在同名文件时加序号；命令行指定了文件路径、--organize、--output-template或--pick时忽略
+func (r *AutoReceiver) applySuggestedName(name string) error {
+	if r.output != nil {
+		return nil
+	}
+	if r.organize != "" || r.outputTemplate != "" || r.pick != "" {
+		fmt.Printf("忽略分享链接建议的文件名 %s（已指定 --organize、--output-template 或 --pick）\n", name)
+		return nil
+	}
+	path, fromDir, err := resolveSavePath(r.savePath, name)
+	if err != nil {
+		return err
+	}
+	if !fromDir {
+		fmt.Printf("使用命令行指定的保存路径，忽略分享链接建议的文件名 %s\n", name)
+		return nil
+	}
+	// 追加模式下要写入已有的文件，不加序号
+	if !r.appendMode {
+		path = uniqueFilePath(path)
+	}
+	fmt.Printf("使用分享链接建议的文件名: %s（指定保存文件路径可以覆盖）\n", filepath.Base(path))
+	r.savePath = path
+	return nil
+}
+
+// startHTTP 使用HTTP模式下载
+func (r *AutoReceiver) startHTTP(downloadURL string) error {
+	if r.password != "" {
+		return fmt.Errorf("HTTP模式不支持 --password（HTTP下载不加密），发送端需使用 --webrtc 或 --tcp 加 --password 发送")
+	}
+	receiver := NewHTTPReceiver(normalizeHTTPAddress(downloadURL), r.savePath)
+	receiver.skipExisting = r.skipExisting
+	receiver.noVerify = r.noVerify
+	receiver.httpUser = r.httpUser
+	receiver.httpPass = r.httpPass
+	receiver.confirm = r.confirm
+	receiver.organize = r.organize
+	receiver.outputTemplate = r.outputTemplate
+	receiver.graph = r.graph
+	receiver.maxSize = r.maxSize
+	receiver.minSpeed = r.minSpeed
+	receiver.deferSync = r.deferSync
+	receiver.appendMode = r.appendMode
+	receiver.resume = r.resume
+	receiver.bufferSize = r.bufferSize
+	receiver.writeBufferSize = r.writeBufferSize
+	receiver.preallocate = r.preallocate
+	receiver.pick = r.pick
+	receiver.output = r.output
+	receiver.keepPartial = r.keepPartial
+	receiver.resumeVerify = r.resumeVerify
+	r.onCancel(receiver.Cancel) // 取消由r的ctx或Cancel经onCancel传递
+	result, err := receiver.Start(context.Background())
+	r.result = result
+	return err
+}
+
+// startWebRTC 使用WebRTC模式接收
+func (r *AutoReceiver) startWebRTC(fileID, sdpOffer string) error {
+	return r.receiveWebRTC(fileID, sdpOffer, "")
+}
+
+// startTCP 直接TCP模式接收（addr为发送端的主机:端口）
+func (r *AutoReceiver) startTCP(addr string) error {
+	return r.receiveWebRTC("", "", addr)
+}
+
+// receiveWebRTC 创建WebRTCReceiver并接收（tcpAddr不为空时直接连接发送端的TCP端口）
+func (r *AutoReceiver) receiveWebRTC(fileID, sdpOffer, tcpAddr string) error {
+	// WebRTC发送端连接后才逐个发送文件的元数据，没有文件清单
+	if r.pick != "" {
+		return fmt.Errorf("WebRTC模式暂不支持 --pick（没有文件清单），请使用HTTP地址")
+	}
+
+	// 如果savePath为空，使用默认目录（写入output时不需要）
+	if r.output == nil && (r.savePath == "" || r.savePath == ".") {
+		defaultDir, err := ensureDefaultSaveDir()
+		if err != nil {
+			return err
+		}
+		r.savePath = defaultDir
+	}
+
+	receiver := NewWebRTCReceiver(fileID, sdpOffer, r.savePath, r.stunServer, r.turnServer, r.signalingURL, r.roomID, false)
+	receiver.stallTimeout = r.stallTimeout
+	receiver.resumeWait = r.resumeWait
+	receiver.confirm = r.confirm
+	receiver.organize = r.organize
+	receiver.outputTemplate = r.outputTemplate
+	receiver.graph = r.graph
+	receiver.maxSize = r.maxSize
+	receiver.minSpeed = r.minSpeed
+	receiver.relayBudget = r.relayBudget
+	receiver.statsInterval = r.statsInterval
+	receiver.deferSync = r.deferSync
+	receiver.appendMode = r.appendMode
+	receiver.resume = r.resume
+	receiver.password = r.password
+	receiver.noVerify = r.noVerify
+	receiver.writeBufferSize = r.writeBufferSize
+	receiver.preallocate = r.preallocate
+	receiver.output = r.output
+	receiver.tcpAddr = tcpAddr
+	r.onCancel(receiver.Cancel)
+	result, err := receiver.Start(context.Background())
+	r.result = result
+	return err
+}
+
+// ReceiveBytes 接收文件并返回其内容而不保存到磁盘（适合小文件，可配合maxSize限制大小）
+func (r *AutoReceiver) ReceiveBytes(ctx context.Context) ([]byte, error) {
+	var buf bytes.Buffer
+	r.output = &buf
+	defer func() { r.output = nil }()
+	if _, err := r.Start(ctx); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// normalizeHTTPAddress 补全省略了协议的HTTP地址（如 192.168.1.2:8080/download、[fd00::1]:8080/download）
+func normalizeHTTPAddress(addr string) string {
+	if strings.Contains(addr, "://") {
+		return addr
+	}
+	return "http://" + addr
+}
+
 // isHTTPAddress 判断是否是HTTP地址
 func (r *AutoReceiver) isHTTPAddress(addr string) bool {
 	// 检查是否是URL格式
@@ -74,6 +306,11 @@ func (r *AutoReceiver) isHTTPAddress(addr string) bool {
 		}
 	}
 	
+	// 方括号开头的是IPv6地址（如 [fd00::1]:8080/download），按HTTP处理
+	if strings.HasPrefix(addr, "[") {
+		return true
+	}
+	
 	// 如果包含://，但不是http/https，可能是其他协议
 	if strings.Contains(addr, "://") {
 		return false
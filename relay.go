@@ -0,0 +1,295 @@
+package main
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// 信令服务器中转（--relay-via-signaling）：P2P和TURN都无法连接时的最后手段
+// 数据与DataChannel上的格式相同（元数据长度+元数据+文件数据），按块base64编码后作为data消息经信令服务器转发
+const (
+	maxRelayFileSize = 64 * 1024 * 1024 // 允许中转的最大文件大小（服务器可能设置更小的上限）
+	relayWindow      = 1024 * 1024      // 未确认数据上限，限制信令服务器和发送队列中积压的消息数
+)
+
+// errRelayClosed 中转已结束（接收端离开、出错或取消），无法继续发送
+var errRelayClosed = errors.New("信令服务器中转已结束")
+
+// relaySender 经信令服务器中转的数据发送器
+// offset为数据块在数据流中的位置（包括开头的元数据），接收端用data_ack确认已处理的位置
+type relaySender struct {
+	client  *SignalingClient
+	roomID  string
+	sent    int64         // 已发送的字节数（仅发送goroutine访问）
+	acked   int64         // 接收端已确认的字节数（原子访问）
+	ackChan chan struct{} // 收到确认时通知
+	closed  chan struct{} // 中转结束时关闭
+}
+
+// newRelaySender 创建中转发送器
+func newRelaySender(client *SignalingClient, roomID string) *relaySender {
+	return &relaySender{
+		client:  client,
+		roomID:  roomID,
+		ackChan: make(chan struct{}, 1),
+		closed:  make(chan struct{}),
+	}
+}
+
+// Send 发送一个数据块，未确认数据超过窗口时等待接收端确认
+func (r *relaySender) Send(data []byte) error {
+	for r.sent-atomic.LoadInt64(&r.acked) > relayWindow {
+		select {
+		case <-r.ackChan:
+		case <-r.closed:
+			return errRelayClosed
+		}
+	}
+
+	r.client.Send(&Message{
+		Type:   "data",
+		RoomID: r.roomID,
+		Offset: r.sent,
+		Data:   base64.StdEncoding.EncodeToString(data),
+	})
+	r.sent += int64(len(data))
+	return nil
+}
+
+// ack 记录接收端确认的位置
+func (r *relaySender) ack(offset int64) {
+	if offset > atomic.LoadInt64(&r.acked) {
+		atomic.StoreInt64(&r.acked, offset)
+	}
+	select {
+	case r.ackChan <- struct{}{}:
+	default:
+	}
+}
+
+// startRelay 经信令服务器中转发送文件，不建立P2P连接
+func (s *WebRTCSender) startRelay() error {
+	fileName, fileSize, err := s.sourceInfo()
+	if err != nil {
+		return err
+	}
+	if fileSize > maxRelayFileSize {
+		return fmt.Errorf("文件大小 %s 超过信令服务器中转上限 %s，请使用P2P或HTTP模式", formatByteSize(fileSize), formatByteSize(maxRelayFileSize))
+	}
+
+	if s.fileID == "" {
+		s.fileID = generateUniqueFileID()
+		defer releaseFileID(s.fileID)
+	}
+
+	fmt.Println("=== 信令服务器中转 - 发送端 ===")
+	fmt.Println("注意: 文件数据将经信令服务器中转，速度较慢，仅建议在P2P和TURN都无法连接时使用")
+
+	signalingURL := s.signalingURL
+	if signalingURL == "" {
+		signalingURL = getDefaultSignalingURL()
+		fmt.Printf("使用默认信令服务器: %s\n", signalingURL)
+	}
+
+	client, err := NewSignalingClient(signalingURL)
+	if err != nil {
+		return fmt.Errorf("连接信令服务器失败: %w", err)
+	}
+	defer client.Close()
+	s.onCancel(client.Close)
+
+	roomID := s.roomID
+	if roomID == "" {
+		roomID = s.fileID
+	}
+	client.Send(&Message{
+		Type:   "create_room",
+		RoomID: roomID,
+	})
+	msg, err := client.Receive(5 * time.Second)
+	if err != nil {
+		return fmt.Errorf("等待房间创建失败: %w", err)
+	}
+	if msg.Type == "error" {
+		return fmt.Errorf("创建房间失败: %s", msg.Error)
+	}
+	if msg.Type != "room_created" {
+		return fmt.Errorf("意外的消息类型: %s", msg.Type)
+	}
+
+	fmt.Printf("房间已创建: %s\n", roomID)
+	fmt.Printf("文件编号: %s\n", s.fileID)
+	link := &MagicLink{
+		Mode:         linkModeWebRTC,
+		FileID:       s.fileID,
+		SignalingURL: signalingURL,
+		RoomID:       roomID,
+	}
+	fmt.Printf("分享链接: %s\n", link.String())
+	fmt.Println("\n等待接收端加入...")
+
+	for {
+		msg, err := client.Receive(5 * time.Minute)
+		if err != nil {
+			return fmt.Errorf("等待接收端加入失败: %w", err)
+		}
+		if msg.Type == "peer_joined" {
+			break
+		} else if msg.Type == "error" {
+			return fmt.Errorf("信令服务器错误: %s", msg.Error)
+		} else if msg.Type == "server_shutdown" {
+			return fmt.Errorf("信令服务器已关闭")
+		}
+		// 其他消息（如还没有接收端加入时的peer_left）与本次连接无关，继续等待
+	}
+	fmt.Println("接收端已加入，开始经信令服务器中转文件...")
+
+	relay := newRelaySender(client, roomID)
+	defer close(relay.closed)
+
+	// 接收确认和服务器通知
+	failed := make(chan error, 1)
+	go func() {
+		for {
+			msg, err := client.Receive(time.Hour)
+			if err != nil {
+				failed <- fmt.Errorf("信令服务器连接中断: %w", err)
+				return
+			}
+			switch msg.Type {
+			case "data_ack":
+				relay.ack(msg.Offset)
+			case "peer_left":
+				failed <- fmt.Errorf("接收端已离开（已确认 %d 字节）", atomic.LoadInt64(&relay.acked))
+				return
+			case "error":
+				failed <- fmt.Errorf("信令服务器错误: %s", msg.Error)
+				return
+			case "server_shutdown":
+				failed <- fmt.Errorf("信令服务器已关闭")
+				return
+			}
+		}
+	}()
+
+	s.stats.SetPeer(connectionSignaling, "")
+	fileSent := make(chan struct{})
+	go func() {
+		if err := s.sendFile(relay, fileName, fileSize); err != nil {
+			s.sendFailed <- err
+			return
+		}
+		close(fileSent)
+	}()
+
+	// 以接收端确认的字节数衡量进度
+	stalled := make(chan struct{}, 1)
+	stopWatch := make(chan struct{})
+	defer close(stopWatch)
+	go watchStall(func() int64 {
+		return atomic.LoadInt64(&relay.acked)
+	}, s.stallTimeout, nil, stalled, stopWatch)
+
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	sendDone := false
+	for {
+		select {
+		case err := <-failed:
+			// 接收端确认全部数据后会立即离开，peer_left可能先于下一次检查到达
+			if !sendDone {
+				select {
+				case <-fileSent:
+					sendDone = true
+				default:
+				}
+			}
+			if !sendDone || atomic.LoadInt64(&relay.acked) < relay.sent {
+				return err
+			}
+		case <-stalled:
+			return fmt.Errorf("传输停滞: %v 内没有数据进展", s.stallTimeout)
+		case err := <-s.sendFailed:
+			return err
+		case <-s.cancelDone():
+			return errTransferCanceled
+		case <-fileSent:
+			fileSent = nil
+			sendDone = true
+			fmt.Println("文件已发送完成，等待接收端确认...")
+		case <-ticker.C:
+		}
+
+		// 全部数据都已确认时传输完成
+		if sendDone && atomic.LoadInt64(&relay.acked) >= relay.sent {
+			if sent := atomic.LoadInt64(&s.totalSent); sent != fileSize {
+				return fmt.Errorf("文件未完整发送: %d / %d 字节", sent, fileSize)
+			}
+			fmt.Println("接收端已确认，传输完成")
+			client.CompleteTransfer(roomID)
+			return nil
+		}
+	}
+}
+
+// receiveRelay 接收经信令服务器中转的文件（发送端使用了--relay-via-signaling），first为收到的第一条data消息
+// 数据交给handleMessage处理，与DataChannel接收的流程相同
+func (r *WebRTCReceiver) receiveRelay(client *SignalingClient, roomID string, first *Message) error {
+	fmt.Println("注意: 发送端使用信令服务器中转文件数据，速度较慢")
+
+	r.state = 0
+	r.startTime = time.Now()
+	r.stats.SetPeer(connectionSignaling, "")
+	r.speedGraph = newSpeedGraph(r.graph)
+	r.speedMeter = newSpeedMeter(r.minSpeed)
+
+	timeout := r.stallTimeout
+	if timeout <= 0 {
+		timeout = 30 * time.Minute
+	}
+
+	var offset int64 // 数据流中已处理的位置
+	for msg := first; ; {
+		switch msg.Type {
+		case "data":
+			if msg.Offset != offset {
+				return fmt.Errorf("中转数据不连续: 期望位置 %d，收到 %d", offset, msg.Offset)
+			}
+			data, err := base64.StdEncoding.DecodeString(msg.Data)
+			if err != nil {
+				return fmt.Errorf("解码中转数据失败: %w", err)
+			}
+			if err := r.handleMessage(data); err != nil {
+				return err
+			}
+			offset += int64(len(data))
+			client.Send(&Message{
+				Type:   "data_ack",
+				RoomID: roomID,
+				Offset: offset,
+			})
+
+			// 接收完成或中止（超过大小限制、拒绝接收）
+			select {
+			case err := <-r.done:
+				return err
+			default:
+			}
+		case "peer_left":
+			return fmt.Errorf("发送端已离开（已接收 %d 字节）", atomic.LoadInt64(&r.totalReceived))
+		case "error":
+			return fmt.Errorf("信令服务器错误: %s", msg.Error)
+		case "server_shutdown":
+			return fmt.Errorf("信令服务器已关闭")
+		}
+
+		next, err := client.Receive(timeout)
+		if err != nil {
+			return fmt.Errorf("接收中转数据失败（已接收 %d 字节）: %w", atomic.LoadInt64(&r.totalReceived), err)
+		}
+		msg = next
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/pion/webrtc/v3"
+)
+
+// 中继流量限制（--relay-budget）：使用按流量计费的TURN服务器时，WebRTC连接建立后检查选中的候选对，
+// 经TURN中继（任一端是relay候选）时统计本次连接传输的文件数据，超过限制时中止传输并提示改用局域网模式；
+// 直接连接（host/srflx候选）以及直接TCP、经信令服务器中转的传输不限制。
+
+// relayBudget 经TURN中继传输的字节数限制
+type relayBudget struct {
+	limit int64 // 本次连接最多传输的字节数
+	base  int64 // 开始计数时的累计字节数（续传时为已传输的部分）
+}
+
+// newRelayBudget 检查pc选中的候选对，经TURN中继时返回流量限制；
+// limit<=0、pc为nil或直接连接时返回nil（不限制）。base为开始计数时的累计字节数
+func newRelayBudget(limit int64, pc *webrtc.PeerConnection, base int64) *relayBudget {
+	if limit <= 0 || pc == nil {
+		return nil
+	}
+	pair, err := selectedCandidatePair(pc)
+	if err != nil {
+		fmt.Printf("无法确定连接类型，不限制中继流量: %v\n", err)
+		return nil
+	}
+	if pair.Local.Typ != webrtc.ICECandidateTypeRelay && pair.Remote.Typ != webrtc.ICECandidateTypeRelay {
+		fmt.Printf("直接连接（本地 %s，对端 %s），不限制中继流量\n", pair.Local.Typ, pair.Remote.Typ)
+		return nil
+	}
+	fmt.Printf("注意: 连接经TURN服务器中继，本次连接最多传输 %s（--relay-budget）\n", formatByteSize(limit))
+	return &relayBudget{limit: limit, base: base}
+}
+
+// Check total为累计传输的字节数，本次连接传输的部分超过限制时返回错误（nil时不检测）
+func (b *relayBudget) Check(total int64) error {
+	if b == nil || total-b.base <= b.limit {
+		return nil
+	}
+	return fmt.Errorf("经TURN中继传输的数据已超过 --relay-budget 限制 %s，已中止传输（同一局域网内请改用HTTP模式 --http 或直接TCP模式 --tcp，不经过中继）", formatByteSize(b.limit))
+}
+
+// selectedCandidatePair 返回pc当前选中的ICE候选对（连接建立后才有）
+func selectedCandidatePair(pc *webrtc.PeerConnection) (*webrtc.ICECandidatePair, error) {
+	sctp := pc.SCTP()
+	if sctp == nil || sctp.Transport() == nil || sctp.Transport().ICETransport() == nil {
+		return nil, fmt.Errorf("连接尚未建立")
+	}
+	pair, err := sctp.Transport().ICETransport().GetSelectedCandidatePair()
+	if err != nil {
+		return nil, err
+	}
+	if pair == nil || pair.Local == nil || pair.Remote == nil {
+		return nil, fmt.Errorf("还没有选中的候选对")
+	}
+	return pair, nil
+}
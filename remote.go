@@ -0,0 +1,193 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 发送远程文件（send <http(s)地址>）：发送端不读取本地文件，而是从远程地址下载并直接转发给接收端
+// HTTP模式下每次下载请求都从远程地址重新获取；WebRTC模式在DataChannel打开后获取，
+// 远程服务器未提供文件大小时先下载到临时文件（接收端需要预先知道文件大小才能判断传输结束）。
+
+// remoteHTTPClient 获取远程文件的HTTP客户端
+// 只限制连接和等待响应头的时间，不限制总时长（大文件转发可能需要很久）
+var remoteHTTPClient = &http.Client{
+	Transport: &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           (&net.Dialer{Timeout: 15 * time.Second}).DialContext,
+		TLSHandshakeTimeout:   15 * time.Second,
+		ResponseHeaderTimeout: 30 * time.Second,
+	},
+}
+
+// remoteFile 远程文件信息
+type remoteFile struct {
+	URL  string
+	Name string
+	Size int64 // 远程服务器未提供Content-Length时为-1
+}
+
+// isRemoteURL 判断发送参数是否是远程文件地址
+func isRemoteURL(arg string) bool {
+	lower := strings.ToLower(arg)
+	return strings.HasPrefix(lower, "http://") || strings.HasPrefix(lower, "https://")
+}
+
+// openRemoteFile 请求远程文件，返回文件信息和响应体（调用方负责关闭）
+func openRemoteFile(rawURL string) (*remoteFile, io.ReadCloser, error) {
+	resp, err := remoteHTTPClient.Get(rawURL)
+	if err != nil {
+		var netErr net.Error
+		if errors.As(err, &netErr) && netErr.Timeout() {
+			return nil, nil, fmt.Errorf("连接远程服务器超时: %w", err)
+		}
+		return nil, nil, fmt.Errorf("连接远程服务器失败: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		if resp.StatusCode == http.StatusNotFound {
+			return nil, nil, fmt.Errorf("远程文件不存在（%s）: %s", resp.Status, rawURL)
+		}
+		return nil, nil, fmt.Errorf("远程服务器返回错误: %s", resp.Status)
+	}
+
+	return &remoteFile{
+		URL:  rawURL,
+		Name: remoteFileName(resp),
+		Size: resp.ContentLength,
+	}, resp.Body, nil
+}
+
+// remoteFileName 远程文件名：优先使用Content-Disposition，其次使用URL路径的最后一段
+func remoteFileName(resp *http.Response) string {
+	if _, params, err := mime.ParseMediaType(resp.Header.Get("Content-Disposition")); err == nil {
+		if name := filepath.Base(params["filename"]); params["filename"] != "" && name != "." && name != string(filepath.Separator) {
+			return name
+		}
+	}
+	name := urlFileName(resp.Request.URL.String())
+	if name == "" || name == "." || name == "/" {
+		return "download"
+	}
+	return name
+}
+
+// describeRemoteFile 打印远程文件信息
+func describeRemoteFile(remote *remoteFile) {
+	fmt.Printf("远程文件: %s\n", remote.URL)
+	fmt.Printf("文件: %s\n", remote.Name)
+	if remote.Size >= 0 {
+		fmt.Printf("大小: %d 字节 (%.2f MB)\n", remote.Size, float64(remote.Size)/1024/1024)
+	} else {
+		fmt.Println("大小: 未知（远程服务器未提供文件大小）")
+	}
+}
+
+// spoolRemoteFile 把远程文件下载到临时目录（保留原文件名），返回本地路径和清理函数
+func spoolRemoteFile(remote *remoteFile, body io.Reader) (string, func(), error) {
+	dir, err := os.MkdirTemp("", "ftf-remote-")
+	if err != nil {
+		return "", nil, fmt.Errorf("创建临时目录失败: %w", err)
+	}
+	cleanup := func() { os.RemoveAll(dir) }
+
+	path := filepath.Join(dir, remote.Name)
+	file, err := os.Create(path)
+	if err != nil {
+		cleanup()
+		return "", nil, fmt.Errorf("创建临时文件失败: %w", err)
+	}
+	n, err := io.Copy(file, body)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		cleanup()
+		return "", nil, fmt.Errorf("下载远程文件失败（已下载 %d 字节）: %w", n, err)
+	}
+	fmt.Printf("远程文件已下载到临时文件: %d 字节\n", n)
+	return path, cleanup, nil
+}
+
+// serveRemote 处理下载请求：从远程地址获取文件并转发给接收端
+// 返回已转发的字节数和是否已把文件完整转发
+func serveRemote(w http.ResponseWriter, r *http.Request, rawURL string) (int64, bool) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return 0, false
+	}
+
+	remote, body, err := openRemoteFile(rawURL)
+	if err != nil {
+		fmt.Printf("[%s] 获取远程文件失败: %v\n", r.RemoteAddr, err)
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return 0, false
+	}
+	defer body.Close()
+
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", remote.Name))
+	w.Header().Set("Content-Type", "application/octet-stream")
+	if remote.Size >= 0 {
+		w.Header().Set("Content-Length", strconv.FormatInt(remote.Size, 10))
+	}
+	w.WriteHeader(http.StatusOK)
+	if r.Method == http.MethodHead {
+		return 0, false
+	}
+
+	counter := &countingWriter{w: w}
+	startTime := time.Now()
+	var copyErr error
+	if remote.Size >= 0 {
+		done := make(chan struct{})
+		go reportServeProgress(r.RemoteAddr, byteRange{start: 0, length: remote.Size}, remote.Size, counter, done)
+		_, copyErr = io.CopyN(counter, body, remote.Size)
+		close(done)
+	} else {
+		fmt.Printf("[%s] 开始下载（文件大小未知）\n", r.RemoteAddr)
+		_, copyErr = io.Copy(counter, body)
+	}
+
+	sent := counter.Count()
+	if copyErr != nil {
+		fmt.Printf("[%s] 转发中断: 已发送 %d 字节 (%v)\n", r.RemoteAddr, sent, copyErr)
+		return sent, false
+	}
+	if remote.Size < 0 {
+		fmt.Printf("[%s] 下载完成: %d 字节，耗时 %.2f 秒\n", r.RemoteAddr, sent, time.Since(startTime).Seconds())
+	}
+	return sent, true
+}
+
+// prepareRemote WebRTC发送远程文件前获取文件信息
+// 远程服务器未提供文件大小时先下载到临时文件，改为发送临时文件；返回的清理函数删除临时文件
+func (s *WebRTCSender) prepareRemote() (func(), error) {
+	remote, body, err := openRemoteFile(s.filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	describeRemoteFile(remote)
+
+	if remote.Size >= 0 {
+		// DataChannel打开后重新请求，直接转发给接收端
+		s.remote = remote
+		return func() {}, nil
+	}
+	fmt.Println("WebRTC传输需要预先知道文件大小，先把远程文件下载到临时文件...")
+	path, cleanup, err := spoolRemoteFile(remote, body)
+	if err != nil {
+		return nil, err
+	}
+	s.filePath = path
+	return cleanup, nil
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/pion/webrtc/v3"
+)
+
+// 传输结果：单次传输的Start（WebRTC/TCP发送和接收、HTTP下载、push上传和receive --listen）返回*TransferResult，
+// 在程序中调用时不需要从输出中解析结果；命令行的结果行（--summary-only）和桌面通知也由它生成。
+// 失败时同样返回结果，Bytes等为失败前的情况。HTTP发送端和混合模式可以服务多次下载，没有单一的结果，仍只返回错误。
+
+// 连接类型（TransferResult.Connection）
+const (
+	connectionDirect    = "direct"    // WebRTC P2P直接连接（host/srflx候选）
+	connectionRelay     = "relay"     // WebRTC经TURN服务器中继
+	connectionHTTP      = "http"      // HTTP下载或上传
+	connectionTCP       = "tcp"       // 直接TCP模式
+	connectionSignaling = "signaling" // 经信令服务器中转（--relay-via-signaling）
+)
+
+// TransferResult 一次传输的结果
+type TransferResult struct {
+	Bytes        int64         // 传输的字节数（发送端为已交给连接的字节数，续传时包含之前已传输的部分）
+	Duration     time.Duration // 传输数据的耗时
+	AverageSpeed float64       // 平均速度（字节/秒）
+	PeakSpeed    float64       // 峰值速度（字节/秒，按1秒间隔采样，不足1秒时等于平均速度）
+	Path         string        // 接收端为保存的文件路径（写入调用方的Writer时为空），发送端为发送的文件路径或地址
+	Checksum     string        // 校验和（十六进制）：接收端为校验通过的值，发送端为告知接收端的值；没有时为空
+	ChecksumAlgo string        // 校验和的算法（见checksum.go）
+	Connection   string        // 连接类型: direct、relay、http、tcp、signaling（未建立连接时为空）
+	PeerAddress  string        // 对端地址（已知时）
+}
+
+// newTransferResult 按字节数、耗时和峰值速度创建结果（计算平均速度）
+func newTransferResult(bytes int64, duration time.Duration, peak float64) *TransferResult {
+	result := &TransferResult{Bytes: bytes, Duration: duration}
+	if duration > 0 {
+		result.AverageSpeed = float64(bytes) / duration.Seconds()
+	}
+	result.PeakSpeed = peak
+	if result.PeakSpeed < result.AverageSpeed {
+		result.PeakSpeed = result.AverageSpeed
+	}
+	return result
+}
+
+// transferStats 传输过程中记录的连接信息和峰值速度（可在多个goroutine中调用），结束后填入TransferResult
+type transferStats struct {
+	mu          sync.Mutex
+	connection  string    // 连接类型
+	peerAddress string    // 对端地址
+	lastAt      time.Time // 上次采样的时间
+	lastTotal   int64     // 上次采样时的累计字节数
+	peak        float64   // 峰值速度（字节/秒）
+	checksum    string    // 校验和及其算法
+	algo        string
+}
+
+// SetPeer 记录连接类型和对端地址（建立连接后调用）
+func (t *transferStats) SetPeer(connection, peerAddress string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.connection, t.peerAddress = connection, peerAddress
+}
+
+// SetChecksum 记录校验通过（接收端）或告知接收端（发送端）的校验和
+func (t *transferStats) SetChecksum(sum, algo string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.checksum, t.algo = sum, algo
+}
+
+// Update 更新累计传输的字节数，按1秒间隔采样峰值速度
+func (t *transferStats) Update(total int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := time.Now()
+	if t.lastAt.IsZero() {
+		t.lastAt, t.lastTotal = now, total
+		return
+	}
+	span := now.Sub(t.lastAt)
+	if span < time.Second {
+		return
+	}
+	if speed := float64(total-t.lastTotal) / span.Seconds(); speed > t.peak {
+		t.peak = speed
+	}
+	t.lastAt, t.lastTotal = now, total
+}
+
+// result 按字节数和耗时创建结果，填入记录的峰值速度、连接类型、对端地址和校验和
+func (t *transferStats) result(bytes int64, duration time.Duration) *TransferResult {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	result := newTransferResult(bytes, duration, t.peak)
+	result.Connection, result.PeerAddress = t.connection, t.peerAddress
+	result.Checksum, result.ChecksumAlgo = t.checksum, t.algo
+	return result
+}
+
+// webrtcConnection 按pc选中的候选对返回连接类型（direct或relay）和对端地址，无法确定时返回空
+func webrtcConnection(pc *webrtc.PeerConnection) (connection, peer string) {
+	if pc == nil {
+		return "", ""
+	}
+	pair, err := selectedCandidatePair(pc)
+	if err != nil {
+		return "", ""
+	}
+	connection = connectionDirect
+	if pair.Local.Typ == webrtc.ICECandidateTypeRelay || pair.Remote.Typ == webrtc.ICECandidateTypeRelay {
+		connection = connectionRelay
+	}
+	return connection, net.JoinHostPort(pair.Remote.Address, fmt.Sprint(pair.Remote.Port))
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+
+	"github.com/pion/webrtc/v3"
+)
+
+// 发送端重启后续传（WebRTC模式）：
+// 发送端指定了--room时，元数据带有传输会话ID（由房间ID和文件的名称、大小、修改时间决定，发送端以相同的--room和未修改的文件重启时得到相同的ID），
+// 接收端收到元数据后用resume控制消息回复已有的字节数（新传输为0），发送端从该位置开始发送。
+// 接收端指定--wait时，连接中断后保持文件打开，离开房间并重试加入，发送端重启后重新建立连接；
+// 新连接的元数据会话ID一致时回复已接收的字节数继续接收，不一致时报错。
+
+// resumeReplyTimeout 发送端等待接收端回复续传位置的时间（超时说明接收端不支持续传，从头发送）
+const resumeReplyTimeout = 10 * time.Second
+
+// rejoinInterval 等待续传时重试加入房间的间隔
+const rejoinInterval = 2 * time.Second
+
+// connectionLostError 连接中断（对端退出、ICE失败或传输停滞）导致的接收失败，--wait时可以等待发送端重启后续传
+type connectionLostError struct{ error }
+
+func (e connectionLostError) Unwrap() error { return e.error }
+
+// transferSessionID 计算可续传的传输会话ID（未指定房间ID时返回空，不支持续传）
+func transferSessionID(roomID, filePath string) string {
+	if roomID == "" {
+		return ""
+	}
+	info, err := os.Stat(filePath)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s\x00%s\x00%d\x00%d", roomID, filepath.Base(filePath), info.Size(), info.ModTime().UnixNano())))
+	return hex.EncodeToString(sum[:8])
+}
+
+// waitResume 等待接收端回复续传位置（接收端不支持续传或未回复时返回0）
+func (s *WebRTCSender) waitResume(fileSize int64) int64 {
+	select {
+	case offset := <-s.resumeOffsets:
+		if offset < 0 || offset > fileSize {
+			fmt.Printf("警告: 接收端回复的续传位置 %d 无效，从头发送\n", offset)
+			return 0
+		}
+		return offset
+	case <-s.cancelDone():
+		return 0
+	case <-time.After(resumeReplyTimeout):
+		fmt.Println("警告: 接收端未回复续传位置（可能是不支持续传的版本），从头发送")
+		return 0
+	}
+}
+
+// shouldWaitResume 接收中断后是否等待发送端重启并续传
+func (r *WebRTCReceiver) shouldWaitResume(err error) bool {
+	var lost connectionLostError
+	if r.resumeWait <= 0 || !errors.As(err, &lost) || r.isCanceled() {
+		return false
+	}
+	if r.metadata == nil || r.metadata.Session == "" || r.state != 2 {
+		if r.metadata != nil && r.metadata.Session == "" {
+			fmt.Println("\n发送端未指定 --room，不支持续传")
+		}
+		return false
+	}
+	r.fileMu.Lock()
+	defer r.fileMu.Unlock()
+	return r.file != nil
+}
+
+// joinRoom 加入房间；等待续传时房间不存在（发送端尚未重启）则在rejoinUntil之前持续重试
+func (r *WebRTCReceiver) joinRoom(client *SignalingClient, roomID string) (*Message, error) {
+	for {
+		client.Send(&Message{
+			Type:   "join_room",
+			RoomID: roomID,
+		})
+
+		// 等待加入确认
+		msg, err := client.Receive(5 * time.Second)
+		if err != nil {
+			return nil, fmt.Errorf("等待加入房间失败: %w", err)
+		}
+		if msg.Type != "error" {
+			return msg, nil
+		}
+		if msg.Error != "房间不存在" || time.Now().After(r.rejoinUntil) {
+			if hint := roomNotFoundHint(msg.Reason); hint != "" {
+				return nil, fmt.Errorf("加入房间失败: %s（%s）", msg.Error, hint)
+			}
+			return nil, fmt.Errorf("加入房间失败: %s", msg.Error)
+		}
+
+		select {
+		case <-r.cancelDone():
+			return nil, errTransferCanceled
+		case <-time.After(rejoinInterval):
+		}
+	}
+}
+
+// roomNotFoundHint 根据信令服务器返回的原因给出房间不存在时的处理建议（旧版信令服务器不返回原因）
+func roomNotFoundHint(reason string) string {
+	switch reason {
+	case "never_existed":
+		return "发送端可能尚未启动，请确认房间ID或文件编号正确，等发送端启动后重试"
+	case "expired":
+		return "会话已过期，请让发送端重新开始"
+	case "closed":
+		return "发送端已完成传输或已退出，请让发送端重新开始"
+	}
+	return ""
+}
+
+// watchPeerLeft 监听信令服务器的peer_left通知，发送端离开房间时结束本次连接
+// 接收端已中止（state为3）时发送端是收到取消消息后离开的，由abort报告原因
+func (r *WebRTCReceiver) watchPeerLeft(client *SignalingClient, ended *int32) {
+	for {
+		msg, err := client.Receive(time.Hour)
+		if err != nil || msg == nil {
+			return
+		}
+		if msg.Type == "peer_left" && r.state != 3 && atomic.LoadInt32(&r.finished) == 0 && atomic.LoadInt32(ended) == 0 {
+			r.finish(connectionLostError{fmt.Errorf("发送端已离开，传输中断（已接收 %d 字节）", atomic.LoadInt64(&r.totalReceived))})
+			return
+		}
+	}
+}
+
+// resumeSession 重新连接后收到元数据：会话一致时回复已接收的字节数，继续写入原文件
+func (r *WebRTCReceiver) resumeSession(metadata *FileMetadata) error {
+	if metadata.Session == "" || metadata.Session != r.metadata.Session || metadata.FileSize != r.metadata.FileSize {
+		return fmt.Errorf("发送端的文件与中断前不一致（文件或房间已变化），无法续传")
+	}
+	// 重启后的发送端使用新的盐，记录序号从0开始：按新的元数据重新派生密钥，丢弃中断时未收完的记录
+	if r.decrypt != nil || metadata.Encryption != "" {
+		decrypt, err := newRecordOpener(r.password, metadata)
+		if err != nil {
+			return err
+		}
+		r.decrypt = decrypt
+	}
+	r.metadata = metadata
+
+	received := atomic.LoadInt64(&r.totalReceived)
+	fmt.Printf("续传: 已接收 %d / %d 字节，从断点继续接收...\n", received, metadata.FileSize)
+	r.state = 2
+	r.replyAccept(metadata, r.savePath)
+	r.sendResume(received)
+	return nil
+}
+
+// sendResume 告诉发送端从offset开始发送
+func (r *WebRTCReceiver) sendResume(offset int64) {
+	if r.dc == nil || r.dc.ReadyState() != webrtc.DataChannelStateOpen {
+		return
+	}
+	resumeJSON, _ := json.Marshal(ControlMessage{Type: "resume", Offset: offset})
+	if err := r.dc.Send(resumeJSON); err != nil {
+		fmt.Printf("发送续传位置失败: %v\n", err)
+	}
+}
+
+// seekSource 把待发送文件定位到offset（续传）
+func seekSource(file io.Reader, offset int64) error {
+	seeker, ok := file.(io.Seeker)
+	if !ok {
+		return fmt.Errorf("文件不支持定位")
+	}
+	_, err := seeker.Seek(offset, io.SeekStart)
+	return err
+}
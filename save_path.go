@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// 接收端保存路径（receive的保存路径参数）的解析规则，WebRTC、直接TCP和HTTP接收共用:
+//
+//	空或"."                       当前目录下，使用发送端的文件名
+//	以路径分隔符结尾（如 out/）    目录：保存到该目录下，使用发送端的文件名（目录不存在时创建）；已存在同名文件时报错
+//	已存在的目录                  保存到该目录下，使用发送端的文件名
+//	已存在的文件                  覆盖该文件（使用指定的文件名）
+//	不存在的其他路径              作为文件路径（上级目录不存在时创建）
+//
+// 只有文件名来自发送端时才按--organize整理到子目录
+
+// resolveSavePath 按上述规则确定保存文件的路径，fromDir表示文件名来自发送端（fileName）
+// 只检查路径，不创建目录（调用方创建返回路径的上级目录）
+func resolveSavePath(savePath, fileName string) (path string, fromDir bool, err error) {
+	if savePath == "" || savePath == "." {
+		return fileName, true, nil
+	}
+
+	// 去掉末尾的分隔符再检查（否则已存在的文件加上分隔符后Stat返回"不是目录"）
+	trimmed := savePath
+	for len(trimmed) > 1 && os.IsPathSeparator(trimmed[len(trimmed)-1]) {
+		trimmed = trimmed[:len(trimmed)-1]
+	}
+	endsWithSeparator := trimmed != savePath
+	info, err := os.Stat(trimmed)
+	switch {
+	case err == nil && info.IsDir():
+		return filepath.Join(trimmed, fileName), true, nil
+	case err == nil && endsWithSeparator:
+		return "", false, fmt.Errorf("保存路径 %s 以路径分隔符结尾（表示目录），但已存在同名文件", savePath)
+	case err == nil:
+		return savePath, false, nil
+	case !os.IsNotExist(err):
+		return "", false, fmt.Errorf("保存路径无效: %w", err)
+	case endsWithSeparator:
+		return filepath.Join(trimmed, fileName), true, nil
+	default:
+		return savePath, false, nil
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestResolveSavePath 按表格检查保存路径的解析规则
+func TestResolveSavePath(t *testing.T) {
+	dir := t.TempDir()
+	existingFile := filepath.Join(dir, "existing.bin")
+	if err := os.WriteFile(existingFile, []byte("x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	sep := string(os.PathSeparator)
+	const name = "sent.bin"
+
+	cases := []struct {
+		desc     string
+		savePath string
+		want     string // 为空表示应返回错误
+		fromDir  bool
+	}{
+		{"空路径", "", name, true},
+		{"当前目录", ".", name, true},
+		{"已存在的目录", dir, filepath.Join(dir, name), true},
+		{"已存在的目录加分隔符", dir + sep, filepath.Join(dir, name), true},
+		{"不存在的目录（分隔符结尾）", filepath.Join(dir, "new") + sep, filepath.Join(dir, "new", name), true},
+		{"不存在的目录（/结尾）", filepath.Join(dir, "new2") + "/", filepath.Join(dir, "new2", name), true},
+		{"已存在的文件", existingFile, existingFile, false},
+		{"已存在的文件加分隔符", existingFile + sep, "", false},
+		{"不存在的文件名", filepath.Join(dir, "out.bin"), filepath.Join(dir, "out.bin"), false},
+		{"上级目录不存在的文件名", filepath.Join(dir, "a", "b", "out.bin"), filepath.Join(dir, "a", "b", "out.bin"), false},
+	}
+	for _, c := range cases {
+		t.Run(c.desc, func(t *testing.T) {
+			got, fromDir, err := resolveSavePath(c.savePath, name)
+			if c.want == "" {
+				if err == nil {
+					t.Fatalf("保存路径 %s: 期望错误，得到 %s", c.savePath, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("保存路径 %s: %v", c.savePath, err)
+			}
+			if got != c.want || fromDir != c.fromDir {
+				t.Fatalf("保存路径 %s: 得到 %s（fromDir=%v），期望 %s（fromDir=%v）", c.savePath, got, fromDir, c.want, c.fromDir)
+			}
+		})
+	}
+}
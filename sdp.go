@@ -0,0 +1,67 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/pion/webrtc/v3"
+)
+
+// errInvalidSDP 对端的SDP无法解析（通常是手动复制时内容被截断或混入了其他字符）
+var errInvalidSDP = errors.New("SDP数据不完整或格式错误，请重新复制")
+
+// decodeSessionDescription 解码base64编码的SDP（JSON格式的SessionDescription）并检查内容完整
+// 解码前去掉复制时可能带入的空白和换行；want为期望的类型（offer或answer）
+func decodeSessionDescription(encoded string, want webrtc.SDPType) (webrtc.SessionDescription, error) {
+	var desc webrtc.SessionDescription
+	encoded = strings.Join(strings.Fields(encoded), "")
+	if encoded == "" {
+		return desc, fmt.Errorf("%w（内容为空）", errInvalidSDP)
+	}
+
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return desc, fmt.Errorf("%w（base64解码失败，共 %d 个字符，请检查粘贴的内容是否完整）: %v", errInvalidSDP, len(encoded), err)
+	}
+	if err := json.Unmarshal(data, &desc); err != nil {
+		return desc, fmt.Errorf("%w（内容不是有效的SDP，可能被截断）: %v", errInvalidSDP, err)
+	}
+	if desc.Type != want {
+		return desc, fmt.Errorf("%w（期望 %s，收到 %s，请确认复制的是对端的%s）", errInvalidSDP, want, desc.Type, want)
+	}
+
+	// SDP正文必须能完整解析，并包含DataChannel所需的媒体段和ICE/DTLS参数
+	parsed, err := desc.Unmarshal()
+	if err != nil {
+		return desc, fmt.Errorf("%w（SDP正文解析失败）: %v", errInvalidSDP, err)
+	}
+	if len(parsed.MediaDescriptions) == 0 {
+		return desc, fmt.Errorf("%w（缺少媒体段）", errInvalidSDP)
+	}
+	for _, attr := range []string{"ice-ufrag", "ice-pwd", "fingerprint"} {
+		if !sdpHasAttribute(desc.SDP, attr) {
+			return desc, fmt.Errorf("%w（缺少 a=%s）", errInvalidSDP, attr)
+		}
+	}
+	return desc, nil
+}
+
+// sdpHasAttribute 判断SDP正文中是否有指定属性（会话级或媒体级）
+func sdpHasAttribute(sdp, name string) bool {
+	_, ok := sdpAttribute(sdp, name)
+	return ok
+}
+
+// sdpAttribute 返回SDP正文中第一个指定属性的值（a=name:value）
+func sdpAttribute(sdp, name string) (string, bool) {
+	for _, line := range strings.Split(sdp, "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "a="+name+":") {
+			return strings.TrimPrefix(line, "a="+name+":"), true
+		}
+	}
+	return "", false
+}
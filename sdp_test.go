@@ -0,0 +1,95 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/pion/webrtc/v3"
+)
+
+// testOffer 创建一个带DataChannel的offer（与发送端的offer结构相同）
+func testOffer(t *testing.T) webrtc.SessionDescription {
+	t.Helper()
+	pc, err := webrtc.NewPeerConnection(webrtc.Configuration{})
+	if err != nil {
+		t.Fatalf("创建PeerConnection: %v", err)
+	}
+	t.Cleanup(func() { pc.Close() })
+	if _, err := pc.CreateDataChannel("test", nil); err != nil {
+		t.Fatalf("创建DataChannel: %v", err)
+	}
+	offer, err := pc.CreateOffer(nil)
+	if err != nil {
+		t.Fatalf("创建offer: %v", err)
+	}
+	return offer
+}
+
+// encodeTestSDP 按发送端的格式编码（JSON后base64）
+func encodeTestSDP(desc webrtc.SessionDescription) string {
+	data, _ := json.Marshal(desc)
+	return base64.StdEncoding.EncodeToString(data)
+}
+
+// TestDecodeSessionDescription 复制时按行折断并带入首尾空白的完整offer可以解码
+func TestDecodeSessionDescription(t *testing.T) {
+	offer := testOffer(t)
+	valid := encodeTestSDP(offer)
+	var wrapped strings.Builder
+	wrapped.WriteString("  ")
+	for i := 0; i < len(valid); i += 64 {
+		end := i + 64
+		if end > len(valid) {
+			end = len(valid)
+		}
+		wrapped.WriteString(valid[i:end] + "\r\n")
+	}
+	desc, err := decodeSessionDescription(wrapped.String(), webrtc.SDPTypeOffer)
+	if err != nil || desc.SDP != offer.SDP {
+		t.Fatalf("带换行的完整offer解码失败: %v", err)
+	}
+}
+
+// TestDecodeSessionDescriptionInvalid 为空、被截断、被改动、缺少必需属性或类型不对时返回errInvalidSDP并说明原因
+func TestDecodeSessionDescriptionInvalid(t *testing.T) {
+	offer := testOffer(t)
+	valid := encodeTestSDP(offer)
+	offerJSON, _ := json.Marshal(offer)
+	withoutLine := func(prefix string) webrtc.SessionDescription {
+		var lines []string
+		for _, line := range strings.Split(offer.SDP, "\r\n") {
+			if !strings.HasPrefix(line, prefix) {
+				lines = append(lines, line)
+			}
+		}
+		return webrtc.SessionDescription{Type: offer.Type, SDP: strings.Join(lines, "\r\n")}
+	}
+	corrupted := []byte(valid)
+	corrupted[len(corrupted)/2] = '!'
+
+	for _, c := range []struct {
+		name, encoded string
+		want          webrtc.SDPType
+		reason        string
+	}{
+		{"empty", " \n\t", webrtc.SDPTypeOffer, "内容为空"},
+		{"truncated base64", valid[:len(valid)-3], webrtc.SDPTypeOffer, "base64解码失败"},
+		{"corrupted base64", string(corrupted), webrtc.SDPTypeOffer, "base64解码失败"},
+		{"truncated JSON", base64.StdEncoding.EncodeToString(offerJSON[:len(offerJSON)/2]), webrtc.SDPTypeOffer, "可能被截断"},
+		{"wrong type", valid, webrtc.SDPTypeAnswer, "期望 answer，收到 offer"},
+		{"unparsable body", encodeTestSDP(webrtc.SessionDescription{Type: webrtc.SDPTypeOffer, SDP: "not an sdp"}), webrtc.SDPTypeOffer, "SDP正文解析失败"},
+		{"no media section", encodeTestSDP(webrtc.SessionDescription{Type: offer.Type, SDP: offer.SDP[:strings.Index(offer.SDP, "m=")]}), webrtc.SDPTypeOffer, "缺少媒体段"},
+		{"no fingerprint", encodeTestSDP(withoutLine("a=fingerprint:")), webrtc.SDPTypeOffer, "缺少 a=fingerprint"},
+		{"no ice-pwd", encodeTestSDP(withoutLine("a=ice-pwd:")), webrtc.SDPTypeOffer, "缺少 a=ice-pwd"},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			_, err := decodeSessionDescription(c.encoded, c.want)
+			if !errors.Is(err, errInvalidSDP) || !strings.Contains(err.Error(), c.reason) {
+				t.Fatalf("应返回SDP无效并提示%q，实际: %v", c.reason, err)
+			}
+		})
+	}
+}
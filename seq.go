@@ -0,0 +1,362 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pion/webrtc/v3"
+)
+
+// 分段格式：DataChannel为无序或不可靠模式时（--unordered、--max-retransmits、--max-packet-lifetime），
+// 消息可能乱序到达或丢失，发送端在每条消息前加8字节的数据流位置（大端，包括开头的元数据），
+// 接收端据此重新排序，并定期用seq_ack报告连续收到的位置和缺失的范围，发送端重传缺失的部分。
+// 有序可靠模式（默认）不使用分段格式，与旧版本兼容。
+const (
+	seqHeaderSize     = 8
+	seqWindow         = 8 * 1024 * 1024  // 发送端保留的未确认数据上限（用于重传）
+	seqMaxPending     = 16 * 1024 * 1024 // 接收端缓存的乱序数据上限，超过时丢弃，等待重传
+	seqAckInterval    = 100 * time.Millisecond
+	seqResendInterval = 250 * time.Millisecond // 确认位置停止前进超过此时间才重传，两次重传的最小间隔也是此值
+	seqTailResend     = 256 * 1024             // 末尾丢失（没有乱序数据）时一次重传的数据量
+)
+
+// dcOptions DataChannel的可靠性选项
+type dcOptions struct {
+	unordered         bool
+	maxRetransmits    int           // 最大重传次数（<0表示不限制）
+	maxPacketLifeTime time.Duration // 最长重传时间（0表示不限制）
+}
+
+// defaultDCOptions 默认有序可靠
+func defaultDCOptions() dcOptions {
+	return dcOptions{maxRetransmits: -1}
+}
+
+// init 转换为DataChannelInit
+func (o dcOptions) init() *webrtc.DataChannelInit {
+	ordered := !o.unordered
+	init := &webrtc.DataChannelInit{Ordered: &ordered}
+	if o.maxRetransmits >= 0 {
+		n := uint16(o.maxRetransmits)
+		init.MaxRetransmits = &n
+	}
+	if o.maxPacketLifeTime > 0 {
+		ms := uint16(o.maxPacketLifeTime / time.Millisecond)
+		init.MaxPacketLifeTime = &ms
+	}
+	return init
+}
+
+// validate 检查选项组合
+func (o dcOptions) validate() error {
+	if o.maxRetransmits > 65535 {
+		return fmt.Errorf("--max-retransmits 不能超过 65535")
+	}
+	if o.maxPacketLifeTime < 0 || o.maxPacketLifeTime > 65535*time.Millisecond {
+		return fmt.Errorf("--max-packet-lifetime 须在 1ms - 65.535s 之间")
+	}
+	if o.maxRetransmits >= 0 && o.maxPacketLifeTime > 0 {
+		return fmt.Errorf("--max-retransmits 和 --max-packet-lifetime 不能同时使用")
+	}
+	return nil
+}
+
+// String 描述当前模式（用于显示）
+func (o dcOptions) String() string {
+	mode := "有序"
+	if o.unordered {
+		mode = "无序"
+	}
+	switch {
+	case o.maxRetransmits >= 0:
+		mode += fmt.Sprintf("，最多重传 %d 次", o.maxRetransmits)
+	case o.maxPacketLifeTime > 0:
+		mode += fmt.Sprintf("，最长重传 %v", o.maxPacketLifeTime)
+	default:
+		mode += "，可靠"
+	}
+	return mode
+}
+
+// reliable 是否为可靠模式（不限制重传）
+func (o dcOptions) reliable() bool {
+	return o.maxRetransmits < 0 && o.maxPacketLifeTime == 0
+}
+
+// sequenced 是否需要分段格式
+func (o dcOptions) sequenced() bool {
+	return o.unordered || !o.reliable()
+}
+
+// dcSequenced 接收端根据对端创建的DataChannel判断是否使用分段格式
+func dcSequenced(dc *webrtc.DataChannel) bool {
+	return !dc.Ordered() || dc.MaxRetransmits() != nil || dc.MaxPacketLifeTime() != nil
+}
+
+// seqChunk 已发送但未确认的消息（包含位置头）
+type seqChunk struct {
+	offset int64
+	frame  []byte
+}
+
+// seqSender 分段格式发送器：给每条消息加上位置头，保留未确认的消息用于重传
+type seqSender struct {
+	inner chunkSender
+	dc    *webrtc.DataChannel
+
+	mu          sync.Mutex
+	next        int64      // 下一条消息的位置
+	acked       int64      // 接收端连续收到的位置
+	retained    []seqChunk // 未确认的消息，按位置排序
+	retainSize  int64
+	lastAdvance time.Time // 确认位置上次前进的时间
+	lastResend  time.Time
+	final       int64 // 全部数据发送完后的结束位置（-1表示未发送完）
+
+	ackChan  chan struct{} // 收到确认时通知
+	closed   chan struct{}
+	complete chan struct{} // 接收端确认全部数据后关闭
+}
+
+// newSeqSender 创建分段格式发送器，inner负责流量控制
+func newSeqSender(inner chunkSender, dc *webrtc.DataChannel) *seqSender {
+	return &seqSender{
+		inner:       inner,
+		dc:          dc,
+		final:       -1,
+		lastAdvance: time.Now(),
+		ackChan:     make(chan struct{}, 1),
+		closed:      make(chan struct{}),
+		complete:    make(chan struct{}),
+	}
+}
+
+// Send 发送一个数据块，未确认数据超过窗口时等待接收端确认
+func (s *seqSender) Send(data []byte) error {
+	for {
+		s.mu.Lock()
+		full := s.retainSize >= seqWindow
+		s.mu.Unlock()
+		if !full {
+			break
+		}
+		select {
+		case <-s.ackChan:
+		case <-s.closed:
+			return errChannelClosed
+		case <-time.After(bufferWaitLimit):
+			return fmt.Errorf("等待接收端确认超时（已确认 %d 字节）", s.ackedOffset())
+		}
+	}
+
+	frame := make([]byte, seqHeaderSize+len(data))
+	s.mu.Lock()
+	offset := s.next
+	binary.BigEndian.PutUint64(frame, uint64(offset))
+	copy(frame[seqHeaderSize:], data)
+	s.retained = append(s.retained, seqChunk{offset: offset, frame: frame})
+	s.retainSize += int64(len(data))
+	s.next += int64(len(data))
+	s.mu.Unlock()
+
+	if err := s.inner.Send(frame); err != nil {
+		// 没有发送出去的消息不保留，调用方可能减小数据块后重新发送同一位置的数据（见chunkLimiter）
+		s.mu.Lock()
+		if last := len(s.retained) - 1; last >= 0 && s.retained[last].offset == offset {
+			s.retained = s.retained[:last]
+			s.retainSize -= int64(len(data))
+			s.next = offset
+		}
+		s.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// finishSending sendFile返回后调用，记录数据流的结束位置
+func (s *seqSender) finishSending() {
+	s.mu.Lock()
+	s.final = s.next
+	done := s.acked >= s.final
+	s.mu.Unlock()
+	if done {
+		s.markComplete()
+	}
+}
+
+// markComplete 接收端已确认全部数据
+func (s *seqSender) markComplete() {
+	select {
+	case <-s.complete:
+	default:
+		close(s.complete)
+	}
+}
+
+// close 停止发送
+func (s *seqSender) close() {
+	select {
+	case <-s.closed:
+	default:
+		close(s.closed)
+	}
+}
+
+// ackedOffset 接收端连续收到的位置
+func (s *seqSender) ackedOffset() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.acked
+}
+
+// handleAck 处理seq_ack：释放已确认的消息；确认位置停止前进时重传缺失的部分
+// 接收端报告了缺失范围（missing为位置、长度交替）时重传这些范围；没有乱序数据时，只有本地缓冲区已发完才认为末尾丢失，重传一小段
+func (s *seqSender) handleAck(offset int64, missing []int64) {
+	s.mu.Lock()
+	if offset > s.acked {
+		s.acked = offset
+		s.lastAdvance = time.Now()
+		i := 0
+		for i < len(s.retained) && s.retained[i].offset+int64(len(s.retained[i].frame)-seqHeaderSize) <= offset {
+			s.retainSize -= int64(len(s.retained[i].frame) - seqHeaderSize)
+			i++
+		}
+		s.retained = s.retained[i:]
+		select {
+		case s.ackChan <- struct{}{}:
+		default:
+		}
+	}
+	done := s.final >= 0 && s.acked >= s.final
+
+	var resend [][]byte
+	stuck := time.Since(s.lastAdvance) >= seqResendInterval && time.Since(s.lastResend) >= seqResendInterval
+	if !done && offset == s.acked && offset < s.next && stuck && (len(missing) >= 2 || s.dc.BufferedAmount() == 0) {
+		if len(missing) < 2 {
+			missing = []int64{offset, seqTailResend}
+		}
+		for _, c := range s.retained {
+			end := c.offset + int64(len(c.frame)-seqHeaderSize)
+			for i := 0; i+1 < len(missing); i += 2 {
+				if c.offset < missing[i]+missing[i+1] && end > missing[i] {
+					resend = append(resend, c.frame)
+					break
+				}
+			}
+		}
+		s.lastResend = time.Now()
+	}
+	s.mu.Unlock()
+
+	if done {
+		s.markComplete()
+		return
+	}
+	// 在回调外发送，避免阻塞控制消息的处理
+	if len(resend) > 0 {
+		go func() {
+			for _, frame := range resend {
+				if s.dc.Send(frame) != nil {
+					return
+				}
+			}
+		}()
+	}
+}
+
+// seqReceiver 分段格式接收端：缓存乱序到达的消息，按位置顺序交给handleMessage
+type seqReceiver struct {
+	mu          sync.Mutex
+	expected    int64            // 下一个需要的位置
+	pending     map[int64][]byte // 乱序到达的数据，按位置索引
+	pendingSize int64
+}
+
+// newSeqReceiver 创建分段格式接收端
+func newSeqReceiver() *seqReceiver {
+	return &seqReceiver{pending: make(map[int64][]byte)}
+}
+
+// push 处理一条消息，返回可以按顺序处理的数据（重复的消息被忽略）
+func (q *seqReceiver) push(frame []byte) ([][]byte, error) {
+	if len(frame) < seqHeaderSize {
+		return nil, fmt.Errorf("分段消息过短: %d 字节", len(frame))
+	}
+	offset := int64(binary.BigEndian.Uint64(frame))
+	data := frame[seqHeaderSize:]
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if offset < q.expected {
+		return nil, nil // 重传造成的重复数据
+	}
+	if offset > q.expected {
+		if _, ok := q.pending[offset]; !ok && q.pendingSize+int64(len(data)) <= seqMaxPending {
+			// pion会复用消息缓冲区，需要复制
+			q.pending[offset] = append([]byte(nil), data...)
+			q.pendingSize += int64(len(data))
+		}
+		return nil, nil
+	}
+
+	ready := [][]byte{data}
+	q.expected += int64(len(data))
+	for {
+		next, ok := q.pending[q.expected]
+		if !ok {
+			break
+		}
+		delete(q.pending, q.expected)
+		q.pendingSize -= int64(len(next))
+		ready = append(ready, next)
+		q.expected += int64(len(next))
+	}
+	// 丢弃已被覆盖的旧数据（发送端重传的块与原块边界一致，正常情况下不会出现）
+	for offset, data := range q.pending {
+		if offset < q.expected {
+			delete(q.pending, offset)
+			q.pendingSize -= int64(len(data))
+		}
+	}
+	return ready, nil
+}
+
+// seqMaxMissing seq_ack中最多报告的缺失范围数
+const seqMaxMissing = 64
+
+// status 返回连续收到的位置和已收到的乱序数据之间缺失的范围（位置、长度交替，没有乱序数据时为空）
+func (q *seqReceiver) status() (expected int64, missing []int64) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	offsets := make([]int64, 0, len(q.pending))
+	for offset := range q.pending {
+		offsets = append(offsets, offset)
+	}
+	sort.Slice(offsets, func(i, j int) bool { return offsets[i] < offsets[j] })
+
+	pos := q.expected
+	for _, offset := range offsets {
+		if offset > pos {
+			if len(missing) >= 2*seqMaxMissing {
+				break
+			}
+			missing = append(missing, pos, offset-pos)
+		}
+		pos = offset + int64(len(q.pending[offset]))
+	}
+	return q.expected, missing
+}
+
+// sendSeqAck 向发送端报告接收位置（分段格式）
+func sendSeqAck(dc *webrtc.DataChannel, q *seqReceiver) {
+	if dc == nil || dc.ReadyState() != webrtc.DataChannelStateOpen {
+		return
+	}
+	expected, missing := q.status()
+	ackJSON, _ := json.Marshal(ControlMessage{Type: "seq_ack", Offset: expected, Missing: missing})
+	dc.Send(ackJSON)
+}
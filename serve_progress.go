@@ -0,0 +1,140 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 发送端的下载总览（HTTP模式）：多个接收端同时下载不同的文件或打包下载时，除了每个连接各自的进度外，
+// 定期在发送端终端显示所有进行中的下载（文件名、进度和对端地址）以及累计发送的字节数和总速度。
+// 只有一个下载时不显示总览（与该连接的进度重复）；打包下载没有Content-Length，显示正在打包的第几个文件。
+
+// serveOverviewInterval 下载总览的刷新间隔（与每个连接的进度相同）
+const serveOverviewInterval = 2 * time.Second
+
+// serveDownload 一个进行中的下载请求
+type serveDownload struct {
+	remoteAddr string
+	name       string          // 文件名或压缩包名
+	start      int64           // 续传起点
+	size       int64           // 文件大小（打包下载为-1）
+	counter    *countingWriter // 本次请求已发送的字节数
+	entry      string          // 打包下载正在发送的文件（如 "2/5 b.txt"）
+}
+
+// serveTracker 统计同一个HTTP服务器上所有下载请求（为nil时不统计）
+type serveTracker struct {
+	mu      sync.Mutex
+	active  []*serveDownload // 进行中的下载，按开始的顺序
+	served  int64            // 已结束的请求发送的字节数
+	running bool             // 定期显示总览的goroutine正在运行
+}
+
+// newServeTracker 创建下载统计
+func newServeTracker() *serveTracker {
+	return &serveTracker{}
+}
+
+// Begin 登记开始发送的下载请求（size为-1表示大小未知），有下载进行时定期显示总览
+func (t *serveTracker) Begin(remoteAddr, path string, start, size int64, counter *countingWriter) *serveDownload {
+	if t == nil {
+		return nil
+	}
+	d := &serveDownload{remoteAddr: remoteAddr, name: filepath.Base(path), start: start, size: size, counter: counter}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.active = append(t.active, d)
+	if !t.running {
+		t.running = true
+		go t.report()
+	}
+	return d
+}
+
+// SetEntry 打包下载开始发送下一个文件
+func (t *serveTracker) SetEntry(d *serveDownload, entry string) {
+	if t == nil || d == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	d.entry = entry
+}
+
+// End 下载请求结束（完成或中断），发送的字节数计入累计
+func (t *serveTracker) End(d *serveDownload) {
+	if t == nil || d == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for i, active := range t.active {
+		if active == d {
+			t.active = append(t.active[:i], t.active[i+1:]...)
+			t.served += d.counter.Count()
+			break
+		}
+	}
+}
+
+// report 定期显示总览，没有进行中的下载时退出（下次Begin时重新启动）
+func (t *serveTracker) report() {
+	ticker := time.NewTicker(serveOverviewInterval)
+	defer ticker.Stop()
+	lastTotal := t.totalServed()
+	for range ticker.C {
+		t.mu.Lock()
+		if len(t.active) == 0 {
+			t.running = false
+			t.mu.Unlock()
+			return
+		}
+		t.mu.Unlock()
+
+		line, total := t.overview(lastTotal, serveOverviewInterval)
+		if line != "" {
+			fmt.Println(line)
+		}
+		lastTotal = total
+	}
+}
+
+// totalServed 累计发送的字节数（包括进行中的下载）
+func (t *serveTracker) totalServed() int64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	total := t.served
+	for _, d := range t.active {
+		total += d.counter.Count()
+	}
+	return total
+}
+
+// overview 生成总览行（少于两个进行中的下载时为空），lastTotal为interval之前的累计字节数，同时返回当前的累计字节数
+func (t *serveTracker) overview(lastTotal int64, interval time.Duration) (string, int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	total := t.served
+	parts := make([]string, 0, len(t.active))
+	for _, d := range t.active {
+		sent := d.counter.Count()
+		total += sent
+		status := formatByteSize(sent)
+		switch {
+		case d.entry != "":
+			status = fmt.Sprintf("%s，%s", d.entry, formatByteSize(sent))
+		case d.size > 0:
+			status = fmt.Sprintf("%.1f%%", float64(d.start+sent)/float64(d.size)*100)
+		}
+		parts = append(parts, fmt.Sprintf("%s %s (%s)", d.name, status, d.remoteAddr))
+	}
+	if len(parts) < 2 {
+		return "", total
+	}
+	speed := float64(total-lastTotal) / interval.Seconds()
+	return fmt.Sprintf("[全部下载] 进行中 %d 个: %s | 累计已发送: %s | 总速度: %s/s",
+		len(parts), strings.Join(parts, ", "), formatByteSize(total), formatByteSize(int64(speed))), total
+}
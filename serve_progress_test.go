@@ -0,0 +1,41 @@
+package main
+
+import (
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestServeOverview HTTP发送端的下载总览：两个同时进行的下载（普通文件和打包下载）都显示，
+// 累计字节数包括已结束的下载，只剩一个下载时不显示总览
+func TestServeOverview(t *testing.T) {
+	tracker := newServeTracker()
+	fileCounter := &countingWriter{w: io.Discard}
+	zipCounter := &countingWriter{w: io.Discard}
+	file := tracker.Begin("10.0.0.2:5000", filepath.Join("data", "a.bin"), 1000, 4000, fileCounter)
+	archive := tracker.Begin("10.0.0.3:6000", "files.zip", 0, -1, zipCounter)
+	tracker.SetEntry(archive, "2/3 b.txt")
+	fileCounter.Write(make([]byte, 1000))
+	zipCounter.Write(make([]byte, 3000))
+
+	line, total := tracker.overview(0, time.Second)
+	for _, want := range []string{"进行中 2 个", "a.bin 50.0% (10.0.0.2:5000)", "files.zip 2/3 b.txt", "(10.0.0.3:6000)"} {
+		if !strings.Contains(line, want) {
+			t.Errorf("下载总览 %q 缺少 %q", line, want)
+		}
+	}
+	if total != 4000 {
+		t.Fatalf("累计已发送 %d 字节，期望 4000", total)
+	}
+
+	tracker.End(file)
+	if line, total := tracker.overview(total, time.Second); line != "" || total != 4000 {
+		t.Fatalf("只剩一个下载时显示了总览 %q（累计 %d 字节）", line, total)
+	}
+	tracker.End(archive)
+	if total := tracker.totalServed(); total != 4000 {
+		t.Fatalf("下载结束后累计已发送 %d 字节，期望 4000", total)
+	}
+}
@@ -0,0 +1,245 @@
+package signaling
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Redis房间注册表（信令服务器 --redis）：多个信令服务器实例共享房间
+// 房间状态保存在哈希 ftf:room:<房间ID> 中，移除原因保存在 ftf:removed:<房间ID> 中（removedRoomRetention后自动删除），
+// 房间内的消息经频道 ftf:msg:<房间标识> 发布，每个实例为有本实例成员的房间单独订阅。
+
+const (
+	redisOpTimeout = 5 * time.Second
+	// redisRoomKeyTTL 房间哈希的过期时间（每次有成员加入时刷新），实例崩溃没有移除房间时由Redis清理
+	redisRoomKeyTTL = 24 * time.Hour
+)
+
+// 检查和修改在同一个脚本中完成，多个实例并发操作同一房间时保持一致
+var (
+	// KEYS: 房间, 移除记录；ARGV: 标识, 创建时间, 是否广播, 过期时间(毫秒)
+	redisCreateRoom = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 1 then return 0 end
+redis.call('HSET', KEYS[1], 'token', ARGV[1], 'created', ARGV[2], 'broadcast', ARGV[3], 'joined', '0', 'members', '1')
+redis.call('PEXPIRE', KEYS[1], ARGV[4])
+redis.call('DEL', KEYS[2])
+return 1`)
+	// KEYS: 房间, 移除记录；ARGV: 标识, 原因, 移除记录保留时间(毫秒)
+	redisRemoveRoom = redis.NewScript(`
+if redis.call('HGET', KEYS[1], 'token') ~= ARGV[1] then return 0 end
+redis.call('DEL', KEYS[1])
+redis.call('SET', KEYS[2], ARGV[2], 'PX', ARGV[3])
+return 1`)
+	// KEYS: 房间；ARGV: 标识, 是否接收端, 过期时间(毫秒)
+	redisJoinRoom = redis.NewScript(`
+if redis.call('HGET', KEYS[1], 'token') ~= ARGV[1] then return 0 end
+redis.call('HINCRBY', KEYS[1], 'members', 1)
+if ARGV[2] == '1' then redis.call('HSET', KEYS[1], 'joined', '1') end
+redis.call('PEXPIRE', KEYS[1], ARGV[3])
+return 1`)
+	// KEYS: 房间；ARGV: 标识；房间已移除时返回-1
+	redisLeaveRoom = redis.NewScript(`
+if redis.call('HGET', KEYS[1], 'token') ~= ARGV[1] then return -1 end
+return redis.call('HINCRBY', KEYS[1], 'members', -1)`)
+)
+
+// RedisRoomStore Redis房间注册表
+type RedisRoomStore struct {
+	client *redis.Client
+}
+
+// NewRedisRoomStore 连接Redis并创建房间注册表，address为 redis://[:密码@]主机:端口[/数据库] 或 主机:端口
+func NewRedisRoomStore(address string) (*RedisRoomStore, error) {
+	if !strings.Contains(address, "://") {
+		address = "redis://" + address
+	}
+	options, err := redis.ParseURL(address)
+	if err != nil {
+		return nil, fmt.Errorf("无效的Redis地址: %w", err)
+	}
+	client := redis.NewClient(options)
+
+	ctx, cancel := context.WithTimeout(context.Background(), redisOpTimeout)
+	defer cancel()
+	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("连接Redis失败: %w", err)
+	}
+	return &RedisRoomStore{client: client}, nil
+}
+
+// redisRoomKey 房间状态的键
+func redisRoomKey(roomID string) string {
+	return "ftf:room:" + roomID
+}
+
+// redisRemovedKey 移除原因的键
+func redisRemovedKey(roomID string) string {
+	return "ftf:removed:" + roomID
+}
+
+// redisChannel 房间消息的频道
+func redisChannel(token string) string {
+	return "ftf:msg:" + token
+}
+
+// CreateRoom 房间不存在时创建，已存在时返回nil
+func (s *RedisRoomStore) CreateRoom(roomID string, broadcast bool) (*RoomInfo, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), redisOpTimeout)
+	defer cancel()
+
+	info := &RoomInfo{
+		ID:        roomID,
+		Token:     newRoomToken(),
+		CreatedAt: time.Now(),
+		Broadcast: broadcast,
+	}
+	created, err := redisCreateRoom.Run(ctx, s.client,
+		[]string{redisRoomKey(roomID), redisRemovedKey(roomID)},
+		info.Token, info.CreatedAt.UnixNano(), redisBool(broadcast), redisRoomKeyTTL.Milliseconds()).Int()
+	if err != nil {
+		return nil, fmt.Errorf("创建房间失败: %w", err)
+	}
+	if created == 0 {
+		return nil, nil
+	}
+	return info, nil
+}
+
+// GetRoom 获取房间状态，房间不存在时返回nil
+func (s *RedisRoomStore) GetRoom(roomID string) (*RoomInfo, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), redisOpTimeout)
+	defer cancel()
+
+	fields, err := s.client.HGetAll(ctx, redisRoomKey(roomID)).Result()
+	if err != nil {
+		return nil, fmt.Errorf("读取房间失败: %w", err)
+	}
+	if fields["token"] == "" {
+		return nil, nil
+	}
+	created, _ := strconv.ParseInt(fields["created"], 10, 64)
+	return &RoomInfo{
+		ID:        roomID,
+		Token:     fields["token"],
+		CreatedAt: time.Unix(0, created),
+		Broadcast: fields["broadcast"] == "1",
+		Joined:    fields["joined"] == "1",
+	}, nil
+}
+
+// RemoveRoom 仅当roomID仍指向token对应的房间时移除，并记录移除原因
+func (s *RedisRoomStore) RemoveRoom(roomID, token, reason string) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), redisOpTimeout)
+	defer cancel()
+
+	removed, err := redisRemoveRoom.Run(ctx, s.client,
+		[]string{redisRoomKey(roomID), redisRemovedKey(roomID)},
+		token, reason, removedRoomRetention.Milliseconds()).Int()
+	if err != nil {
+		return false, fmt.Errorf("移除房间失败: %w", err)
+	}
+	return removed == 1, nil
+}
+
+// RemovedReason 最近移除的房间的原因
+func (s *RedisRoomStore) RemovedReason(roomID string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), redisOpTimeout)
+	defer cancel()
+
+	reason, err := s.client.Get(ctx, redisRemovedKey(roomID)).Result()
+	if errors.Is(err, redis.Nil) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("读取房间移除原因失败: %w", err)
+	}
+	return reason, nil
+}
+
+// Join 房间成员数加一
+func (s *RedisRoomStore) Join(roomID, token string, receiver bool) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), redisOpTimeout)
+	defer cancel()
+
+	joined, err := redisJoinRoom.Run(ctx, s.client, []string{redisRoomKey(roomID)},
+		token, redisBool(receiver), redisRoomKeyTTL.Milliseconds()).Int()
+	if err != nil {
+		return false, fmt.Errorf("加入房间失败: %w", err)
+	}
+	return joined == 1, nil
+}
+
+// Leave 房间成员数减一，返回剩余成员数
+func (s *RedisRoomStore) Leave(roomID, token string) (int, bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), redisOpTimeout)
+	defer cancel()
+
+	remaining, err := redisLeaveRoom.Run(ctx, s.client, []string{redisRoomKey(roomID)}, token).Int()
+	if err != nil {
+		return 0, false, fmt.Errorf("离开房间失败: %w", err)
+	}
+	if remaining < 0 {
+		return 0, false, nil
+	}
+	return remaining, true, nil
+}
+
+// Publish 把消息发布到房间的频道
+func (s *RedisRoomStore) Publish(token string, env Envelope) error {
+	data, err := json.Marshal(env)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), redisOpTimeout)
+	defer cancel()
+	if err := s.client.Publish(ctx, redisChannel(token), data).Err(); err != nil {
+		return fmt.Errorf("发布房间消息失败: %w", err)
+	}
+	return nil
+}
+
+// Subscribe 订阅房间的频道（每个房间一个订阅连接），订阅生效后才返回，之后发布的消息不会丢失
+func (s *RedisRoomStore) Subscribe(token string, deliver func(Envelope)) (func(), error) {
+	ctx, cancel := context.WithTimeout(context.Background(), redisOpTimeout)
+	defer cancel()
+
+	pubsub := s.client.Subscribe(ctx, redisChannel(token))
+	if _, err := pubsub.Receive(ctx); err != nil {
+		pubsub.Close()
+		return nil, fmt.Errorf("订阅房间消息失败: %w", err)
+	}
+
+	go func() {
+		for message := range pubsub.Channel() {
+			var env Envelope
+			if err := json.Unmarshal([]byte(message.Payload), &env); err != nil {
+				log.Printf("解析Redis房间消息失败: %v", err)
+				continue
+			}
+			deliver(env)
+		}
+	}()
+	return func() { pubsub.Close() }, nil
+}
+
+// Close 关闭Redis连接
+func (s *RedisRoomStore) Close() error {
+	return s.client.Close()
+}
+
+// redisBool 布尔值在Redis中保存为"1"/"0"
+func redisBool(b bool) string {
+	if b {
+		return "1"
+	}
+	return "0"
+}
@@ -0,0 +1,940 @@
+// Package signaling WebRTC信令服务器：客户端通过WebSocket创建/加入房间，服务器在同一房间的客户端之间转发offer/answer等消息
+// 由cmd/signaling（独立部署的信令服务器）和发送端的自检等功能共用
+package signaling
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// 信令服务器
+type SignalingServer struct {
+	rooms      map[string]*Room // 本实例上有成员的房间（按房间标识）
+	roomsMu    sync.Mutex
+	clients    map[*Client]bool // 所有已连接的客户端（用于关闭时通知）
+	clientsMu  sync.Mutex
+	upgrader   websocket.Upgrader
+	httpServer *http.Server
+	serverMu   sync.Mutex
+	// AllowedOrigins 允许的浏览器来源（Origin头），为空或包含"*"时允许所有来源
+	AllowedOrigins []string
+	// RelayMaxBytes 每个房间允许经服务器中转的最大数据量（data消息），0表示不允许中转
+	RelayMaxBytes int64
+	// RoomTTL 房间创建后超过该时间仍没有接收端加入时过期（访问该房间时移除），0表示不过期
+	RoomTTL time.Duration
+	// SendBufferSize 每个客户端的发送队列长度（条消息），队列满时断开该客户端（在开始服务前设置）
+	SendBufferSize int
+	// Store 房间注册表，默认保存在内存中；多个实例共享房间时使用NewRedisRoomStore（在开始服务前设置）
+	Store RoomStore
+	// ReadBufferSize、WriteBufferSize 每个WebSocket连接的读写缓冲区大小（字节），只影响I/O效率和内存占用，
+	// 不限制消息大小；0表示使用websocket库的默认值4KB（在开始服务前设置）
+	ReadBufferSize  int
+	WriteBufferSize int
+	// EnableCompression 与支持的客户端协商permessage-deflate压缩，只压缩不小于compressMinSize的消息（在开始服务前设置）
+	EnableCompression bool
+}
+
+// DefaultRelayMaxBytes 默认每个房间允许中转的数据量
+const DefaultRelayMaxBytes = 64 * 1024 * 1024
+
+// DefaultRoomTTL 默认房间有效期
+const DefaultRoomTTL = time.Hour
+
+// DefaultSendBufferSize 默认每个客户端的发送队列长度
+const DefaultSendBufferSize = 256
+
+// DefaultReadBufferSize、DefaultWriteBufferSize 默认的读写缓冲区大小：能容纳一条base64编码的SDP（通常2~6KB），
+// 大多数消息一次读写完成；候选和控制消息只有几百字节，更大的缓冲区只会增加每个连接的内存占用
+const (
+	DefaultReadBufferSize  = 8 * 1024
+	DefaultWriteBufferSize = 8 * 1024
+)
+
+// compressMinSize 启用压缩时只压缩不小于该大小的消息：SDP压缩后通常只有原来的一半左右，
+// 几十到几百字节的控制消息压缩后几乎不变小，反而增加CPU开销
+const compressMinSize = 1024
+
+// 加入房间失败（房间不存在）时错误消息reason字段的取值
+const (
+	RoomNeverExisted = "never_existed" // 没有创建过该房间（或移除已超过removedRoomRetention）
+	RoomExpired      = "expired"       // 超过RoomTTL没有接收端加入，已过期
+	RoomClosed       = "closed"        // 传输已完成，或所有客户端都已离开（发送端已退出）
+)
+
+// removedRoomRetention 记住已移除房间的时间
+const removedRoomRetention = 10 * time.Minute
+
+// removedRoom 已移除房间的记录
+type removedRoom struct {
+	reason    string
+	removedAt time.Time
+}
+
+// Room 本实例上的房间（房间状态保存在注册表中，这里只记录连接到本实例的成员）
+type Room struct {
+	ID          string
+	token       string // 房间标识（见RoomInfo.Token）
+	clients     map[*Client]bool
+	clientsMu   sync.RWMutex
+	broadcast   bool   // 广播房间：一个发送端同时发送给多个接收端，offer/answer等按PeerID只转发给对应的客户端
+	relayBytes  int64  // 已中转的数据量（原子访问，只有发送端发送数据，由发送端所在的实例统计）
+	unsubscribe func() // 取消订阅房间消息
+}
+
+// Client 客户端
+type Client struct {
+	conn        *websocket.Conn
+	room        *Room
+	roomID      atomic.Value  // 当前房间ID（string），logf可能在其他goroutine中调用（如向已满的发送队列发送时），不能读取room
+	send        chan []byte   // 发送队列，由writePump读取（从不关闭，避免其他goroutine向已关闭的通道发送）
+	done        chan struct{} // 断开连接时关闭，writePump随之退出
+	doneOnce    sync.Once
+	server      *SignalingServer
+	clientType  string // "sender" or "receiver"
+	id          string // 连接ID，日志中用于关联同一连接的所有操作
+	remoteAddr  string // 客户端地址（经反向代理时附带X-Forwarded-For）
+	connectedAt time.Time
+}
+
+// newConnID 生成连接ID（8位十六进制）
+func newConnID() string {
+	b := make([]byte, 4)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("%08x", time.Now().UnixNano()&0xffffffff)
+	}
+	return hex.EncodeToString(b)
+}
+
+// requestRemoteAddr 请求的来源地址，经反向代理时附带X-Forwarded-For（仅用于日志，不作为可信信息）
+func requestRemoteAddr(r *http.Request) string {
+	if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+		return fmt.Sprintf("%s（X-Forwarded-For: %s）", r.RemoteAddr, forwarded)
+	}
+	return r.RemoteAddr
+}
+
+// setRoom 设置客户端所在的房间（只在readPump中调用），同时记录日志使用的房间ID
+func (c *Client) setRoom(room *Room) {
+	c.room = room
+	if room != nil {
+		c.roomID.Store(room.ID)
+	} else {
+		c.roomID.Store("")
+	}
+}
+
+// logf 输出带连接ID和房间ID的日志，便于在繁忙的日志中关联同一次传输的发送端和接收端（可在任意goroutine中调用）
+func (c *Client) logf(format string, args ...interface{}) {
+	roomID, _ := c.roomID.Load().(string)
+	if roomID == "" {
+		roomID = "-"
+	}
+	log.Printf("[conn=%s room=%s] "+format, append([]interface{}{c.id, roomID}, args...)...)
+}
+
+// Message 消息类型
+type Message struct {
+	Type       string `json:"type"` // "create_room", "join_room", "offer", "answer", "request_offer", "data", "data_ack", "transfer_complete", "error"
+	RoomID     string `json:"room_id,omitempty"`
+	FileID     string `json:"file_id,omitempty"`
+	SDP        string `json:"sdp,omitempty"`
+	Error      string `json:"error,omitempty"`
+	ClientType string `json:"client_type,omitempty"`
+	Data       string `json:"data,omitempty"`   // data: base64编码的数据块（客户端 --relay-via-signaling）
+	Offset     int64  `json:"offset,omitempty"` // data: 数据块位置；data_ack: 接收端已写入的位置
+	Reason     string `json:"reason,omitempty"` // error: 加入房间失败的原因（RoomNeverExisted/RoomExpired/RoomClosed）
+	// 广播房间：create_room/room_created的Broadcast为true；peer_joined、peer_left、answer的PeerID为接收端的连接ID，
+	// 发送端在offer中指定PeerID，服务器只转发给该接收端
+	Broadcast bool   `json:"broadcast,omitempty"`
+	PeerID    string `json:"peer_id,omitempty"`
+}
+
+// NewSignalingServer 创建信令服务器
+func NewSignalingServer() *SignalingServer {
+	s := &SignalingServer{
+		rooms:             make(map[string]*Room),
+		clients:           make(map[*Client]bool),
+		RelayMaxBytes:     DefaultRelayMaxBytes,
+		RoomTTL:           DefaultRoomTTL,
+		SendBufferSize:    DefaultSendBufferSize,
+		Store:             NewMemoryRoomStore(),
+		ReadBufferSize:    DefaultReadBufferSize,
+		WriteBufferSize:   DefaultWriteBufferSize,
+		EnableCompression: true,
+	}
+	s.upgrader = websocket.Upgrader{
+		CheckOrigin: s.checkOrigin,
+	}
+	return s
+}
+
+// ParseAllowedOrigins 解析逗号分隔的来源列表（如 "https://a.com,https://b.com" 或 "*"）
+func ParseAllowedOrigins(list string) []string {
+	var origins []string
+	for _, origin := range strings.Split(list, ",") {
+		origin = normalizeOrigin(origin)
+		if origin != "" {
+			origins = append(origins, origin)
+		}
+	}
+	return origins
+}
+
+// normalizeOrigin 统一来源格式（小写、去掉末尾斜杠）便于比较
+func normalizeOrigin(origin string) string {
+	return strings.TrimSuffix(strings.ToLower(strings.TrimSpace(origin)), "/")
+}
+
+// checkOrigin 校验WebSocket握手的Origin头，防止跨站WebSocket劫持（CSWSH）
+// 命令行客户端不发送Origin头，始终允许；浏览器请求必须来自允许列表中的来源
+func (s *SignalingServer) checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" || len(s.AllowedOrigins) == 0 {
+		return true
+	}
+
+	origin = normalizeOrigin(origin)
+	for _, allowed := range s.AllowedOrigins {
+		if allowed == "*" || allowed == origin {
+			return true
+		}
+	}
+	log.Printf("拒绝来源 %s 的WebSocket连接（不在--allowed-origins中），地址: %s", origin, requestRemoteAddr(r))
+	return false
+}
+
+// getRoom 获取房间状态（创建后超过RoomTTL仍没有接收端加入的房间先移除并通知房间内的客户端，返回nil）
+func (s *SignalingServer) getRoom(roomID string) (*RoomInfo, error) {
+	info, err := s.Store.GetRoom(roomID)
+	if err != nil || info == nil {
+		return nil, err
+	}
+	if s.RoomTTL <= 0 || info.Joined || time.Since(info.CreatedAt) < s.RoomTTL {
+		return info, nil
+	}
+
+	removed, err := s.Store.RemoveRoom(roomID, info.Token, RoomExpired)
+	if err != nil {
+		return nil, err
+	}
+	if removed {
+		log.Printf("[room=%s] 房间已过期（%v 内没有接收端加入），已移除", roomID, s.RoomTTL)
+		s.publish(roomID, info.Token, Envelope{Msg: Message{
+			Type:   "error",
+			RoomID: roomID,
+			Error:  "房间已过期",
+			Reason: RoomExpired,
+		}})
+	}
+	return nil, nil
+}
+
+// createRoom 房间不存在（或已过期）时创建新房间，已存在时返回nil
+func (s *SignalingServer) createRoom(roomID string, broadcast bool) (*RoomInfo, error) {
+	if _, err := s.getRoom(roomID); err != nil {
+		return nil, err
+	}
+	return s.Store.CreateRoom(roomID, broadcast)
+}
+
+// removeRoomIfCurrent 仅当房间ID仍指向room时移除（房间被提前移除后ID可能已被新房间使用）
+func (s *SignalingServer) removeRoomIfCurrent(room *Room, reason string) bool {
+	removed, err := s.Store.RemoveRoom(room.ID, room.token, reason)
+	if err != nil {
+		log.Printf("[room=%s] %v", room.ID, err)
+	}
+	return removed
+}
+
+// RoomNotFoundReason 房间不存在的原因（RoomNeverExisted/RoomExpired/RoomClosed）
+func (s *SignalingServer) RoomNotFoundReason(roomID string) string {
+	reason, err := s.Store.RemovedReason(roomID)
+	if err != nil {
+		log.Printf("[room=%s] %v", roomID, err)
+	}
+	if reason == "" {
+		return RoomNeverExisted
+	}
+	return reason
+}
+
+// attachRoom 把客户端加入本实例上的房间，本实例还没有该房间的成员时创建并订阅房间消息
+func (s *SignalingServer) attachRoom(c *Client, info *RoomInfo) (*Room, error) {
+	s.roomsMu.Lock()
+	defer s.roomsMu.Unlock()
+
+	room := s.rooms[info.Token]
+	if room == nil {
+		room = &Room{
+			ID:        info.ID,
+			token:     info.Token,
+			broadcast: info.Broadcast,
+			clients:   make(map[*Client]bool),
+		}
+		unsubscribe, err := s.Store.Subscribe(info.Token, room.deliver)
+		if err != nil {
+			return nil, err
+		}
+		room.unsubscribe = unsubscribe
+		s.rooms[info.Token] = room
+	}
+	room.clientsMu.Lock()
+	room.clients[c] = true
+	room.clientsMu.Unlock()
+	return room, nil
+}
+
+// detachRoom 从本实例上的房间移除客户端，本实例没有该房间的其他成员时取消订阅
+func (s *SignalingServer) detachRoom(c *Client, room *Room) {
+	s.roomsMu.Lock()
+	defer s.roomsMu.Unlock()
+
+	room.clientsMu.Lock()
+	delete(room.clients, c)
+	empty := len(room.clients) == 0
+	room.clientsMu.Unlock()
+	if empty && s.rooms[room.token] == room {
+		delete(s.rooms, room.token)
+		room.unsubscribe()
+	}
+}
+
+// publish 发布房间消息，由注册表投递给所有实例上的房间成员
+func (s *SignalingServer) publish(roomID, token string, env Envelope) {
+	if err := s.Store.Publish(token, env); err != nil {
+		log.Printf("[room=%s] %v", roomID, err)
+	}
+}
+
+// deliver 把房间消息投递给本实例上的成员（不投递给发出消息的客户端）
+// Routed消息按广播房间的规则投递：接收端的消息只投递给发送端，发送端的消息只投递给msg.PeerID对应的接收端（为空时投递给所有接收端）
+func (r *Room) deliver(env Envelope) {
+	r.clientsMu.RLock()
+	defer r.clientsMu.RUnlock()
+
+	for client := range r.clients {
+		if client.id == env.From {
+			continue
+		}
+		if env.Routed {
+			if env.FromType == "sender" && env.Msg.PeerID != "" && client.id != env.Msg.PeerID {
+				continue
+			}
+			if env.FromType != "sender" && client.clientType != "sender" {
+				continue
+			}
+		}
+		msg := env.Msg
+		client.sendMessage(&msg)
+	}
+}
+
+// handleWebSocket 处理WebSocket连接
+func (s *SignalingServer) handleWebSocket(w http.ResponseWriter, r *http.Request) {
+	upgrader := s.upgrader
+	upgrader.ReadBufferSize = s.ReadBufferSize
+	upgrader.WriteBufferSize = s.WriteBufferSize
+	upgrader.EnableCompression = s.EnableCompression
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Printf("WebSocket升级失败（地址: %s）: %v", requestRemoteAddr(r), err)
+		return
+	}
+
+	bufferSize := s.SendBufferSize
+	if bufferSize <= 0 {
+		bufferSize = DefaultSendBufferSize
+	}
+	client := &Client{
+		conn:        conn,
+		send:        make(chan []byte, bufferSize),
+		done:        make(chan struct{}),
+		server:      s,
+		id:          newConnID(),
+		remoteAddr:  requestRemoteAddr(r),
+		connectedAt: time.Now(),
+	}
+	s.addClient(client)
+	client.logf("客户端已连接，地址: %s", client.remoteAddr)
+
+	go client.writePump()
+	go client.readPump()
+}
+
+// addClient 记录已连接的客户端
+func (s *SignalingServer) addClient(c *Client) {
+	s.clientsMu.Lock()
+	defer s.clientsMu.Unlock()
+	s.clients[c] = true
+}
+
+// removeClient 移除已断开的客户端
+func (s *SignalingServer) removeClient(c *Client) {
+	s.clientsMu.Lock()
+	defer s.clientsMu.Unlock()
+	delete(s.clients, c)
+}
+
+// readPump 读取客户端消息
+func (c *Client) readPump() {
+	defer func() {
+		c.conn.Close()
+		c.logf("客户端已断开，地址: %s，连接时长: %v", c.remoteAddr, time.Since(c.connectedAt).Round(time.Second))
+		if c.room != nil {
+			c.leaveRoom()
+		}
+		c.server.removeClient(c)
+	}()
+
+	// 收到任何数据（消息、pong、客户端主动发送的ping）都延长读取期限
+	extend := func() { c.conn.SetReadDeadline(time.Now().Add(60 * time.Second)) }
+	extend()
+	c.conn.SetPongHandler(func(string) error {
+		extend()
+		return nil
+	})
+	c.conn.SetPingHandler(func(data string) error {
+		extend()
+		err := c.conn.WriteControl(websocket.PongMessage, []byte(data), time.Now().Add(10*time.Second))
+		if err == websocket.ErrCloseSent {
+			return nil
+		}
+		if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+			return nil
+		}
+		return err
+	})
+
+	for {
+		_, message, err := c.conn.ReadMessage()
+		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
+				c.logf("WebSocket错误: %v", err)
+			}
+			break
+		}
+		extend()
+
+		c.handleMessage(message)
+	}
+}
+
+// writePump 向客户端发送消息
+func (c *Client) writePump() {
+	ticker := time.NewTicker(54 * time.Second)
+	defer func() {
+		ticker.Stop()
+		c.disconnect()
+		c.conn.Close()
+	}()
+
+	for {
+		select {
+		case <-c.done:
+			c.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+			c.conn.WriteMessage(websocket.CloseMessage, []byte{})
+			return
+		case message := <-c.send:
+			c.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+			// 发送队列中的其他消息合并在同一帧中
+			n := len(c.send)
+			messages := [][]byte{message}
+			size := len(message)
+			for i := 0; i < n; i++ {
+				next := <-c.send
+				messages = append(messages, next)
+				size += len(next) + 1
+			}
+
+			// 没有协商压缩时该设置不起作用
+			c.conn.EnableWriteCompression(size >= compressMinSize)
+			w, err := c.conn.NextWriter(websocket.TextMessage)
+			if err != nil {
+				return
+			}
+			for i, message := range messages {
+				if i > 0 {
+					w.Write([]byte{'\n'})
+				}
+				w.Write(message)
+			}
+
+			if err := w.Close(); err != nil {
+				return
+			}
+		case <-ticker.C:
+			c.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// handleMessage 处理客户端消息
+func (c *Client) handleMessage(data []byte) {
+	var msg Message
+	if err := json.Unmarshal(data, &msg); err != nil {
+		c.sendError("无效的消息格式")
+		return
+	}
+
+	switch msg.Type {
+	case "create_room":
+		c.handleCreateRoom(&msg)
+	case "join_room":
+		c.handleJoinRoom(&msg)
+	case "offer":
+		c.handleOffer(&msg)
+	case "answer":
+		c.handleAnswer(&msg)
+	case "request_offer":
+		c.handleRequestOffer(&msg)
+	case "data":
+		c.handleData(&msg)
+	case "data_ack":
+		c.handleDataAck(&msg)
+	case "transfer_complete":
+		c.handleTransferComplete(&msg)
+	default:
+		c.sendError(fmt.Sprintf("未知的消息类型: %s", msg.Type))
+	}
+}
+
+// handleCreateRoom 处理创建房间
+func (c *Client) handleCreateRoom(msg *Message) {
+	if msg.RoomID == "" {
+		c.sendError("房间ID不能为空")
+		return
+	}
+
+	// 创建房间（已存在时失败）
+	info, err := c.server.createRoom(msg.RoomID, msg.Broadcast)
+	if err != nil {
+		c.storeError("创建房间", err)
+		return
+	}
+	if info == nil {
+		c.logf("创建房间 %s 失败: 房间已存在", msg.RoomID)
+		c.sendError("房间已存在")
+		return
+	}
+	c.clientType = "sender"
+	room, err := c.server.attachRoom(c, info)
+	if err != nil {
+		c.server.Store.RemoveRoom(info.ID, info.Token, RoomClosed)
+		c.storeError("创建房间", err)
+		return
+	}
+	c.setRoom(room)
+
+	if msg.Broadcast {
+		c.logf("广播房间 %s 已创建，客户端类型: sender", msg.RoomID)
+	} else {
+		c.logf("房间 %s 已创建，客户端类型: sender", msg.RoomID)
+	}
+
+	// 发送确认（Broadcast告知发送端服务器支持广播房间）
+	response := Message{
+		Type:      "room_created",
+		RoomID:    msg.RoomID,
+		Broadcast: msg.Broadcast,
+	}
+	c.sendMessage(&response)
+}
+
+// handleJoinRoom 处理加入房间
+func (c *Client) handleJoinRoom(msg *Message) {
+	if msg.RoomID == "" {
+		c.sendError("房间ID不能为空")
+		return
+	}
+
+	info, err := c.server.getRoom(msg.RoomID)
+	if err != nil {
+		c.storeError("加入房间", err)
+		return
+	}
+	var room *Room
+	if info != nil {
+		// 先订阅房间消息再加入，发送端收到加入通知后发出的offer不会丢失
+		c.clientType = "receiver"
+		if room, err = c.server.attachRoom(c, info); err != nil {
+			c.storeError("加入房间", err)
+			return
+		}
+		joined, err := c.server.Store.Join(info.ID, info.Token, true)
+		if err != nil || !joined {
+			c.server.detachRoom(c, room)
+			room = nil
+			if err != nil {
+				c.storeError("加入房间", err)
+				return
+			}
+		}
+	}
+	if room == nil {
+		reason := c.server.RoomNotFoundReason(msg.RoomID)
+		c.logf("加入房间 %s 失败: 房间不存在（%s）", msg.RoomID, reason)
+		c.sendMessage(&Message{
+			Type:   "error",
+			Error:  "房间不存在",
+			Reason: reason,
+		})
+		return
+	}
+
+	c.setRoom(room)
+
+	c.logf("客户端加入房间 %s，客户端类型: receiver", msg.RoomID)
+
+	// 发送确认
+	response := Message{
+		Type:   "room_joined",
+		RoomID: msg.RoomID,
+	}
+	c.sendMessage(&response)
+
+	// 通知房间内其他客户端有新成员加入（广播房间只通知发送端）
+	c.relayInRoom(Message{
+		Type:   "peer_joined",
+		RoomID: msg.RoomID,
+	})
+}
+
+// handleOffer 处理Offer
+func (c *Client) handleOffer(msg *Message) {
+	if c.room == nil {
+		c.sendError("未加入房间")
+		return
+	}
+
+	if c.clientType != "sender" {
+		c.sendError("只有发送端可以发送Offer")
+		return
+	}
+
+	// 广播Offer给房间内其他客户端（接收端），广播房间只转发给PeerID对应的接收端
+	c.relayInRoom(Message{
+		Type:   "offer",
+		RoomID: msg.RoomID,
+		FileID: msg.FileID,
+		SDP:    msg.SDP,
+		PeerID: msg.PeerID,
+	})
+}
+
+// handleAnswer 处理Answer
+func (c *Client) handleAnswer(msg *Message) {
+	if c.room == nil {
+		c.sendError("未加入房间")
+		return
+	}
+
+	if c.clientType != "receiver" {
+		c.sendError("只有接收端可以发送Answer")
+		return
+	}
+
+	// 广播Answer给房间内其他客户端（发送端）
+	c.relayInRoom(Message{
+		Type:   "answer",
+		RoomID: msg.RoomID,
+		SDP:    msg.SDP,
+	})
+}
+
+// handleRequestOffer 转发接收端重新发送Offer的请求（接收端加入后一直没有收到Offer时发送）
+func (c *Client) handleRequestOffer(msg *Message) {
+	if c.room == nil {
+		c.sendError("未加入房间")
+		return
+	}
+
+	if c.clientType != "receiver" {
+		c.sendError("只有接收端可以请求Offer")
+		return
+	}
+
+	c.relayInRoom(Message{
+		Type:   "request_offer",
+		RoomID: msg.RoomID,
+	})
+}
+
+// handleData 转发发送端经服务器中转的数据块（P2P无法连接时的最后手段），每个房间的中转量受RelayMaxBytes限制
+func (c *Client) handleData(msg *Message) {
+	if c.room == nil {
+		c.sendError("未加入房间")
+		return
+	}
+
+	if c.clientType != "sender" {
+		c.sendError("只有发送端可以发送数据")
+		return
+	}
+
+	if c.server.RelayMaxBytes <= 0 {
+		c.sendError("信令服务器未启用数据中转")
+		return
+	}
+	if c.room.broadcast {
+		c.sendError("广播房间不支持数据中转")
+		return
+	}
+	total := atomic.AddInt64(&c.room.relayBytes, int64(base64.StdEncoding.DecodedLen(len(msg.Data))))
+	if total > c.server.RelayMaxBytes {
+		c.sendError(fmt.Sprintf("中转数据超过信令服务器上限（%d MB）", c.server.RelayMaxBytes/1024/1024))
+		return
+	}
+	if msg.Offset == 0 {
+		c.logf("房间 %s 开始经信令服务器中转数据", c.room.ID)
+	}
+
+	c.broadcastToRoom(Message{
+		Type:   "data",
+		RoomID: msg.RoomID,
+		Offset: msg.Offset,
+		Data:   msg.Data,
+	}, c)
+}
+
+// handleDataAck 转发接收端对中转数据的确认
+func (c *Client) handleDataAck(msg *Message) {
+	if c.room == nil {
+		c.sendError("未加入房间")
+		return
+	}
+
+	if c.clientType != "receiver" {
+		c.sendError("只有接收端可以确认数据")
+		return
+	}
+
+	c.broadcastToRoom(Message{
+		Type:   "data_ack",
+		RoomID: msg.RoomID,
+		Offset: msg.Offset,
+	}, c)
+}
+
+// handleTransferComplete 处理传输完成：立即移除房间，房间ID可以马上重新使用
+// 发送端和接收端都会发送，第二次收到时房间已移除，忽略即可
+func (c *Client) handleTransferComplete(msg *Message) {
+	if c.room == nil {
+		c.sendError("未加入房间")
+		return
+	}
+
+	// 广播房间中某个接收端完成时其他接收端可能仍在传输，由发送端在全部结束后移除
+	if c.room.broadcast && c.clientType != "sender" {
+		return
+	}
+	if c.server.removeRoomIfCurrent(c.room, RoomClosed) {
+		c.logf("房间 %s 传输完成，已移除", c.room.ID)
+	}
+}
+
+// broadcastToRoom 向房间内其他客户端广播消息
+func (c *Client) broadcastToRoom(msg Message, exclude *Client) {
+	if c.room == nil {
+		return
+	}
+
+	env := Envelope{Msg: msg}
+	if exclude != nil {
+		env.From = exclude.id
+	}
+	c.server.publish(c.room.ID, c.room.token, env)
+}
+
+// relayInRoom 向房间内其他客户端转发消息
+// 广播房间中接收端的消息只转发给发送端（附带接收端的PeerID），发送端的消息只转发给msg.PeerID对应的接收端（为空时转发给所有接收端）
+func (c *Client) relayInRoom(msg Message) {
+	if c.room == nil {
+		return
+	}
+	if !c.room.broadcast {
+		c.broadcastToRoom(msg, c)
+		return
+	}
+
+	if c.clientType != "sender" {
+		msg.PeerID = c.id
+	}
+	c.server.publish(c.room.ID, c.room.token, Envelope{
+		From:     c.id,
+		FromType: c.clientType,
+		Routed:   true,
+		Msg:      msg,
+	})
+}
+
+// leaveRoom 离开房间
+func (c *Client) leaveRoom() {
+	if c.room == nil {
+		return
+	}
+
+	clientCount, current, err := c.server.Store.Leave(c.room.ID, c.room.token)
+	if err != nil {
+		c.logf("%v", err)
+	}
+	c.server.detachRoom(c, c.room)
+
+	if current {
+		c.logf("客户端离开房间 %s，剩余客户端: %d", c.room.ID, clientCount)
+	} else {
+		c.logf("客户端离开房间 %s（房间已移除）", c.room.ID)
+	}
+
+	// 如果房间为空，移除房间
+	if current && clientCount == 0 {
+		if c.server.removeRoomIfCurrent(c.room, RoomClosed) {
+			c.logf("房间 %s 已移除（无客户端）", c.room.ID)
+		}
+	} else {
+		// 通知其他客户端有成员离开（广播房间中接收端离开只通知发送端）
+		c.relayInRoom(Message{
+			Type:   "peer_left",
+			RoomID: c.room.ID,
+		})
+	}
+
+	c.setRoom(nil)
+}
+
+// sendMessage 发送消息
+func (c *Client) sendMessage(msg *Message) {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		c.logf("序列化消息失败: %v", err)
+		return
+	}
+
+	select {
+	case <-c.done:
+		// 已断开，丢弃消息
+	case c.send <- data:
+	default:
+		// 客户端读取太慢，发送队列已满：丢弃消息并断开（不关闭send，其他goroutine可能同时在发送）
+		c.logf("发送队列已满（%d 条消息），断开客户端", cap(c.send))
+		c.disconnect()
+	}
+}
+
+// disconnect 断开客户端（可重复调用，也可在多个goroutine中同时调用）：通知writePump发送关闭帧后退出，
+// 读取端随之出错，readPump负责离开房间
+func (c *Client) disconnect() {
+	c.doneOnce.Do(func() {
+		close(c.done)
+	})
+}
+
+// storeError 记录房间注册表的错误（如Redis不可用）并告知客户端
+func (c *Client) storeError(action string, err error) {
+	c.logf("%s失败: %v", action, err)
+	c.sendError("信令服务器暂时无法访问房间信息，请稍后重试")
+}
+
+// sendError 发送错误消息
+func (c *Client) sendError(errMsg string) {
+	msg := Message{
+		Type:  "error",
+		Error: errMsg,
+	}
+	c.sendMessage(&msg)
+}
+
+// Handler 信令服务器的HTTP路由（WebSocket端点为/ws）
+func (s *SignalingServer) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ws", s.handleWebSocket)
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("WebRTC信令服务器运行中\n"))
+	})
+	return mux
+}
+
+// Start 启动信令服务器（阻塞直到服务器关闭）
+func (s *SignalingServer) Start(port int) error {
+	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
+	if err != nil {
+		return err
+	}
+	log.Printf("信令服务器启动在端口 %d", port)
+	log.Printf("WebSocket端点: ws://localhost:%d/ws", port)
+	return s.Serve(listener)
+}
+
+// Serve 在已创建的监听器上运行信令服务器（阻塞直到服务器关闭），用于监听随机端口（如 127.0.0.1:0）
+func (s *SignalingServer) Serve(listener net.Listener) error {
+	s.serverMu.Lock()
+	s.httpServer = &http.Server{
+		Handler: s.Handler(),
+	}
+	server := s.httpServer
+	s.serverMu.Unlock()
+
+	if err := server.Serve(listener); err != nil && err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
+
+// Shutdown 优雅关闭信令服务器
+// 停止接受新连接，向所有客户端广播server_shutdown消息，然后发送关闭帧并断开连接
+func (s *SignalingServer) Shutdown(ctx context.Context) error {
+	s.serverMu.Lock()
+	server := s.httpServer
+	s.serverMu.Unlock()
+
+	var shutdownErr error
+	if server != nil {
+		// WebSocket连接已被劫持，http.Server.Shutdown不会等待它们
+		shutdownErr = server.Shutdown(ctx)
+	}
+
+	s.clientsMu.Lock()
+	clients := make([]*Client, 0, len(s.clients))
+	for client := range s.clients {
+		clients = append(clients, client)
+	}
+	s.clientsMu.Unlock()
+
+	log.Printf("正在关闭信令服务器，通知 %d 个客户端...", len(clients))
+
+	for _, client := range clients {
+		client.sendMessage(&Message{
+			Type: "server_shutdown",
+		})
+	}
+
+	// 给writePump留出时间把通知发送出去
+	select {
+	case <-time.After(500 * time.Millisecond):
+	case <-ctx.Done():
+	}
+
+	closeMsg := websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutdown")
+	for _, client := range clients {
+		client.conn.WriteControl(websocket.CloseMessage, closeMsg, time.Now().Add(time.Second))
+		client.conn.Close()
+	}
+
+	log.Printf("信令服务器已关闭")
+	return shutdownErr
+}
@@ -0,0 +1,468 @@
+package signaling
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// testClient 测试用的WebSocket客户端
+type testClient struct {
+	t       *testing.T
+	conn    *websocket.Conn
+	pending []Message // 服务器可能把多条消息合并在一帧中（以换行分隔）
+}
+
+// dialTestClient 连接测试服务器的WebSocket端点
+func dialTestClient(t *testing.T, server *httptest.Server) *testClient {
+	t.Helper()
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/ws", nil)
+	if err != nil {
+		t.Fatalf("连接信令服务器失败: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return &testClient{t: t, conn: conn}
+}
+
+// send 发送消息
+func (c *testClient) send(msg Message) {
+	c.t.Helper()
+	data, _ := json.Marshal(msg)
+	if err := c.conn.WriteMessage(websocket.TextMessage, data); err != nil {
+		c.t.Fatalf("发送 %s 失败: %v", msg.Type, err)
+	}
+}
+
+// next 读取下一条消息
+func (c *testClient) next() (*Message, error) {
+	for len(c.pending) == 0 {
+		c.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		_, data, err := c.conn.ReadMessage()
+		if err != nil {
+			return nil, err
+		}
+		for _, line := range bytes.Split(data, []byte{'\n'}) {
+			var msg Message
+			if err := json.Unmarshal(line, &msg); err != nil {
+				return nil, err
+			}
+			c.pending = append(c.pending, msg)
+		}
+	}
+	msg := c.pending[0]
+	c.pending = c.pending[1:]
+	return &msg, nil
+}
+
+// expect 等待指定类型的消息
+func (c *testClient) expect(msgType string) *Message {
+	c.t.Helper()
+	msg, err := c.next()
+	if err != nil {
+		c.t.Fatalf("等待 %s 失败: %v", msgType, err)
+	}
+	if msg.Type != msgType {
+		c.t.Fatalf("期望 %s，收到 %s（%s）", msgType, msg.Type, msg.Error)
+	}
+	return msg
+}
+
+// TestShutdown 关闭时客户端先收到server_shutdown，再收到CloseGoingAway关闭帧
+func TestShutdown(t *testing.T) {
+	s := NewSignalingServer()
+	server := httptest.NewServer(s.Handler())
+	defer server.Close()
+
+	client := dialTestClient(t, server)
+	client.send(Message{Type: "create_room", RoomID: "shutdown-room"})
+	client.expect("room_created")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	shutdownErr := make(chan error, 1)
+	go func() { shutdownErr <- s.Shutdown(ctx) }()
+
+	client.expect("server_shutdown")
+	_, err := client.next()
+	var closeErr *websocket.CloseError
+	if !errors.As(err, &closeErr) || closeErr.Code != websocket.CloseGoingAway {
+		t.Fatalf("期望CloseGoingAway关闭帧，实际: %v", err)
+	}
+	if err := <-shutdownErr; err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+	if ctx.Err() != nil {
+		t.Fatal("Shutdown没有在超时之前返回")
+	}
+}
+
+// TestCheckOrigin 允许列表中的来源（忽略大小写和末尾斜杠）和不带Origin的命令行客户端可以连接，其他来源返回403
+func TestCheckOrigin(t *testing.T) {
+	s := NewSignalingServer()
+	s.AllowedOrigins = ParseAllowedOrigins("https://App.example.com/, https://other.example.com")
+	server := httptest.NewServer(s.Handler())
+	defer server.Close()
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws"
+
+	for _, c := range []struct {
+		origin string
+		status int
+	}{
+		{"https://app.example.com", http.StatusSwitchingProtocols},
+		{"https://evil.example.com", http.StatusForbidden},
+		{"", http.StatusSwitchingProtocols},
+	} {
+		header := http.Header{}
+		if c.origin != "" {
+			header.Set("Origin", c.origin)
+		}
+		conn, resp, err := websocket.DefaultDialer.Dial(url, header)
+		if conn != nil {
+			conn.Close()
+		}
+		if resp == nil || resp.StatusCode != c.status {
+			t.Errorf("来源 %q: 期望状态 %d，握手结果: %v", c.origin, c.status, err)
+		}
+	}
+}
+
+// TestCreateRoomRace 多个客户端同时创建同一房间，应该恰好一个成功，其他都收到"房间已存在"
+func TestCreateRoomRace(t *testing.T) {
+	server := httptest.NewServer(NewSignalingServer().Handler())
+	defer server.Close()
+
+	clients := make([]*testClient, 20)
+	for i := range clients {
+		clients[i] = dialTestClient(t, server)
+	}
+
+	// 所有客户端连接后同时发送create_room
+	data, _ := json.Marshal(Message{Type: "create_room", RoomID: "race-room"})
+	start := make(chan struct{})
+	results := make(chan string, len(clients))
+	for _, c := range clients {
+		go func(c *testClient) {
+			<-start
+			if err := c.conn.WriteMessage(websocket.TextMessage, data); err != nil {
+				results <- err.Error()
+				return
+			}
+			msg, err := c.next()
+			switch {
+			case err != nil:
+				results <- err.Error()
+			case msg.Type == "error":
+				results <- msg.Error
+			default:
+				results <- msg.Type
+			}
+		}(c)
+	}
+	close(start)
+
+	created := 0
+	for range clients {
+		switch result := <-results; result {
+		case "room_created":
+			created++
+		case "房间已存在":
+		default:
+			t.Fatalf("期望 room_created 或\"房间已存在\"，收到 %s", result)
+		}
+	}
+	if created != 1 {
+		t.Fatalf("%d 个客户端同时创建同一房间，期望 1 个成功，实际 %d 个", len(clients), created)
+	}
+}
+
+// expectRoomNotFound 加入房间应失败（"房间不存在"），错误原因为reason
+func (c *testClient) expectRoomNotFound(roomID, reason string) {
+	c.t.Helper()
+	c.send(Message{Type: "join_room", RoomID: roomID})
+	msg := c.expect("error")
+	if msg.Error != "房间不存在" || msg.Reason != reason {
+		c.t.Fatalf("期望\"房间不存在\"（原因 %s），收到 %s（原因 %q）", reason, msg.Error, msg.Reason)
+	}
+}
+
+// TestJoinReasons 加入不存在的房间时区分从未创建、已关闭（传输完成）和已过期
+func TestJoinReasons(t *testing.T) {
+	t.Run("never existed", func(t *testing.T) {
+		server := httptest.NewServer(NewSignalingServer().Handler())
+		defer server.Close()
+		dialTestClient(t, server).expectRoomNotFound("no-such-room", RoomNeverExisted)
+	})
+
+	t.Run("closed", func(t *testing.T) {
+		server := httptest.NewServer(NewSignalingServer().Handler())
+		defer server.Close()
+		sender := dialTestClient(t, server)
+		receiver := dialTestClient(t, server)
+		sender.send(Message{Type: "create_room", RoomID: "closed-room"})
+		sender.expect("room_created")
+		sender.send(Message{Type: "transfer_complete", RoomID: "closed-room"})
+		// 同一连接的消息按顺序处理，发送端收到回复时房间一定已移除
+		sender.expectRoomNotFound("closed-room", RoomClosed)
+		receiver.expectRoomNotFound("closed-room", RoomClosed)
+	})
+
+	t.Run("expired", func(t *testing.T) {
+		s := NewSignalingServer()
+		s.RoomTTL = 200 * time.Millisecond
+		server := httptest.NewServer(s.Handler())
+		defer server.Close()
+		sender := dialTestClient(t, server)
+		receiver := dialTestClient(t, server)
+		sender.send(Message{Type: "create_room", RoomID: "expired-room"})
+		sender.expect("room_created")
+		time.Sleep(s.RoomTTL + 100*time.Millisecond)
+
+		receiver.expectRoomNotFound("expired-room", RoomExpired)
+		// 发送端收到"房间已过期"
+		if msg := sender.expect("error"); msg.Reason != RoomExpired {
+			t.Fatalf("期望发送端收到过期通知，收到 %s（原因 %q）", msg.Error, msg.Reason)
+		}
+	})
+}
+
+// TestSendOverflow 发送队列溢出：广播房间的发送端不读取消息，多个接收端同时发送大量answer，
+// 服务器应断开发送端而不是崩溃（多个goroutine同时向已满的队列发送），之后仍能正常创建房间
+func TestSendOverflow(t *testing.T) {
+	s := NewSignalingServer()
+	s.SendBufferSize = 4
+	server := httptest.NewServer(s.Handler())
+	defer server.Close()
+
+	sender := dialTestClient(t, server)
+	sender.send(Message{Type: "create_room", RoomID: "overflow-room", Broadcast: true})
+	sender.expect("room_created")
+
+	receivers := make([]*testClient, 4)
+	for i := range receivers {
+		receivers[i] = dialTestClient(t, server)
+		receivers[i].send(Message{Type: "join_room", RoomID: "overflow-room"})
+		receivers[i].expect("room_joined")
+	}
+
+	// 发送端不读取：服务器写入阻塞后发送队列很快填满（发送端断开后接收端的发送可能失败，忽略）
+	data, _ := json.Marshal(Message{Type: "answer", RoomID: "overflow-room", SDP: strings.Repeat("x", 64*1024)})
+	var wg sync.WaitGroup
+	for _, receiver := range receivers {
+		wg.Add(1)
+		go func(receiver *testClient) {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				if err := receiver.conn.WriteMessage(websocket.TextMessage, data); err != nil {
+					return
+				}
+			}
+		}(receiver)
+	}
+	wg.Wait()
+
+	// 读出已发送的消息后连接应被服务器关闭（而不是一直等到超时）
+	for {
+		_, err := sender.next()
+		if err == nil {
+			continue
+		}
+		var netErr net.Error
+		if errors.As(err, &netErr) && netErr.Timeout() {
+			t.Fatal("发送队列溢出后服务器没有断开发送端")
+		}
+		break
+	}
+
+	// 服务器仍在正常工作
+	client := dialTestClient(t, server)
+	client.send(Message{Type: "create_room", RoomID: "overflow-room-after"})
+	client.expect("room_created")
+}
+
+// TestCompression 发送端协商permessage-deflate压缩，接收端不压缩，较大的offer/answer在两者之间原样转发
+func TestCompression(t *testing.T) {
+	server := httptest.NewServer(NewSignalingServer().Handler())
+	defer server.Close()
+
+	dialer := websocket.Dialer{EnableCompression: true}
+	conn, resp, err := dialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/ws", nil)
+	if err != nil {
+		t.Fatalf("连接信令服务器失败: %v", err)
+	}
+	defer conn.Close()
+	if ext := resp.Header.Get("Sec-WebSocket-Extensions"); !strings.Contains(ext, "permessage-deflate") {
+		t.Fatalf("服务器没有协商压缩（Sec-WebSocket-Extensions: %q）", ext)
+	}
+	sender := &testClient{t: t, conn: conn}
+	receiver := dialTestClient(t, server)
+
+	sender.send(Message{Type: "create_room", RoomID: "compress-room"})
+	sender.expect("room_created")
+	receiver.send(Message{Type: "join_room", RoomID: "compress-room"})
+	receiver.expect("room_joined")
+	sender.expect("peer_joined")
+
+	// 类似SDP的候选行，每行内容不同，解压出错时内容不一致；超过默认的读写缓冲区，需要多次读写
+	const sdpSize = 20 * 1024
+	var sdp strings.Builder
+	for i := 0; sdp.Len() < sdpSize; i++ {
+		fmt.Fprintf(&sdp, "a=candidate:%d 1 udp 2130706431 192.168.%d.%d %d typ host\r\n", i, i%256, i*7%256, 40000+i)
+	}
+	offerSDP := sdp.String()
+	sender.send(Message{Type: "offer", RoomID: "compress-room", FileID: "compress-room", SDP: offerSDP})
+	if offer := receiver.expect("offer"); offer.SDP != offerSDP {
+		t.Fatalf("转发压缩的offer: 内容不一致（%d 字节，期望 %d 字节）", len(offer.SDP), len(offerSDP))
+	}
+
+	answerSDP := strings.Repeat("a=answer-line\r\n", sdpSize/16)
+	receiver.send(Message{Type: "answer", RoomID: "compress-room", SDP: answerSDP})
+	if answer := sender.expect("answer"); answer.SDP != answerSDP {
+		t.Fatalf("压缩转发answer: 内容不一致（%d 字节，期望 %d 字节）", len(answer.SDP), len(answerSDP))
+	}
+}
+
+// TestRelay 两个客户端创建/加入房间并交换offer/answer，传输完成后房间立即移除，同一房间ID可以马上重新创建
+func TestRelay(t *testing.T) {
+	server := httptest.NewServer(NewSignalingServer().Handler())
+	defer server.Close()
+	sender := dialTestClient(t, server)
+	receiver := dialTestClient(t, server)
+
+	sender.send(Message{Type: "create_room", RoomID: "relay-room"})
+	sender.expect("room_created")
+
+	// 加入房间，发送端应收到peer_joined
+	receiver.send(Message{Type: "join_room", RoomID: "relay-room"})
+	receiver.expect("room_joined")
+	sender.expect("peer_joined")
+
+	// 接收端请求重新发送Offer，转发给发送端
+	receiver.send(Message{Type: "request_offer", RoomID: "relay-room"})
+	sender.expect("request_offer")
+
+	sender.send(Message{Type: "offer", RoomID: "relay-room", FileID: "relay-file", SDP: "relay-offer"})
+	if offer := receiver.expect("offer"); offer.SDP != "relay-offer" || offer.FileID != "relay-file" {
+		t.Fatalf("转发offer: 内容不一致（%+v）", offer)
+	}
+	receiver.send(Message{Type: "answer", RoomID: "relay-room", SDP: "relay-answer"})
+	if answer := sender.expect("answer"); answer.SDP != "relay-answer" {
+		t.Fatalf("转发answer: 内容不一致（%q）", answer.SDP)
+	}
+
+	sender.send(Message{Type: "transfer_complete", RoomID: "relay-room"})
+	receiver.send(Message{Type: "transfer_complete", RoomID: "relay-room"})
+	again := dialTestClient(t, server)
+	again.send(Message{Type: "create_room", RoomID: "relay-room"})
+	again.expect("room_created")
+}
+
+// TestBroadcast 广播房间：接收端只看到发给自己的offer，answer和离开通知附带接收端的PeerID只发给发送端
+func TestBroadcast(t *testing.T) {
+	server := httptest.NewServer(NewSignalingServer().Handler())
+	defer server.Close()
+
+	sender := dialTestClient(t, server)
+	sender.send(Message{Type: "create_room", RoomID: "broadcast-room", Broadcast: true})
+	if created := sender.expect("room_created"); !created.Broadcast {
+		t.Fatal("服务器没有确认广播房间")
+	}
+
+	// 两个接收端依次加入，发送端收到各自的PeerID
+	receivers := make([]*testClient, 2)
+	peerIDs := make([]string, 2)
+	for i := range receivers {
+		receivers[i] = dialTestClient(t, server)
+		receivers[i].send(Message{Type: "join_room", RoomID: "broadcast-room"})
+		receivers[i].expect("room_joined")
+		if peerIDs[i] = sender.expect("peer_joined").PeerID; peerIDs[i] == "" {
+			t.Fatalf("接收端 #%d 的加入通知没有PeerID", i+1)
+		}
+	}
+
+	// 按相反顺序发送offer：接收端的下一条消息必须是发给自己的offer（不应收到其他接收端的加入通知或offer）
+	for i := len(receivers) - 1; i >= 0; i-- {
+		sender.send(Message{Type: "offer", RoomID: "broadcast-room", SDP: fmt.Sprintf("offer-%d", i), PeerID: peerIDs[i]})
+	}
+	for i, receiver := range receivers {
+		if offer, want := receiver.expect("offer"), fmt.Sprintf("offer-%d", i); offer.SDP != want {
+			t.Fatalf("接收端 #%d 收到了其他接收端的offer（%s）", i+1, offer.SDP)
+		}
+	}
+
+	receivers[0].send(Message{Type: "answer", RoomID: "broadcast-room", SDP: "answer-0"})
+	if answer := sender.expect("answer"); answer.PeerID != peerIDs[0] || answer.SDP != "answer-0" {
+		t.Fatalf("answer的PeerID为 %q，期望 %q", answer.PeerID, peerIDs[0])
+	}
+
+	receivers[1].conn.Close()
+	if left := sender.expect("peer_left"); left.PeerID != peerIDs[1] {
+		t.Fatalf("离开通知的PeerID为 %q，期望 %q", left.PeerID, peerIDs[1])
+	}
+}
+
+// TestSharedStore 多实例部署：两个服务器实例共享房间注册表，发送端和接收端连接到不同实例。
+// 默认共享内存注册表；设置环境变量FTF_TEST_REDIS（Redis地址）时同时检查Redis注册表
+func TestSharedStore(t *testing.T) {
+	stores := map[string]func(t *testing.T) RoomStore{
+		"memory": func(t *testing.T) RoomStore { return NewMemoryRoomStore() },
+		"redis": func(t *testing.T) RoomStore {
+			addr := os.Getenv("FTF_TEST_REDIS")
+			if addr == "" {
+				t.Skip("没有设置FTF_TEST_REDIS")
+			}
+			store, err := NewRedisRoomStore(addr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return store
+		},
+	}
+	for name, newStore := range stores {
+		t.Run(name, func(t *testing.T) {
+			store := newStore(t)
+			defer store.Close()
+			servers := make([]*httptest.Server, 2)
+			for i := range servers {
+				s := NewSignalingServer()
+				s.Store = store
+				servers[i] = httptest.NewServer(s.Handler())
+				defer servers[i].Close()
+			}
+			roomID := fmt.Sprintf("shared-%d", time.Now().UnixNano())
+			sender := dialTestClient(t, servers[0])
+			receiver := dialTestClient(t, servers[1])
+
+			sender.send(Message{Type: "create_room", RoomID: roomID})
+			sender.expect("room_created")
+			// 另一个实例上重复创建同一房间应失败
+			receiver.send(Message{Type: "create_room", RoomID: roomID})
+			receiver.expect("error")
+
+			receiver.send(Message{Type: "join_room", RoomID: roomID})
+			receiver.expect("room_joined")
+			sender.expect("peer_joined")
+			sender.send(Message{Type: "offer", RoomID: roomID, SDP: "shared-offer"})
+			if offer := receiver.expect("offer"); offer.SDP != "shared-offer" {
+				t.Fatalf("跨实例转发offer: 内容不一致（%q）", offer.SDP)
+			}
+			receiver.send(Message{Type: "answer", RoomID: roomID, SDP: "shared-answer"})
+			if answer := sender.expect("answer"); answer.SDP != "shared-answer" {
+				t.Fatalf("跨实例转发answer: 内容不一致（%q）", answer.SDP)
+			}
+			receiver.conn.Close()
+			sender.expect("peer_left")
+		})
+	}
+}
@@ -0,0 +1,228 @@
+package signaling
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// 房间注册表：记录房间状态（是否存在、成员数、是否已有接收端加入）并在房间成员之间投递消息
+// 单实例部署使用内存注册表（默认）；多个信令服务器实例部署在负载均衡后面时使用Redis注册表，
+// 发送端和接收端连接到不同实例也能找到对方。每个实例只保存连接到本实例的客户端，
+// 房间内的消息发布到注册表，由有该房间成员的实例投递给各自的客户端。
+
+// RoomInfo 房间注册表中的房间状态
+type RoomInfo struct {
+	ID        string
+	Token     string // 创建房间时生成的随机标识，区分先后使用同一ID的房间
+	CreatedAt time.Time
+	Broadcast bool // 广播房间（见Room.broadcast）
+	Joined    bool // 已有接收端加入（加入过的房间不会过期）
+}
+
+// Envelope 在房间成员之间投递的消息
+type Envelope struct {
+	From     string  `json:"from,omitempty"`      // 发出消息的连接ID，不投递给该连接；为空时投递给所有成员
+	FromType string  `json:"from_type,omitempty"` // 发出消息的客户端类型（"sender"或"receiver"）
+	Routed   bool    `json:"routed,omitempty"`    // 按广播房间的规则投递（见relayInRoom）
+	Msg      Message `json:"msg"`
+}
+
+// RoomStore 房间注册表，内存和Redis两种实现，SignalingServer只通过该接口访问房间状态
+type RoomStore interface {
+	// CreateRoom 房间不存在时创建（检查和创建是原子操作，并发创建同一房间时只有一个成功），创建者计为第一个成员
+	// 房间已存在时返回nil
+	CreateRoom(roomID string, broadcast bool) (*RoomInfo, error)
+	// GetRoom 获取房间状态，房间不存在时返回nil
+	GetRoom(roomID string) (*RoomInfo, error)
+	// RemoveRoom 仅当roomID仍指向token对应的房间时移除，并记录移除原因
+	RemoveRoom(roomID, token, reason string) (bool, error)
+	// RemovedReason 最近移除的房间的原因，没有记录（或超过removedRoomRetention）时返回空字符串
+	RemovedReason(roomID string) (string, error)
+	// Join 房间成员数加一，receiver为true时标记已有接收端加入；房间已移除时返回false
+	Join(roomID, token string, receiver bool) (bool, error)
+	// Leave 房间成员数减一，返回剩余成员数；房间已移除时current为false
+	Leave(roomID, token string) (remaining int, current bool, err error)
+	// Publish 向token对应房间的所有订阅者投递消息
+	Publish(token string, env Envelope) error
+	// Subscribe 订阅token对应房间的消息，返回取消订阅的函数
+	Subscribe(token string, deliver func(Envelope)) (unsubscribe func(), err error)
+	// Close 释放注册表的资源（连接等）
+	Close() error
+}
+
+// newRoomToken 生成房间标识（16位十六进制）
+func newRoomToken() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("%016x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b)
+}
+
+// memoryRoom 内存注册表中的房间
+type memoryRoom struct {
+	info    RoomInfo
+	members int
+}
+
+// MemoryRoomStore 内存房间注册表（单实例部署，默认）
+type MemoryRoomStore struct {
+	mu          sync.Mutex
+	rooms       map[string]*memoryRoom
+	removed     map[string]removedRoom // 最近移除的房间及原因
+	subscribers map[string]map[int]func(Envelope)
+	nextSubID   int
+}
+
+// NewMemoryRoomStore 创建内存房间注册表
+func NewMemoryRoomStore() *MemoryRoomStore {
+	return &MemoryRoomStore{
+		rooms:       make(map[string]*memoryRoom),
+		removed:     make(map[string]removedRoom),
+		subscribers: make(map[string]map[int]func(Envelope)),
+	}
+}
+
+// CreateRoom 房间不存在时创建，已存在时返回nil
+func (m *MemoryRoomStore) CreateRoom(roomID string, broadcast bool) (*RoomInfo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.rooms[roomID] != nil {
+		return nil, nil
+	}
+	room := &memoryRoom{
+		info: RoomInfo{
+			ID:        roomID,
+			Token:     newRoomToken(),
+			CreatedAt: time.Now(),
+			Broadcast: broadcast,
+		},
+		members: 1,
+	}
+	m.rooms[roomID] = room
+	delete(m.removed, roomID)
+	info := room.info
+	return &info, nil
+}
+
+// GetRoom 获取房间状态，房间不存在时返回nil
+func (m *MemoryRoomStore) GetRoom(roomID string) (*RoomInfo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	room := m.rooms[roomID]
+	if room == nil {
+		return nil, nil
+	}
+	info := room.info
+	return &info, nil
+}
+
+// current 返回仍指向token的房间（调用方持有mu）
+func (m *MemoryRoomStore) current(roomID, token string) *memoryRoom {
+	room := m.rooms[roomID]
+	if room == nil || room.info.Token != token {
+		return nil
+	}
+	return room
+}
+
+// RemoveRoom 仅当roomID仍指向token对应的房间时移除，同时清理超过保留时间的移除记录
+func (m *MemoryRoomStore) RemoveRoom(roomID, token, reason string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.current(roomID, token) == nil {
+		return false, nil
+	}
+	delete(m.rooms, roomID)
+
+	now := time.Now()
+	for id, removed := range m.removed {
+		if now.Sub(removed.removedAt) > removedRoomRetention {
+			delete(m.removed, id)
+		}
+	}
+	m.removed[roomID] = removedRoom{reason: reason, removedAt: now}
+	return true, nil
+}
+
+// RemovedReason 最近移除的房间的原因
+func (m *MemoryRoomStore) RemovedReason(roomID string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	removed, ok := m.removed[roomID]
+	if !ok || time.Since(removed.removedAt) > removedRoomRetention {
+		return "", nil
+	}
+	return removed.reason, nil
+}
+
+// Join 房间成员数加一
+func (m *MemoryRoomStore) Join(roomID, token string, receiver bool) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	room := m.current(roomID, token)
+	if room == nil {
+		return false, nil
+	}
+	room.members++
+	if receiver {
+		room.info.Joined = true
+	}
+	return true, nil
+}
+
+// Leave 房间成员数减一，返回剩余成员数
+func (m *MemoryRoomStore) Leave(roomID, token string) (int, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	room := m.current(roomID, token)
+	if room == nil {
+		return 0, false, nil
+	}
+	room.members--
+	return room.members, true, nil
+}
+
+// Publish 在调用方的goroutine中依次投递给所有订阅者
+func (m *MemoryRoomStore) Publish(token string, env Envelope) error {
+	m.mu.Lock()
+	delivers := make([]func(Envelope), 0, len(m.subscribers[token]))
+	for _, deliver := range m.subscribers[token] {
+		delivers = append(delivers, deliver)
+	}
+	m.mu.Unlock()
+
+	for _, deliver := range delivers {
+		deliver(env)
+	}
+	return nil
+}
+
+// Subscribe 订阅房间消息
+func (m *MemoryRoomStore) Subscribe(token string, deliver func(Envelope)) (func(), error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.subscribers[token] == nil {
+		m.subscribers[token] = make(map[int]func(Envelope))
+	}
+	id := m.nextSubID
+	m.nextSubID++
+	m.subscribers[token][id] = deliver
+
+	return func() {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		delete(m.subscribers[token], id)
+		if len(m.subscribers[token]) == 0 {
+			delete(m.subscribers, token)
+		}
+	}, nil
+}
+
+// Close 内存注册表没有需要释放的资源
+func (m *MemoryRoomStore) Close() error {
+	return nil
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// sizeUnits 大小单位（与进度显示一致，按1024进制换算）
+var sizeUnits = map[string]float64{
+	"":    1,
+	"b":   1,
+	"k":   1 << 10,
+	"kb":  1 << 10,
+	"kib": 1 << 10,
+	"m":   1 << 20,
+	"mb":  1 << 20,
+	"mib": 1 << 20,
+	"g":   1 << 30,
+	"gb":  1 << 30,
+	"gib": 1 << 30,
+	"t":   1 << 40,
+	"tb":  1 << 40,
+	"tib": 1 << 40,
+}
+
+// parseByteSize 解析带单位的大小，如 500MB、2GB、1.5G、1024（字节）
+// 空字符串和0表示不限制，返回0
+func parseByteSize(s string) (int64, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, nil
+	}
+
+	// 拆分数字和单位
+	i := 0
+	for i < len(s) && (s[i] >= '0' && s[i] <= '9' || s[i] == '.') {
+		i++
+	}
+	numStr := s[:i]
+	unit := strings.ToLower(strings.TrimSpace(s[i:]))
+
+	num, err := strconv.ParseFloat(numStr, 64)
+	if err != nil {
+		return 0, fmt.Errorf("无效的大小: %s", s)
+	}
+	multiplier, ok := sizeUnits[unit]
+	if !ok {
+		return 0, fmt.Errorf("无效的大小单位: %s（可用: B、KB、MB、GB、TB）", s)
+	}
+
+	bytes := num * multiplier
+	if bytes >= math.MaxInt64 {
+		return 0, fmt.Errorf("大小超出范围: %s", s)
+	}
+	return int64(bytes), nil
+}
+
+// formatByteSize 把字节数格式化为便于阅读的大小
+func formatByteSize(n int64) string {
+	units := []string{"B", "KB", "MB", "GB", "TB"}
+	size := float64(n)
+	i := 0
+	for size >= 1024 && i < len(units)-1 {
+		size /= 1024
+		i++
+	}
+	if i == 0 {
+		return fmt.Sprintf("%d B", n)
+	}
+	return fmt.Sprintf("%.2f %s", size, units[i])
+}
+
+// checkMaxSize 检查文件大小是否超过--max-size限制（maxSize<=0表示不限制）
+func checkMaxSize(fileSize, maxSize int64) error {
+	if maxSize <= 0 || fileSize <= maxSize {
+		return nil
+	}
+	return fmt.Errorf("文件大小 %s 超过限制 %s（可使用 --max-size 提高限制，0 表示不限制）",
+		formatByteSize(fileSize), formatByteSize(maxSize))
+}
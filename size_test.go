@@ -0,0 +1,59 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+// TestParseByteSize 各种单位后缀按1024进制换算，空字符串和0表示不限制
+func TestParseByteSize(t *testing.T) {
+	for _, c := range []struct {
+		in   string
+		want int64
+	}{
+		{"", 0},
+		{"0", 0},
+		{"1024", 1024},
+		{"512b", 512},
+		{"10K", 10 << 10},
+		{" 1kib ", 1 << 10},
+		{"500MB", 500 << 20},
+		{"1.5G", 3 << 29},
+		{"2 GiB", 2 << 30},
+		{"3tb", 3 << 40},
+		{"8388607TB", 8388607 << 40},
+	} {
+		got, err := parseByteSize(c.in)
+		if err != nil || got != c.want {
+			t.Errorf("parseByteSize(%q) = %d, %v，期望 %d", c.in, got, err, c.want)
+		}
+	}
+}
+
+// TestParseByteSizeInvalid 无效的数字或单位、超出int64的大小报错
+func TestParseByteSizeInvalid(t *testing.T) {
+	for _, in := range []string{"abc", "-5MB", "1..5G", "10XB", "5 MBs", "8388608TB", "9223372036854775807", "1e30"} {
+		if got, err := parseByteSize(in); err == nil {
+			t.Errorf("parseByteSize(%q) 应报错，实际返回 %d", in, got)
+		}
+	}
+}
+
+// TestCheckMaxSize 恰好等于限制时允许，超过1字节时拒绝，0或负数表示不限制
+func TestCheckMaxSize(t *testing.T) {
+	for _, c := range []struct {
+		fileSize, maxSize int64
+		ok                bool
+	}{
+		{100 << 20, 100 << 20, true},
+		{100<<20 + 1, 100 << 20, false},
+		{0, 1, true},
+		{math.MaxInt64, 0, true},
+		{math.MaxInt64, -1, true},
+		{math.MaxInt64, math.MaxInt64 - 1, false},
+	} {
+		if err := checkMaxSize(c.fileSize, c.maxSize); (err == nil) != c.ok {
+			t.Errorf("checkMaxSize(%d, %d) = %v，期望允许=%v", c.fileSize, c.maxSize, err, c.ok)
+		}
+	}
+}
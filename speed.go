@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	minSpeedGrace    = 10 * time.Second // 开始传输后不检查速度的时间（连接建立后的慢启动）
+	minSpeedWindow   = 20 * time.Second // 计算移动平均速度的时间窗口
+	minSpeedInterval = time.Second      // 采样间隔
+)
+
+// speedSample 速度采样点
+type speedSample struct {
+	at    time.Time
+	total int64
+}
+
+// speedMeter 最低速度检测（--min-speed）：宽限期过后，最近一个窗口内的移动平均速度低于下限时报错
+type speedMeter struct {
+	minSpeed int64 // 最低速度（字节/秒）
+	start    time.Time
+	samples  []speedSample // 最近一个窗口内的采样（第一个采样不晚于窗口起点）
+}
+
+// newSpeedMeter 创建最低速度检测；minSpeed<=0时返回nil（不检测）
+func newSpeedMeter(minSpeed int64) *speedMeter {
+	if minSpeed <= 0 {
+		return nil
+	}
+	return &speedMeter{minSpeed: minSpeed, start: time.Now()}
+}
+
+// Check 根据累计传输字节数更新移动平均速度，持续低于下限时返回错误（nil时不检测）
+func (m *speedMeter) Check(total int64) error {
+	if m == nil {
+		return nil
+	}
+
+	now := time.Now()
+	if now.Sub(m.start) < minSpeedGrace {
+		return nil
+	}
+	if n := len(m.samples); n > 0 && now.Sub(m.samples[n-1].at) < minSpeedInterval {
+		return nil
+	}
+	m.samples = append(m.samples, speedSample{at: now, total: total})
+	for len(m.samples) > 1 && now.Sub(m.samples[1].at) >= minSpeedWindow {
+		m.samples = m.samples[1:]
+	}
+
+	oldest := m.samples[0]
+	span := now.Sub(oldest.at)
+	if span < minSpeedWindow {
+		return nil
+	}
+	average := int64(float64(total-oldest.total) / span.Seconds())
+	if average >= m.minSpeed {
+		return nil
+	}
+	return fmt.Errorf("传输速度过低: 最近 %v 平均速度 %s/s，低于 --min-speed %s/s（局域网内可改用HTTP模式 --http，跨网络时可尝试其他TURN服务器 --turn）",
+		minSpeedWindow, formatByteSize(average), formatByteSize(m.minSpeed))
+}
+
+// parseSpeed 解析速度，如 100KB/s、1MB/s、500KB（/s可省略）；空字符串和0表示不限制，返回0
+func parseSpeed(s string) (int64, error) {
+	s = strings.TrimSpace(s)
+	if lower := strings.ToLower(s); strings.HasSuffix(lower, "/s") {
+		s = s[:len(s)-2]
+	}
+	return parseByteSize(s)
+}
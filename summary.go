@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 结果行模式（--summary-only）：不显示进度等输出，传输结束时在标准输出打印一行结果，便于在脚本中用grep/awk处理：
+//
+//	OK <路径> <字节数> <秒数> <MB/s>
+//	FAIL <原因>
+//
+// 开始时把os.Stdout换成空设备（程序中fmt.Print*的输出全部丢弃），结果行写到原来的标准输出，标准错误不受影响。
+// 校验和不一致等错误同样输出FAIL。路径可能包含空格，解析时从行尾取后三个字段。
+
+// summaryReporter 输出结果行；为nil时（未启用--summary-only）所有方法都不输出
+type summaryReporter struct {
+	mu  sync.Mutex // HTTP模式下多个下载可能同时完成
+	out io.Writer  // 原来的标准输出
+}
+
+// startSummaryOnly 屏蔽标准输出，返回输出结果行的summaryReporter
+func startSummaryOnly() (*summaryReporter, error) {
+	devNull, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	if err != nil {
+		return nil, fmt.Errorf("打开空设备失败: %w", err)
+	}
+	s := &summaryReporter{out: os.Stdout}
+	os.Stdout = devNull
+	return s, nil
+}
+
+// OK 输出传输成功的结果行（本地路径转换为绝对路径，速度按bytes/elapsed计算）
+func (s *summaryReporter) OK(path string, bytes int64, elapsed time.Duration) {
+	if s == nil {
+		return
+	}
+	if !isRemoteURL(path) {
+		if absPath, err := filepath.Abs(path); err == nil {
+			path = absPath
+		}
+	}
+	speed := 0.0
+	if elapsed > 0 {
+		speed = float64(bytes) / elapsed.Seconds() / 1024 / 1024
+	}
+	s.println(fmt.Sprintf("OK %s %d %.2f %.2f", path, bytes, elapsed.Seconds(), speed))
+}
+
+// Fail 输出传输失败的结果行（原因中的换行替换为空格，保证只有一行）
+func (s *summaryReporter) Fail(err error) {
+	if s == nil {
+		return
+	}
+	s.println("FAIL " + strings.Join(strings.Fields(err.Error()), " "))
+}
+
+// println 输出一行结果
+func (s *summaryReporter) println(line string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fmt.Fprintln(s.out, line)
+}
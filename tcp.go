@@ -0,0 +1,228 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// 直接TCP模式（send --tcp）：WebRTC和HTTP都不可用，但对端可以直接连接某个端口时（局域网或手动端口转发）使用
+// 发送端监听端口，把文件发送给第一个连接的接收端，数据格式与DataChannel相同（4字节元数据长度+元数据JSON+文件数据）；
+// 接收端连接 tcp://主机:端口，数据交给handleMessage处理，接收完成或取消时在同一连接上回复控制消息（每行一条JSON）。
+
+const (
+	tcpDialTimeout    = 15 * time.Second
+	tcpReadBufferSize = 256 * 1024
+)
+
+// tcpAddressPrefix 直接TCP模式的接收地址前缀
+const tcpAddressPrefix = "tcp://"
+
+// tcpAddress 判断接收地址是否是直接TCP模式（tcp://主机:端口），返回主机:端口
+func tcpAddress(address string) (string, bool) {
+	if !strings.HasPrefix(strings.ToLower(address), tcpAddressPrefix) {
+		return "", false
+	}
+	return strings.TrimSuffix(address[len(tcpAddressPrefix):], "/"), true
+}
+
+// tcpSender 直接TCP连接的数据发送器（TCP保证顺序和可靠，直接写入）
+type tcpSender struct {
+	conn net.Conn
+}
+
+// Send 发送一个数据块
+func (t tcpSender) Send(data []byte) error {
+	_, err := t.conn.Write(data)
+	return err
+}
+
+// writeTCPControl 在TCP连接上发送一条控制消息
+func writeTCPControl(conn net.Conn, msg ControlMessage) error {
+	data, _ := json.Marshal(msg)
+	conn.SetWriteDeadline(time.Now().Add(5 * time.Second))
+	_, err := conn.Write(append(data, '\n'))
+	conn.SetWriteDeadline(time.Time{})
+	return err
+}
+
+// readTCPControls 读取接收端的控制消息，连接关闭时关闭controls
+func readTCPControls(conn net.Conn, controls chan<- ControlMessage) {
+	defer close(controls)
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		var ctrl ControlMessage
+		if err := json.Unmarshal(scanner.Bytes(), &ctrl); err == nil {
+			controls <- ctrl
+		}
+	}
+}
+
+// startTCP 直接TCP模式发送：监听端口，把文件发送给第一个连接的接收端
+func (s *WebRTCSender) startTCP() error {
+	fileName, fileSize, err := s.sourceInfo()
+	if err != nil {
+		return err
+	}
+
+	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", s.tcpPort))
+	if err != nil {
+		return fmt.Errorf("监听TCP端口失败: %w", err)
+	}
+	defer listener.Close()
+	s.onCancel(func() { listener.Close() })
+	port := listener.Addr().(*net.TCPAddr).Port
+
+	localIPs, err := getLocalIPs()
+	if err != nil {
+		return fmt.Errorf("获取本机IP失败: %w", err)
+	}
+	address := tcpAddressPrefix + net.JoinHostPort(localIPs[0].IP, fmt.Sprint(port))
+
+	fmt.Println("=== 直接TCP文件传输 - 发送端 ===")
+	fmt.Printf("文件: %s\n", fileName)
+	fmt.Printf("大小: %d 字节 (%.2f MB)\n", fileSize, float64(fileSize)/1024/1024)
+	fmt.Println("\n" + strings.Repeat("=", 70))
+	fmt.Printf("接收地址: %s\n", address)
+	printLocalIPNotes(localIPs)
+	fmt.Println(strings.Repeat("-", 70))
+	fmt.Println("复制以下命令到另一台电脑执行:")
+	fmt.Println(strings.Repeat("-", 70))
+	fmt.Printf("ftf.exe receive %s\n", address)
+	fmt.Println(strings.Repeat("=", 70))
+	fmt.Println("\n等待接收端连接（需要对端能直接访问该端口，必要时在防火墙或路由器上放行）...")
+
+	conn, err := listener.Accept()
+	if err != nil {
+		return fmt.Errorf("等待接收端连接失败: %w", err)
+	}
+	listener.Close() // 只发送给第一个连接的接收端
+	defer conn.Close()
+	s.onCancel(func() { conn.Close() })
+	fmt.Printf("接收端已连接: %s\n", conn.RemoteAddr())
+	s.stats.SetPeer(connectionTCP, conn.RemoteAddr().String())
+
+	// 接收端的控制消息（接收完成、取消）
+	controls := make(chan ControlMessage, 1)
+	go readTCPControls(conn, controls)
+
+	fileSent := make(chan struct{})
+	go func() {
+		if err := s.sendFiles(tcpSender{conn: conn}, fileName, fileSize); err != nil {
+			s.sendFailed <- err
+			return
+		}
+		close(fileSent)
+	}()
+
+	// 以交给TCP连接的字节数衡量进度（接收端停止读取时写入阻塞，不再增长）
+	stalled := make(chan struct{}, 1)
+	stopWatch := make(chan struct{})
+	defer close(stopWatch)
+	go watchStall(pausedWhile(func() int64 {
+		return atomic.LoadInt64(&s.totalSent)
+	}, s.isAwaitingConfirm), s.stallTimeout, nil, stalled, stopWatch)
+
+	for {
+		select {
+		case ctrl, ok := <-controls:
+			if !ok {
+				return fmt.Errorf("接收端在确认接收完成前断开连接（已发送 %d / %d 字节）", atomic.LoadInt64(&s.totalSent), fileSize)
+			}
+			deliverHandshakeReply(s.handshakeReplies, ctrl)
+			switch ctrl.Type {
+			case "file_received":
+				fmt.Println("\n接收端已确认接收完成")
+				return nil
+			case "cancel":
+				return fmt.Errorf("接收端已取消传输: %s", ctrl.Reason)
+			}
+		case err := <-s.sendFailed:
+			return err
+		case <-stalled:
+			return fmt.Errorf("传输停滞: %v 内没有数据进展", s.stallTimeout)
+		case <-s.cancelDone():
+			return errTransferCanceled
+		case <-fileSent:
+			fileSent = nil
+			fmt.Println("文件已发送完成，等待接收端确认...")
+		}
+	}
+}
+
+// receiveTCP 直接TCP模式接收：连接发送端，按DataChannel相同的格式交给handleMessage处理
+func (r *WebRTCReceiver) receiveTCP() error {
+	fmt.Println("=== 直接TCP文件传输 - 接收端 ===")
+	fmt.Printf("连接发送端: %s\n", r.tcpAddr)
+	conn, err := net.DialTimeout("tcp", r.tcpAddr, tcpDialTimeout)
+	if err != nil {
+		return fmt.Errorf("连接发送端失败: %w", err)
+	}
+	defer conn.Close()
+	r.tcpConn = conn
+	r.stats.SetPeer(connectionTCP, conn.RemoteAddr().String())
+	r.onCancel(func() { conn.Close() })
+	r.onCancel(func() { r.sendCancel("接收已取消") })
+	fmt.Println("已连接，等待元数据...")
+
+	r.state = 0
+	r.startTime = time.Now()
+	r.speedGraph = newSpeedGraph(r.graph)
+	r.speedMeter = newSpeedMeter(r.minSpeed)
+
+	// 元数据长度和元数据完整读取后一起交给handleMessage（TCP读取不保留发送端的消息边界）
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return fmt.Errorf("读取元数据失败: %w", err)
+	}
+	metadataLen := binary.BigEndian.Uint32(header)
+	if metadataLen == 0 || metadataLen > maxMetadataLen {
+		return fmt.Errorf("无效的元数据长度 %d（对端可能不是 send --tcp 的发送端）", metadataLen)
+	}
+	frame := make([]byte, 4+metadataLen)
+	copy(frame, header)
+	if _, err := io.ReadFull(conn, frame[4:]); err != nil {
+		return fmt.Errorf("读取元数据失败: %w", err)
+	}
+
+	buffer := make([]byte, tcpReadBufferSize)
+	data := frame
+	for {
+		if len(data) > 0 {
+			if err := r.handleMessage(data); err != nil {
+				r.abort(err)
+				return err
+			}
+		}
+
+		// 接收完成或中止（超过大小限制、拒绝接收、速度过低）
+		select {
+		case err := <-r.done:
+			if err == nil {
+				if ackErr := writeTCPControl(conn, ControlMessage{Type: "file_received"}); ackErr != nil {
+					fmt.Printf("发送确认消息失败: %v\n", ackErr)
+				}
+			}
+			return err
+		default:
+		}
+
+		if r.stallTimeout > 0 {
+			conn.SetReadDeadline(time.Now().Add(r.stallTimeout))
+		}
+		n, err := conn.Read(buffer)
+		data = buffer[:n]
+		if err != nil && n == 0 {
+			if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+				return fmt.Errorf("传输停滞: %v 内没有数据进展", r.stallTimeout)
+			}
+			return fmt.Errorf("连接在接收完成前关闭（已接收 %d 字节）: %w", atomic.LoadInt64(&r.totalReceived), err)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// 只校验不传输（send --verify-only）：核对两台电脑上已有的两份文件是否相同（如确认之前的传输成功）。
+// 建立WebRTC连接后发送端不发送元数据长度前缀和文件数据，而是发送一条verify_request控制消息，
+// 附带文件名、大小和校验和（FileMetadata）；接收端按保存路径规则（见save_path.go，不使用--organize和--output-template）
+// 找到本地的同名文件，比较大小并按同一算法计算校验和，回复verify_result（match/differ/missing），两端都显示MATCH或DIFFER。
+// 接收端不需要额外参数，也不会创建或修改文件；旧版接收端把该消息当作无效的元数据长度拒绝，同样不会写入文件。
+
+// verify_result的比对结果
+const (
+	verifyMatch   = "match"   // 大小和校验和一致
+	verifyDiffer  = "differ"  // 大小或校验和不一致
+	verifyMissing = "missing" // 接收端没有该文件（或无法读取）
+)
+
+// verifyReplyTimeout 发送端等待校验结果的时间（接收端计算大文件的校验和需要一段时间）
+const verifyReplyTimeout = 30 * time.Minute
+
+// isVerifyRequest 是否是verify_request消息（元数据长度前缀的第一个字节不会是'{'，长度会超过maxMetadataLen）
+func isVerifyRequest(data []byte) bool {
+	return len(data) > 0 && data[0] == '{'
+}
+
+// sendVerifyRequest 发送校验请求并等待接收端的比对结果，不一致或接收端没有该文件时返回错误
+func (s *WebRTCSender) sendVerifyRequest(sender chunkSender, fileName string, fileSize int64) error {
+	if s.checksum == nil {
+		return fmt.Errorf("--verify-only 需要本地文件（远程文件无法预先计算校验和）")
+	}
+	fmt.Printf("正在计算%s...\n", checksumName(s.checksum.algo))
+	sum, err := s.checksum.Get()
+	if err != nil {
+		return fmt.Errorf("计算校验和失败: %w", err)
+	}
+	metadata := FileMetadata{FileName: fileName, FileSize: fileSize, Checksum: sum, ChecksumAlgo: s.checksum.algo}
+	s.stats.SetChecksum(sum, s.checksum.algo)
+
+	// 接收端计算校验和期间没有数据进展，不检测无进度超时
+	atomic.StoreInt32(&s.awaitingConfirm, 1)
+	defer atomic.StoreInt32(&s.awaitingConfirm, 0)
+	request, _ := json.Marshal(ControlMessage{Type: "verify_request", Metadata: &metadata})
+	if err := sender.Send(request); err != nil {
+		return fmt.Errorf("发送校验请求失败: %w", err)
+	}
+	fmt.Println("已发送校验请求（不传输文件数据），等待接收端比对本地文件...")
+
+	select {
+	case reply := <-s.verifyResults:
+		if reply.Result == verifyMatch {
+			fmt.Printf("\n校验结果: MATCH（接收端的 %s 与本地文件的大小和%s一致）\n", reply.Name, checksumName(metadata.ChecksumAlgo))
+			return nil
+		}
+		fmt.Printf("\n校验结果: DIFFER（%s）\n", reply.Reason)
+		return fmt.Errorf("校验结果: DIFFER（%s）", reply.Reason)
+	case <-s.cancelDone():
+		return errTransferCanceled
+	case <-time.After(verifyReplyTimeout):
+		return fmt.Errorf("等待接收端的校验结果超时（%v）", verifyReplyTimeout)
+	}
+}
+
+// handleVerifyRequest 接收端处理verify_request：比对本地文件并回复结果，一致时Start返回nil，否则返回错误
+func (r *WebRTCReceiver) handleVerifyRequest(data []byte) error {
+	var request ControlMessage
+	if err := json.Unmarshal(data, &request); err != nil || request.Type != "verify_request" || request.Metadata == nil {
+		return fmt.Errorf("无效的元数据（数据损坏或对端不是本程序的发送端）")
+	}
+	metadata := request.Metadata
+	r.state = 3
+	fmt.Printf("发送端请求校验（不传输文件数据）: %s（%d 字节）\n", metadata.FileName, metadata.FileSize)
+
+	// 计算校验和期间没有数据进展，不检测无进度超时
+	atomic.StoreInt32(&r.confirming, 1)
+	result, localPath, reason := r.compareLocalFile(metadata)
+	atomic.StoreInt32(&r.confirming, 0)
+
+	r.sendControl(ControlMessage{Type: "verify_result", Result: result, Name: localPath, Reason: reason})
+	// Start返回后会关闭连接，等待结果发出
+	time.Sleep(500 * time.Millisecond)
+
+	if result != verifyMatch {
+		fmt.Printf("校验结果: DIFFER（%s）\n", reason)
+		r.finish(fmt.Errorf("校验结果: DIFFER（%s）", reason))
+		return nil
+	}
+	fmt.Printf("校验结果: MATCH（%s 与发送端文件的大小和%s一致）\n", localPath, checksumName(metadata.ChecksumAlgo))
+	r.savePath = localPath
+	atomic.StoreInt32(&r.finished, 1)
+	r.finish(nil)
+	return nil
+}
+
+// compareLocalFile 按保存路径规则找到本地文件，比较大小和校验和，返回比对结果、本地路径和不一致的原因
+func (r *WebRTCReceiver) compareLocalFile(metadata *FileMetadata) (result, localPath, reason string) {
+	if r.output != nil {
+		return verifyMissing, "", "接收端写入内存，没有可比对的本地文件"
+	}
+	if metadata.Checksum == "" {
+		return verifyDiffer, "", "发送端没有提供校验和"
+	}
+	localPath, _, err := resolveSavePath(r.savePath, metadata.FileName)
+	if err != nil {
+		return verifyMissing, "", err.Error()
+	}
+	info, err := os.Stat(localPath)
+	if err != nil || !info.Mode().IsRegular() {
+		return verifyMissing, localPath, fmt.Sprintf("接收端没有文件 %s", localPath)
+	}
+	if info.Size() != metadata.FileSize {
+		return verifyDiffer, localPath, fmt.Sprintf("%s 大小不一致: 接收端 %d 字节，发送端 %d 字节", localPath, info.Size(), metadata.FileSize)
+	}
+
+	name := checksumName(metadata.ChecksumAlgo)
+	fmt.Printf("正在计算本地文件的%s...\n", name)
+	sum, err := fileChecksum(localPath, metadata.ChecksumAlgo)
+	if err != nil {
+		return verifyDiffer, localPath, fmt.Sprintf("计算 %s 的校验和失败: %v", localPath, err)
+	}
+	if !strings.EqualFold(sum, metadata.Checksum) {
+		return verifyDiffer, localPath, fmt.Sprintf("%s 的%s不一致: 接收端 %s，发送端 %s", localPath, name, sum, metadata.Checksum)
+	}
+	r.stats.SetChecksum(sum, metadata.ChecksumAlgo)
+	return verifyMatch, localPath, ""
+}
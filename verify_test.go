@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestVerifyOnly 只校验不传输（--verify-only）：接收端已有相同的文件时两端都报告MATCH，
+// 内容不同或没有该文件时两端都报告DIFFER，接收端的文件不被修改
+func TestVerifyOnly(t *testing.T) {
+	const timeout = 30 * time.Second
+	signalingURL := startTestSignaling(t)
+	srcPath := filepath.Join(t.TempDir(), "audit.bin")
+	if err := writeRandomFile(srcPath, 64*1024); err != nil {
+		t.Fatal(err)
+	}
+	content, err := os.ReadFile(srcPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recvDir := t.TempDir()
+	localPath := filepath.Join(recvDir, "audit.bin")
+
+	rooms := 0
+	verify := func() (sendErr, recvErr error) {
+		t.Helper()
+		rooms++
+		roomID := fmt.Sprintf("verify-%d", rooms)
+		sender := NewWebRTCSender(srcPath, iceServerNone, iceServerNone, signalingURL, roomID)
+		sender.embedded = true
+		sender.verifyOnly = true
+		receiver := NewWebRTCReceiver(roomID, "", recvDir, iceServerNone, iceServerNone, signalingURL, roomID, false)
+		receiver.rejoinUntil = time.Now().Add(timeout)
+		sendDone := make(chan error, 1)
+		recvDone := make(chan error, 1)
+		go func() {
+			_, err := sender.Start(context.Background())
+			sendDone <- err
+		}()
+		go func() {
+			_, err := receiver.Start(context.Background())
+			recvDone <- err
+		}()
+		deadline := time.After(timeout)
+		for i := 0; i < 2; i++ {
+			select {
+			case sendErr = <-sendDone:
+			case recvErr = <-recvDone:
+			case <-deadline:
+				sender.Cancel()
+				receiver.Cancel()
+				<-sendDone
+				<-recvDone
+				t.Fatalf("校验超时（%v）", timeout)
+			}
+		}
+		return sendErr, recvErr
+	}
+
+	t.Run("match", func(t *testing.T) {
+		if err := os.WriteFile(localPath, content, 0644); err != nil {
+			t.Fatal(err)
+		}
+		if sendErr, recvErr := verify(); sendErr != nil || recvErr != nil {
+			t.Fatalf("相同的文件没有报告MATCH（发送端: %v，接收端: %v）", sendErr, recvErr)
+		}
+	})
+
+	t.Run("differ", func(t *testing.T) {
+		changed := append([]byte(nil), content...)
+		changed[len(changed)/2] ^= 0xff
+		if err := os.WriteFile(localPath, changed, 0644); err != nil {
+			t.Fatal(err)
+		}
+		sendErr, recvErr := verify()
+		if sendErr == nil || recvErr == nil || !strings.Contains(sendErr.Error(), "DIFFER") || !strings.Contains(recvErr.Error(), "DIFFER") {
+			t.Fatalf("内容不同的文件没有报告DIFFER（发送端: %v，接收端: %v）", sendErr, recvErr)
+		}
+		if data, err := os.ReadFile(localPath); err != nil || !bytes.Equal(data, changed) {
+			t.Fatal("校验时接收端的文件被修改")
+		}
+	})
+
+	t.Run("missing", func(t *testing.T) {
+		os.Remove(localPath)
+		if sendErr, recvErr := verify(); sendErr == nil || recvErr == nil {
+			t.Fatalf("接收端没有该文件时没有报告DIFFER（发送端: %v，接收端: %v）", sendErr, recvErr)
+		}
+		if _, err := os.Stat(localPath); !os.IsNotExist(err) {
+			t.Fatal("校验时接收端创建了文件")
+		}
+	})
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"time"
+)
+
+// defaultStallTimeout 默认无进度超时时间
+const defaultStallTimeout = 60 * time.Second
+
+// pausedWhile 包装progress：paused返回true期间视为一直有进展（如等待用户确认接收），不触发无进度超时
+// 返回的函数只能在一个goroutine中调用（watchStall）
+func pausedWhile(progress func() int64, paused func() bool) func() int64 {
+	var ticks int64
+	return func() int64 {
+		if paused() {
+			ticks++
+		}
+		return progress() + ticks
+	}
+}
+
+// watchStall 无进度看门狗：progress返回的字节数在timeout内没有增长时向stalled发送信号
+// timeout<=0表示不启用；stop关闭或isFinished返回true时退出（isFinished可为nil）
+func watchStall(progress func() int64, timeout time.Duration, isFinished func() bool, stalled chan<- struct{}, stop <-chan struct{}) {
+	if timeout <= 0 {
+		return
+	}
+
+	interval := time.Second
+	if timeout < interval {
+		interval = timeout
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	last := progress()
+	lastProgress := time.Now()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			if isFinished != nil && isFinished() {
+				return
+			}
+			current := progress()
+			if current != last {
+				last = current
+				lastProgress = time.Now()
+				continue
+			}
+			if time.Since(lastProgress) >= timeout {
+				select {
+				case stalled <- struct{}{}:
+				default:
+				}
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/pion/webrtc/v3"
+)
+
+// newPeerConnection 创建仅用于DataChannel传输的PeerConnection（发送端和接收端共用）
+//
+// 与webrtc.NewPeerConnection不同，这里显式构造pion API：
+//   - MediaEngine为空，不注册任何音视频编解码器，也不启用RTP/RTCP拦截器
+//   - SettingEngine使用默认值，集中在此处调整以保证两端配置一致
+//
+// 因此SDP中只包含application（DataChannel）媒体段，也不会因为编解码器配置问题
+// 导致CreateDataChannel/CreateOffer失败。
+func newPeerConnection(iceServers []webrtc.ICEServer) (*webrtc.PeerConnection, error) {
+	mediaEngine := &webrtc.MediaEngine{}
+	settingEngine := webrtc.SettingEngine{}
+
+	api := webrtc.NewAPI(
+		webrtc.WithMediaEngine(mediaEngine),
+		webrtc.WithSettingEngine(settingEngine),
+	)
+
+	pc, err := api.NewPeerConnection(webrtc.Configuration{
+		ICEServers: iceServers,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("创建PeerConnection失败（仅DataChannel配置）: %w", err)
+	}
+	return pc, nil
+}
@@ -1,13 +1,20 @@
 package main
 
 import (
+	"context"
 	"encoding/base64"
 	"encoding/binary"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"hash"
+	"io"
+	"net"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/pion/webrtc/v3"
@@ -24,14 +31,58 @@ type WebRTCReceiver struct {
 	roomID       string
 	pc           *webrtc.PeerConnection
 	dc           *webrtc.DataChannel
-	file         *os.File
+	file         io.WriteCloser // 接收的数据写入的文件（或调用方提供的output）
+	fileMu       sync.Mutex     // 保护file的写入和关闭（出错或取消时在其他goroutine中关闭）
+	writeBufferSize int         // 写文件缓冲区大小（0表示不缓冲，见bufferedFile）
+	preallocate  bool           // 收到元数据后预先分配磁盘空间（--preallocate，见preallocate.go）
+	output       io.Writer      // 不为nil时数据写入output而不是创建文件（如在内存中接收小文件）
 	metadata     *FileMetadata
-	state        int // 0: 等待元数据长度, 1: 等待元数据, 2: 接收文件数据
+	state        int // 0: 等待元数据长度, 1: 等待元数据, 2: 接收文件数据, 3: 已结束（完成或中止）
 	metadataLen  uint32
+	lengthBuf    []byte // 元数据长度前缀（4字节）被分到多条消息时已收到的部分
 	metadataBuf  []byte
 	totalReceived int64
+	fileOffset   int64  // 接收多个文件时当前文件之前已接收的字节数（totalReceived为所有文件的累计值，见multi_send.go）
+	wireReceived int64  // 收到的文件数据在网络上的字节数（压缩、加密后的，见compress.go；totalReceived为解压、解密后的）
+	saveDir      string // 接收多个文件时的保存位置（收到第一个文件的元数据时确定，每个文件按它确定保存路径）
 	startTime    time.Time
+	elapsed      time.Duration // 接收完成时为从开始接收到完成的耗时（--summary-only）
 	debug        bool
+	stallTimeout time.Duration // 无进度超时时间（0表示不检测）
+	finished     int32         // 接收完成标志（原子访问）
+	closeOK      chan struct{} // 接收完成后发送端回复close_ok或关闭了DataChannel（见close_ack.go）
+	confirm      bool          // 接收前交互确认（接受/重命名/拒绝）
+	done         chan error    // 接收结束（nil表示成功，否则为失败/中止原因）
+	organize     string        // 按日期/对端整理到子目录（见organize.go）
+	outputTemplate string      // 接收文件的命名模板（--output-template，见output_template.go）
+	appendMode   bool          // 追加到已有文件之后而不是覆盖（--append，见append.go）
+	appendBase   int64         // 追加前文件已有的字节数
+	resume       bool          // 接收目录时解压到已有的同名目录并跳过已完成的文件（--resume，见dir_archive.go）
+	graph        bool          // 在进度后显示速度曲线（仅终端输出时）
+	speedGraph   *speedGraph
+	minSpeed     int64       // 最低速度（字节/秒，--min-speed，0表示不检测，见speed.go）
+	relayBudget  int64       // 经TURN中继时本次连接最多接收的字节数（--relay-budget，0表示不限制，见relay_budget.go）
+	statsInterval time.Duration // 连接统计的采样间隔（--stats-interval，0表示不采样，见conn_stats.go）
+	budget       *relayBudget
+	deferSync    bool        // 接收到.ft-incoming子目录，完成后再移动到保存位置（--defer-sync，见defer_sync.go）
+	writePath    string      // 正在写入的文件路径（--defer-sync时与savePath不同）
+	speedMeter   *speedMeter
+	maxSize      int64 // 允许接收的最大文件大小（0表示不限制）
+	noVerify     bool      // 不校验发送端在元数据中提供的校验和
+	confirming   int32     // 正在等待用户确认接收（--confirm，原子访问，期间不检测无进度超时）
+	checksum     hash.Hash // 按元数据中的算法计算已接收数据的校验和（发送端未提供或--no-verify时为nil）
+	gunzip       *gunzipTarget // 发送端压缩了文件数据时解压后写入文件（同时是file，见compress.go）
+	password     string        // 解密文件数据的密码（--password，见encrypt.go）
+	decrypt      *recordOpener // 发送端加密了文件数据时按记录解密
+	lastAckOffset int64     // 最近一次确认的字节偏移（--reliable-ack）
+	lastAckTime   time.Time // 最近一次确认的时间
+	seq           *seqReceiver // 发送端使用无序或不可靠DataChannel时的分段格式重组（见seq.go）
+	resumeWait    time.Duration // 连接中断后等待发送端重启并续传的最长时间（--wait，0表示不等待，见resume.go）
+	rejoinUntil   time.Time     // 等待续传时，在此之前房间不存在也继续重试加入
+	tcpAddr       string        // 直接TCP模式：连接该地址（主机:端口）接收，不使用信令和ICE（见tcp.go）
+	tcpConn       net.Conn      // 直接TCP模式的连接（用于回复控制消息）
+	stats         transferStats // 连接类型、对端地址、峰值速度和校验通过的校验和（Start返回的TransferResult，见result.go）
+	*canceler               // Cancel: 通知发送端并关闭连接，Start返回errTransferCanceled
 }
 
 // NewWebRTCReceiver 创建WebRTC接收端
@@ -45,43 +96,167 @@ func NewWebRTCReceiver(fileID, sdpOffer, savePath, stunServer, turnServer, signa
 		signalingURL: signalingURL,
 		roomID:       roomID,
 		debug:        debug,
+		stallTimeout: defaultStallTimeout,
+		writeBufferSize: defaultWriteBufferSize,
+		done:         make(chan error, 1),
+		closeOK:      make(chan struct{}, 1),
+		canceler:     newCanceler(),
 	}
 }
 
-// Start 开始接收文件
-func (r *WebRTCReceiver) Start() error {
+// Start 开始接收文件，返回传输结果（失败时为失败前的情况，见result.go）；可以在其他goroutine中调用Cancel取消
+// ctx取消时（如收到Ctrl+C）调用Cancel中止接收（关闭连接，按Cancel的规则处理未完成的文件）
+func (r *WebRTCReceiver) Start(ctx context.Context) (*TransferResult, error) {
+	defer context.AfterFunc(ctx, r.Cancel)()
+	err := r.run()
+	return r.result(), err
+}
+
+// run 检查取消状态后接收，取消导致的错误转换为errTransferCanceled
+func (r *WebRTCReceiver) run() error {
+	if r.isCanceled() {
+		return errTransferCanceled
+	}
+	return r.canceledOr(r.start())
+}
+
+// result 本次接收的结果（接收完成后才有保存路径，写入output时为空）
+func (r *WebRTCReceiver) result() *TransferResult {
+	elapsed := r.elapsed
+	if elapsed == 0 && !r.startTime.IsZero() {
+		elapsed = time.Since(r.startTime)
+	}
+	result := r.stats.result(atomic.LoadInt64(&r.totalReceived), elapsed)
+	if atomic.LoadInt32(&r.finished) == 1 && r.output == nil {
+		result.Path = r.savePath
+	}
+	return result
+}
+
+// start 接收流程，取消导致的错误由run统一转换为errTransferCanceled
+func (r *WebRTCReceiver) start() error {
+	// 先检查保存位置是否可写，避免建立连接（以及占用TURN中继）后才失败
+	if r.output == nil {
+		if err := checkSaveDirWritable(r.savePath); err != nil {
+			return err
+		}
+	}
+	// 出错时也关闭文件，让已收到的数据写入磁盘（在连接关闭之后执行）；取消时删除未完成的文件
+	defer r.closeOrDiscard()
+
+	if r.tcpAddr != "" {
+		return r.receiveTCP()
+	}
 	fmt.Println("=== WebRTC P2P 文件传输 - 接收端 ===")
 	fmt.Printf("文件编号: %s\n", r.fileID)
 
+	for {
+		err := r.connect()
+		if !r.shouldWaitResume(err) {
+			return err
+		}
+		r.rejoinUntil = time.Now().Add(r.resumeWait)
+		fmt.Printf("\n%v\n等待发送端重新连接以续传（最长 %v，按 Ctrl+C 放弃）...\n", err, r.resumeWait)
+	}
+}
+
+// connect 建立一次连接并接收，直到完成、出错或连接中断
+func (r *WebRTCReceiver) connect() error {
 	// 配置ICE服务器
 	iceServers := getDefaultICEServers(r.stunServer, r.turnServer, r.debug)
 
-	// 创建PeerConnection配置
-	config := webrtc.Configuration{
-		ICEServers: iceServers,
-	}
-
-	// 创建PeerConnection
-	pc, err := webrtc.NewPeerConnection(config)
+	// 创建PeerConnection（仅DataChannel配置）
+	pc, err := newPeerConnection(iceServers)
 	if err != nil {
-		return fmt.Errorf("创建PeerConnection失败: %w", err)
+		return err
 	}
 	r.pc = pc
 	defer pc.Close()
+	// 本次连接结束后，旧连接关闭时的回调不再影响后续的续传连接
+	var ended int32
+	defer atomic.StoreInt32(&ended, 1)
+	// 清理函数按相反顺序执行：先通知发送端取消，再关闭连接
+	r.onCancel(func() { go pc.Close() }) // ICE收集未结束时Close会阻塞，放到后台执行
+	r.onCancel(func() { r.sendCancel("接收已取消") })
+	connStats := startConnStats(pc, r.statsInterval)
+	defer connStats.Stop()
+
+	// 无进度看门狗（DataChannel建立后开始计时）
+	stalled := make(chan struct{}, 1)
+	stopWatch := make(chan struct{})
+	defer close(stopWatch)
 
 	// 设置DataChannel接收事件
 	pc.OnDataChannel(func(dc *webrtc.DataChannel) {
 		r.dc = dc
 		r.state = 0
-		r.startTime = time.Now()
+		r.lengthBuf = nil
+		if r.startTime.IsZero() {
+			r.startTime = time.Now() // 续传时保留首次连接的开始时间
+			r.speedGraph = newSpeedGraph(r.graph)
+		}
+		// 续传时重新开始检测速度（不计入等待发送端重启的时间）
+		r.speedMeter = newSpeedMeter(r.minSpeed)
+		// 每次连接重新检查连接类型，只统计本次连接接收的数据
+		r.budget = newRelayBudget(r.relayBudget, r.pc, atomic.LoadInt64(&r.totalReceived))
+		r.stats.SetPeer(webrtcConnection(r.pc))
+
+		go watchStall(pausedWhile(func() int64 {
+			return atomic.LoadInt64(&r.totalReceived)
+		}, func() bool {
+			return atomic.LoadInt32(&r.confirming) == 1
+		}), r.stallTimeout, func() bool {
+			return atomic.LoadInt32(&r.finished) == 1
+		}, stalled, stopWatch)
 		
 		dc.OnOpen(func() {
 			fmt.Println("DataChannel已打开，准备接收文件...")
 		})
 
+		// 发送端使用无序或不可靠模式时，按分段格式重组数据并定期报告接收位置
+		if dcSequenced(dc) {
+			r.seq = newSeqReceiver()
+			if r.debug {
+				fmt.Println("DataChannel为无序或不可靠模式，使用分段格式接收")
+			}
+			go func() {
+				ticker := time.NewTicker(seqAckInterval)
+				defer ticker.Stop()
+				for {
+					select {
+					case <-ticker.C:
+						if atomic.LoadInt32(&r.finished) == 1 {
+							return
+						}
+						sendSeqAck(dc, r.seq)
+					case <-stopWatch:
+						return
+					}
+				}
+			}()
+		}
+
 		dc.OnMessage(func(msg webrtc.DataChannelMessage) {
-			if err := r.handleMessage(msg.Data); err != nil {
-				fmt.Printf("处理消息失败: %v\n", err)
+			// 接收完成后只处理发送端对接收完成确认的回复
+			if atomic.LoadInt32(&r.finished) == 1 {
+				if isCloseOK(msg.Data) {
+					r.signalCloseOK()
+				}
+				return
+			}
+			if err := r.receiveMessage(msg.Data); err != nil {
+				// 写文件失败等错误无法继续接收，通知发送端并结束
+				r.abort(err)
+			}
+		})
+
+		dc.OnClose(func() {
+			if atomic.LoadInt32(&r.finished) == 1 {
+				r.signalCloseOK()
+				return
+			}
+			if atomic.LoadInt32(&ended) == 0 {
+				r.finish(connectionLostError{fmt.Errorf("连接在接收完成前关闭（已接收 %d 字节）", atomic.LoadInt64(&r.totalReceived))})
 			}
 		})
 	})
@@ -96,10 +271,15 @@ func (r *WebRTCReceiver) Start() error {
 			if r.debug {
 				fmt.Println("P2P连接已建立!")
 			}
+			connStats.Connected()
 		case webrtc.ICEConnectionStateFailed, webrtc.ICEConnectionStateDisconnected, webrtc.ICEConnectionStateClosed:
 			if r.debug {
 				fmt.Printf("ICE连接失败: %s\n", state.String())
 			}
+			// 连接彻底失败（对端退出或网络中断）时不必等到超时
+			if state == webrtc.ICEConnectionStateFailed && atomic.LoadInt32(&r.finished) == 0 && atomic.LoadInt32(&ended) == 0 {
+				r.finish(connectionLostError{fmt.Errorf("ICE连接失败，传输中断（已接收 %d 字节）", atomic.LoadInt64(&r.totalReceived))})
+			}
 		}
 	})
 
@@ -134,6 +314,7 @@ func (r *WebRTCReceiver) Start() error {
 	}
 
 	// 处理Offer和Answer交换
+	notifyComplete := func() {} // 接收成功后通知信令服务器移除房间
 	if signalingURL != "" {
 		// 使用信令服务器
 		if r.debug {
@@ -144,6 +325,7 @@ func (r *WebRTCReceiver) Start() error {
 			return fmt.Errorf("连接信令服务器失败: %w", err)
 		}
 		defer signalingClient.Close()
+		r.onCancel(signalingClient.Close)
 
 		// 加入房间
 		roomID := r.roomID
@@ -152,19 +334,10 @@ func (r *WebRTCReceiver) Start() error {
 		}
 
 		fmt.Printf("加入房间: %s\n", roomID)
-		signalingClient.Send(&Message{
-			Type: "join_room",
-			RoomID: roomID,
-		})
-
-		// 等待加入确认
-		msg, err := signalingClient.Receive(5 * time.Second)
+		notifyComplete = func() { signalingClient.CompleteTransfer(roomID) }
+		msg, err := r.joinRoom(signalingClient, roomID)
 		if err != nil {
-			return fmt.Errorf("等待加入房间失败: %w", err)
-		}
-
-		if msg.Type == "error" {
-			return fmt.Errorf("加入房间失败: %s", msg.Error)
+			return err
 		}
 
 		if msg.Type != "room_joined" {
@@ -173,10 +346,21 @@ func (r *WebRTCReceiver) Start() error {
 
 		fmt.Println("已加入房间，等待Offer...")
 
-		// 等待Offer
+		// 等待Offer：加入后offerRequestInterval内没有收到Offer时请求发送端重新发送
 		var offerSDP string
+		offerDeadline := time.Now().Add(5 * time.Minute)
 		for {
-			msg, err := signalingClient.Receive(5 * time.Minute)
+			msg, err := signalingClient.Receive(offerRequestInterval)
+			if err == errReceiveTimeout && time.Now().Before(offerDeadline) {
+				if r.debug {
+					fmt.Printf("%v 内没有收到Offer，请求发送端重新发送\n", offerRequestInterval)
+				}
+				signalingClient.Send(&Message{
+					Type: "request_offer",
+					RoomID: roomID,
+				})
+				continue
+			}
 			if err != nil {
 				return fmt.Errorf("接收Offer失败: %w", err)
 			}
@@ -188,19 +372,31 @@ func (r *WebRTCReceiver) Start() error {
 					fmt.Printf("文件编号: %s\n", r.fileID)
 				}
 				break
+			} else if msg.Type == "data" {
+				// 发送端使用信令服务器中转，不建立P2P连接
+				if err := r.receiveRelay(signalingClient, roomID, msg); err != nil {
+					return err
+				}
+				notifyComplete()
+				return nil
+			} else if msg.Type == "peer_left" {
+				// 发送端已退出，不会再发送Offer；--wait续传时可以继续等待发送端重启
+				return connectionLostError{fmt.Errorf("发送端在发送Offer之前离开了房间，请确认发送端仍在运行，重新发送后再接收")}
 			} else if msg.Type == "error" {
+				if isUnknownRequestOffer(msg) {
+					continue // 旧版信令服务器不支持request_offer，继续等待发送端的Offer
+				}
 				return fmt.Errorf("信令服务器错误: %s", msg.Error)
+			} else if msg.Type == "server_shutdown" {
+				return fmt.Errorf("信令服务器已关闭")
+			} else if r.debug {
+				fmt.Printf("等待Offer时忽略信令消息: %s\n", msg.Type)
 			}
 		}
 
 		// 解码Offer
-		offerJSON, err := base64.StdEncoding.DecodeString(offerSDP)
+		offer, err := decodeSessionDescription(offerSDP, webrtc.SDPTypeOffer)
 		if err != nil {
-			return fmt.Errorf("解码Offer失败: %w", err)
-		}
-
-		var offer webrtc.SessionDescription
-		if err = json.Unmarshal(offerJSON, &offer); err != nil {
 			return fmt.Errorf("解析Offer失败: %w", err)
 		}
 
@@ -241,6 +437,8 @@ func (r *WebRTCReceiver) Start() error {
 			if r.debug {
 				fmt.Println("ICE候选者已收集完成")
 			}
+		case <-r.cancelDone():
+			return errTransferCanceled
 		case <-time.After(10 * time.Second):
 			if r.debug {
 				fmt.Println("警告: ICE候选者收集超时，继续使用当前SDP")
@@ -277,6 +475,11 @@ func (r *WebRTCReceiver) Start() error {
 		if r.debug {
 			fmt.Println("Answer已发送，等待连接建立...")
 		}
+
+		// 等待续传时，发送端进程退出（信令服务器通知peer_left）立即视为连接中断，不必等到ICE超时
+		if r.resumeWait > 0 {
+			go r.watchPeerLeft(signalingClient, &ended)
+		}
 	} else {
 		// 无信令服务器，使用手动输入方式
 		if r.sdpOffer == "" {
@@ -284,13 +487,8 @@ func (r *WebRTCReceiver) Start() error {
 		}
 
 		// 解码Offer
-		offerJSON, err := base64.StdEncoding.DecodeString(r.sdpOffer)
+		offer, err := decodeSessionDescription(r.sdpOffer, webrtc.SDPTypeOffer)
 		if err != nil {
-			return fmt.Errorf("解码Offer失败: %w", err)
-		}
-
-		var offer webrtc.SessionDescription
-		if err = json.Unmarshal(offerJSON, &offer); err != nil {
 			return fmt.Errorf("解析Offer失败: %w", err)
 		}
 
@@ -331,6 +529,8 @@ func (r *WebRTCReceiver) Start() error {
 			if r.debug {
 				fmt.Println("ICE候选者已收集完成")
 			}
+		case <-r.cancelDone():
+			return errTransferCanceled
 		case <-time.After(10 * time.Second):
 			if r.debug {
 				fmt.Println("警告: ICE候选者收集超时，继续使用当前SDP")
@@ -369,25 +569,74 @@ func (r *WebRTCReceiver) Start() error {
 		}
 	}
 
-	// 等待文件接收完成
+	// 等待文件接收完成（handleMessage完成或中止时通过done通知）
 	select {
+	case err := <-r.done:
+		if err == nil {
+			notifyComplete()
+		}
+		return err
+	case <-stalled:
+		// 发送端进程卡死与退出一样，可以等待其重启后续传
+		return connectionLostError{fmt.Errorf("传输停滞: %v 内没有数据进展", r.stallTimeout)}
+	case <-r.cancelDone():
+		return errTransferCanceled
 	case <-time.After(30 * time.Minute):
 		return fmt.Errorf("文件接收超时")
 	}
 }
 
+// offerRequestInterval 加入房间后超过该时间没有收到Offer时请求发送端重新发送
+const offerRequestInterval = 5 * time.Second
+
+// isUnknownRequestOffer 是否为旧版信令服务器对request_offer的"未知的消息类型"回复
+func isUnknownRequestOffer(msg *Message) bool {
+	return msg.Error == "未知的消息类型: request_offer"
+}
+
+// receiveMessage 处理DataChannel上收到的消息（分段格式先按位置重组）
+func (r *WebRTCReceiver) receiveMessage(data []byte) error {
+	if r.seq == nil {
+		return r.handleMessage(data)
+	}
+	ready, err := r.seq.push(data)
+	if err != nil {
+		return err
+	}
+	for _, chunk := range ready {
+		if err := r.handleMessage(chunk); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // handleMessage 处理接收到的消息
 func (r *WebRTCReceiver) handleMessage(data []byte) error {
 	switch r.state {
 	case 0: // 等待元数据长度
-		if len(data) >= 4 {
-			r.metadataLen = binary.BigEndian.Uint32(data[:4])
-			r.metadataBuf = make([]byte, 0, r.metadataLen)
-			r.state = 1
-			if len(data) > 4 {
-				// 如果还有数据，继续处理
-				return r.handleMessage(data[4:])
-			}
+		// 发送端只请求校验，不传输文件（--verify-only）
+		if len(r.lengthBuf) == 0 && isVerifyRequest(data) {
+			return r.handleVerifyRequest(data)
+		}
+		// 长度前缀可能被分到多条消息中，凑满4字节后再解析
+		need := 4 - len(r.lengthBuf)
+		if len(data) < need {
+			r.lengthBuf = append(r.lengthBuf, data...)
+			return nil
+		}
+		header := append(r.lengthBuf, data[:need]...)
+		data = data[need:]
+		r.lengthBuf = nil
+		r.metadataLen = binary.BigEndian.Uint32(header)
+		if r.metadataLen == 0 || r.metadataLen > maxMetadataLen {
+			return fmt.Errorf("无效的元数据长度 %d（应为1-%d字节，数据损坏或对端不是本程序的发送端）", r.metadataLen, maxMetadataLen)
+		}
+		r.metadataBuf = make([]byte, 0, r.metadataLen)
+		r.state = 1
+		if len(data) > 0 {
+			// 如果还有数据，继续处理
+			return r.handleMessage(data)
 		}
 	case 1: // 等待元数据
 		r.metadataBuf = append(r.metadataBuf, data...)
@@ -397,49 +646,165 @@ func (r *WebRTCReceiver) handleMessage(data []byte) error {
 			if err := json.Unmarshal(r.metadataBuf[:r.metadataLen], &metadata); err != nil {
 				return fmt.Errorf("解析元数据失败: %w", err)
 			}
+
+			// 发送端重启后重新连接：同一传输会话时从已接收的位置继续
+			if r.metadata != nil {
+				return r.resumeSession(&metadata)
+			}
 			r.metadata = &metadata
 
+			// 发送端一次发送多个文件：保存位置按目录处理，每个文件按自己的文件名保存（见multi_send.go）
+			if metadata.FileCount > 1 {
+				if r.output != nil || r.appendMode {
+					r.abort(fmt.Errorf("发送端发送了多个文件，不能接收到内存/剪贴板或追加到已有文件"))
+					return nil // 错误由Start返回
+				}
+				if metadata.FileIndex == 1 {
+					r.saveDir = multiFileSaveDir(r.savePath)
+				}
+				r.savePath = r.saveDir
+				fmt.Printf("[%d/%d] ", metadata.FileIndex, metadata.FileCount)
+			}
+
 			fmt.Printf("文件: %s\n", metadata.FileName)
 			fmt.Printf("大小: %d 字节 (%.2f MB)\n", metadata.FileSize, float64(metadata.FileSize)/1024/1024)
 
-			// 确定保存路径
-			savePath := r.savePath
-			if savePath == "" || savePath == "." {
-				savePath = metadata.FileName
+			// 超过大小限制时通知发送端取消
+			if err := checkMaxSize(metadata.FileSize, r.maxSize); err != nil {
+				r.abort(err)
+				return nil // 错误由Start返回
+			}
+
+			// 发送端发送的是目录（tar打包流）：解压到保存位置下的同名子目录，见dir_archive.go
+			if metadata.IsArchive && (r.output != nil || r.appendMode) {
+				r.abort(fmt.Errorf("发送端发送的是目录，不能接收到内存/剪贴板或追加到已有文件"))
+				return nil // 错误由Start返回
+			}
+
+			// 加密传输：先验证密码，只有一方指定了密码或密码错误时中止，不创建文件（见encrypt.go）
+			if opener, err := newRecordOpener(r.password, &metadata); err != nil {
+				r.abort(err)
+				return nil // 错误由Start返回
 			} else {
-				if info, err := os.Stat(savePath); err == nil && info.IsDir() {
-					savePath = filepath.Join(savePath, metadata.FileName)
-				} else if err != nil && os.IsNotExist(err) {
-					// savePath可能是目录但不存在，尝试创建
-					if err := os.MkdirAll(savePath, 0755); err == nil {
-						savePath = filepath.Join(savePath, metadata.FileName)
-					}
+				r.decrypt = opener
+			}
+
+			// 确定保存路径（写入调用方提供的Writer时不需要）
+			savePath := ""
+			if r.output == nil {
+				var err error
+				if savePath, err = r.metadataSavePath(&metadata); err != nil {
+					return err
+				}
+				if metadata.IsArchive {
+					savePath = archiveSavePath(savePath, r.resume)
 				}
 			}
 
-			// 确保保存目录存在
-			dir := filepath.Dir(savePath)
-			if dir != "." && dir != "" {
-				if err := os.MkdirAll(dir, 0755); err != nil {
-					return fmt.Errorf("创建保存目录失败: %w", err)
+			// 交互确认（接受/重命名/拒绝）
+			// 发送端支持握手时在用户决定之前不会发送文件数据
+			if r.confirm && r.output == nil {
+				if metadata.Handshake {
+					r.sendControl(ControlMessage{Type: "confirm_pending"})
 				}
+				atomic.StoreInt32(&r.confirming, 1)
+				confirmedPath, err := confirmReceive(metadata.FileName, metadata.FileSize, savePath)
+				atomic.StoreInt32(&r.confirming, 0)
+				if err != nil {
+					r.abort(err)
+					return nil // 错误由Start返回
+				}
+				savePath = confirmedPath
 			}
 
 			// 保存完整路径用于后续显示
 			r.savePath = savePath
 
-			// 创建文件
-			file, err := os.Create(savePath)
+			// --defer-sync时先写入.ft-incoming子目录
+			r.writePath = savePath
+			if r.deferSync && r.output == nil {
+				var err error
+				if r.writePath, err = deferredPath(savePath); err != nil {
+					return err
+				}
+			}
+
+			// 追加模式下记录已有的长度，校验失败时截断回该长度
+			if r.appendMode && r.output == nil {
+				r.appendBase = appendStartSize(r.writePath)
+				fmt.Printf("追加模式: 文件已有 %d 字节，本次接收的数据追加到末尾\n", r.appendBase)
+			}
+
+			// 创建文件（或使用调用方提供的Writer；目录时边接收边解压），--preallocate时按元数据中的大小预先分配磁盘空间
+			var file io.WriteCloser
+			var err error
+			if metadata.IsArchive {
+				file, err = createArchiveTarget(r.writePath, r.resume)
+			} else if r.preallocate && r.output == nil && metadata.FileSize > 0 {
+				file, err = createPreallocatedTarget(r.writePath, r.appendBase, metadata.FileSize, r.writeBufferSize)
+			} else {
+				file, err = createReceiveTarget(r.writePath, r.output, r.writeBufferSize, r.appendMode)
+			}
 			if err != nil {
-				return fmt.Errorf("创建文件失败: %w", err)
+				return err
 			}
+			r.fileMu.Lock()
 			r.file = file
+			r.fileMu.Unlock()
+
+			// 发送端提供了校验和时边接收边按同一算法计算
+			r.checksum = nil
+			if metadata.Checksum != "" && !r.noVerify {
+				if h, err := newChecksumHash(metadata.ChecksumAlgo); err != nil {
+					fmt.Printf("跳过校验: %v\n", err)
+				} else {
+					r.checksum = h
+				}
+			}
+
+			// 发送端压缩了文件数据：接收的是gzip流，边接收边解压写入文件并计算校验和
+			r.gunzip = nil
+			if metadata.Compressed {
+				var sum io.Writer
+				if r.checksum != nil {
+					sum = r.checksum
+				}
+				r.gunzip = newGunzipTarget(file, sum)
+				r.fileMu.Lock()
+				r.file = r.gunzip
+				r.fileMu.Unlock()
+			}
 
-			fmt.Printf("保存到: %s\n", savePath)
+			if metadata.IsArchive {
+				fmt.Printf("解压到: %s\n", savePath)
+			} else {
+				fmt.Printf("保存到: %s\n", receiveTargetName(savePath, r.output))
+			}
+			if r.writePath != savePath {
+				fmt.Printf("接收完成前写入: %s\n", r.writePath)
+			}
 			fmt.Println("开始接收...")
 			fmt.Println()
 
 			r.state = 2
+			r.replyAccept(&metadata, savePath)
+
+			// 可续传的传输会话：告诉发送端从头开始发送
+			if metadata.Session != "" {
+				r.sendResume(0)
+			}
+
+			// 一次发送多个文件时空文件没有数据，直接完成（压缩时仍有gzip流）
+			if metadata.FileCount > 1 && metadata.FileSize == 0 && !metadata.Compressed {
+				rest := r.metadataBuf[r.metadataLen:]
+				if err := r.completeFile(); err != nil {
+					return err
+				}
+				if len(rest) > 0 {
+					return r.handleMessage(rest)
+				}
+				return nil
+			}
 
 			// 如果还有剩余数据，继续处理
 			if len(r.metadataBuf) > int(r.metadataLen) {
@@ -447,69 +812,373 @@ func (r *WebRTCReceiver) handleMessage(data []byte) error {
 			}
 		}
 	case 2: // 接收文件数据
-		if r.file == nil {
-			return fmt.Errorf("文件未创建")
+		if r.decrypt != nil {
+			return r.receiveEncrypted(data)
 		}
+		return r.receiveData(data)
+	}
 
-		written, err := r.file.Write(data)
+	return nil
+}
+
+// receiveEncrypted 加密传输时按记录解密，明文按未加密时的流程处理，文件接收完成后剩余的数据属于下一个文件；
+// 记录认证失败时删除已接收的数据（追加模式下撤销本次追加）并返回错误
+func (r *WebRTCReceiver) receiveEncrypted(data []byte) error {
+	for len(data) > 0 && r.state == 2 {
+		before := len(data)
+		plain, rest, err := r.decrypt.next(data)
 		if err != nil {
-			return fmt.Errorf("写入文件失败: %w", err)
-		}
-
-		r.totalReceived += int64(written)
-
-		// 显示进度
-		if r.metadata != nil && r.metadata.FileSize > 0 {
-			progress := float64(r.totalReceived) / float64(r.metadata.FileSize) * 100
-			elapsed := time.Since(r.startTime).Seconds()
-			if elapsed > 0 {
-				speed := float64(r.totalReceived) / elapsed / 1024 / 1024 // MB/s
-				fmt.Printf("\r进度: %.2f%% (%.2f MB/s)", progress, speed)
-			}
-
-			// 检查是否接收完成
-			if r.totalReceived >= r.metadata.FileSize {
-				r.file.Close()
-				elapsed := time.Since(r.startTime).Seconds()
-				
-				// 获取文件的绝对路径
-				absPath, _ := filepath.Abs(r.savePath)
-				
-				fmt.Println("\n" + strings.Repeat("=", 70))
-				fmt.Println("✓ 接收完成!")
-				fmt.Println(strings.Repeat("=", 70))
-				fmt.Printf("文件保存路径: %s\n", absPath)
-				fmt.Printf("总大小: %d 字节 (%.2f MB)\n", r.totalReceived, float64(r.totalReceived)/1024/1024)
-				fmt.Printf("耗时: %.2f 秒\n", elapsed)
-				if elapsed > 0 {
-					fmt.Printf("平均速度: %.2f MB/s\n", float64(r.totalReceived)/elapsed/1024/1024)
-				}
-				fmt.Println(strings.Repeat("=", 70))
-				
-				// 发送确认消息给发送端
-				if r.dc != nil && r.dc.ReadyState() == webrtc.DataChannelStateOpen {
-					ack := map[string]string{"type": "file_received"}
-					ackJSON, _ := json.Marshal(ack)
-					if err := r.dc.Send(ackJSON); err != nil {
-						fmt.Printf("发送确认消息失败: %v\n", err)
-					} else {
-						fmt.Println("已发送接收完成确认给发送端，可以关闭窗口了（按Ctrl+C退出）")
-					}
-				}
-				
-				// 等待一小段时间确保确认消息发送完成
-				time.Sleep(500 * time.Millisecond)
-				return nil // 接收完成，不再处理后续消息
-			}
-		} else {
-			elapsed := time.Since(r.startTime).Seconds()
-			if elapsed > 0 {
-				speed := float64(r.totalReceived) / elapsed / 1024 / 1024 // MB/s
-				fmt.Printf("\r已接收: %.2f MB (%.2f MB/s)", float64(r.totalReceived)/1024/1024, speed)
+			r.closeFile()
+			result := "已删除"
+			if r.output == nil && r.writePath != "" {
+				result = r.discardWritten()
 			}
+			fmt.Println()
+			return fmt.Errorf("%w，%s", err, result)
+		}
+		r.wireReceived += int64(before - len(rest))
+		if plain == nil {
+			return nil
+		}
+		data = rest
+		if err := r.receiveData(plain); err != nil {
+			return err
+		}
+	}
+	if len(data) > 0 {
+		return r.handleMessage(data)
+	}
+	return nil
+}
+
+// wireDiffers 文件数据经过压缩或加密，网络上收到的字节数与原始大小不同
+func (r *WebRTCReceiver) wireDiffers() bool {
+	return r.decrypt != nil || (r.metadata != nil && r.metadata.Compressed)
+}
+
+// receiveData 处理文件数据（加密传输时为解密后的明文）：写入文件、显示进度，接收完成时完成当前文件
+func (r *WebRTCReceiver) receiveData(data []byte) error {
+	// 一次发送多个文件时，超出当前文件的部分属于下一个文件（直接TCP模式的一次读取可能跨越文件边界）
+	var rest []byte
+	if r.metadata != nil && r.metadata.FileCount > 1 && r.gunzip == nil {
+		if remaining := r.metadata.FileSize - (r.totalReceived - r.fileOffset); int64(len(data)) > remaining {
+			data, rest = data[:remaining], data[remaining:]
+		}
+	}
+	r.fileMu.Lock()
+	if r.file == nil {
+		r.fileMu.Unlock()
+		return fmt.Errorf("文件未创建")
+	}
+	var written int
+	var err error
+	if r.gunzip != nil {
+		// 压缩传输：解压后的数据写入文件并计算校验和，gzip流之后的数据属于下一个文件
+		var consumed int
+		consumed, written, err = r.gunzip.writeCompressed(data)
+		rest = data[consumed:]
+		if r.decrypt == nil {
+			r.wireReceived += int64(consumed)
+		}
+	} else {
+		written, err = r.file.Write(data)
+		if r.decrypt == nil {
+			r.wireReceived += int64(written)
+		}
+	}
+	r.fileMu.Unlock()
+	if err != nil {
+		return fmt.Errorf("写入文件失败: %w", err)
+	}
+	if r.checksum != nil && r.gunzip == nil {
+		r.checksum.Write(data[:written])
+	}
+
+	atomic.AddInt64(&r.totalReceived, int64(written))
+	r.stats.Update(r.totalReceived)
+
+	// 发送端要求确认时，定期回报已写入的字节偏移
+	if r.metadata != nil && r.metadata.ReliableAck {
+		r.maybeSendAck()
+	}
+
+	// 显示进度
+	if r.metadata != nil && r.metadata.FileSize > 0 {
+		progress := float64(r.totalReceived-r.fileOffset) / float64(r.metadata.FileSize) * 100
+		elapsed := time.Since(r.startTime).Seconds()
+		if elapsed > 0 && r.wireDiffers() {
+			// 压缩或加密时进度按解压、解密后的原始大小，速度按网络上收到的字节数
+			speed := float64(r.wireReceived) / elapsed / 1024 / 1024 // MB/s
+			fmt.Printf("\r进度: %.2f%% (原始) | %.2f MB/s (网络)%s", progress, speed, r.speedGraph.Update(r.wireReceived))
+		} else if elapsed > 0 {
+			speed := float64(r.totalReceived) / elapsed / 1024 / 1024 // MB/s
+			fmt.Printf("\r进度: %.2f%% (%.2f MB/s)%s", progress, speed, r.speedGraph.Update(r.totalReceived))
+		}
+		if err := r.speedMeter.Check(r.totalReceived); err != nil {
+			fmt.Println()
+			return err
+		}
+		if err := r.budget.Check(r.totalReceived); err != nil {
+			fmt.Println()
+			return err
+		}
+
+	} else {
+		elapsed := time.Since(r.startTime).Seconds()
+		if elapsed > 0 {
+			speed := float64(r.totalReceived) / elapsed / 1024 / 1024 // MB/s
+			fmt.Printf("\r已接收: %.2f MB (%.2f MB/s)%s", float64(r.totalReceived)/1024/1024, speed, r.speedGraph.Update(r.totalReceived))
+		}
+		if err := r.speedMeter.Check(r.totalReceived); err != nil {
+			fmt.Println()
+			return err
+		}
+		if err := r.budget.Check(r.totalReceived); err != nil {
+			fmt.Println()
+			return err
 		}
 	}
 
+	// 检查是否接收完成
+	if r.fileComplete() {
+		if err := r.completeFile(); err != nil {
+			return err
+		}
+		if len(rest) > 0 {
+			return r.handleMessage(rest)
+		}
+	}
 	return nil
 }
 
+// fileComplete 当前文件是否已接收完成：压缩传输时为gzip流已结束，否则为已接收到元数据中的大小
+func (r *WebRTCReceiver) fileComplete() bool {
+	if r.gunzip != nil {
+		return r.gunzip.Finished()
+	}
+	return r.metadata != nil && r.metadata.FileSize > 0 && r.totalReceived-r.fileOffset >= r.metadata.FileSize
+}
+
+
+// completeFile 当前文件接收完成：刷新并校验；一次发送多个文件且不是最后一个时准备接收下一个文件（见multi_send.go），
+// 否则输出汇总并确认接收完成
+func (r *WebRTCReceiver) completeFile() error {
+	// 刷新写缓冲区并同步到磁盘，写入网络文件系统失败时在此报告
+	if err := r.closeFile(); err != nil {
+		return fmt.Errorf("写入文件失败: %w", err)
+	}
+	if received := r.totalReceived - r.fileOffset; r.gunzip != nil && received != r.metadata.FileSize {
+		return fmt.Errorf("解压后的大小 %d 字节与文件大小 %d 字节不一致", received, r.metadata.FileSize)
+	}
+	if err := r.verifyChecksum(); err != nil {
+		return err
+	}
+	if r.writePath != r.savePath {
+		if err := finishDeferred(r.writePath, r.savePath); err != nil {
+			return err
+		}
+	}
+	if r.metadata.FileIndex < r.metadata.FileCount {
+		r.nextFile()
+		return nil
+	}
+	atomic.StoreInt32(&r.finished, 1)
+	r.elapsed = time.Since(r.startTime)
+	elapsed := r.elapsed.Seconds()
+	
+	// 获取文件的绝对路径
+	absPath, _ := filepath.Abs(r.savePath)
+	
+	fmt.Println("\n" + strings.Repeat("=", 70))
+	fmt.Println("✓ 接收完成!")
+	fmt.Println(strings.Repeat("=", 70))
+	fmt.Printf("文件保存路径: %s\n", receiveTargetName(absPath, r.output))
+	if r.metadata.FileCount > 1 {
+		fmt.Printf("共接收 %d 个文件\n", r.metadata.FileCount)
+	}
+	fmt.Printf("总大小: %d 字节 (%.2f MB)\n", r.totalReceived, float64(r.totalReceived)/1024/1024)
+	if r.wireDiffers() {
+		fmt.Printf("网络传输: %d 字节 (%.2f MB)\n", r.wireReceived, float64(r.wireReceived)/1024/1024)
+	}
+	if r.appendMode && r.output == nil {
+		printAppendResult(r.appendBase, r.totalReceived)
+	}
+	fmt.Printf("耗时: %.2f 秒\n", elapsed)
+	if elapsed > 0 {
+		fmt.Printf("平均速度: %.2f MB/s\n", float64(r.totalReceived)/elapsed/1024/1024)
+	}
+	fmt.Println(strings.Repeat("=", 70))
+	
+	// 发送确认消息给发送端（分段格式先确认全部数据，接收完成确认丢失时发送端据此判断完成）
+	if r.seq != nil {
+		sendSeqAck(r.dc, r.seq)
+	}
+	r.state = 3 // 接收完成，不再处理后续消息
+	// WebRTC: 等待发送端回复close_ok后Start才返回并关闭连接；
+	// 直接TCP和经信令服务器中转时由调用方在连接上回复确认
+	if r.dc != nil {
+		go r.confirmReceived()
+	} else {
+		r.finish(nil)
+	}
+	return nil
+}
+
+// verifyChecksum 比对已接收数据与元数据中的校验和，不一致时删除文件（追加模式下撤销本次追加的数据）并返回错误
+func (r *WebRTCReceiver) verifyChecksum() error {
+	if r.checksum == nil {
+		return nil
+	}
+	name := checksumName(r.metadata.ChecksumAlgo)
+	actualSum := hex.EncodeToString(r.checksum.Sum(nil))
+	if !strings.EqualFold(actualSum, r.metadata.Checksum) {
+		fmt.Println()
+		result := "已删除"
+		if r.output == nil && r.writePath != "" {
+			result = discardReceived(r.writePath, r.appendMode, r.appendBase)
+		}
+		return fmt.Errorf("文件校验失败: %s不一致（期望 %s，实际 %s），文件可能在传输中损坏，%s", name, r.metadata.Checksum, actualSum, result)
+	}
+	fmt.Printf("\n%s校验通过", name)
+	r.stats.SetChecksum(actualSum, r.metadata.ChecksumAlgo)
+	return nil
+}
+
+// metadataSavePath 根据元数据中的文件名确定保存路径（保存位置是目录时使用该文件名，并按--organize或--output-template整理），并确保目录存在
+func (r *WebRTCReceiver) metadataSavePath(metadata *FileMetadata) (string, error) {
+	// 文件名由元数据决定时（fromDir）才按--organize或--output-template整理，规则见save_path.go
+	savePath, fromDir, err := resolveSavePath(r.savePath, metadata.FileName)
+	if err != nil {
+		return "", err
+	}
+
+	// 按命名模板或日期/房间ID整理到子目录
+	if fromDir {
+		peer := r.roomID
+		if peer == "" {
+			peer = r.fileID
+		}
+		if r.outputTemplate != "" {
+			savePath = expandOutputTemplate(filepath.Dir(savePath), r.outputTemplate, outputTemplateValues{
+				name:   metadata.FileName,
+				size:   metadata.FileSize,
+				roomID: peer,
+				at:     time.Now(),
+			})
+			// 追加模式下要写入已有的文件，不加序号
+			if !r.appendMode {
+				savePath = uniqueFilePath(savePath)
+			}
+		} else {
+			savePath = organizePath(savePath, r.organize, peer)
+		}
+	}
+
+	// 确保保存目录存在
+	dir := filepath.Dir(savePath)
+	if dir != "." && dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return "", fmt.Errorf("创建保存目录失败: %w", err)
+		}
+	}
+	return savePath, nil
+}
+
+// closeFile 关闭接收的文件（刷新写缓冲区），可重复调用
+func (r *WebRTCReceiver) closeFile() error {
+	r.fileMu.Lock()
+	defer r.fileMu.Unlock()
+	if r.file == nil {
+		return nil
+	}
+	err := r.file.Close()
+	r.file = nil
+	return err
+}
+
+// closeOrDiscard 关闭文件；已取消且文件还没有接收完成（仍打开）时删除未完成的文件，
+// 追加模式下撤销本次追加的数据（写入output时不处理，--defer-sync时留在.ft-incoming中，见defer_sync.go）；
+// 因其他原因中断时保留为.part，之后可以通过HTTP下载续传（见part_resume.go）
+func (r *WebRTCReceiver) closeOrDiscard() {
+	r.fileMu.Lock()
+	incomplete := r.file != nil
+	r.fileMu.Unlock()
+	r.closeFile()
+	if incomplete && !r.isCanceled() {
+		r.leavePart()
+		return
+	}
+	if !incomplete || !r.isCanceled() || r.output != nil || r.writePath != r.savePath {
+		return
+	}
+	fmt.Printf("\n接收已取消，未完成的文件%s: %s\n", r.discardWritten(), r.writePath)
+}
+
+// discardWritten 丢弃接收失败的数据（见discardReceived），--resume接收目录时保留已解压的文件
+func (r *WebRTCReceiver) discardWritten() string {
+	if r.resume && r.metadata != nil && r.metadata.IsArchive {
+		return keptArchive
+	}
+	return discardReceived(r.writePath, r.appendMode, r.appendBase)
+}
+
+// abort 中止接收：通知发送端取消传输，并让Start返回err
+func (r *WebRTCReceiver) abort(err error) {
+	r.state = 3
+	r.sendCancel(err.Error())
+	r.finish(err)
+}
+
+// sendCancel 通知发送端取消传输并等待消息发出（DataChannel未打开时什么也不做）
+func (r *WebRTCReceiver) sendCancel(reason string) {
+	if r.tcpConn != nil {
+		writeTCPControl(r.tcpConn, ControlMessage{Type: "cancel", Reason: reason})
+		return
+	}
+	if r.dc != nil && r.dc.ReadyState() == webrtc.DataChannelStateOpen {
+		cancelJSON, _ := json.Marshal(ControlMessage{Type: "cancel", Reason: reason})
+		if sendErr := r.dc.Send(cancelJSON); sendErr != nil {
+			fmt.Printf("发送取消消息失败: %v\n", sendErr)
+		} else {
+			// Start返回后会关闭连接，等待取消消息发出
+			drainDataChannel(r.dc, time.Second)
+			time.Sleep(200 * time.Millisecond)
+		}
+	}
+}
+
+// finish 结束接收并让Start返回err（只有第一次调用生效）
+func (r *WebRTCReceiver) finish(err error) {
+	select {
+	case r.done <- err:
+	default:
+	}
+}
+
+// 确认间隔：每写入ackIntervalBytes字节或经过ackIntervalTime发送一次确认
+const (
+	ackIntervalBytes = 1024 * 1024
+	ackIntervalTime  = 500 * time.Millisecond
+)
+
+// maybeSendAck 按间隔向发送端确认已连续写入文件的字节偏移（接收完成时必定确认）
+func (r *WebRTCReceiver) maybeSendAck() {
+	offset := atomic.LoadInt64(&r.totalReceived)
+	done := offset >= r.metadata.FileSize
+	if !done && offset-r.lastAckOffset < ackIntervalBytes && time.Since(r.lastAckTime) < ackIntervalTime {
+		return
+	}
+	if r.dc == nil || r.dc.ReadyState() != webrtc.DataChannelStateOpen {
+		return
+	}
+
+	ackJSON, _ := json.Marshal(ControlMessage{Type: "ack", Offset: offset})
+	if err := r.dc.Send(ackJSON); err != nil {
+		if r.debug {
+			fmt.Printf("\n发送确认失败: %v\n", err)
+		}
+		return
+	}
+	r.lastAckOffset = offset
+	r.lastAckTime = time.Now()
+}
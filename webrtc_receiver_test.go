@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"sync/atomic"
+	"testing"
+)
+
+// TestMetadataLimit 接收端拒绝无效的元数据长度（0或超过maxMetadataLen），且不按该长度分配内存
+func TestMetadataLimit(t *testing.T) {
+	for _, metadataLen := range []uint32{0, maxMetadataLen + 1, 0xFFFFFFFF} {
+		t.Run(fmt.Sprint(metadataLen), func(t *testing.T) {
+			receiver := NewWebRTCReceiver("", "", t.TempDir(), iceServerNone, iceServerNone, "", "", false)
+			header := make([]byte, 4)
+			binary.BigEndian.PutUint32(header, metadataLen)
+			if err := receiver.handleMessage(header); err == nil {
+				t.Fatal("无效的元数据长度未被拒绝")
+			}
+			if cap(receiver.metadataBuf) != 0 {
+				t.Fatalf("被拒绝前分配了 %d 字节", cap(receiver.metadataBuf))
+			}
+		})
+	}
+}
+
+// TestFragmentedHeader 长度前缀每条消息只有1字节、元数据也分成多条消息（最后一段带着文件数据的开头）时，
+// 接收端仍能正确重组元数据和文件内容
+func TestFragmentedHeader(t *testing.T) {
+	content := []byte("fragmented header payload")
+	metadataJSON, _ := json.Marshal(FileMetadata{FileName: "fragmented.txt", FileSize: int64(len(content))})
+	header := make([]byte, 4)
+	binary.BigEndian.PutUint32(header, uint32(len(metadataJSON)))
+
+	var messages [][]byte
+	for _, b := range header {
+		messages = append(messages, []byte{b})
+	}
+	third := len(metadataJSON) / 3
+	messages = append(messages,
+		metadataJSON[:third],
+		metadataJSON[third:2*third],
+		append(append([]byte{}, metadataJSON[2*third:]...), content[:5]...),
+		content[5:],
+	)
+
+	var out bytes.Buffer
+	receiver := NewWebRTCReceiver("", "", "", iceServerNone, iceServerNone, "", "", false)
+	receiver.output = &out
+	for i, msg := range messages {
+		if err := receiver.handleMessage(msg); err != nil {
+			t.Fatalf("处理第 %d 条消息: %v", i+1, err)
+		}
+	}
+	if receiver.metadata == nil || receiver.metadata.FileName != "fragmented.txt" {
+		t.Fatalf("分片的元数据没有正确重组: %+v", receiver.metadata)
+	}
+	if !bytes.Equal(out.Bytes(), content) {
+		t.Fatalf("接收的内容为 %q，期望 %q", out.Bytes(), content)
+	}
+	if atomic.LoadInt32(&receiver.finished) != 1 {
+		t.Fatal("接收没有完成")
+	}
+}
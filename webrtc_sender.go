@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"encoding/base64"
 	"encoding/binary"
 	"encoding/json"
@@ -9,8 +10,10 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"sync/atomic"
 	"time"
 
+	"github.com/pion/stun"
 	"github.com/pion/webrtc/v3"
 )
 
@@ -25,6 +28,43 @@ type WebRTCSender struct {
 	pc            *webrtc.PeerConnection
 	dc            *webrtc.DataChannel
 	debug         bool
+	embedded      bool // 由HybridSender启动（分享链接由HybridSender统一显示）
+	stallTimeout  time.Duration // 无进度超时时间（0表示不检测）
+	totalSent     int64         // 已交给DataChannel的字节数（原子访问）
+	sendStartNanos int64        // 开始发送文件数据的时间（UnixNano，原子访问，--summary-only计算耗时）
+	graph         bool          // 在进度后显示速度曲线（仅终端输出时）
+	reliableAck   bool          // 要求接收端确认已写入的字节偏移，全部确认后才算成功
+	ackedOffset   int64         // 接收端已确认的字节偏移（原子访问）
+	relayViaSignaling bool      // 不建立P2P连接，经信令服务器中转文件数据（见relay.go）
+	tcp           bool          // 直接TCP模式：监听tcpPort，发送给第一个连接的接收端（见tcp.go）
+	tcpPort       int           // 直接TCP模式监听的端口（0表示随机端口）
+	checksumAlgo  string        // 校验算法（--checksum-algo），校验和随元数据发送给接收端（见checksum.go）
+	checksum      *lazyChecksum // 本地文件的校验和（Start时在后台开始计算，HybridSender与HTTP共用）
+	broadcast     int           // 广播模式：同时发送给最多broadcast个接收端（0表示点对点，见broadcast.go）
+	dcOptions     dcOptions     // DataChannel有序/可靠性设置（默认有序可靠，见seq.go）
+	remote        *remoteFile   // 发送远程文件时的文件信息（filePath是http(s)地址，见remote.go）
+	archive       *dirArchive   // 发送目录时的打包计划（filePath是目录，见dir_archive.go）
+	moreFiles     []string      // 一次发送多个文件时filePath之后的其余文件（见multi_send.go）
+	fileIndex     int           // 发送多个文件时正在发送的文件序号（从1开始）和文件总数，写入元数据
+	fileCount     int
+	sentBefore    int64         // 发送多个文件时之前的文件已发送的字节数（totalSent为所有文件的累计值）
+	compress      bool          // 按gzip压缩文件数据后发送（--compress，见compress.go）
+	password      string        // 用该密码派生的密钥加密文件数据（--password，见encrypt.go）
+	limiter       *bandwidthLimiter // 发送限速（--limit，nil表示不限速，见bandwidth_limit.go）
+	chunkSize     int           // 每条消息携带的数据量（--chunk-size，0表示defaultChunkSize）
+	dcChunkSize   int           // DataChannel打开后按协商的最大消息限制后的chunkSize（0表示不是DataChannel连接）
+	session       string        // 可续传的传输会话ID（指定了--room时，见resume.go）
+	resumeOffsets chan int64    // 接收端回复的续传位置
+	minSpeed      int64         // 最低速度（字节/秒，--min-speed，0表示不检测，见speed.go）
+	relayBudget   int64         // 经TURN中继时本次连接最多传输的字节数（--relay-budget，0表示不限制，见relay_budget.go）
+	statsInterval time.Duration // 连接统计的采样间隔（--stats-interval，0表示不采样，见conn_stats.go）
+	sendFailed    chan error    // sendFile失败（读取文件、发送数据失败、速度持续低于minSpeed或超过中继流量限制）时的错误
+	handshakeReplies chan ControlMessage // 接收端对元数据的确认回复（见handshake.go）
+	awaitingConfirm  int32               // 等待接收端用户确认接收（原子访问，期间不检测无进度超时）
+	verifyOnly       bool                // 只比对接收端已有的文件，不传输数据（--verify-only，见verify.go）
+	verifyResults    chan ControlMessage // 接收端的比对结果（verify_result）
+	stats         transferStats // 连接类型、对端地址、峰值速度和告知接收端的校验和（Start返回的TransferResult，见result.go）
+	*canceler                   // Cancel: 关闭信令连接和PeerConnection，Start返回errTransferCanceled
 }
 
 // NewWebRTCSender 创建WebRTC发送端
@@ -35,23 +75,74 @@ func NewWebRTCSender(filePath, stunServer, turnServer, signalingURL, roomID stri
 		turnServer:   turnServer,
 		signalingURL: signalingURL,
 		roomID:       roomID,
+		stallTimeout: defaultStallTimeout,
+		dcOptions:    defaultDCOptions(),
+		resumeOffsets: make(chan int64, 1),
+		verifyResults: make(chan ControlMessage, 1),
+		sendFailed:   make(chan error, 1),
+		handshakeReplies: make(chan ControlMessage, 4),
+		checksumAlgo: defaultChecksumAlgo,
+		canceler:     newCanceler(),
 	}
 }
 
-// Start 开始发送文件
-func (s *WebRTCSender) Start() error {
+// Start 开始发送文件，返回传输结果（失败时为失败前的情况，见result.go）；
+// 可以在其他goroutine中调用Cancel取消，手动输入Answer时除外
+// ctx取消时（如收到Ctrl+C）调用Cancel中止发送（关闭PeerConnection或TCP连接）
+func (s *WebRTCSender) Start(ctx context.Context) (*TransferResult, error) {
+	defer context.AfterFunc(ctx, s.Cancel)()
+	started := time.Now()
+	err := s.run()
+	result := s.stats.result(atomic.LoadInt64(&s.totalSent), s.transferElapsed(started))
+	result.Path = s.filePath
+	return result, err
+}
+
+// run 按模式（中转、直接TCP、广播或P2P）发送，取消导致的错误转换为errTransferCanceled
+func (s *WebRTCSender) run() error {
+	if s.isCanceled() {
+		return errTransferCanceled
+	}
+	// 本地文件且指定了--room时支持发送端重启后续传（目录的打包流在重启之间可能变化，多个文件或压缩时续传位置无法对应，都不支持）
+	if !s.relayViaSignaling && !s.tcp && s.broadcast == 0 && !isRemoteURL(s.filePath) && !isDirectory(s.filePath) && len(s.moreFiles) == 0 && !s.compress {
+		s.session = transferSessionID(s.roomID, s.filePath)
+	}
+	// 本地文件在等待接收端期间后台计算校验和，发送元数据前等待计算完成
+	if s.checksum == nil && !isRemoteURL(s.filePath) {
+		s.checksum = newLazyChecksum(s.filePath, s.checksumAlgo)
+		go s.checksum.Get()
+	}
+	if isRemoteURL(s.filePath) {
+		cleanup, err := s.prepareRemote()
+		if err != nil {
+			return err
+		}
+		defer cleanup()
+	}
+	if s.relayViaSignaling {
+		return s.canceledOr(s.startRelay())
+	}
+	if s.tcp {
+		return s.canceledOr(s.startTCP())
+	}
+	if s.broadcast > 0 {
+		return s.canceledOr(s.startBroadcast())
+	}
+	return s.canceledOr(s.start())
+}
+
+// start 发送流程，取消导致的错误由run统一转换为errTransferCanceled
+func (s *WebRTCSender) start() error {
 	// 检查文件是否存在
-	fileInfo, err := os.Stat(s.filePath)
+	fileName, fileSize, err := s.sourceInfo()
 	if err != nil {
-		return fmt.Errorf("文件不存在: %w", err)
+		return err
 	}
 
-	fileName := filepath.Base(s.filePath)
-	fileSize := fileInfo.Size()
-
 	// 生成随机文件ID（如果尚未设置）
 	if s.fileID == "" {
-		s.fileID = generateFileID()
+		s.fileID = generateUniqueFileID()
+		defer releaseFileID(s.fileID)
 	}
 
 	fmt.Println("=== WebRTC P2P 文件传输 - 发送端 ===")
@@ -59,43 +150,83 @@ func (s *WebRTCSender) Start() error {
 	// 配置ICE服务器
 	iceServers := getDefaultICEServers(s.stunServer, s.turnServer, s.debug)
 
-	// 创建PeerConnection配置
-	config := webrtc.Configuration{
-		ICEServers: iceServers,
-	}
-
-	// 创建PeerConnection
-	pc, err := webrtc.NewPeerConnection(config)
+	// 创建PeerConnection（仅DataChannel配置）
+	pc, err := newPeerConnection(iceServers)
 	if err != nil {
-		return fmt.Errorf("创建PeerConnection失败: %w", err)
+		return err
 	}
 	s.pc = pc
 	defer pc.Close()
+	// ICE收集未结束时pion的Close会阻塞到收集结束，放到后台执行，让Start尽快返回
+	s.onCancel(func() { go pc.Close() })
+	connStats := startConnStats(pc, s.statsInterval)
+	defer connStats.Stop()
 
-	// 创建DataChannel
-	ordered := true
-	dc, err := pc.CreateDataChannel("fileTransfer", &webrtc.DataChannelInit{
-		Ordered: &ordered, // 保证顺序
-	})
+	// 创建DataChannel（默认有序可靠）
+	dc, err := pc.CreateDataChannel("fileTransfer", s.dcOptions.init())
 	if err != nil {
-		return fmt.Errorf("创建DataChannel失败: %w", err)
+		return fmt.Errorf("创建DataChannel失败（请检查WebRTC配置）: %w", err)
 	}
 	s.dc = dc
 
-	// 设置DataChannel打开事件
+	// 设置DataChannel打开事件（发送失败时错误发送到s.sendFailed）
 	fileSentChan := make(chan bool, 1)
 	fileReceivedAck := make(chan bool, 1) // 接收端确认接收完成
+	verifyDone := make(chan error, 1)     // --verify-only: 比对结束（一致时为nil）
+	
+	transferCancelled := make(chan string, 1) // 接收端取消传输（附带原因）
+
+	// 无序或不可靠模式使用分段格式，由接收端的seq_ack驱动重传
+	var seq *seqSender
+	var seqComplete <-chan struct{}
+	if s.dcOptions.sequenced() {
+		seq = newSeqSender(nil, dc)
+		seqComplete = seq.complete
+		defer seq.close()
+		fmt.Printf("DataChannel模式: %s（使用分段格式）\n", s.dcOptions)
+	}
 	
-	// 监听接收端的消息（用于接收确认）
+	var ackHandled int32 // 已处理接收完成确认并回复close_ok（原子访问，见close_ack.go）
+	// 监听接收端的控制消息（接收确认、取消）
+	// 在OnOpen之前注册：极小的文件一次发送完，接收端的确认可能在sendFile返回之前到达，
+	// fileReceivedAck有缓冲，等待确认时仍能取到
 	dc.OnMessage(func(msg webrtc.DataChannelMessage) {
-		var ack struct {
-			Type string `json:"type"`
-		}
-		if err := json.Unmarshal(msg.Data, &ack); err == nil {
-			if ack.Type == "file_received" {
-				fmt.Println("\n接收端已确认接收完成")
+		var ctrl ControlMessage
+		if err := json.Unmarshal(msg.Data, &ctrl); err == nil {
+			deliverHandshakeReply(s.handshakeReplies, ctrl)
+			switch ctrl.Type {
+			case "file_received":
+				// 已处理过确认时回复接收端重发的确认；第一条确认由等待确认的流程处理后再回复
+				if atomic.LoadInt32(&ackHandled) == 1 {
+					replyCloseOK(dc)
+					return
+				}
 				select {
 				case fileReceivedAck <- true:
+					fmt.Println("\n接收端已确认接收完成")
+				default:
+				}
+			case "cancel":
+				select {
+				case transferCancelled <- ctrl.Reason:
+				default:
+				}
+			case "ack":
+				if ctrl.Offset > atomic.LoadInt64(&s.ackedOffset) {
+					atomic.StoreInt64(&s.ackedOffset, ctrl.Offset)
+				}
+			case "seq_ack":
+				if seq != nil {
+					seq.handleAck(ctrl.Offset, ctrl.Missing)
+				}
+			case "resume":
+				select {
+				case s.resumeOffsets <- ctrl.Offset:
+				default:
+				}
+			case "verify_result":
+				select {
+				case s.verifyResults <- ctrl:
 				default:
 				}
 			}
@@ -104,8 +235,37 @@ func (s *WebRTCSender) Start() error {
 	
 	dc.OnOpen(func() {
 		fmt.Println("DataChannel已打开，开始传输文件...")
+		s.stats.SetPeer(webrtcConnection(s.pc))
 		go func() {
-			s.sendFile(fileName, fileSize, fileInfo)
+			var sender chunkSender = newDCSender(s.dc, s.debug)
+			header := 0
+			if seq != nil {
+				seq.inner = sender
+				sender = seq
+				header = seqHeaderSize
+			}
+			// 数据块不超过对端声明的最大消息（有些浏览器只接受16KB）
+			limits := queryDCLimits(s.pc)
+			requested := s.requestedChunkSize()
+			s.dcChunkSize = clampChunkSize(requested, limits, header)
+			if s.dcChunkSize < requested && s.chunkSize != 0 {
+				fmt.Printf("--chunk-size %d 超过DataChannel最大消息，按 %d 字节发送\n", requested, s.dcChunkSize)
+			}
+			if s.debug {
+				fmt.Printf("数据块大小: %d 字节（请求 %d 字节）\n", s.dcChunkSize, requested)
+				printChunkAdvice(limits, s.dcChunkSize, header)
+			}
+			if s.verifyOnly {
+				verifyDone <- s.sendVerifyRequest(sender, fileName, fileSize)
+				return
+			}
+			if err := s.sendFiles(sender, fileName, fileSize); err != nil {
+				s.sendFailed <- err
+				return
+			}
+			if seq != nil {
+				seq.finishSending()
+			}
 			fileSentChan <- true
 		}()
 	})
@@ -122,6 +282,7 @@ func (s *WebRTCSender) Start() error {
 			if s.debug {
 				fmt.Println("ICE连接已建立!")
 			}
+			connStats.Connected()
 			select {
 			case iceConnected <- true:
 			default:
@@ -151,7 +312,7 @@ func (s *WebRTCSender) Start() error {
 			}
 		} else {
 			if s.debug {
-				fmt.Println("ICE候选者: %s\n", candidate.String())
+				fmt.Printf("ICE候选者: %s\n", candidate.String())
 			}
 		}
 	})
@@ -159,7 +320,7 @@ func (s *WebRTCSender) Start() error {
 	// 创建Offer
 	offer, err := pc.CreateOffer(nil)
 	if err != nil {
-		return fmt.Errorf("创建Offer失败: %w", err)
+		return fmt.Errorf("创建Offer失败（请检查WebRTC配置）: %w", err)
 	}
 
 	// 设置LocalDescription（这会触发ICE候选者收集）
@@ -178,6 +339,8 @@ func (s *WebRTCSender) Start() error {
 		if s.debug {
 			fmt.Println("ICE候选者已收集完成")
 		}
+	case <-s.cancelDone():
+		return errTransferCanceled
 	case <-time.After(10 * time.Second):
 		fmt.Println("警告: ICE候选者收集超时，继续使用当前SDP")
 	}
@@ -210,6 +373,7 @@ func (s *WebRTCSender) Start() error {
 
 	// 连接信令服务器
 	var signalingClient *SignalingClient
+	notifyComplete := func() {} // 传输成功后通知信令服务器移除房间
 	if signalingURL != "" {
 		fmt.Println("正在连接信令服务器...")
 		signalingClient, err = NewSignalingClient(signalingURL)
@@ -217,12 +381,14 @@ func (s *WebRTCSender) Start() error {
 			return fmt.Errorf("连接信令服务器失败: %w", err)
 		}
 		defer signalingClient.Close()
+		s.onCancel(signalingClient.Close)
 
 		// 创建房间
 		roomID := s.roomID
 		if roomID == "" {
 			roomID = s.fileID // 使用文件ID作为房间ID
 		}
+		notifyComplete = func() { signalingClient.CompleteTransfer(roomID) }
 
 		if s.debug {
 			fmt.Printf("创建房间: %s\n", roomID)
@@ -248,9 +414,29 @@ func (s *WebRTCSender) Start() error {
 
 		fmt.Printf("房间已创建: %s\n", roomID)
 		fmt.Printf("文件编号: %s\n", s.fileID)
+		if !s.embedded {
+			link := &MagicLink{
+				Mode:         linkModeWebRTC,
+				FileID:       s.fileID,
+				SignalingURL: signalingURL,
+				STUNServer:   s.stunServer,
+				TURNServer:   s.turnServer,
+				RoomID:       roomID,
+			}
+			fmt.Printf("分享链接: %s\n", link.String())
+		}
 		fmt.Println("\n等待接收端加入...")
 
-		// 等待接收端加入（收到peer_joined消息）
+		sendOffer := func() {
+			signalingClient.Send(&Message{
+				Type: "offer",
+				RoomID: roomID,
+				FileID: s.fileID,
+				SDP: offerB64,
+			})
+		}
+
+		// 等待接收端加入（收到peer_joined消息，peer_joined丢失时接收端会请求Offer）
 		offerSent := false
 		for !offerSent {
 			msg, err := signalingClient.Receive(5 * time.Minute)
@@ -258,38 +444,50 @@ func (s *WebRTCSender) Start() error {
 				return fmt.Errorf("等待接收端加入失败: %w", err)
 			}
 
-			if msg.Type == "peer_joined" {
+			if msg.Type == "peer_joined" || msg.Type == "request_offer" {
 				fmt.Println("接收端已加入，发送Offer...")
-				// 发送Offer
-				signalingClient.Send(&Message{
-					Type: "offer",
-					RoomID: roomID,
-					FileID: s.fileID,
-					SDP: offerB64,
-				})
+				sendOffer()
 				offerSent = true
 				fmt.Println("Offer已发送，等待Answer...")
+			} else if msg.Type == "peer_left" {
+				// 还没有接收端加入，离开的不是本次连接的接收端，继续等待
+				if s.debug {
+					fmt.Println("收到peer_left（还没有接收端加入），继续等待")
+				}
 			} else if msg.Type == "error" {
 				return fmt.Errorf("信令服务器错误: %s", msg.Error)
+			} else if msg.Type == "server_shutdown" {
+				return fmt.Errorf("信令服务器已关闭")
+			} else if s.debug {
+				fmt.Printf("等待接收端加入时忽略信令消息: %s\n", msg.Type)
 			}
 		}
 
-		// 等待Answer
+		// 等待Answer：接收端可能错过了Offer（加入后还没开始等待Offer），
+		// 每隔offerResendInterval没有收到Answer或接收端请求时重新发送
+		answerDeadline := time.Now().Add(5 * time.Minute)
 		for {
-			msg, err := signalingClient.Receive(5 * time.Minute)
+			msg, err := signalingClient.Receive(offerResendInterval)
+			if err == errReceiveTimeout && time.Now().Before(answerDeadline) {
+				if s.debug {
+					fmt.Printf("%v 内没有收到Answer，重新发送Offer\n", offerResendInterval)
+				}
+				sendOffer()
+				continue
+			}
 			if err != nil {
 				return fmt.Errorf("接收Answer失败: %w", err)
 			}
 
-			if msg.Type == "answer" {
+			if msg.Type == "request_offer" || msg.Type == "peer_joined" {
+				if s.debug {
+					fmt.Println("接收端请求重新发送Offer")
+				}
+				sendOffer()
+			} else if msg.Type == "answer" {
 				// 解码Answer
-				answerJSON, err := base64.StdEncoding.DecodeString(msg.SDP)
+				answer, err := decodeSessionDescription(msg.SDP, webrtc.SDPTypeAnswer)
 				if err != nil {
-					return fmt.Errorf("解码Answer失败: %w", err)
-				}
-
-				var answer webrtc.SessionDescription
-				if err = json.Unmarshal(answerJSON, &answer); err != nil {
 					return fmt.Errorf("解析Answer失败: %w", err)
 				}
 
@@ -310,8 +508,14 @@ func (s *WebRTCSender) Start() error {
 
 				fmt.Println("Answer已设置，等待连接建立...")
 				break
+			} else if msg.Type == "peer_left" {
+				return fmt.Errorf("接收端在回复Answer之前离开了房间，请让接收端重新执行 receive 后重试")
 			} else if msg.Type == "error" {
 				return fmt.Errorf("信令服务器错误: %s", msg.Error)
+			} else if msg.Type == "server_shutdown" {
+				return fmt.Errorf("信令服务器已关闭")
+			} else if s.debug {
+				fmt.Printf("等待Answer时忽略信令消息: %s\n", msg.Type)
 			}
 		}
 	} else {
@@ -336,13 +540,8 @@ func (s *WebRTCSender) Start() error {
 			return fmt.Errorf("未收到Answer")
 		}
 
-		answerJSON, err := base64.StdEncoding.DecodeString(answerB64)
+		answer, err := decodeSessionDescription(answerB64, webrtc.SDPTypeAnswer)
 		if err != nil {
-			return fmt.Errorf("解码Answer失败: %w", err)
-		}
-
-		var answer webrtc.SessionDescription
-		if err = json.Unmarshal(answerJSON, &answer); err != nil {
 			return fmt.Errorf("解析Answer失败: %w", err)
 		}
 
@@ -361,6 +560,8 @@ func (s *WebRTCSender) Start() error {
 		fmt.Println("ICE连接已建立，等待DataChannel打开...")
 	case <-iceFailed:
 		return fmt.Errorf("ICE连接失败，无法建立P2P连接")
+	case <-s.cancelDone():
+		return errTransferCanceled
 	case <-iceTimeout:
 		return fmt.Errorf("等待ICE连接超时")
 	}
@@ -377,6 +578,8 @@ func (s *WebRTCSender) Start() error {
 			return fmt.Errorf("等待DataChannel打开超时（ICE连接可能未完全建立）")
 		case <-iceFailed:
 			return fmt.Errorf("ICE连接失败，DataChannel无法打开")
+		case <-s.cancelDone():
+			return errTransferCanceled
 		case <-ticker.C:
 			if dc.ReadyState() == webrtc.DataChannelStateOpen {
 				dcOpened = true
@@ -386,14 +589,62 @@ func (s *WebRTCSender) Start() error {
 
 	// 等待文件传输完成
 	fmt.Println("等待文件传输完成...")
+
+	// 无进度看门狗：以对端实际取走的字节数（已发送减去缓冲区中未发出的）衡量进度
+	stalled := make(chan struct{}, 1)
+	stopWatch := make(chan struct{})
+	defer close(stopWatch)
+	go watchStall(pausedWhile(func() int64 {
+		return atomic.LoadInt64(&s.totalSent) - int64(dc.BufferedAmount())
+	}, s.isAwaitingConfirm), s.stallTimeout, nil, stalled, stopWatch)
+
 	select {
+	case reason := <-transferCancelled:
+		return fmt.Errorf("接收端已取消传输: %s", reason)
+	case <-stalled:
+		return fmt.Errorf("传输停滞: %v 内没有数据进展", s.stallTimeout)
+	case err := <-s.sendFailed:
+		return err
+	case err := <-verifyDone:
+		if err == nil {
+			notifyComplete()
+		}
+		return err
+	case <-s.cancelDone():
+		return errTransferCanceled
 	case <-fileSentChan:
 		fmt.Println("文件已发送完成，等待接收端确认...")
 		// 等待接收端确认接收完成，或者超时
 		select {
+		case reason := <-transferCancelled:
+			return fmt.Errorf("接收端已取消传输: %s", reason)
+		case <-s.cancelDone():
+			return errTransferCanceled
 		case <-fileReceivedAck:
+			// 确认消息与数据在同一个有序通道上，最终偏移确认一定先于接收完成确认到达
+			if s.reliableAck {
+				acked := atomic.LoadInt64(&s.ackedOffset)
+				fmt.Printf("接收端已确认写入: %d / %d 字节\n", acked, fileSize)
+				if acked != fileSize {
+					return fmt.Errorf("接收端确认的字节数 %d 与文件大小 %d 不一致（接收端可能不支持--reliable-ack）", acked, fileSize)
+				}
+			}
+			// 回复close_ok，等它发出后再关闭连接
+			atomic.StoreInt32(&ackHandled, 1)
+			replyCloseOK(dc)
+			drainDataChannel(dc, time.Second)
 			fmt.Println("接收端已确认，关闭连接，可以关闭窗口了（按Ctrl+C退出）")
+			notifyComplete()
+		case <-seqComplete:
+			// 不可靠模式下接收完成确认可能丢失，seq_ack确认了全部数据同样表示接收完成
+			// （随后到达的接收完成确认也回复close_ok）
+			atomic.StoreInt32(&ackHandled, 1)
+			fmt.Println("接收端已确认全部数据，关闭连接，可以关闭窗口了（按Ctrl+C退出）")
+			notifyComplete()
 		case <-time.After(5 * time.Minute):
+			if s.reliableAck {
+				return fmt.Errorf("等待接收端确认超时，已确认 %d / %d 字节", atomic.LoadInt64(&s.ackedOffset), fileSize)
+			}
 			fmt.Println("警告: 等待接收端确认超时，但文件已发送完成")
 		}
 		return nil
@@ -402,72 +653,194 @@ func (s *WebRTCSender) Start() error {
 	}
 }
 
-// sendFile 发送文件
-func (s *WebRTCSender) sendFile(fileName string, fileSize int64, fileInfo os.FileInfo) {
+// offerResendInterval 发送Offer后超过该时间没有收到Answer时重新发送（接收端只处理第一个Offer，重复的Offer被忽略）
+const offerResendInterval = 5 * time.Second
+
+// sourceInfo 待发送文件的名称和大小（目录为目录名和打包后的大小）
+func (s *WebRTCSender) sourceInfo() (string, int64, error) {
+	if s.remote != nil {
+		return s.remote.Name, s.remote.Size, nil
+	}
+	fileInfo, err := os.Stat(s.filePath)
+	if err != nil {
+		return "", 0, fmt.Errorf("文件不存在: %w", err)
+	}
+	if fileInfo.IsDir() {
+		if s.archive == nil {
+			if s.archive, err = newDirArchive(s.filePath); err != nil {
+				return "", 0, err
+			}
+			if !s.embedded {
+				s.archive.describe()
+			}
+		}
+		return s.archive.name, s.archive.size, nil
+	}
+	return filepath.Base(s.filePath), fileInfo.Size(), nil
+}
+
+// openSource 打开待发送文件（目录为按打包计划生成的tar流）；远程文件重新请求，大小与之前不一致时报错
+func (s *WebRTCSender) openSource() (io.ReadCloser, error) {
+	if s.archive != nil {
+		return s.archive.Open(), nil
+	}
+	if s.remote == nil {
+		return os.Open(s.filePath)
+	}
+	remote, body, err := openRemoteFile(s.remote.URL)
+	if err != nil {
+		return nil, err
+	}
+	if remote.Size != s.remote.Size {
+		body.Close()
+		return nil, fmt.Errorf("远程文件大小已变化: %d -> %d 字节", s.remote.Size, remote.Size)
+	}
+	return body, nil
+}
+
+// sendFile 通过sender发送元数据和文件数据，全部数据交给sender后返回nil；
+// 打开或读取文件、发送数据失败、接收端拒绝以及速度过低时返回错误（调用方不应再报告发送完成）
+func (s *WebRTCSender) sendFile(sender chunkSender, fileName string, fileSize int64) error {
 	// 打开文件
-	file, err := os.Open(s.filePath)
+	file, err := s.openSource()
 	if err != nil {
-		fmt.Printf("打开文件失败: %v\n", err)
-		return
+		return fmt.Errorf("打开文件失败: %w", err)
+	}
+	// --compress: 发送压缩后的数据，进度按已压缩的原始字节数计算
+	var source io.ReadCloser = file
+	var compressed *compressedSource
+	if s.compress {
+		compressed = compressSource(file)
+		source = compressed
 	}
-	defer file.Close()
+	defer source.Close()
 
 	// 发送文件元数据
 	metadata := FileMetadata{
-		FileName: fileName,
-		FileSize: fileSize,
+		FileName:    fileName,
+		FileSize:    fileSize,
+		ReliableAck: s.reliableAck,
+		Session:     s.session,
+		Handshake:   !s.relayViaSignaling, // 中转模式下接收端没有回复控制消息的通道
+		IsArchive:   s.archive != nil,
+		FileIndex:   s.fileIndex,
+		FileCount:   s.fileCount,
+		Compressed:  s.compress,
+	}
+	s.addChecksum(&metadata)
+	// --password: 按记录加密文件数据，元数据中带盐和密钥校验值
+	var sealer *recordSealer
+	if s.password != "" {
+		if sealer, err = newRecordSealer(s.password, &metadata); err != nil {
+			return err
+		}
+	}
+	if err := sendMetadata(sender, metadata); err != nil {
+		return fmt.Errorf("发送元数据失败: %w", err)
+	}
+	// 接收端拒绝或取消时由等待传输结束的一方报告
+	if metadata.Handshake {
+		if err := waitAccept(s.handshakeReplies, &s.awaitingConfirm, s.cancelDone()); err != nil {
+			return err
+		}
 	}
-	metadataJSON, _ := json.Marshal(metadata)
-	metadataLen := uint32(len(metadataJSON))
 
-	// 发送元数据长度和元数据
-	lenBuf := make([]byte, 4)
-	binary.BigEndian.PutUint32(lenBuf, metadataLen)
-	s.dc.Send(lenBuf)
-	s.dc.Send(metadataJSON)
+	// 可续传的传输会话：从接收端已有的位置开始发送
+	var totalSent int64
+	if s.session != "" {
+		if offset := s.waitResume(fileSize); offset > 0 {
+			if err := seekSource(file, offset); err != nil {
+				return fmt.Errorf("续传定位失败: %w", err)
+			}
+			totalSent = offset
+			atomic.StoreInt64(&s.totalSent, s.sentBefore+totalSent)
+			fmt.Printf("接收端已有 %d / %d 字节，从断点续传\n", offset, fileSize)
+		}
+	}
+	resumedFrom := totalSent
 
 	fmt.Println("元数据已发送，开始传输文件数据...")
 	fmt.Println()
 
 	// 发送文件数据
-	// WebRTC DataChannel最大消息大小为65536字节，使用32KB缓冲区确保不超过限制
-	const maxChunkSize = 32 * 1024 // 32KB
+	// 数据块默认32KB（--chunk-size），DataChannel连接不超过协商的最大消息（见clampChunkSize）
+	maxChunkSize := s.dataChunkSize()
 	buffer := make([]byte, maxChunkSize)
-	var totalSent int64
+	if sealer != nil {
+		// 加密后每条记录多出长度前缀和认证标签，仍不超过数据块大小
+		buffer = buffer[:maxChunkSize-recordOverhead]
+	}
+	sourceRead := resumedFrom // 已读取的加密前的数据字节数
+	// logicalSent 已发送的原始文件字节数（压缩时为已压缩的原始字节数，加密时不计记录的额外字节），totalSent为网络上的字节数
+	logicalSent := func() int64 {
+		if compressed != nil {
+			return compressed.Consumed()
+		}
+		if sealer != nil {
+			return sourceRead
+		}
+		return totalSent
+	}
+	limiter := newChunkLimiter(maxChunkSize)
 	startTime := time.Now()
+	atomic.StoreInt64(&s.sendStartNanos, startTime.UnixNano())
+	graph := newSpeedGraph(s.graph)
+	meter := newSpeedMeter(s.minSpeed)
+	budget := newRelayBudget(s.relayBudget, s.pc, resumedFrom)
 
 	for {
-		n, err := file.Read(buffer)
+		n, err := source.Read(buffer)
 		if n > 0 {
-			// 确保不超过最大消息大小限制
-			chunkSize := n
-			if chunkSize > maxChunkSize {
-				chunkSize = maxChunkSize
+			sourceRead += int64(n)
+			data := buffer[:n]
+			if sealer != nil {
+				data = sealer.seal(data)
 			}
-			
-			// 如果读取的数据超过限制，分块发送
+			// 按当前数据块大小分块发送（连续发送失败时减小，见chunkLimiter）
 			offset := 0
-			for offset < n {
-				chunk := chunkSize
-				if offset+chunk > n {
-					chunk = n - offset
-				}
+			for offset < len(data) {
+				chunk := limiter.Next(len(data) - offset)
+				s.limiter.Wait(chunk)
 				
 				// 发送数据块
-				if sendErr := s.dc.Send(buffer[offset : offset+chunk]); sendErr != nil {
-					fmt.Printf("\n发送数据失败: %v\n", sendErr)
-					return
+				if sendErr := sender.Send(data[offset : offset+chunk]); sendErr != nil {
+					if limiter.Shrink(sendErr) {
+						continue
+					}
+					fmt.Println()
+					return fmt.Errorf("发送数据失败（已发送 %d / %d 字节）: %w", totalSent, fileSize, sendErr)
 				}
 				offset += chunk
 				totalSent += int64(chunk)
+				atomic.StoreInt64(&s.totalSent, s.sentBefore+totalSent)
+				s.stats.Update(s.sentBefore + totalSent)
 				
-				// 显示进度
+				// 显示进度（压缩时按原始大小，加密时不计记录的额外字节）
 				elapsed := time.Since(startTime).Seconds()
 				if elapsed > 0 {
-					progress := float64(totalSent) / float64(fileSize) * 100
-					speed := float64(totalSent) / elapsed / 1024 / 1024 // MB/s
-					fmt.Printf("\r进度: %.2f%% | 已传输: %d / %d 字节 | 速度: %.2f MB/s", 
-						progress, totalSent, fileSize, speed)
+					done := logicalSent()
+					progress := float64(done) / float64(fileSize) * 100
+					speed := float64(totalSent-resumedFrom) / elapsed / 1024 / 1024 // MB/s
+					acked := ""
+					if s.reliableAck {
+						acked = fmt.Sprintf(" | 已确认: %.2f%%", float64(atomic.LoadInt64(&s.ackedOffset))/float64(fileSize)*100)
+					}
+					if compressed != nil || sealer != nil {
+						// 压缩或加密时进度按原始文件，速度按网络上发送的字节数（压缩后、加上加密记录的额外字节）
+						fmt.Printf("\r进度: %.2f%% (原始) | 已传输: %d / %d 字节 (原始) | 网络: %d 字节 | 速度: %.2f MB/s (网络)%s%s",
+							progress, done, fileSize, totalSent, speed, acked, graph.Update(totalSent))
+					} else {
+						fmt.Printf("\r进度: %.2f%% | 已传输: %d / %d 字节 | 速度: %.2f MB/s%s%s", 
+							progress, done, fileSize, speed, acked, graph.Update(totalSent))
+					}
+				}
+				if slowErr := meter.Check(totalSent - resumedFrom); slowErr != nil {
+					fmt.Println()
+					return slowErr
+				}
+				if budgetErr := budget.Check(s.sentBefore + totalSent); budgetErr != nil {
+					fmt.Println()
+					return budgetErr
 				}
 			}
 		}
@@ -476,36 +849,107 @@ func (s *WebRTCSender) sendFile(fileName string, fileSize int64, fileInfo os.Fil
 			break
 		}
 		if err != nil {
-			fmt.Printf("\n读取文件失败: %v\n", err)
-			return
+			fmt.Println()
+			return fmt.Errorf("读取文件失败（已发送 %d / %d 字节）: %w", totalSent, fileSize, err)
 		}
 	}
 
 	elapsed := time.Since(startTime).Seconds()
 	fmt.Printf("\n\n传输完成!\n")
-	fmt.Printf("总大小: %d 字节 (%.2f MB)\n", totalSent, float64(totalSent)/1024/1024)
+	fmt.Printf("总大小: %d 字节 (%.2f MB)\n", logicalSent(), float64(logicalSent())/1024/1024)
+	if compressed != nil || sealer != nil {
+		fmt.Printf("网络传输: %d 字节 (%.2f MB)\n", totalSent, float64(totalSent)/1024/1024)
+	}
+	if compressed != nil && fileSize > 0 {
+		fmt.Printf("压缩: 原始 %d 字节，压缩后为原始大小的 %.1f%%\n", fileSize, float64(totalSent)/float64(fileSize)*100)
+	}
 	fmt.Printf("耗时: %.2f 秒\n", elapsed)
-	if elapsed > 0 {
-		fmt.Printf("平均速度: %.2f MB/s\n", float64(totalSent)/elapsed/1024/1024)
+	if elapsed > 0 && (compressed != nil || sealer != nil) {
+		fmt.Printf("平均速度: %.2f MB/s (网络)\n", float64(totalSent-resumedFrom)/elapsed/1024/1024)
+	} else if elapsed > 0 {
+		fmt.Printf("平均速度: %.2f MB/s\n", float64(totalSent-resumedFrom)/elapsed/1024/1024)
+	}
+	return nil
+}
+
+// requestedChunkSize --chunk-size指定的数据块大小（未指定时为默认值）
+func (s *WebRTCSender) requestedChunkSize() int {
+	if s.chunkSize > 0 {
+		return s.chunkSize
+	}
+	return defaultChunkSize
+}
+
+// dataChunkSize 发送文件数据的数据块大小：DataChannel连接为按最大消息限制后的值，直接TCP连接为--chunk-size
+func (s *WebRTCSender) dataChunkSize() int {
+	if s.dcChunkSize > 0 {
+		return s.dcChunkSize
+	}
+	return s.requestedChunkSize()
+}
+
+// transferElapsed 从开始发送文件数据到现在的时间（还没有开始发送时从started算起），用于--summary-only
+func (s *WebRTCSender) transferElapsed(started time.Time) time.Duration {
+	if nanos := atomic.LoadInt64(&s.sendStartNanos); nanos != 0 {
+		started = time.Unix(0, nanos)
+	}
+	return time.Since(started)
+}
+
+// isAwaitingConfirm 是否正在等待接收端用户确认接收
+func (s *WebRTCSender) isAwaitingConfirm() bool {
+	return atomic.LoadInt32(&s.awaitingConfirm) == 1
+}
+
+// addChecksum 在元数据中加入文件的校验和（远程文件或计算失败时不加入，接收端跳过校验）
+func (s *WebRTCSender) addChecksum(metadata *FileMetadata) {
+	if s.checksum == nil {
+		return
+	}
+	sum, err := s.checksum.Get()
+	if err != nil {
+		fmt.Printf("计算校验和失败，接收端将跳过校验: %v\n", err)
+		return
+	}
+	metadata.Checksum = sum
+	metadata.ChecksumAlgo = s.checksum.algo
+	s.stats.SetChecksum(sum, s.checksum.algo)
+}
+
+// sendMetadata 发送元数据长度（4字节大端）和元数据JSON
+func sendMetadata(sender chunkSender, metadata FileMetadata) error {
+	metadataJSON, _ := json.Marshal(metadata)
+	if len(metadataJSON) > maxMetadataLen {
+		return fmt.Errorf("元数据长度 %d 超过上限 %d 字节（文件名过长）", len(metadataJSON), maxMetadataLen)
 	}
+
+	lenBuf := make([]byte, 4)
+	binary.BigEndian.PutUint32(lenBuf, uint32(len(metadataJSON)))
+	if err := sender.Send(lenBuf); err != nil {
+		return err
+	}
+	return sender.Send(metadataJSON)
 }
 
+// iceServerNone 作为stunServer或turnServer时表示不使用STUN/TURN（只使用本机地址的候选，适用于局域网和本机自检）
+const iceServerNone = "none"
+
 // getDefaultICEServers 获取默认ICE服务器配置
-// 如果用户指定了stunServer或turnServer，则使用用户指定的；否则使用默认配置
+// 如果用户指定了stunServer或turnServer（可用逗号分隔多个），则使用用户指定的；否则使用默认配置
 func getDefaultICEServers(stunServer, turnServer string, debug bool) []webrtc.ICEServer {
 	iceServers := []webrtc.ICEServer{}
 
-	// 如果用户指定了STUN服务器，使用用户指定的
-	if stunServer != "" {
-		stunURL := stunServer
-		if !strings.HasPrefix(stunURL, "stun:") {
-			stunURL = "stun:" + stunURL
-		}
-		iceServers = append(iceServers, webrtc.ICEServer{
-			URLs: []string{stunURL},
-		})
+	// 如果用户指定了STUN服务器，使用用户指定的（无效地址跳过）
+	stunURLs := parseICEServerURLs(stunServer, "stun", debug)
+	if stunServer == iceServerNone {
 		if debug {
-			fmt.Printf("STUN服务器: %s\n", stunURL)
+			fmt.Println("不使用STUN服务器")
+		}
+	} else if len(stunURLs) > 0 {
+		for _, stunURL := range stunURLs {
+			iceServers = append(iceServers, webrtc.ICEServer{
+				URLs: []string{stunURL},
+			})
 		}
 	} else {
 		// 使用默认STUN服务器
@@ -517,17 +961,17 @@ func getDefaultICEServers(stunServer, turnServer string, debug bool) []webrtc.IC
 		}
 	}
 
-	// 如果用户指定了TURN服务器，使用用户指定的
-	if turnServer != "" {
-		turnURL := turnServer
-		if !strings.HasPrefix(turnURL, "turn:") {
-			turnURL = "turn:" + turnURL
-		}
-		iceServers = append(iceServers, webrtc.ICEServer{
-			URLs: []string{turnURL},
-		})
+	// 如果用户指定了TURN服务器，使用用户指定的（无效地址跳过）
+	turnURLs := parseICEServerURLs(turnServer, "turn", debug)
+	if turnServer == iceServerNone {
 		if debug {
-			fmt.Printf("TURN服务器: %s\n", turnURL)
+			fmt.Println("不使用TURN服务器")
+		}
+	} else if len(turnURLs) > 0 {
+		for _, turnURL := range turnURLs {
+			iceServers = append(iceServers, webrtc.ICEServer{
+				URLs: []string{turnURL},
+			})
 		}
 	} else {
 		// 使用默认TURN服务器
@@ -547,8 +991,51 @@ func getDefaultICEServers(stunServer, turnServer string, debug bool) []webrtc.IC
 	return iceServers
 }
 
+// parseICEServerURLs 解析逗号分隔的STUN/TURN服务器列表（kind为"stun"或"turn"）
+// 没有协议前缀的地址自动补全；格式错误的地址打印警告后跳过，不影响其他地址
+func parseICEServerURLs(list, kind string, debug bool) []string {
+	name := strings.ToUpper(kind)
+	if list == iceServerNone {
+		return nil
+	}
+	var urls []string
+	for _, server := range strings.Split(list, ",") {
+		server = strings.TrimSpace(server)
+		if server == "" {
+			continue
+		}
+		if !strings.HasPrefix(server, kind+":") && !strings.HasPrefix(server, kind+"s:") {
+			server = kind + ":" + server
+		}
+
+		uri, err := stun.ParseURI(server)
+		if err != nil {
+			fmt.Printf("警告: 忽略无效的%s服务器地址 %s: %v\n", name, server, err)
+			continue
+		}
+		if uri.Host == "" {
+			fmt.Printf("警告: 忽略无效的%s服务器地址 %s: 缺少主机名\n", name, server)
+			continue
+		}
+
+		urls = append(urls, server)
+		if debug {
+			fmt.Printf("%s服务器: %s\n", name, server)
+		}
+	}
+
+	if list != "" && len(urls) == 0 {
+		fmt.Printf("警告: 没有有效的%s服务器地址，使用默认配置\n", name)
+	}
+	return urls
+}
+
 // getDefaultSignalingURL 获取默认信令服务器URL
+// 配置文件中设置了signaling_servers时使用该列表（逗号连接，NewSignalingClient按顺序尝试）
 func getDefaultSignalingURL() string {
+	if servers := loadConfig().SignalingServers; len(servers) > 0 {
+		return strings.Join(servers, ",")
+	}
 	return "ws://175.24.2.28:37851/ws"
 }
 
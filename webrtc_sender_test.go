@@ -0,0 +1,320 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"filetransfer_pc/signaling"
+)
+
+// startTestSignaling 启动临时信令服务器，返回WebSocket地址
+func startTestSignaling(t *testing.T) string {
+	t.Helper()
+	server := httptest.NewServer(signaling.NewSignalingServer().Handler())
+	t.Cleanup(server.Close)
+	return "ws" + strings.TrimPrefix(server.URL, "http") + "/ws"
+}
+
+// TestOfferResend 接收端错过Offer时的时序：接收端加入后丢弃第一个Offer，
+// 请求后发送端立即重新发送同一个Offer，不回复Answer时发送端定时重新发送
+func TestOfferResend(t *testing.T) {
+	signalingURL := startTestSignaling(t)
+	srcPath := filepath.Join(t.TempDir(), "offer.bin")
+	if err := writeRandomFile(srcPath, 1024); err != nil {
+		t.Fatal(err)
+	}
+
+	const roomID = "offer-resend"
+	sender := NewWebRTCSender(srcPath, iceServerNone, iceServerNone, signalingURL, roomID)
+	sender.embedded = true
+	sendErr := make(chan error, 1)
+	go func() {
+		_, err := sender.Start(context.Background())
+		sendErr <- err
+	}()
+	defer func() {
+		sender.Cancel()
+		<-sendErr
+	}()
+
+	// 模拟接收端：用信令客户端加入房间（发送端收集ICE候选后才创建房间）
+	client, err := NewSignalingClient(signalingURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	joinDeadline := time.Now().Add(10 * time.Second)
+	for {
+		client.Send(&Message{Type: "join_room", RoomID: roomID})
+		msg, err := client.Receive(5 * time.Second)
+		if err != nil {
+			t.Fatalf("加入房间: %v", err)
+		}
+		if msg.Type == "room_joined" {
+			break
+		}
+		if msg.Type != "error" || time.Now().After(joinDeadline) {
+			t.Fatalf("加入房间: %s %s", msg.Type, msg.Error)
+		}
+		time.Sleep(rejoinInterval)
+	}
+
+	expectOffer := func(wait time.Duration) *Message {
+		t.Helper()
+		for {
+			msg, err := client.Receive(wait)
+			if err != nil {
+				t.Fatalf("等待Offer: %v", err)
+			}
+			if msg.Type == "offer" {
+				return msg
+			}
+		}
+	}
+
+	// 丢弃第一个Offer（接收端还没有开始等待Offer）
+	first := expectOffer(5 * time.Second)
+
+	// 接收端请求后发送端立即重新发送（不必等到定时重发）
+	client.Send(&Message{Type: "request_offer", RoomID: roomID})
+	if again := expectOffer(offerResendInterval / 2); again.SDP != first.SDP {
+		t.Fatal("重新发送的Offer与第一个不一致")
+	}
+
+	// 不回复Answer时发送端定时重新发送
+	expectOffer(offerResendInterval + 5*time.Second)
+}
+
+// loopbackTransfer 经signalingURL的信令服务器在本机把srcPath传输到recvDir目录，
+// 检查两端Start返回的传输结果后返回接收的文件路径
+func loopbackTransfer(t *testing.T, signalingURL, srcPath, recvDir string, timeout time.Duration) string {
+	t.Helper()
+	// 发送端和接收端使用同一个房间，不使用STUN/TURN
+	roomID := filepath.Base(srcPath)
+	sender := NewWebRTCSender(srcPath, iceServerNone, iceServerNone, signalingURL, roomID)
+	sender.embedded = true
+	receiver := NewWebRTCReceiver(roomID, "", recvDir, iceServerNone, iceServerNone, signalingURL, roomID, false)
+	// 发送端收集ICE候选后才创建房间，接收端在此之前加入时重试
+	receiver.rejoinUntil = time.Now().Add(timeout)
+	// 本机直接连接（host候选），中继流量限制不生效
+	sender.relayBudget = 1
+	receiver.relayBudget = 1
+	// 发送端输出连接统计（传输很快时只有结束时的汇总）
+	sender.statsInterval = minConnStatsInterval
+	// 接收端按元数据中的大小预分配，传输完成后文件应正好是完整大小（调用方比较内容）
+	receiver.preallocate = true
+
+	var sendResult, recvResult *TransferResult
+	sendErr := make(chan error, 1)
+	recvErr := make(chan error, 1)
+	go func() {
+		result, err := sender.Start(context.Background())
+		sendResult = result
+		sendErr <- err
+	}()
+	go func() {
+		result, err := receiver.Start(context.Background())
+		recvResult = result
+		recvErr <- err
+	}()
+
+	deadline := time.After(timeout)
+	var sendDone, recvDone bool
+	for !sendDone || !recvDone {
+		select {
+		case err := <-sendErr:
+			if err != nil {
+				receiver.Cancel()
+				t.Fatalf("发送端: %v", err)
+			}
+			sendDone = true
+		case err := <-recvErr:
+			if err != nil {
+				sender.Cancel()
+				t.Fatalf("接收端: %v", err)
+			}
+			recvDone = true
+		case <-deadline:
+			sender.Cancel()
+			receiver.Cancel()
+			t.Fatalf("传输超时（%v）", timeout)
+		}
+	}
+	checkTransferResults(t, sendResult, recvResult, srcPath)
+	return recvResult.Path
+}
+
+// checkTransferResults 检查本机传输后两端Start返回的传输结果（字节数、本机直接连接、校验和、保存路径）
+func checkTransferResults(t *testing.T, sendResult, recvResult *TransferResult, srcPath string) {
+	t.Helper()
+	info, err := os.Stat(srcPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range []struct {
+		side   string
+		result *TransferResult
+	}{{"发送端", sendResult}, {"接收端", recvResult}} {
+		if r.result.Bytes != info.Size() {
+			t.Errorf("%s的传输结果为 %d 字节，期望 %d", r.side, r.result.Bytes, info.Size())
+		}
+		if r.result.Connection != connectionDirect || r.result.PeerAddress == "" {
+			t.Errorf("%s的传输结果连接类型为 %q（对端 %q），期望本机直接连接", r.side, r.result.Connection, r.result.PeerAddress)
+		}
+		if r.result.PeakSpeed < r.result.AverageSpeed {
+			t.Errorf("%s的峰值速度 %.0f 低于平均速度 %.0f", r.side, r.result.PeakSpeed, r.result.AverageSpeed)
+		}
+	}
+	if recvResult.Checksum == "" || !strings.EqualFold(recvResult.Checksum, sendResult.Checksum) || recvResult.ChecksumAlgo != sendResult.ChecksumAlgo {
+		t.Errorf("接收端校验通过的校验和 %s:%s 与发送端的 %s:%s 不一致", recvResult.ChecksumAlgo, recvResult.Checksum, sendResult.ChecksumAlgo, sendResult.Checksum)
+	}
+	if recvResult.Path == "" || sendResult.Path != srcPath {
+		t.Fatalf("传输结果的路径不正确（发送端 %q，接收端 %q）", sendResult.Path, recvResult.Path)
+	}
+}
+
+// TestTinyFiles 极小的文件：长度前缀、元数据和全部数据在同一条消息中时接收端能完成接收；
+// 1字节和10字节的文件端到端传输后两端都及时结束（发送端不会错过接收完成确认而等待确认超时）
+func TestTinyFiles(t *testing.T) {
+	t.Run("single message", func(t *testing.T) {
+		// 一条消息包含长度前缀、元数据和1字节数据
+		metadataJSON, _ := json.Marshal(FileMetadata{FileName: "one.bin", FileSize: 1})
+		message := make([]byte, 4, 4+len(metadataJSON)+1)
+		binary.BigEndian.PutUint32(message, uint32(len(metadataJSON)))
+		message = append(append(message, metadataJSON...), 'x')
+		var out bytes.Buffer
+		receiver := NewWebRTCReceiver("", "", "", iceServerNone, iceServerNone, "", "", false)
+		receiver.output = &out
+		if err := receiver.handleMessage(message); err != nil {
+			t.Fatal(err)
+		}
+		if out.String() != "x" || atomic.LoadInt32(&receiver.finished) != 1 {
+			t.Fatalf("单条消息的文件没有完成接收（已接收 %q）", out.String())
+		}
+	})
+
+	signalingURL := startTestSignaling(t)
+	for _, size := range []int{1, 10} {
+		t.Run(fmt.Sprintf("%d bytes", size), func(t *testing.T) {
+			dir := t.TempDir()
+			content := []byte("0123456789")[:size]
+			srcPath := filepath.Join(dir, fmt.Sprintf("tiny-%d.bin", size))
+			if err := os.WriteFile(srcPath, content, 0644); err != nil {
+				t.Fatal(err)
+			}
+			recvDir := filepath.Join(dir, "received")
+			if err := os.Mkdir(recvDir, 0755); err != nil {
+				t.Fatal(err)
+			}
+			// 远小于发送端等待确认的超时（5分钟），错过确认时在此报错
+			received, err := os.ReadFile(loopbackTransfer(t, signalingURL, srcPath, recvDir, 30*time.Second))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(received, content) {
+				t.Fatalf("接收的内容不一致: %q", received)
+			}
+		})
+	}
+}
+
+// writeRandomFile 创建size字节随机内容的文件
+func writeRandomFile(path string, size int64) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	_, err = io.CopyN(file, rand.Reader, size)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// TestLoopbackTransfer 在本机经临时信令服务器用WebRTC传输随机内容的文件（不使用STUN/TURN，只用本机地址的候选），
+// 回归检查完整的WebRTC路径（信令、ICE、DataChannel、元数据、写文件），两端文件的SHA-256一致
+func TestLoopbackTransfer(t *testing.T) {
+	dir := t.TempDir()
+	srcPath := filepath.Join(dir, "loopback.bin")
+	if err := writeRandomFile(srcPath, 4*1024*1024); err != nil {
+		t.Fatal(err)
+	}
+	recvDir := filepath.Join(dir, "received")
+	if err := os.Mkdir(recvDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	receivedPath := loopbackTransfer(t, startTestSignaling(t), srcPath, recvDir, 2*time.Minute)
+	srcSum, err := fileSHA256(srcPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recvSum, err := fileSHA256(receivedPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if recvSum != srcSum {
+		t.Fatalf("接收的文件（SHA-256: %s）与发送的文件（SHA-256: %s）不一致", recvSum, srcSum)
+	}
+}
+
+// TestSendReadError 发送中途读取文件失败（远程服务器只返回一半数据后断开）时，
+// 发送端Start应返回读取错误，而不是报告发送完成后等待接收端确认直到超时
+func TestSendReadError(t *testing.T) {
+	const timeout = 30 * time.Second
+	signalingURL := startTestSignaling(t)
+
+	// 声明的长度是实际返回数据的两倍，读取到一半时出错
+	const size = 256 * 1024
+	fileServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", strconv.Itoa(size))
+		io.CopyN(w, rand.Reader, size/2)
+	}))
+	defer fileServer.Close()
+
+	const roomID = "read-error"
+	sender := NewWebRTCSender(fileServer.URL+"/broken.bin", iceServerNone, iceServerNone, signalingURL, roomID)
+	sender.embedded = true
+	receiver := NewWebRTCReceiver(roomID, "", t.TempDir(), iceServerNone, iceServerNone, signalingURL, roomID, false)
+	receiver.rejoinUntil = time.Now().Add(timeout)
+
+	sendErr := make(chan error, 1)
+	recvErr := make(chan error, 1)
+	go func() {
+		_, err := sender.Start(context.Background())
+		sendErr <- err
+	}()
+	go func() {
+		_, err := receiver.Start(context.Background())
+		recvErr <- err
+	}()
+	defer func() {
+		receiver.Cancel()
+		<-recvErr
+	}()
+
+	select {
+	case err := <-sendErr:
+		if err == nil || !strings.Contains(err.Error(), "读取文件失败") {
+			t.Fatalf("发送端返回 %v，期望读取错误", err)
+		}
+	case <-time.After(timeout):
+		sender.Cancel()
+		<-sendErr
+		t.Fatalf("读取文件失败后发送端没有在 %v 内返回错误", timeout)
+	}
+}
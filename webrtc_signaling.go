@@ -1,10 +1,15 @@
 package main
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"net"
 	"net/url"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/gorilla/websocket"
@@ -16,10 +21,57 @@ type SignalingClient struct {
 	send   chan *Message
 	recv   chan *Message
 	errors chan error
+
+	pingInterval time.Duration // 主动发送ping的间隔，超过3倍间隔没有收到任何数据（消息、ping、pong）时认为连接已断开
+
+	closing   chan struct{} // Close时关闭，通知writePump发送关闭帧
+	writeDone chan struct{} // writePump退出时关闭
+	readDone  chan struct{} // readPump退出时关闭
+	closeOnce sync.Once
 }
 
 // NewSignalingClient 创建信令客户端
+// serverURL可以是逗号分隔的多个地址（主服务器在前，备用服务器在后），按顺序尝试，连接失败时切换到下一个
+// 房间只存在于某一台服务器上，因此发送端和接收端必须使用相同顺序的地址列表
 func NewSignalingClient(serverURL string) (*SignalingClient, error) {
+	urls := parseSignalingURLs(serverURL)
+	if len(urls) == 0 {
+		return nil, fmt.Errorf("信令服务器地址为空")
+	}
+
+	var lastErr error
+	for i, u := range urls {
+		client, err := dialSignalingServer(u)
+		if err == nil {
+			if i > 0 {
+				fmt.Printf("已切换到备用信令服务器: %s\n", u)
+			}
+			return client, nil
+		}
+		lastErr = err
+		if i < len(urls)-1 {
+			fmt.Printf("信令服务器 %s 不可用，尝试下一个: %v\n", u, err)
+		}
+	}
+	if len(urls) == 1 {
+		return nil, lastErr
+	}
+	return nil, fmt.Errorf("%d 个信令服务器都无法连接，最后一个: %w", len(urls), lastErr)
+}
+
+// parseSignalingURLs 解析逗号分隔的信令服务器地址列表（忽略空项）
+func parseSignalingURLs(s string) []string {
+	var urls []string
+	for _, u := range strings.Split(s, ",") {
+		if u = strings.TrimSpace(u); u != "" {
+			urls = append(urls, u)
+		}
+	}
+	return urls
+}
+
+// dialSignalingServer 连接单个信令服务器
+func dialSignalingServer(serverURL string) (*SignalingClient, error) {
 	u, err := url.Parse(serverURL)
 	if err != nil {
 		return nil, fmt.Errorf("解析服务器URL失败: %w", err)
@@ -34,74 +86,155 @@ func NewSignalingClient(serverURL string) (*SignalingClient, error) {
 		u.Scheme = "ws"
 	}
 
-	conn, _, err := websocket.DefaultDialer.Dial(u.String(), nil)
+	// 服务器支持时压缩较大的消息（base64编码的SDP），旧版服务器不协商压缩，照常连接
+	dialer := *websocket.DefaultDialer
+	dialer.EnableCompression = true
+	conn, _, err := dialer.Dial(u.String(), nil)
 	if err != nil {
 		return nil, fmt.Errorf("连接信令服务器失败: %w", err)
 	}
+	return newSignalingClient(conn, signalingPingInterval), nil
+}
+
+// signalingPingInterval 客户端主动发送ping的间隔：长时间等待接收端加入时保持连接活跃
+// （服务器60秒内没有收到客户端的数据时断开，中间的NAT和代理也可能关闭空闲连接）
+const signalingPingInterval = 20 * time.Second
 
+// signalingCompressMinSize 与服务器协商了压缩时只压缩不小于该大小的消息（与信令服务器的规则相同）
+const signalingCompressMinSize = 1024
+
+// newSignalingClient 在已建立的WebSocket连接上创建信令客户端并启动读写
+func newSignalingClient(conn *websocket.Conn, pingInterval time.Duration) *SignalingClient {
 	client := &SignalingClient{
 		conn:   conn,
+		pingInterval: pingInterval,
 		send:   make(chan *Message, 256),
 		recv:   make(chan *Message, 256),
 		errors: make(chan error, 1),
+
+		closing:   make(chan struct{}),
+		writeDone: make(chan struct{}),
+		readDone:  make(chan struct{}),
 	}
 
 	go client.readPump()
 	go client.writePump()
 
-	return client, nil
+	return client
 }
 
 // readPump 读取消息
 func (c *SignalingClient) readPump() {
+	defer close(c.readDone)
 	defer close(c.recv)
 
+	// 收到任何数据（消息、服务器的ping、对本端ping的pong）都延长读取期限
+	readTimeout := 3 * c.pingInterval
+	extend := func() { c.conn.SetReadDeadline(time.Now().Add(readTimeout)) }
+	extend()
+	c.conn.SetPongHandler(func(string) error {
+		extend()
+		return nil
+	})
+	c.conn.SetPingHandler(func(data string) error {
+		extend()
+		err := c.conn.WriteControl(websocket.PongMessage, []byte(data), time.Now().Add(10*time.Second))
+		if err == websocket.ErrCloseSent {
+			return nil
+		}
+		var netErr net.Error
+		if errors.As(err, &netErr) && netErr.Timeout() {
+			return nil // 回复pong超时不断开，由读取期限判断连接是否可用
+		}
+		return err
+	})
+
 	for {
 		_, message, err := c.conn.ReadMessage()
 		if err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				err = fmt.Errorf("信令服务器连接已断开（%v 内没有收到任何数据）: %w", readTimeout, err)
+			}
 			c.errors <- err
 			return
 		}
+		extend()
 
-		var msg Message
-		if err := json.Unmarshal(message, &msg); err != nil {
-			log.Printf("解析消息失败: %v", err)
-			continue
-		}
+		// 服务器可能把队列中的多条消息合并在一帧中（以换行分隔）
+		for _, line := range bytes.Split(message, []byte{'\n'}) {
+			var msg Message
+			if err := json.Unmarshal(line, &msg); err != nil {
+				log.Printf("解析消息失败: %v", err)
+				continue
+			}
 
-		c.recv <- &msg
+			c.recv <- &msg
+		}
 	}
 }
 
 // writePump 发送消息
+// 收到Close通知时先发送队列中剩余的消息，再发送正常关闭帧
 func (c *SignalingClient) writePump() {
-	defer c.conn.Close()
+	defer close(c.writeDone)
+	ticker := time.NewTicker(c.pingInterval)
+	defer ticker.Stop()
 
 	for {
 		select {
-		case msg, ok := <-c.send:
-			c.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
-			if !ok {
-				c.conn.WriteMessage(websocket.CloseMessage, []byte{})
+		case <-ticker.C:
+			if err := c.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(10*time.Second)); err != nil {
+				log.Printf("发送ping失败: %v", err)
+				c.conn.Close()
 				return
 			}
-
-			data, err := json.Marshal(msg)
-			if err != nil {
-				log.Printf("序列化消息失败: %v", err)
-				continue
-			}
-
-			if err := c.conn.WriteMessage(websocket.TextMessage, data); err != nil {
+		case msg := <-c.send:
+			if err := c.writeMessage(msg); err != nil {
 				log.Printf("发送消息失败: %v", err)
+				c.conn.Close()
 				return
 			}
+		case <-c.closing:
+			for drained := false; !drained; {
+				select {
+				case msg := <-c.send:
+					if err := c.writeMessage(msg); err != nil {
+						c.conn.Close()
+						return
+					}
+				default:
+					drained = true
+				}
+			}
+			closeMsg := websocket.FormatCloseMessage(websocket.CloseNormalClosure, "")
+			c.conn.WriteControl(websocket.CloseMessage, closeMsg, time.Now().Add(time.Second))
+			return
 		}
 	}
 }
 
-// Send 发送消息
+// writeMessage 序列化并发送一条消息（序列化失败只记录日志）
+func (c *SignalingClient) writeMessage(msg *Message) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		log.Printf("序列化消息失败: %v", err)
+		return nil
+	}
+	c.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	// 只压缩SDP等较大的消息（没有协商压缩时该设置不起作用）
+	c.conn.EnableWriteCompression(len(data) >= signalingCompressMinSize)
+	return c.conn.WriteMessage(websocket.TextMessage, data)
+}
+
+// Send 发送消息（连接关闭后调用会被忽略）
 func (c *SignalingClient) Send(msg *Message) {
+	select {
+	case <-c.closing:
+		return
+	default:
+	}
+
 	select {
 	case c.send <- msg:
 	default:
@@ -109,6 +242,9 @@ func (c *SignalingClient) Send(msg *Message) {
 	}
 }
 
+// errReceiveTimeout Receive在超时时间内没有收到消息（连接仍然正常，可以继续等待）
+var errReceiveTimeout = errors.New("接收消息超时")
+
 // Receive 接收消息（带超时）
 func (c *SignalingClient) Receive(timeout time.Duration) (*Message, error) {
 	select {
@@ -117,13 +253,36 @@ func (c *SignalingClient) Receive(timeout time.Duration) (*Message, error) {
 	case err := <-c.errors:
 		return nil, err
 	case <-time.After(timeout):
-		return nil, fmt.Errorf("接收消息超时")
+		return nil, errReceiveTimeout
 	}
 }
 
-// Close 关闭连接
-func (c *SignalingClient) Close() {
-	close(c.send)
-	c.conn.Close()
+// CompleteTransfer 通知信令服务器传输已完成，服务器立即移除房间（Close前调用，消息会在关闭前发出）
+func (c *SignalingClient) CompleteTransfer(roomID string) {
+	c.Send(&Message{
+		Type:   "transfer_complete",
+		RoomID: roomID,
+	})
 }
 
+// Close 关闭连接（可重复调用）
+// 发送正常关闭帧并短暂等待服务器回应，避免服务器把断开当作异常并延迟清理房间
+func (c *SignalingClient) Close() {
+	c.closeOnce.Do(func() {
+		close(c.closing)
+
+		// 等待writePump发送完剩余消息和关闭帧
+		select {
+		case <-c.writeDone:
+		case <-time.After(time.Second):
+		}
+
+		// 等待服务器回应关闭帧（readPump随之退出）
+		select {
+		case <-c.readDone:
+		case <-time.After(500 * time.Millisecond):
+		}
+
+		c.conn.Close()
+	})
+}
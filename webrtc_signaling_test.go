@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// TestSignalingKeepalive 模拟长时间空闲等待：服务器的读取期限很短且只在收到客户端的ping时延长，
+// 自己不发送ping；客户端按缩短的间隔主动发送ping，空闲数倍于读取期限后连接仍然可用
+func TestSignalingKeepalive(t *testing.T) {
+	const (
+		pingInterval = 100 * time.Millisecond
+		serverIdle   = 500 * time.Millisecond // 服务器的读取期限
+		idle         = 2 * time.Second        // 空闲等待时间
+	)
+
+	serverErr := make(chan error, 1)
+	release := make(chan struct{})
+	upgrader := websocket.Upgrader{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.SetReadDeadline(time.Now().Add(serverIdle))
+		conn.SetPingHandler(func(data string) error {
+			conn.SetReadDeadline(time.Now().Add(serverIdle))
+			return conn.WriteControl(websocket.PongMessage, []byte(data), time.Now().Add(time.Second))
+		})
+		readErr := make(chan error, 1)
+		go func() {
+			for {
+				if _, _, err := conn.ReadMessage(); err != nil {
+					readErr <- err
+					return
+				}
+			}
+		}()
+		select {
+		case err := <-readErr:
+			serverErr <- err
+		case <-release:
+			conn.WriteMessage(websocket.TextMessage, []byte(`{"type":"peer_joined"}`))
+			<-readErr
+		}
+	}))
+	defer server.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/ws", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := newSignalingClient(conn, pingInterval)
+	defer client.Close()
+
+	// 空闲等待期间只有超时（不是连接错误）
+	if _, err := client.Receive(idle); err != errReceiveTimeout {
+		t.Fatalf("空闲等待期间连接出错: %v", err)
+	}
+	select {
+	case err := <-serverErr:
+		t.Fatalf("服务器在空闲期间断开: %v", err)
+	default:
+	}
+
+	close(release)
+	msg, err := client.Receive(idle)
+	if err != nil {
+		t.Fatalf("空闲等待后接收消息: %v", err)
+	}
+	if msg.Type != "peer_joined" {
+		t.Fatalf("空闲等待后收到 %s，期望 peer_joined", msg.Type)
+	}
+}
+
+// TestPeerLeftWhileWaiting 脚本化的信令服务器在对端加入前后混入无关消息，然后通知peer_left：
+// 等待接收端加入的发送端忽略无关消息和过时的peer_left，等待Answer的发送端和等待Offer的接收端
+// 收到peer_left时立即报告对端已离开，而不是等到5分钟超时
+func TestPeerLeftWhileWaiting(t *testing.T) {
+	const limit = 10 * time.Second // 远小于等待Offer/Answer的超时
+	upgrader := websocket.Upgrader{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		send := func(msgType string) {
+			data, _ := json.Marshal(Message{Type: msgType})
+			conn.WriteMessage(websocket.TextMessage, data)
+		}
+		for {
+			_, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			var msg Message
+			if json.Unmarshal(data, &msg) != nil {
+				continue
+			}
+			switch msg.Type {
+			case "create_room":
+				send("room_created")
+				send("peer_left") // 过时的通知：还没有接收端加入
+				send("data_ack")  // 与等待无关的消息
+				send("peer_joined")
+			case "offer":
+				send("peer_left")
+			case "join_room":
+				send("room_joined")
+				send("peer_joined")
+				send("peer_left")
+			}
+		}
+	}))
+	defer server.Close()
+	signalingURL := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws"
+
+	dir := t.TempDir()
+	srcPath := filepath.Join(dir, "left.bin")
+	if err := os.WriteFile(srcPath, make([]byte, 1024), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	run := func(t *testing.T, start func() error, cancel func(), want string) {
+		errc := make(chan error, 1)
+		go func() { errc <- start() }()
+		select {
+		case err := <-errc:
+			if err == nil || !strings.Contains(err.Error(), want) {
+				t.Fatalf("收到peer_left后返回 %v，期望包含 %q", err, want)
+			}
+		case <-time.After(limit):
+			cancel()
+			<-errc
+			t.Fatalf("收到peer_left后 %v 内没有结束", limit)
+		}
+	}
+
+	t.Run("sender waiting for answer", func(t *testing.T) {
+		sender := NewWebRTCSender(srcPath, iceServerNone, iceServerNone, signalingURL, "left")
+		sender.embedded = true
+		run(t, func() error {
+			_, err := sender.Start(context.Background())
+			return err
+		}, sender.Cancel, "接收端在回复Answer之前离开了房间")
+	})
+
+	t.Run("receiver waiting for offer", func(t *testing.T) {
+		receiver := NewWebRTCReceiver("left", "", dir, iceServerNone, iceServerNone, signalingURL, "", false)
+		run(t, func() error {
+			_, err := receiver.Start(context.Background())
+			return err
+		}, receiver.Cancel, "发送端在发送Offer之前离开了房间")
+	})
+}